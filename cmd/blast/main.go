@@ -0,0 +1,63 @@
+// Command blast reports what depends on each change in a plan.
+//
+//	terraform show -json tfplan > tfplan.json
+//	go run ./cmd/blast -plan tfplan.json
+//	go run ./cmd/blast -plan tfplan.json -address module.network -format json
+//
+// For every changed resource it lists the resources and data sources that
+// depend on it, directly or through module inputs and outputs, with what
+// the plan does to each (replaced, updated in place, re-read or unchanged),
+// and the outputs and modules in its path.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"terraform-advanced-course/internal/blast"
+	"terraform-advanced-course/internal/plan"
+)
+
+func main() {
+	var (
+		planPath = flag.String("plan", "", "saved plan file, or terraform show -json output for one (- for stdin)")
+		address  = flag.String("address", "", "only report changes at or under this address, e.g. module.network")
+		format   = flag.String("format", "text", "output format: text or json")
+	)
+	flag.Parse()
+
+	if *planPath == "" {
+		fmt.Fprintln(os.Stderr, "blast: -plan is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*planPath, *address, *format); err != nil {
+		fmt.Fprintln(os.Stderr, "blast:", err)
+		os.Exit(1)
+	}
+}
+
+func run(planPath, address, format string) error {
+	p, err := plan.Load(planPath)
+	if err != nil {
+		return err
+	}
+	if p.Config == nil {
+		return fmt.Errorf("%s has no configuration section; use terraform show -json on a saved plan", planPath)
+	}
+	r := blast.Analyze(p)
+	if address != "" {
+		r = r.Filter(address)
+	}
+
+	switch format {
+	case "json":
+		return blast.WriteJSON(os.Stdout, r)
+	case "text":
+		return blast.WriteText(os.Stdout, r)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
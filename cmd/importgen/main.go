@@ -0,0 +1,123 @@
+// Command importgen writes Terraform import blocks for Azure resources that
+// are not yet under management.
+//
+//	go run ./cmd/orphans -state state.json -resource-group myTFResourceGroup-dev -format json > orphans.json
+//	go run ./cmd/importgen -orphans orphans.json -state state.json > imports.tf
+//	go run ./cmd/importgen /subscriptions/.../providers/Microsoft.KeyVault/vaults/kv-demo
+//
+// Resources are fetched from Resource Manager to fill in starter resource
+// blocks; pass -fetch=false to work from the IDs alone.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"terraform-advanced-course/internal/arm"
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/importgen"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+func main() {
+	var (
+		orphansFile  = flag.String("orphans", "", "JSON output of the orphans command")
+		idsFile      = flag.String("ids", "", "file with one resource ID per line")
+		statePath    = flag.String("state", "", "state whose addresses are already taken")
+		fetch        = flag.Bool("fetch", true, "read each resource from Resource Manager for its properties")
+		subscription = flag.String("subscription", firstEnv("ARM_SUBSCRIPTION_ID", "AZURE_SUBSCRIPTION_ID"), "Azure subscription ID")
+		endpoint     = flag.String("endpoint", arm.DefaultEndpoint, "Resource Manager endpoint")
+	)
+	flag.Parse()
+
+	if err := run(*orphansFile, *idsFile, *statePath, *fetch, *subscription, *endpoint, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "importgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(orphansFile, idsFile, statePath string, fetch bool, subscription, endpoint string, ids []string) error {
+	resources, err := collect(orphansFile, idsFile, ids)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		return fmt.Errorf("no resources given; use -orphans, -ids or pass IDs as arguments")
+	}
+
+	if fetch {
+		client := arm.NewClient(subscription, azauth.EnvironmentToken())
+		client.Endpoint = endpoint
+		for i, res := range resources {
+			full, err := client.GetResource(context.Background(), res.ID)
+			if err != nil {
+				return fmt.Errorf("get %s: %w", res.ID, err)
+			}
+			resources[i] = full
+		}
+	}
+
+	gen := &importgen.Generator{Occupied: map[string]bool{}}
+	if statePath != "" {
+		st, err := tfstate.Load(statePath)
+		if err != nil {
+			return err
+		}
+		for _, r := range st.Resources {
+			gen.Occupied[r.Address] = true
+		}
+	}
+
+	imports, unsupported := gen.Plan(resources)
+	if err := importgen.Write(os.Stdout, imports); err != nil {
+		return err
+	}
+	return importgen.WriteUnsupported(os.Stdout, unsupported)
+}
+
+func collect(orphansFile, idsFile string, ids []string) ([]arm.Resource, error) {
+	var resources []arm.Resource
+	if orphansFile != "" {
+		data, err := os.ReadFile(orphansFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &resources); err != nil {
+			return nil, fmt.Errorf("%s: %w", orphansFile, err)
+		}
+	}
+	if idsFile != "" {
+		f, err := os.Open(idsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				ids = append(ids, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range ids {
+		resources = append(resources, arm.Resource{ID: id})
+	}
+	return resources, nil
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"terraform-advanced-course/internal/environment"
+	"terraform-advanced-course/internal/naming"
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/report"
+	"terraform-advanced-course/internal/summary"
+	"terraform-advanced-course/internal/tfrun"
+)
+
+const reportFormats = "text, json or markdown"
+
+func validateNames(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("validate-names", flag.ExitOnError)
+	c.register(fs, report.FormatText, reportFormats)
+	fs.Parse(args)
+	if err := report.CheckFormat(c.format); err != nil {
+		return err
+	}
+
+	envs, err := c.environments()
+	if err != nil {
+		return err
+	}
+	var reports []*report.Report
+	for _, env := range envs {
+		r := report.New("validate-names", env.Name, env.Workspace)
+		for _, v := range naming.Check(env.Vars) {
+			r.Add(report.SeverityError, "var."+v.Variable, "%s", v.Message)
+		}
+		reports = append(reports, r)
+	}
+	return c.writeReports(reports)
+}
+
+func policy(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("policy", flag.ExitOnError)
+	c.register(fs, report.FormatText, reportFormats)
+	c.registerPlan(fs)
+	var (
+		policyDir = fs.String("policies", "policies", "directory of .rego policies")
+		opa       = fs.String("opa", "opa", "opa binary")
+	)
+	fs.Parse(args)
+	if err := report.CheckFormat(c.format); err != nil {
+		return err
+	}
+
+	envs, err := c.targets()
+	if err != nil {
+		return err
+	}
+	var reports []*report.Report
+	for _, env := range envs {
+		data, err := c.planJSON(env)
+		if err != nil {
+			return err
+		}
+		p, err := plan.ParseJSON(data)
+		if err != nil {
+			return err
+		}
+		violations, err := evalPolicies(*opa, *policyDir, data)
+		if err != nil {
+			return err
+		}
+
+		name, workspace := labels(env)
+		r := report.New("policy", name, workspace)
+		for _, v := range violations {
+			r.Add(report.SeverityError, addressIn(p, v.Message), "%s", v.Message)
+		}
+		r.Sort()
+		reports = append(reports, r)
+	}
+	return c.writeReports(reports)
+}
+
+// planJSON returns show -json output for -plan or a fresh plan of env.
+// OPA reads the JSON itself, so a plan file has to go through terraform
+// show, which needs an initialized working directory.
+func (c *common) planJSON(env *environment.Environment) ([]byte, error) {
+	ctx := context.Background()
+	if c.planPath == "" {
+		return env.PlanJSON(ctx, c.dir)
+	}
+	data, err := os.ReadFile(c.planPath)
+	if err != nil || !plan.IsSaved(data) {
+		return data, err
+	}
+	runner := &tfrun.Runner{Dir: c.dir}
+	if env != nil {
+		runner = env.Runner(c.dir)
+	}
+	return runner.ShowJSON(ctx, c.absPlanPath())
+}
+
+// evalPolicies evaluates every deny rule under data.terraform.
+func evalPolicies(opa, policyDir string, planJSON []byte) ([]summary.Finding, error) {
+	cmd := exec.Command(opa, "eval", "--format", "json", "--data", policyDir, "--stdin-input", "data.terraform[_].deny")
+	cmd.Stdin = bytes.NewReader(planJSON)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("opa eval: %w", err)
+	}
+	return summary.ParsePolicyFindings(out)
+}
+
+// addressIn returns the longest resource address in p that msg mentions,
+// or "" when it mentions none.
+func addressIn(p *plan.Plan, msg string) string {
+	best := ""
+	for _, rc := range p.ResourceChanges {
+		if len(rc.Address) > len(best) && strings.Contains(msg, rc.Address) {
+			best = rc.Address
+		}
+	}
+	return best
+}
+
+func drift(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	c.register(fs, report.FormatText, reportFormats)
+	c.registerPlan(fs)
+	fs.Parse(args)
+	if err := report.CheckFormat(c.format); err != nil {
+		return err
+	}
+
+	envs, err := c.targets()
+	if err != nil {
+		return err
+	}
+	var reports []*report.Report
+	for _, env := range envs {
+		p, err := c.plan(env, "-refresh-only")
+		if err != nil {
+			return err
+		}
+		name, workspace := labels(env)
+		r := report.New("drift", name, workspace)
+		addDrift(r, p)
+		reports = append(reports, r)
+	}
+	return c.writeReports(reports)
+}
+
+// addDrift reports each object that changed outside terraform, with the
+// attributes that differ from the last apply.
+func addDrift(r *report.Report, p *plan.Plan) {
+	drifted := summary.Build(&plan.Plan{ResourceChanges: p.ResourceDrift})
+	for _, m := range drifted.Modules {
+		for _, ch := range m.Changes {
+			if ch.Action == summary.ActionDelete {
+				r.Add(report.SeverityError, ch.Address, "deleted outside terraform")
+				continue
+			}
+			paths := make([]string, 0, len(ch.Attributes))
+			for _, a := range ch.Attributes {
+				paths = append(paths, a.Path)
+			}
+			r.Add(report.SeverityError, ch.Address, "changed outside terraform: %s", strings.Join(paths, ", "))
+		}
+	}
+	r.Sort()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+
+	"terraform-advanced-course/internal/cost"
+	"terraform-advanced-course/internal/environment"
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/report"
+)
+
+func costCmd(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("cost", flag.ExitOnError)
+	c.register(fs, report.FormatText, reportFormats)
+	c.registerPlan(fs)
+	var (
+		catalogPath = fs.String("catalog", "", "price catalog file (default: embedded catalog)")
+		region      = fs.String("region", "", "region for resources whose location is unknown")
+		budget      = fs.Float64("budget", 0, "fail when an environment's monthly total exceeds this (0: no limit)")
+		basePath    = fs.String("base", "", "for markdown, compare against this plan instead of the current state")
+		baseEnv     = fs.String("base-env", "", "for markdown, compare against a plan of this environment")
+		headEnv     = fs.String("head-env", "", "the environment to compare with -base-env or -base; same as a single -env")
+		baseLabel   = fs.String("base-label", "", "name of the base side in the markdown report")
+		headLabel   = fs.String("head-label", "", "name of the planned side in the markdown report")
+	)
+	fs.Parse(args)
+	if err := report.CheckFormat(c.format); err != nil {
+		return err
+	}
+	if *basePath != "" && *baseEnv != "" {
+		return fmt.Errorf("give -base or -base-env, not both")
+	}
+	if *headEnv != "" {
+		if len(c.envs) > 0 {
+			return fmt.Errorf("give -head-env or -env, not both")
+		}
+		c.envs = stringList{*headEnv}
+	}
+
+	catalog := cost.DefaultCatalog()
+	if *catalogPath != "" {
+		var err error
+		if catalog, err = cost.LoadCatalog(*catalogPath); err != nil {
+			return err
+		}
+	}
+	opts := cost.Options{DefaultRegion: *region}
+	var (
+		base     *cost.Estimate
+		baseName = "base"
+	)
+	switch {
+	case *basePath != "":
+		p, err := plan.Load(*basePath)
+		if err != nil {
+			return err
+		}
+		base = cost.EstimatePlan(p, catalog, opts)
+	case *baseEnv != "":
+		env, err := environment.Get(c.dir, *baseEnv)
+		if err != nil {
+			return err
+		}
+		p, err := env.Plan(context.Background(), c.dir)
+		if err != nil {
+			return err
+		}
+		base, baseName = cost.EstimatePlan(p, catalog, opts), env.Name
+	}
+	if *baseLabel != "" {
+		baseName = *baseLabel
+	}
+
+	envs, err := c.targets()
+	if err != nil {
+		return err
+	}
+	var (
+		reports []*report.Report
+		detail  bytes.Buffer
+	)
+	for _, env := range envs {
+		p, err := c.plan(env)
+		if err != nil {
+			return err
+		}
+		est := cost.EstimatePlan(p, catalog, opts)
+
+		name, workspace := labels(env)
+		r := report.New("cost", name, workspace)
+		r.Details = est
+		for _, l := range est.Unpriced() {
+			r.Add(report.SeverityWarning, l.Address, "no catalog price for %s", l.Key)
+		}
+		if *budget > 0 && est.Total > *budget {
+			r.Add(report.SeverityError, "", "projected %.2f %s/month exceeds the budget of %.2f", est.Total, est.Currency, *budget)
+		}
+		r.Sort()
+		reports = append(reports, r)
+
+		// Text and Markdown carry the estimate after the findings; JSON
+		// already has it in details.
+		switch c.format {
+		case report.FormatText:
+			fmt.Fprintf(&detail, "\n=== cost estimate%s ===\n", suffix(name))
+			err = cost.WriteText(&detail, est)
+		case report.FormatMarkdown:
+			from, label := base, baseName
+			if from == nil {
+				from, label = cost.EstimatePrior(p, catalog, opts), "current"
+				if *baseLabel != "" {
+					label = *baseLabel
+				}
+			}
+			head := "planned" + suffix(name)
+			if *headLabel != "" {
+				head = *headLabel
+			}
+			fmt.Fprintf(&detail, "\n")
+			err = cost.WriteMarkdown(&detail, cost.Compare(from, est), label, head)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf, c.format, reports); err != nil {
+		return err
+	}
+	buf.Write(detail.Bytes())
+	if err := c.emit(buf.Bytes()); err != nil {
+		return err
+	}
+	if !report.Passed(reports) {
+		return errFailed
+	}
+	return nil
+}
+
+// suffix formats an environment name for a heading, e.g. " (dev)".
+func suffix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " (" + name + ")"
+}
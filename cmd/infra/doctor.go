@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+
+	"terraform-advanced-course/internal/doctor"
+	"terraform-advanced-course/internal/report"
+)
+
+func doctorCmd(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.StringVar(&c.dir, "dir", ".", "root module directory")
+	fs.StringVar(&c.format, "format", report.FormatText, "output format: text or json")
+	fs.StringVar(&c.out, "o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+
+	results := doctor.Run(context.Background(), doctor.Env{Dir: c.dir})
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	switch c.format {
+	case report.FormatText:
+		err = doctor.WriteText(&buf, results)
+	case report.FormatJSON:
+		err = doctor.WriteJSON(&buf, results)
+	default:
+		err = fmt.Errorf("unknown format %q", c.format)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.emit(buf.Bytes()); err != nil {
+		return err
+	}
+	if !doctor.Passed(results) {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Command infra is the project's infrastructure tooling in one binary.
+//
+//	go run ./cmd/infra validate-names
+//	go run ./cmd/infra policy -env prod
+//	go run ./cmd/infra drift -env dev -format json
+//	go run ./cmd/infra cost -env dev -env prod -format markdown
+//	go run ./cmd/infra cost -base-env dev -head-env prod -format markdown
+//	go run ./cmd/infra diagram -env dev -format svg -o docs/diagrams/architecture.svg
+//	go run ./cmd/infra plan-summary -plan tfplan-prod -policy policy.json
+//	go run ./cmd/infra doctor
+//
+// Every subcommand reads the environments from environments/*.tfvars and
+// plans each in the workspace named after its var file, as the Makefile
+// does. -env picks environments by name (repeatable; default all), and
+// -plan uses an existing plan instead of planning.
+//
+// validate-names, policy, drift and cost write the same reports: -format
+// text, json or markdown. They exit with status 3 when a check fails, 1 on
+// any other error. doctor checks the local setup instead of a plan, and
+// exits with status 3 when a check fails.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"terraform-advanced-course/internal/environment"
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/report"
+)
+
+const usage = `usage: infra <command> [flags]
+
+commands:
+  validate-names   check resource names in each var file against Azure's rules
+  policy           evaluate the OPA policies in policies/ against a plan
+  drift            report resources changed outside terraform
+  cost             price a plan from the local catalog
+  diagram          draw the module diagram as Mermaid, DOT or SVG
+  plan-summary     render a plan for review as Markdown or HTML
+  doctor           check terraform, credentials and the backend on this machine
+
+Run infra <command> -h for a command's flags.
+`
+
+// exitFailed distinguishes a failed check from a failure to run it.
+const exitFailed = 3
+
+// errFailed is returned by a subcommand whose check failed after its
+// report was written.
+var errFailed = errors.New("check failed")
+
+var commands = map[string]func(args []string) error{
+	"validate-names": validateNames,
+	"policy":         policy,
+	"drift":          drift,
+	"cost":           costCmd,
+	"diagram":        diagramCmd,
+	"plan-summary":   planSummary,
+	"doctor":         doctorCmd,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch err := cmd(os.Args[2:]); err {
+	case nil:
+	case errFailed:
+		os.Exit(exitFailed)
+	default:
+		fmt.Fprintf(os.Stderr, "infra %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// common holds the flags the subcommands share.
+type common struct {
+	dir       string
+	envs      stringList
+	workspace string
+	planPath  string
+	format    string
+	out       string
+}
+
+// register adds the shared flags. defaultFormat is the subcommand's own
+// default, and formats documents the ones it takes.
+func (c *common) register(fs *flag.FlagSet, defaultFormat, formats string) {
+	fs.StringVar(&c.dir, "dir", ".", "root module directory")
+	fs.Var(&c.envs, "env", "environment name or var file (repeatable; default all in environments/)")
+	fs.StringVar(&c.format, "format", defaultFormat, "output format: "+formats)
+	fs.StringVar(&c.out, "o", "", "write to this file instead of stdout")
+}
+
+// registerPlan adds the flags of subcommands that work on a plan.
+func (c *common) registerPlan(fs *flag.FlagSet) {
+	fs.StringVar(&c.workspace, "workspace", "", "workspace to plan in, when it differs from the environment name")
+	fs.StringVar(&c.planPath, "plan", "", "use this saved plan file or show -json output instead of planning (- for stdin)")
+}
+
+// environments returns the environments named by -env, or all of them.
+func (c *common) environments() ([]*environment.Environment, error) {
+	var envs []*environment.Environment
+	if len(c.envs) == 0 {
+		all, err := environment.Load(c.dir)
+		if err != nil {
+			return nil, err
+		}
+		envs = all
+	}
+	for _, name := range c.envs {
+		env, err := environment.Get(c.dir, name)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, env)
+	}
+	if c.workspace != "" {
+		if len(envs) != 1 {
+			return nil, fmt.Errorf("-workspace needs exactly one -env")
+		}
+		envs[0].Workspace = c.workspace
+	}
+	return envs, nil
+}
+
+// targets returns the environments to report on, one report each. With
+// -plan and no -env the plan stands on its own, as a nil environment.
+func (c *common) targets() ([]*environment.Environment, error) {
+	if c.planPath == "" {
+		return c.environments()
+	}
+	env, err := c.environment()
+	if err != nil {
+		return nil, err
+	}
+	return []*environment.Environment{env}, nil
+}
+
+// environment returns the single environment a subcommand works on. With
+// -plan and no -env the plan stands on its own and env is nil.
+func (c *common) environment() (*environment.Environment, error) {
+	if c.planPath != "" && len(c.envs) == 0 {
+		return nil, nil
+	}
+	if len(c.envs) != 1 {
+		return nil, fmt.Errorf("give exactly one -env, or -plan")
+	}
+	envs, err := c.environments()
+	if err != nil {
+		return nil, err
+	}
+	return envs[0], nil
+}
+
+// plan returns the -plan file, or plans env with extra arguments.
+func (c *common) plan(env *environment.Environment, args ...string) (*plan.Plan, error) {
+	if c.planPath != "" {
+		return plan.Load(c.planPath)
+	}
+	return env.Plan(context.Background(), c.dir, args...)
+}
+
+// absPlanPath returns -plan as an absolute path, since terraform resolves
+// paths relative to -chdir.
+func (c *common) absPlanPath() string {
+	if abs, err := filepath.Abs(c.planPath); err == nil {
+		return abs
+	}
+	return c.planPath
+}
+
+// emit writes rendered output to -o, or to stdout. Rendering happens
+// first so a failure never leaves a truncated file behind.
+func (c *common) emit(data []byte) error {
+	if c.out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(c.out, data, 0o644)
+}
+
+// writeReports writes reports and turns a failed check into errFailed.
+func (c *common) writeReports(reports []*report.Report) error {
+	var buf bytes.Buffer
+	if err := report.Write(&buf, c.format, reports); err != nil {
+		return err
+	}
+	if err := c.emit(buf.Bytes()); err != nil {
+		return err
+	}
+	if !report.Passed(reports) {
+		return errFailed
+	}
+	return nil
+}
+
+// labels returns the environment and workspace a report is for.
+func labels(env *environment.Environment) (string, string) {
+	if env == nil {
+		return "", ""
+	}
+	return env.Name, env.Workspace
+}
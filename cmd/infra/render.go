@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"terraform-advanced-course/internal/cost"
+	"terraform-advanced-course/internal/diagram"
+	"terraform-advanced-course/internal/summary"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+func diagramCmd(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("diagram", flag.ExitOnError)
+	c.register(fs, diagram.FormatMermaid, "mermaid, dot or svg")
+	c.registerPlan(fs)
+	var (
+		statePath = fs.String("state", "", "also draw this state file or show -json output")
+		graphPath = fs.String("graph", "", "also draw this terraform graph output (- for stdin)")
+	)
+	fs.Parse(args)
+
+	// -state or -graph alone draw without a plan.
+	g := diagram.New()
+	if c.planPath != "" || len(c.envs) > 0 || *statePath == "" && *graphPath == "" {
+		env, err := c.environment()
+		if err != nil {
+			return err
+		}
+		p, err := c.plan(env)
+		if err != nil {
+			return err
+		}
+		g = diagram.FromPlan(p)
+	}
+	if *statePath != "" {
+		st, err := tfstate.Load(*statePath)
+		if err != nil {
+			return err
+		}
+		g.Merge(diagram.FromState(st))
+	}
+	if *graphPath != "" {
+		var r io.Reader = os.Stdin
+		if *graphPath != "-" {
+			f, err := os.Open(*graphPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		if err := g.AddTerraformGraph(r); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := diagram.Write(&buf, g, c.format); err != nil {
+		return err
+	}
+	return c.emit(buf.Bytes())
+}
+
+func planSummary(args []string) error {
+	var c common
+	fs := flag.NewFlagSet("plan-summary", flag.ExitOnError)
+	c.register(fs, "markdown", "markdown or html")
+	c.registerPlan(fs)
+	var (
+		policyPath  = fs.String("policy", "", "policy violations to attach")
+		withCost    = fs.Bool("cost", true, "attach cost deltas from the price catalog")
+		catalogPath = fs.String("catalog", "", "price catalog file (default: embedded catalog)")
+	)
+	fs.Parse(args)
+
+	env, err := c.environment()
+	if err != nil {
+		return err
+	}
+	p, err := c.plan(env)
+	if err != nil {
+		return err
+	}
+	s := summary.Build(p)
+
+	if *policyPath != "" {
+		data, err := os.ReadFile(*policyPath)
+		if err != nil {
+			return err
+		}
+		findings, err := summary.ParsePolicyFindings(data)
+		if err != nil {
+			return err
+		}
+		s.Attach(findings...)
+	}
+	if *withCost {
+		catalog := cost.DefaultCatalog()
+		if *catalogPath != "" {
+			if catalog, err = cost.LoadCatalog(*catalogPath); err != nil {
+				return err
+			}
+		}
+		cmp := cost.Compare(cost.EstimatePrior(p, catalog, cost.Options{}), cost.EstimatePlan(p, catalog, cost.Options{}))
+		s.Attach(summary.CostFindings(cmp)...)
+	}
+
+	var buf bytes.Buffer
+	switch c.format {
+	case "markdown":
+		err = summary.WriteMarkdown(&buf, s)
+	case "html":
+		err = summary.WriteHTML(&buf, s)
+	default:
+		err = fmt.Errorf("unknown format %q", c.format)
+	}
+	if err != nil {
+		return err
+	}
+	return c.emit(buf.Bytes())
+}
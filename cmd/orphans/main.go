@@ -0,0 +1,96 @@
+// Command orphans reports Azure resources that exist in a resource group but
+// are not tracked by any of the given Terraform states.
+//
+//	terraform show -json > state.json
+//	go run ./cmd/orphans -state state.json -resource-group myTFResourceGroup-dev
+//	go run ./cmd/orphans -state a.tfstate -state b.tfstate -resource-group 'rg-terratest-*'
+//
+// The subscription is taken from -subscription, ARM_SUBSCRIPTION_ID or
+// AZURE_SUBSCRIPTION_ID, in that order. Pass -endpoint to point the command at
+// a fake ARM server.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"terraform-advanced-course/internal/arm"
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/orphans"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var (
+		states         stringList
+		resourceGroups stringList
+		subscription   = flag.String("subscription", firstEnv("ARM_SUBSCRIPTION_ID", "AZURE_SUBSCRIPTION_ID"), "Azure subscription ID")
+		endpoint       = flag.String("endpoint", arm.DefaultEndpoint, "Resource Manager endpoint")
+		format         = flag.String("format", "text", "output format: text or json")
+	)
+	flag.Var(&states, "state", "state file or show -json output (repeatable, - for stdin)")
+	flag.Var(&resourceGroups, "resource-group", "resource group name or glob pattern (repeatable)")
+	flag.Parse()
+
+	if len(states) == 0 || len(resourceGroups) == 0 || *subscription == "" {
+		fmt.Fprintln(os.Stderr, "orphans: -state, -resource-group and a subscription are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*subscription, *endpoint, *format, states, resourceGroups); err != nil {
+		fmt.Fprintln(os.Stderr, "orphans:", err)
+		os.Exit(1)
+	}
+}
+
+func run(subscription, endpoint, format string, statePaths, patterns []string) error {
+	ctx := context.Background()
+
+	var parsed []*tfstate.State
+	for _, p := range statePaths {
+		st, err := tfstate.Load(p)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, st)
+	}
+
+	client := arm.NewClient(subscription, azauth.EnvironmentToken())
+	client.Endpoint = endpoint
+
+	groups, err := orphans.ExpandResourceGroups(ctx, client, patterns)
+	if err != nil {
+		return err
+	}
+	found, err := orphans.Find(ctx, client, groups, orphans.ManagedIDs(parsed...))
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return orphans.WriteJSON(os.Stdout, found)
+	case "text":
+		return orphans.WriteText(os.Stdout, found)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+// Command planguard fails when a plan would delete or replace a protected
+// stateful resource.
+//
+//	terraform show -json tfplan > tfplan.json
+//	go run ./cmd/planguard -plan tfplan.json
+//	go run ./cmd/planguard -plan tfplan.json -protect azurerm_key_vault -protect 'module.storage.*'
+//
+// Without -protect, key vaults, storage accounts and storage containers are
+// protected. TF_GUARD_PROTECTED may hold a comma-separated list instead.
+// A blocked plan prints the override token that approves exactly its
+// destructive changes; pass it with -override or TF_GUARD_OVERRIDE.
+//
+// Exit status is 0 when the plan may be applied, 3 when it is blocked and 1
+// on any other error.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"terraform-advanced-course/internal/guard"
+	"terraform-advanced-course/internal/plan"
+)
+
+// exitBlocked distinguishes a refused plan from a failure to check it.
+const exitBlocked = 3
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var (
+		protected stringList
+		planPath  = flag.String("plan", "", "saved plan file, or terraform show -json output for one (- for stdin)")
+		override  = flag.String("override", os.Getenv("TF_GUARD_OVERRIDE"), "override token approving the plan's destructive changes")
+		format    = flag.String("format", "text", "output format: text or json")
+	)
+	flag.Var(&protected, "protect", "protected resource type or address pattern (repeatable)")
+	flag.Parse()
+
+	if *planPath == "" {
+		fmt.Fprintln(os.Stderr, "planguard: -plan is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(protected) == 0 {
+		for _, p := range strings.Split(os.Getenv("TF_GUARD_PROTECTED"), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protected = append(protected, p)
+			}
+		}
+	}
+
+	p, err := plan.Load(*planPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "planguard:", err)
+		os.Exit(1)
+	}
+	res := guard.New(protected...).Check(p)
+	blocked := res.Err(*override)
+
+	switch *format {
+	case "json":
+		out := struct {
+			*guard.Result
+			Token   string `json:"token,omitempty"`
+			Blocked bool   `json:"blocked"`
+		}{res, res.Token(), blocked != nil}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintln(os.Stderr, "planguard:", err)
+			os.Exit(1)
+		}
+	case "text":
+		switch {
+		case blocked != nil:
+			fmt.Println(blocked)
+		case len(res.Violations) > 0:
+			fmt.Printf("%d protected resource(s) will be destroyed, approved by override token.\n", len(res.Violations))
+		default:
+			fmt.Println("No protected resources are deleted or replaced.")
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "planguard: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	if blocked != nil {
+		os.Exit(exitBlocked)
+	}
+}
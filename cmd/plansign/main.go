@@ -0,0 +1,219 @@
+// Command plansign applies exactly the plan that was reviewed.
+//
+//	go run ./cmd/plansign keygen -o plan-signing
+//	go run ./cmd/plansign plan -var-file environments/dev.tfvars -out tfplan-dev -key plan-signing.pem
+//	go run ./cmd/plansign verify -plan tfplan-dev -pub plan-signing.pub
+//	go run ./cmd/plansign apply -plan tfplan-dev -pub plan-signing.pub
+//
+// plan saves the plan file and writes tfplan-dev.approval.json next to it
+// with the plan's content hash and the state serial and lineage it was made
+// against, signed when -key is given. apply verifies the plan file against
+// the approval and the workspace's current state, then applies the plan
+// file itself instead of re-planning.
+//
+// -key, -pub and -hash default to TF_PLAN_SIGNING_KEY, TF_PLAN_PUBLIC_KEY
+// and TF_PLAN_HASH. -hash is the hash a reviewer approved, so an approval
+// file swapped along with the plan is still caught.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"terraform-advanced-course/internal/environment"
+	"terraform-advanced-course/internal/plansign"
+	"terraform-advanced-course/internal/tfrun"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+const usage = `usage: plansign <command> [flags]
+
+commands:
+  keygen   create an ed25519 key pair for signing approvals
+  plan     save a plan file and its approval
+  verify   check a plan file against its approval and the current state
+  apply    verify, then apply the plan file
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "plan":
+		err = planCmd(os.Args[2:])
+	case "verify":
+		err = verifyCmd(os.Args[2:], false)
+	case "apply":
+		err = verifyCmd(os.Args[2:], true)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "plansign:", err)
+		os.Exit(1)
+	}
+}
+
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("o", "plan-signing", "writes <o>.pem (private) and <o>.pub (public)")
+	fs.Parse(args)
+
+	priv, pub, err := plansign.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out+".pem", priv, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out+".pub", pub, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s.pem and %s.pub. Keep the private key out of the repository.\n", *out, *out)
+	return nil
+}
+
+func planCmd(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	var (
+		dir     = fs.String("dir", ".", "root module directory")
+		varFile = fs.String("var-file", "", "environments/*.tfvars file, or an environment name; also selects the workspace")
+		out     = fs.String("out", "", "plan file to write (default tfplan-<workspace>)")
+		keyPath = fs.String("key", os.Getenv("TF_PLAN_SIGNING_KEY"), "private key to sign the approval with")
+	)
+	fs.Parse(args)
+	if *varFile == "" {
+		return fmt.Errorf("-var-file is required")
+	}
+	env, err := environment.Get(*dir, *varFile)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = "tfplan-" + env.Workspace
+	}
+	// terraform resolves -out relative to -chdir.
+	outPath, err := filepath.Abs(*out)
+	if err != nil {
+		return err
+	}
+
+	var key ed25519.PrivateKey
+	if *keyPath != "" {
+		if key, err = plansign.LoadPrivateKey(*keyPath); err != nil {
+			return err
+		}
+	}
+
+	if err := env.Runner(*dir).SavePlan(context.Background(), outPath, env.Args()...); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*out)
+	if err != nil {
+		return err
+	}
+	a, err := plansign.New(data)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		a.Sign(key)
+	}
+	if err := a.Write(approvalPath(*out)); err != nil {
+		return err
+	}
+
+	signed := "unsigned"
+	if key != nil {
+		signed = "signed by key " + a.KeyID
+	}
+	fmt.Printf("\nSaved %s (%s, state serial %d).\nPlan hash %s, %s.\n",
+		*out, a.Workspace, a.StateSerial, a.PlanHash, signed)
+	return nil
+}
+
+func verifyCmd(args []string, apply bool) error {
+	name := "verify"
+	if apply {
+		name = "apply"
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var (
+		dir       = fs.String("dir", ".", "root module directory")
+		planPath  = fs.String("plan", "", "plan file written by plansign plan")
+		approval  = fs.String("approval", "", "approval file (default <plan>.approval.json)")
+		pubPath   = fs.String("pub", os.Getenv("TF_PLAN_PUBLIC_KEY"), "public key the approval must be signed with")
+		hash      = fs.String("hash", os.Getenv("TF_PLAN_HASH"), "plan hash the reviewer approved")
+		statePath = fs.String("state", "", "current state file instead of terraform state pull")
+	)
+	fs.Parse(args)
+	if *planPath == "" {
+		return fmt.Errorf("-plan is required")
+	}
+	if *approval == "" {
+		*approval = approvalPath(*planPath)
+	}
+
+	data, err := os.ReadFile(*planPath)
+	if err != nil {
+		return err
+	}
+	a, err := plansign.Load(*approval)
+	if err != nil {
+		return err
+	}
+	expect := plansign.Expect{Hash: *hash}
+	if *pubPath != "" {
+		if expect.PublicKey, err = plansign.LoadPublicKey(*pubPath); err != nil {
+			return err
+		}
+	}
+
+	// The workspace is the approved one; TF_WORKSPACE makes state pull and
+	// apply use it regardless of the directory's selected workspace.
+	r := &tfrun.Runner{Dir: *dir, Workspace: a.Workspace}
+	if *statePath != "" {
+		if expect.State, err = tfstate.Load(*statePath); err != nil {
+			return err
+		}
+	} else {
+		raw, err := r.StatePull(context.Background())
+		if err != nil {
+			return err
+		}
+		if raw != nil {
+			if expect.State, err = tfstate.Parse(raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := plansign.Verify(data, a, expect); err != nil {
+		return fmt.Errorf("%s: %w", *planPath, err)
+	}
+	fmt.Printf("%s matches %s (%s, state serial %d).\n", *planPath, a.PlanHash, a.Workspace, a.StateSerial)
+
+	if !apply {
+		return nil
+	}
+	abs, err := filepath.Abs(*planPath)
+	if err != nil {
+		return err
+	}
+	return r.Apply(context.Background(), abs)
+}
+
+func approvalPath(planPath string) string {
+	return planPath + ".approval.json"
+}
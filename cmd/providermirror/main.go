@@ -0,0 +1,118 @@
+// Command providermirror builds a filesystem provider mirror so that
+// terraform init works without network access.
+//
+//	go run ./cmd/providermirror -artifacts /media/provider-zips
+//	go run ./cmd/providermirror -artifacts ./zips -platform linux_amd64 -platform darwin_arm64 -o /srv/mirror
+//	export TF_CLI_CONFIG_FILE="$PWD/provider-mirror/terraform.rc"
+//
+// It reads required_providers from every module and fixture under -dir,
+// takes the versions pinned in their .terraform.lock.hcl files, and copies
+// the matching release archives from -artifacts into the mirror after
+// checking each against the lock file checksums. The CLI config it writes
+// installs providers from the mirror only.
+//
+// Exit status is 0 when the mirror is complete, 2 on bad flags and 1 on
+// any other error, including a missing or mismatched archive.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"terraform-advanced-course/internal/providermirror"
+)
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var (
+		platforms stringList
+		dir       = flag.String("dir", ".", "root of the configuration; every module and fixture below it is read")
+		artifacts = flag.String("artifacts", "", "directory holding terraform-provider-<type>_<version>_<os>_<arch>.zip archives")
+		out       = flag.String("o", "provider-mirror", "mirror directory to fill")
+		config    = flag.String("config", "", "CLI config file to write (default <mirror>/terraform.rc)")
+		format    = flag.String("format", "text", "output format: text or json")
+	)
+	flag.Var(&platforms, "platform", "os_arch to mirror (repeatable; default this machine's)")
+	flag.Parse()
+
+	if *artifacts == "" {
+		fmt.Fprintln(os.Stderr, "providermirror: -artifacts is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "providermirror: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if len(platforms) == 0 {
+		platforms = stringList{runtime.GOOS + "_" + runtime.GOARCH}
+	}
+	if *config == "" {
+		*config = filepath.Join(*out, "terraform.rc")
+	}
+
+	entries, err := build(*dir, *artifacts, *out, *config, platforms)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "providermirror:", strings.TrimPrefix(err.Error(), "providermirror: "))
+		os.Exit(1)
+	}
+
+	abs, _ := filepath.Abs(*config)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Config    string                 `json:"config"`
+			Providers []providermirror.Entry `json:"providers"`
+		}{abs, entries})
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Source, e.Version, e.Platform, e.Hash)
+		}
+		tw.Flush()
+		_, err = fmt.Printf("\nMirrored %d archive(s). To install providers only from the mirror:\n  export TF_CLI_CONFIG_FILE=%q\n", len(entries), abs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "providermirror:", err)
+		os.Exit(1)
+	}
+}
+
+func build(dir, artifacts, mirror, config string, platforms []string) ([]providermirror.Entry, error) {
+	reqs, err := providermirror.Requirements(dir)
+	if err != nil {
+		return nil, err
+	}
+	found, err := providermirror.FindArtifacts(artifacts)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := providermirror.Build(reqs, found, mirror, platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := providermirror.WriteCLIConfig(f, mirror); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return entries, f.Close()
+}
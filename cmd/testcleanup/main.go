@@ -0,0 +1,213 @@
+// Command testcleanup removes what interrupted test runs left behind.
+//
+//	go run ./cmd/testcleanup resume
+//	go run ./cmd/testcleanup resume -dry-run -format json
+//	go run ./cmd/testcleanup janitor -dry-run
+//	go run ./cmd/testcleanup janitor -format json > janitor.json
+//
+// resume destroys every deployment still recorded in the test harness's
+// cleanup journal (test/.cleanup-journal, or TEST_CLEANUP_JOURNAL): those
+// of tests that were killed, timed out or failed to destroy. It runs
+// terraform init and destroy in each entry's working directory with the
+// entry's variables and the caller's Azure credentials, and removes the
+// entry once destroy succeeds. Entries of a test run that is still going
+// are skipped. Like the tests themselves, resume refuses to touch anything
+// the production denylist (test/production_denylist.json, or
+// TEST_PRODUCTION_DENYLIST) matches, and keeps such entries.
+//
+// janitor deletes the stale test resource groups in the subscription,
+// whichever machine's run leaked them: groups named like the tests name
+// theirs, or carrying the harness's terratest-expires tag, once that tag's
+// time has passed. It deletes at most -workers groups at a time. The
+// subscription is taken from -subscription, ARM_SUBSCRIPTION_ID or
+// AZURE_SUBSCRIPTION_ID, in that order; pass -endpoint to point it at a
+// fake ARM server.
+//
+// Exit status is 0 when the journal ends up empty, or every stale group
+// was deleted; 3 when journal entries remain because a destroy failed,
+// their state is gone or they match the denylist, or a group could not be
+// deleted; 2 on bad flags and
+// 1 on any other error.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"terraform-advanced-course/internal/arm"
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/cleanup"
+	"terraform-advanced-course/internal/janitor"
+	"terraform-advanced-course/internal/safety"
+)
+
+const usage = `usage: testcleanup <command> [flags]
+
+commands:
+  resume   destroy the deployments left in the test harness's cleanup journal
+  janitor  delete stale test resource groups in the subscription
+
+Run testcleanup <command> -h for a command's flags.
+`
+
+// exitRemaining means entries are left that need another attempt or
+// cleaning up by hand.
+const exitRemaining = 3
+
+var errRemaining = errors.New("entries remain")
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"resume":  resume,
+	"janitor": clean,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch err := cmd(ctx, os.Args[2:]); err {
+	case nil:
+	case errRemaining:
+		os.Exit(exitRemaining)
+	default:
+		fmt.Fprintln(os.Stderr, "testcleanup:", err)
+		os.Exit(1)
+	}
+}
+
+func defaultJournal() string {
+	if dir := os.Getenv("TEST_CLEANUP_JOURNAL"); dir != "" && dir != "off" {
+		return dir
+	}
+	return "test/.cleanup-journal"
+}
+
+func defaultDenylist() string {
+	if file := os.Getenv("TEST_PRODUCTION_DENYLIST"); file != "" {
+		return file
+	}
+	return "test/production_denylist.json"
+}
+
+func resume(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	var (
+		journal  = fs.String("journal", defaultJournal(), "cleanup journal directory")
+		denylist = fs.String("denylist", defaultDenylist(), "production denylist entries are checked against before destroy")
+		binary   = fs.String("terraform", "terraform", "terraform executable for entries that do not name one")
+		dryRun   = fs.Bool("dry-run", false, "report what would be destroyed without destroying it")
+		format   = fs.String("format", "text", "output format: text or json")
+	)
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "testcleanup: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	d, err := safety.LoadDenylist(*denylist)
+	if err != nil {
+		return fmt.Errorf("production denylist: %w", err)
+	}
+
+	r := &cleanup.Resumer{
+		Journal:  &cleanup.Journal{Dir: *journal},
+		Binary:   *binary,
+		DryRun:   *dryRun,
+		Denylist: d,
+		Log:      os.Stderr,
+	}
+	results, err := r.Resume(ctx)
+	if *format == "json" {
+		if werr := cleanup.WriteJSON(os.Stdout, results); werr != nil {
+			return werr
+		}
+	} else if werr := cleanup.WriteText(os.Stdout, results); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		switch res.Outcome {
+		case cleanup.OutcomeFailed, cleanup.OutcomeLost, cleanup.OutcomeRefused:
+			return errRemaining
+		}
+	}
+	return nil
+}
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func clean(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("janitor", flag.ExitOnError)
+	var (
+		patterns     stringList
+		subscription = fs.String("subscription", firstEnv("ARM_SUBSCRIPTION_ID", "AZURE_SUBSCRIPTION_ID"), "Azure subscription ID")
+		endpoint     = fs.String("endpoint", arm.DefaultEndpoint, "Resource Manager endpoint")
+		workers      = fs.Int("workers", 4, "resource groups deleted at once")
+		dryRun       = fs.Bool("dry-run", false, "list the stale resource groups without deleting them")
+		format       = fs.String("format", "text", "output format: text or json")
+	)
+	fs.Var(&patterns, "pattern", "resource group name pattern (repeatable; defaults to "+strings.Join(janitor.DefaultPatterns, ", ")+")")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "testcleanup: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if *subscription == "" {
+		fmt.Fprintln(os.Stderr, "testcleanup: janitor needs a subscription")
+		os.Exit(2)
+	}
+
+	client := arm.NewClient(*subscription, azauth.EnvironmentToken())
+	client.Endpoint = *endpoint
+	j := &janitor.Janitor{
+		Groups:   client,
+		Patterns: patterns,
+		Workers:  *workers,
+		DryRun:   *dryRun,
+		Log:      os.Stderr,
+	}
+	report, err := j.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		err = janitor.WriteJSON(os.Stdout, report)
+	} else {
+		err = janitor.WriteText(os.Stdout, report)
+	}
+	if err != nil {
+		return err
+	}
+	if report.Count(janitor.ActionFailed) > 0 {
+		return errRemaining
+	}
+	return nil
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+// Package arm is a small Azure Resource Manager client used by the course
+// tooling to inspect what actually exists in a subscription.
+//
+// The tooling only needs a handful of read calls, so instead of pulling in
+// the full Azure SDK it talks to the ARM REST API directly. Everything goes
+// through the Inspector interface so commands can run against the fake ARM
+// server in package armfake without credentials or network access.
+package arm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultEndpoint is the public-cloud Resource Manager endpoint.
+const DefaultEndpoint = "https://management.azure.com"
+
+// Resource is a live ARM resource. The resources list API fills in the
+// envelope fields only; Properties is populated by GetResource.
+type Resource struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Location   string                 `json:"location,omitempty"`
+	Kind       string                 `json:"kind,omitempty"`
+	SKU        *SKU                   `json:"sku,omitempty"`
+	Tags       map[string]string      `json:"tags,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// SKU is the pricing tier of a resource.
+type SKU struct {
+	Name string `json:"name"`
+	Tier string `json:"tier,omitempty"`
+}
+
+// ResourceGroup is a live resource group.
+type ResourceGroup struct {
+	ID         string                   `json:"id"`
+	Name       string                   `json:"name"`
+	Location   string                   `json:"location"`
+	Tags       map[string]string        `json:"tags,omitempty"`
+	Properties *ResourceGroupProperties `json:"properties,omitempty"`
+}
+
+// ResourceGroupProperties are the properties of a ResourceGroup.
+type ResourceGroupProperties struct {
+	// ProvisioningState is "Deleting" while a delete is in progress.
+	ProvisioningState string `json:"provisioningState,omitempty"`
+}
+
+// DeletedVault is a soft-deleted key vault. Its name stays taken until
+// it is purged or its retention period ends.
+type DeletedVault struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Properties DeletedVaultProperties `json:"properties"`
+}
+
+// DeletedVaultProperties are the properties of a DeletedVault.
+type DeletedVaultProperties struct {
+	VaultID                string            `json:"vaultId"`
+	Location               string            `json:"location"`
+	DeletionDate           string            `json:"deletionDate,omitempty"`
+	ScheduledPurgeDate     string            `json:"scheduledPurgeDate,omitempty"`
+	PurgeProtectionEnabled bool              `json:"purgeProtectionEnabled,omitempty"`
+	Tags                   map[string]string `json:"tags,omitempty"`
+}
+
+// Inspector lists live resources in a subscription.
+type Inspector interface {
+	// ListResourceGroups returns every resource group in the subscription.
+	ListResourceGroups(ctx context.Context) ([]ResourceGroup, error)
+
+	// ListResources returns the top-level resources in a resource group.
+	ListResources(ctx context.Context, resourceGroup string) ([]Resource, error)
+
+	// GetResource returns a single resource, including its properties.
+	GetResource(ctx context.Context, id string) (Resource, error)
+}
+
+// ResponseError is a non-2xx response from Resource Manager.
+type ResponseError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("arm: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("arm: %s (status %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is, or wraps, a 404 from Resource
+// Manager.
+func IsNotFound(err error) bool {
+	var re *ResponseError
+	return errors.As(err, &re) && re.StatusCode == 404
+}
+
+// NormalizeID lower-cases a resource ID and trims any trailing slash.
+// ARM treats IDs case-insensitively and the provider and the API do not
+// always agree on casing (resourceGroups vs resourcegroups), so IDs must be
+// normalized before they are compared.
+func NormalizeID(id string) string {
+	return strings.TrimRight(strings.ToLower(id), "/")
+}
@@ -0,0 +1,18 @@
+package arm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNotFound(t *testing.T) {
+	notFound := &ResponseError{StatusCode: 404, Code: "ResourceGroupNotFound"}
+	assert.True(t, IsNotFound(notFound))
+	assert.True(t, IsNotFound(fmt.Errorf("list resources in rg: %w", notFound)))
+	assert.False(t, IsNotFound(&ResponseError{StatusCode: 409, Code: "ScopeLocked"}))
+	assert.False(t, IsNotFound(errors.New("404")))
+	assert.False(t, IsNotFound(nil))
+}
@@ -0,0 +1,381 @@
+// Package armfake is an in-memory fake of the Resource Manager REST API.
+//
+// It implements just enough of the API for the arm.Client calls used by the
+// tooling, so those tools can be exercised offline and without credentials.
+// Lists are paginated with nextLink like the real service; set PageSize to
+// force small pages in tests.
+package armfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+// DefaultSubscriptionID is used when New is given an empty subscription.
+const DefaultSubscriptionID = "00000000-0000-0000-0000-000000000000"
+
+// Server is a running fake Resource Manager endpoint.
+type Server struct {
+	*httptest.Server
+
+	SubscriptionID string
+
+	// PageSize caps the number of items per list page. Zero means unlimited.
+	PageSize int
+
+	// PurgePolls is how many more times a deleted key vault can be read,
+	// and is listed, after its purge was accepted, as the real service
+	// keeps it while the purge runs. Zero purges at once.
+	PurgePolls int
+
+	mu      sync.Mutex
+	groups  map[string]*group
+	deleted []arm.DeletedVault
+	purged  []string
+	purging map[string]int
+	locked  map[string]bool
+	removed []string
+}
+
+type group struct {
+	arm.ResourceGroup
+	resources []arm.Resource
+}
+
+// New starts a fake server for subscriptionID. Call Close when done.
+func New(subscriptionID string) *Server {
+	if subscriptionID == "" {
+		subscriptionID = DefaultSubscriptionID
+	}
+	s := &Server{
+		SubscriptionID: subscriptionID,
+		groups:         map[string]*group{},
+		purging:        map[string]int{},
+		locked:         map[string]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns an arm.Client pointed at the fake server.
+func (s *Server) Client() *arm.Client {
+	return &arm.Client{
+		Endpoint:       s.URL,
+		SubscriptionID: s.SubscriptionID,
+		HTTPClient:     s.Server.Client(),
+	}
+}
+
+// AddResourceGroup creates or replaces a resource group.
+func (s *Server) AddResourceGroup(name, location string, tags map[string]string) arm.ResourceGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rg := arm.ResourceGroup{
+		ID:       fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", s.SubscriptionID, name),
+		Name:     name,
+		Location: location,
+		Tags:     tags,
+	}
+	s.groups[strings.ToLower(name)] = &group{ResourceGroup: rg}
+	return rg
+}
+
+// AddResource creates a resource of resourceType (for example
+// "Microsoft.Storage/storageAccounts") in an existing resource group.
+func (s *Server) AddResource(resourceGroup, resourceType, name string, tags map[string]string) arm.Resource {
+	return s.PutResource(resourceGroup, arm.Resource{Type: resourceType, Name: name, Tags: tags})
+}
+
+// PutResource stores res in an existing resource group, replacing any
+// resource with the same ID. An empty ID is derived from Type and Name, which
+// must then name a top-level resource; child resources such as subnets need
+// an explicit ID. Location defaults to the group's location.
+func (s *Server) PutResource(resourceGroup string, res arm.Resource) arm.Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[strings.ToLower(resourceGroup)]
+	if !ok {
+		panic(fmt.Sprintf("armfake: resource group %q does not exist", resourceGroup))
+	}
+	if res.ID == "" {
+		res.ID = fmt.Sprintf("%s/providers/%s/%s", g.ID, res.Type, res.Name)
+	}
+	if res.Location == "" {
+		res.Location = g.Location
+	}
+	for i, existing := range g.resources {
+		if arm.NormalizeID(existing.ID) == arm.NormalizeID(res.ID) {
+			g.resources[i] = res
+			return res
+		}
+	}
+	g.resources = append(g.resources, res)
+	return res
+}
+
+// AddDeletedVault records a soft-deleted key vault.
+func (s *Server) AddDeletedVault(name, location string, purgeProtection bool) arm.DeletedVault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := arm.DeletedVault{
+		ID:   fmt.Sprintf("/subscriptions/%s/providers/Microsoft.KeyVault/locations/%s/deletedVaults/%s", s.SubscriptionID, location, name),
+		Name: name,
+		Properties: arm.DeletedVaultProperties{
+			VaultID:                fmt.Sprintf("/subscriptions/%s/resourceGroups/deleted/providers/Microsoft.KeyVault/vaults/%s", s.SubscriptionID, name),
+			Location:               location,
+			PurgeProtectionEnabled: purgeProtection,
+		},
+	}
+	s.deleted = append(s.deleted, v)
+	return v
+}
+
+// Purged returns the names of the vaults purged so far, in order.
+func (s *Server) Purged() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.purged...)
+}
+
+// LockResourceGroup puts a delete lock on a resource group, so deleting
+// it fails as it does in Azure.
+func (s *Server) LockResourceGroup(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locked[strings.ToLower(name)] = true
+}
+
+// DeletedResourceGroups returns the names of the resource groups deleted
+// so far, in order.
+func (s *Server) DeletedResourceGroups() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.removed...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 2 || !strings.EqualFold(segments[0], "subscriptions") ||
+		!strings.EqualFold(segments[1], s.SubscriptionID) {
+		writeError(w, http.StatusNotFound, "SubscriptionNotFound",
+			fmt.Sprintf("The subscription '%s' could not be found.", segmentAt(segments, 1)))
+		return
+	}
+	rest := segments[2:]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case len(rest) == 1 && strings.EqualFold(rest[0], "resourcegroups") && r.Method == http.MethodGet:
+		s.listResourceGroups(w, r)
+	case len(rest) == 2 && strings.EqualFold(rest[0], "resourcegroups") && r.Method == http.MethodDelete:
+		s.deleteResourceGroup(w, rest[1])
+	case len(rest) == 3 && strings.EqualFold(rest[0], "resourcegroups") &&
+		strings.EqualFold(rest[2], "resources") && r.Method == http.MethodGet:
+		s.listResources(w, r, rest[1])
+	case len(rest) == 3 && strings.EqualFold(rest[0], "providers") &&
+		strings.EqualFold(rest[1], "Microsoft.KeyVault") && strings.EqualFold(rest[2], "deletedVaults") &&
+		r.Method == http.MethodGet:
+		s.listDeletedVaults(w, r)
+	case len(rest) == 6 && strings.EqualFold(rest[0], "providers") && strings.EqualFold(rest[1], "Microsoft.KeyVault") &&
+		strings.EqualFold(rest[2], "locations") && strings.EqualFold(rest[4], "deletedVaults") &&
+		r.Method == http.MethodGet:
+		s.getDeletedVault(w, rest[3], rest[5])
+	case len(rest) == 7 && strings.EqualFold(rest[0], "providers") && strings.EqualFold(rest[1], "Microsoft.KeyVault") &&
+		strings.EqualFold(rest[2], "locations") && strings.EqualFold(rest[4], "deletedVaults") &&
+		strings.EqualFold(rest[6], "purge") && r.Method == http.MethodPost:
+		s.purgeDeletedVault(w, rest[3], rest[5])
+	case len(rest) >= 4 && strings.EqualFold(rest[0], "resourcegroups") &&
+		strings.EqualFold(rest[2], "providers") && r.Method == http.MethodGet:
+		s.getResource(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound",
+			fmt.Sprintf("armfake: no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) listResourceGroups(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		items = append(items, s.groups[name].ResourceGroup)
+	}
+	s.writePage(w, r, items)
+}
+
+// deleteResourceGroup deletes at once, where the real service keeps the
+// group in the Deleting state for minutes.
+func (s *Server) deleteResourceGroup(w http.ResponseWriter, name string) {
+	g, ok := s.groups[strings.ToLower(name)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "ResourceGroupNotFound",
+			fmt.Sprintf("Resource group '%s' could not be found.", name))
+		return
+	}
+	if s.locked[strings.ToLower(name)] {
+		writeError(w, http.StatusConflict, "ScopeLocked",
+			fmt.Sprintf("The scope '%s' cannot perform delete operation because following scope(s) are locked: '%s'. Please remove the lock and try again.", g.ID, g.ID))
+		return
+	}
+	delete(s.groups, strings.ToLower(name))
+	s.removed = append(s.removed, g.Name)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) listResources(w http.ResponseWriter, r *http.Request, resourceGroup string) {
+	g, ok := s.groups[strings.ToLower(resourceGroup)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "ResourceGroupNotFound",
+			fmt.Sprintf("Resource group '%s' could not be found.", resourceGroup))
+		return
+	}
+	// Like the real API, the list only covers top-level resources and
+	// leaves out properties.
+	items := make([]interface{}, 0, len(g.resources))
+	for _, res := range g.resources {
+		if strings.Count(res.Type, "/") != 1 {
+			continue
+		}
+		res.Properties = nil
+		items = append(items, res)
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) getResource(w http.ResponseWriter, r *http.Request) {
+	id := arm.NormalizeID(r.URL.Path)
+	for _, g := range s.groups {
+		for _, res := range g.resources {
+			if arm.NormalizeID(res.ID) == id {
+				writeJSON(w, http.StatusOK, res)
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "ResourceNotFound",
+		fmt.Sprintf("The Resource '%s' was not found.", r.URL.Path))
+}
+
+func (s *Server) listDeletedVaults(w http.ResponseWriter, r *http.Request) {
+	items := make([]interface{}, 0, len(s.deleted))
+	for _, v := range s.deleted {
+		items = append(items, v)
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) getDeletedVault(w http.ResponseWriter, location, name string) {
+	for i, v := range s.deleted {
+		if !strings.EqualFold(v.Name, name) || !strings.EqualFold(v.Properties.Location, location) {
+			continue
+		}
+		key := deletedVaultKey(location, name)
+		if polls, ok := s.purging[key]; ok {
+			if polls == 0 {
+				delete(s.purging, key)
+				s.deleted = append(s.deleted[:i], s.deleted[i+1:]...)
+				break
+			}
+			s.purging[key] = polls - 1
+		}
+		writeJSON(w, http.StatusOK, v)
+		return
+	}
+	writeError(w, http.StatusNotFound, "ResourceNotFound",
+		fmt.Sprintf("The Resource 'Microsoft.KeyVault/locations/%s/deletedVaults/%s' was not found.", location, name))
+}
+
+// purgeDeletedVault accepts a purge. The vault stays readable for
+// PurgePolls more reads, where the real service takes minutes.
+func (s *Server) purgeDeletedVault(w http.ResponseWriter, location, name string) {
+	for i, v := range s.deleted {
+		if !strings.EqualFold(v.Name, name) || !strings.EqualFold(v.Properties.Location, location) {
+			continue
+		}
+		if v.Properties.PurgeProtectionEnabled {
+			writeError(w, http.StatusConflict, "Conflict",
+				fmt.Sprintf("Operation \"purge\" is not allowed because purge protection is enabled for this vault. Key Vault '%s' will be purged automatically after the retention period.", name))
+			return
+		}
+		key := deletedVaultKey(location, name)
+		if _, ok := s.purging[key]; ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.purged = append(s.purged, v.Name)
+		if s.PurgePolls > 0 {
+			s.purging[key] = s.PurgePolls
+		} else {
+			s.deleted = append(s.deleted[:i], s.deleted[i+1:]...)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeError(w, http.StatusNotFound, "ResourceNotFound",
+		fmt.Sprintf("The Resource 'Microsoft.KeyVault/locations/%s/deletedVaults/%s' was not found.", location, name))
+}
+
+func deletedVaultKey(location, name string) string {
+	return strings.ToLower(location + "/" + name)
+}
+
+// writePage writes one page of items, adding a nextLink that carries the
+// offset of the following page in $skiptoken.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := len(items)
+	if s.PageSize > 0 && offset+s.PageSize < end {
+		end = offset + s.PageSize
+	}
+
+	page := map[string]interface{}{"value": items[offset:end]}
+	if end < len(items) {
+		next := *r.URL
+		next.Scheme = "http"
+		next.Host = r.Host
+		q := next.Query()
+		q.Set("$skiptoken", strconv.Itoa(end))
+		next.RawQuery = q.Encode()
+		page["nextLink"] = next.String()
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+func segmentAt(segments []string, i int) string {
+	if i < len(segments) {
+		return segments[i]
+	}
+	return ""
+}
@@ -0,0 +1,237 @@
+package arm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	resourcesAPIVersion      = "2021-04-01"
+	resourceGroupsAPIVersion = "2021-04-01"
+	keyVaultAPIVersion       = "2023-07-01"
+)
+
+// apiVersions pins the API version used by GetResource per resource
+// provider namespace. Namespaces not listed fall back to resourcesAPIVersion,
+// which only works for the generic resource envelope.
+var apiVersions = map[string]string{
+	"microsoft.keyvault": keyVaultAPIVersion,
+	"microsoft.network":  "2023-09-01",
+	"microsoft.storage":  "2023-01-01",
+	"microsoft.web":      "2022-09-01",
+}
+
+// TokenSource returns a bearer token for Resource Manager.
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenSource that always yields token.
+func StaticToken(token string) TokenSource {
+	return func(context.Context) (string, error) { return token, nil }
+}
+
+// Client is an Inspector backed by the Resource Manager REST API.
+type Client struct {
+	// Endpoint is the Resource Manager base URL. Defaults to DefaultEndpoint.
+	Endpoint string
+
+	// SubscriptionID scopes every request.
+	SubscriptionID string
+
+	// Token authenticates requests. A nil Token sends no Authorization
+	// header, which is what the fake server expects.
+	Token TokenSource
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the given subscription.
+func NewClient(subscriptionID string, token TokenSource) *Client {
+	return &Client{
+		Endpoint:       DefaultEndpoint,
+		SubscriptionID: subscriptionID,
+		Token:          token,
+	}
+}
+
+// ListResourceGroups implements Inspector.
+func (c *Client) ListResourceGroups(ctx context.Context) ([]ResourceGroup, error) {
+	var groups []ResourceGroup
+	path := fmt.Sprintf("/subscriptions/%s/resourcegroups", c.SubscriptionID)
+	err := c.list(ctx, c.url(path, resourceGroupsAPIVersion), func(raw json.RawMessage) error {
+		var page []ResourceGroup
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		groups = append(groups, page...)
+		return nil
+	})
+	return groups, err
+}
+
+// DeleteResourceGroup deletes a resource group and everything in it.
+// Azure accepts the request and deletes in the background; the group is
+// listed as Deleting until it is gone.
+func (c *Client) DeleteResourceGroup(ctx context.Context, name string) error {
+	path := fmt.Sprintf("/subscriptions/%s/resourcegroups/%s", c.SubscriptionID, url.PathEscape(name))
+	return c.do(ctx, http.MethodDelete, c.url(path, resourceGroupsAPIVersion), nil)
+}
+
+// ListResources implements Inspector.
+func (c *Client) ListResources(ctx context.Context, resourceGroup string) ([]Resource, error) {
+	var resources []Resource
+	path := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/resources",
+		c.SubscriptionID, url.PathEscape(resourceGroup))
+	err := c.list(ctx, c.url(path, resourcesAPIVersion), func(raw json.RawMessage) error {
+		var page []Resource
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		resources = append(resources, page...)
+		return nil
+	})
+	return resources, err
+}
+
+// GetResource implements Inspector.
+func (c *Client) GetResource(ctx context.Context, id string) (Resource, error) {
+	rid, err := ParseID(id)
+	if err != nil {
+		return Resource{}, err
+	}
+	version := resourcesAPIVersion
+	if rid.Namespace == "" {
+		version = resourceGroupsAPIVersion
+	} else if v, ok := apiVersions[strings.ToLower(rid.Namespace)]; ok {
+		version = v
+	}
+
+	var res Resource
+	if err := c.do(ctx, http.MethodGet, c.url(rid.String(), version), &res); err != nil {
+		return Resource{}, err
+	}
+	return res, nil
+}
+
+// ListDeletedVaults returns the subscription's soft-deleted key vaults.
+func (c *Client) ListDeletedVaults(ctx context.Context) ([]DeletedVault, error) {
+	var vaults []DeletedVault
+	path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.KeyVault/deletedVaults", c.SubscriptionID)
+	err := c.list(ctx, c.url(path, keyVaultAPIVersion), func(raw json.RawMessage) error {
+		var page []DeletedVault
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return err
+		}
+		vaults = append(vaults, page...)
+		return nil
+	})
+	return vaults, err
+}
+
+// GetDeletedVault returns a soft-deleted key vault. Once a purge has
+// finished it fails with a *ResponseError IsNotFound recognizes.
+func (c *Client) GetDeletedVault(ctx context.Context, location, name string) (DeletedVault, error) {
+	path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.KeyVault/locations/%s/deletedVaults/%s",
+		c.SubscriptionID, url.PathEscape(location), url.PathEscape(name))
+	var v DeletedVault
+	if err := c.do(ctx, http.MethodGet, c.url(path, keyVaultAPIVersion), &v); err != nil {
+		return DeletedVault{}, err
+	}
+	return v, nil
+}
+
+// PurgeDeletedVault permanently deletes a soft-deleted key vault, freeing
+// its name. Azure accepts the request and purges in the background, which
+// takes a few minutes; the name is free once GetDeletedVault no longer
+// finds the vault.
+func (c *Client) PurgeDeletedVault(ctx context.Context, location, name string) error {
+	path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.KeyVault/locations/%s/deletedVaults/%s/purge",
+		c.SubscriptionID, url.PathEscape(location), url.PathEscape(name))
+	return c.do(ctx, http.MethodPost, c.url(path, keyVaultAPIVersion), nil)
+}
+
+func (c *Client) url(path, apiVersion string) string {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return strings.TrimRight(endpoint, "/") + path + "?api-version=" + apiVersion
+}
+
+// list follows nextLink pagination, handing each page's value array to fn.
+func (c *Client) list(ctx context.Context, next string, fn func(json.RawMessage) error) error {
+	for next != "" {
+		var page struct {
+			Value    json.RawMessage `json:"value"`
+			NextLink string          `json:"nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, next, &page); err != nil {
+			return err
+		}
+		if len(page.Value) > 0 {
+			if err := fn(page.Value); err != nil {
+				return fmt.Errorf("arm: decode page: %w", err)
+			}
+		}
+		next = page.NextLink
+	}
+	return nil
+}
+
+// do sends a request and decodes a JSON response body into out, if non-nil.
+func (c *Client) do(ctx context.Context, method, rawURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != nil {
+		token, err := c.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp.StatusCode, body)
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+func decodeError(status int, body []byte) error {
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &envelope)
+	return &ResponseError{
+		StatusCode: status,
+		Code:       envelope.Error.Code,
+		Message:    envelope.Error.Message,
+	}
+}
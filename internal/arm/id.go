@@ -0,0 +1,92 @@
+package arm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourceGroupType is the ARM type of a resource group.
+const ResourceGroupType = "Microsoft.Resources/resourceGroups"
+
+// ResourceID is a parsed ARM resource ID of the form
+//
+//	/subscriptions/{sub}/resourceGroups/{rg}/providers/{ns}/{type}/{name}[/{type}/{name}...]
+type ResourceID struct {
+	SubscriptionID string
+	ResourceGroup  string
+
+	// Namespace is the resource provider, e.g. Microsoft.Storage. It is
+	// empty when the ID names the resource group itself.
+	Namespace string
+
+	// Types and Names hold the alternating type/name segments after the
+	// namespace, outermost first.
+	Types []string
+	Names []string
+}
+
+// ParseID parses a resource group or resource ID.
+func ParseID(id string) (ResourceID, error) {
+	segments := strings.Split(strings.Trim(id, "/"), "/")
+	if len(segments) < 4 || !strings.EqualFold(segments[0], "subscriptions") ||
+		!strings.EqualFold(segments[2], "resourceGroups") {
+		return ResourceID{}, fmt.Errorf("arm: %q is not a resource group scoped ID", id)
+	}
+	rid := ResourceID{SubscriptionID: segments[1], ResourceGroup: segments[3]}
+	rest := segments[4:]
+	if len(rest) == 0 {
+		return rid, nil
+	}
+	if len(rest) < 4 || !strings.EqualFold(rest[0], "providers") || len(rest[2:])%2 != 0 {
+		return ResourceID{}, fmt.Errorf("arm: malformed resource ID %q", id)
+	}
+	rid.Namespace = rest[1]
+	for i := 2; i < len(rest); i += 2 {
+		rid.Types = append(rid.Types, rest[i])
+		rid.Names = append(rid.Names, rest[i+1])
+	}
+	return rid, nil
+}
+
+// Type returns the full ARM type, e.g. Microsoft.Network/virtualNetworks/subnets.
+func (r ResourceID) Type() string {
+	if r.Namespace == "" {
+		return ResourceGroupType
+	}
+	return r.Namespace + "/" + strings.Join(r.Types, "/")
+}
+
+// Name returns the innermost resource name.
+func (r ResourceID) Name() string {
+	if len(r.Names) == 0 {
+		return r.ResourceGroup
+	}
+	return r.Names[len(r.Names)-1]
+}
+
+// Parent returns the ID of the enclosing resource, or of the resource group
+// for a top-level resource.
+func (r ResourceID) Parent() ResourceID {
+	parent := r
+	switch {
+	case len(r.Names) > 1:
+		parent.Types = r.Types[:len(r.Types)-1]
+		parent.Names = r.Names[:len(r.Names)-1]
+	default:
+		parent.Namespace, parent.Types, parent.Names = "", nil, nil
+	}
+	return parent
+}
+
+// String formats the ID in its canonical form.
+func (r ResourceID) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/subscriptions/%s/resourceGroups/%s", r.SubscriptionID, r.ResourceGroup)
+	if r.Namespace != "" {
+		fmt.Fprintf(&b, "/providers/%s", r.Namespace)
+		for i := range r.Types {
+			fmt.Fprintf(&b, "/%s/%s", r.Types[i], r.Names[i])
+		}
+	}
+	return b.String()
+}
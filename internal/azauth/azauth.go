@@ -0,0 +1,268 @@
+// Package azauth resolves the Azure credentials the tooling and the live
+// tests run with, so terraform and the Go clients always act as the same
+// identity in the same subscription.
+//
+// Credentials are resolved from the environment in this order; the first
+// method whose variables are set wins:
+//
+//  1. Client secret: ARM_CLIENT_SECRET, with ARM_CLIENT_ID and ARM_TENANT_ID.
+//  2. OIDC federated token file: ARM_OIDC_TOKEN_FILE_PATH or
+//     AZURE_FEDERATED_TOKEN_FILE, with ARM_CLIENT_ID and ARM_TENANT_ID.
+//  3. Managed identity: ARM_USE_MSI=true, with ARM_CLIENT_ID for a
+//     user-assigned identity.
+//  4. The Azure CLI's logged-in account.
+//
+// The AZURE_* spellings of the client, tenant and secret variables are
+// read when the ARM_* ones are unset. The subscription is
+// ARM_SUBSCRIPTION_ID or AZURE_SUBSCRIPTION_ID, falling back to the CLI
+// account's. Setting the two to different subscriptions is an error rather
+// than a guess, as is a method with some of its variables missing: a run
+// either has complete credentials or none at all.
+package azauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+// Methods, in resolution order.
+const (
+	MethodClientSecret    = "client secret"
+	MethodOIDC            = "OIDC"
+	MethodManagedIdentity = "managed identity"
+	MethodAzureCLI        = "Azure CLI"
+
+	// MethodFake is the method of the test double returned by Fake.
+	MethodFake = "fake"
+)
+
+// ErrNoCredentials means no method's variables are set and the Azure CLI
+// is not logged in. Live tests skip on it; any other error fails them.
+var ErrNoCredentials = errors.New("azauth: no Azure credentials found")
+
+// Credential is a resolved identity and subscription.
+type Credential struct {
+	Method         string
+	SubscriptionID string
+	TenantID       string
+
+	// ClientID is the service principal or user-assigned identity, empty
+	// for the Azure CLI and a system-assigned identity.
+	ClientID string
+
+	clientSecret string
+	tokenFile    string
+	token        arm.TokenSource
+}
+
+// String describes the credential without its secret.
+func (c *Credential) String() string {
+	s := fmt.Sprintf("%s in subscription %s", c.Method, c.SubscriptionID)
+	if c.ClientID != "" {
+		s += " as " + c.ClientID
+	}
+	return s
+}
+
+// TerraformEnv returns the environment that makes the azurerm provider
+// and backend authenticate with this credential. It sets every variable
+// the other methods read to a value that turns them off, so nothing in
+// the caller's environment can switch terraform to another identity.
+func (c *Credential) TerraformEnv() map[string]string {
+	env := map[string]string{
+		"ARM_SUBSCRIPTION_ID": c.SubscriptionID,
+		"ARM_TENANT_ID":       c.TenantID,
+		"ARM_CLIENT_ID":       c.ClientID,
+		"ARM_CLIENT_SECRET":   c.clientSecret,
+		"ARM_USE_OIDC":        "false",
+		"ARM_USE_MSI":         "false",
+		"ARM_USE_CLI":         "false",
+	}
+	switch c.Method {
+	case MethodOIDC:
+		env["ARM_USE_OIDC"] = "true"
+		env["ARM_OIDC_TOKEN_FILE_PATH"] = c.tokenFile
+	case MethodManagedIdentity:
+		env["ARM_USE_MSI"] = "true"
+	case MethodAzureCLI:
+		env["ARM_USE_CLI"] = "true"
+	}
+	return env
+}
+
+// SDKEnv returns the AZURE_* environment that makes the Azure SDK's
+// environment authorizer, which terratest's azure helpers use, pick the
+// same identity. An empty value means the variable must be unset. The
+// older SDK has no federated token support, so with OIDC only clients
+// built from TokenSource authenticate.
+func (c *Credential) SDKEnv() map[string]string {
+	env := map[string]string{
+		"AZURE_SUBSCRIPTION_ID":      c.SubscriptionID,
+		"AZURE_TENANT_ID":            c.TenantID,
+		"AZURE_CLIENT_ID":            c.ClientID,
+		"AZURE_CLIENT_SECRET":        c.clientSecret,
+		"AZURE_FEDERATED_TOKEN_FILE": c.tokenFile,
+		"AZURE_AUTH_LOCATION":        "",
+	}
+	if c.Method == MethodAzureCLI || c.Method == MethodFake {
+		// Without a client ID the SDK falls back to the CLI.
+		env["AZURE_CLIENT_ID"] = ""
+	}
+	return env
+}
+
+// TokenSource returns Resource Manager tokens for this credential. Tokens
+// are cached until shortly before they expire.
+func (c *Credential) TokenSource() arm.TokenSource {
+	return c.token
+}
+
+// Client returns a Resource Manager client for the credential's
+// subscription.
+func (c *Credential) Client() *arm.Client {
+	return arm.NewClient(c.SubscriptionID, c.token)
+}
+
+// Fake returns a credential for tests that never leave the process. Its
+// client sends no Authorization header, which is what armfake expects, and
+// its terraform environment names the subscription without any way to
+// authenticate.
+func Fake(subscriptionID string) *Credential {
+	return &Credential{
+		Method:         MethodFake,
+		SubscriptionID: subscriptionID,
+		TenantID:       "00000000-0000-0000-0000-000000000000",
+	}
+}
+
+// EnvironmentToken returns a TokenSource for the commands: ARM_ACCESS_TOKEN
+// as is when it is set, otherwise the credentials Resolve finds, resolved
+// on the first request so that a command that never calls Resource
+// Manager never needs them.
+func EnvironmentToken() arm.TokenSource {
+	if token := os.Getenv("ARM_ACCESS_TOKEN"); token != "" {
+		return arm.StaticToken(token)
+	}
+	var (
+		once   sync.Once
+		source arm.TokenSource
+		err    error
+	)
+	return func(ctx context.Context) (string, error) {
+		once.Do(func() {
+			var c *Credential
+			if c, err = Resolve(ctx); err == nil {
+				source = c.TokenSource()
+			}
+		})
+		if err != nil {
+			return "", err
+		}
+		return source(ctx)
+	}
+}
+
+// Resolver resolves credentials. The zero value reads the process
+// environment and runs the Azure CLI.
+type Resolver struct {
+	Getenv func(string) string
+
+	// AzureCLIAccount returns the CLI's logged-in account. It defaults to
+	// running az account show.
+	AzureCLIAccount func(ctx context.Context) (Account, error)
+
+	// AuthorityHost is the Entra ID endpoint for client secret and OIDC
+	// tokens. It defaults to AZURE_AUTHORITY_HOST, then the public cloud.
+	AuthorityHost string
+
+	// IMDSEndpoint is the managed identity token endpoint. It defaults to
+	// the Azure Instance Metadata Service.
+	IMDSEndpoint string
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Account is an Azure CLI account.
+type Account struct {
+	SubscriptionID string `json:"id"`
+	TenantID       string `json:"tenantId"`
+}
+
+// Resolve resolves credentials from the process environment.
+func Resolve(ctx context.Context) (*Credential, error) {
+	return (&Resolver{}).Resolve(ctx)
+}
+
+// Resolve resolves credentials in the documented order.
+func (r *Resolver) Resolve(ctx context.Context) (*Credential, error) {
+	getenv := r.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	first := func(names ...string) string {
+		for _, n := range names {
+			if v := getenv(n); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	c := &Credential{
+		SubscriptionID: first("ARM_SUBSCRIPTION_ID", "AZURE_SUBSCRIPTION_ID"),
+		TenantID:       first("ARM_TENANT_ID", "AZURE_TENANT_ID"),
+		ClientID:       first("ARM_CLIENT_ID", "AZURE_CLIENT_ID"),
+	}
+	if a, b := getenv("ARM_SUBSCRIPTION_ID"), getenv("AZURE_SUBSCRIPTION_ID"); a != "" && b != "" && a != b {
+		return nil, fmt.Errorf("azauth: ARM_SUBSCRIPTION_ID (%s) and AZURE_SUBSCRIPTION_ID (%s) name different subscriptions", a, b)
+	}
+
+	switch {
+	case first("ARM_CLIENT_SECRET", "AZURE_CLIENT_SECRET") != "":
+		c.Method = MethodClientSecret
+		c.clientSecret = first("ARM_CLIENT_SECRET", "AZURE_CLIENT_SECRET")
+		c.token = r.clientCredentials(c, func() (string, error) { return c.clientSecret, nil }, false)
+	case first("ARM_OIDC_TOKEN_FILE_PATH", "AZURE_FEDERATED_TOKEN_FILE") != "":
+		c.Method = MethodOIDC
+		c.tokenFile = first("ARM_OIDC_TOKEN_FILE_PATH", "AZURE_FEDERATED_TOKEN_FILE")
+		// The file is re-read for every token: the platform rotates it.
+		c.token = r.clientCredentials(c, func() (string, error) {
+			data, err := os.ReadFile(c.tokenFile)
+			return string(data), err
+		}, true)
+	case getenv("ARM_USE_MSI") == "true":
+		c.Method = MethodManagedIdentity
+		c.token = r.managedIdentity(c)
+	default:
+		account, err := r.cliAccount(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrNoCredentials, err)
+		}
+		c.Method = MethodAzureCLI
+		if c.SubscriptionID == "" {
+			c.SubscriptionID = account.SubscriptionID
+		}
+		if c.TenantID == "" {
+			c.TenantID = account.TenantID
+		}
+		// The CLI signs in as a user; a client ID in the environment
+		// belongs to no method and would only confuse terraform.
+		c.ClientID = ""
+		c.token = cached(cliToken)
+	}
+
+	if (c.Method == MethodClientSecret || c.Method == MethodOIDC) && (c.ClientID == "" || c.TenantID == "") {
+		return nil, fmt.Errorf("azauth: %s authentication needs ARM_CLIENT_ID and ARM_TENANT_ID", c.Method)
+	}
+	if c.SubscriptionID == "" {
+		return nil, fmt.Errorf("azauth: %s credentials found, but no subscription: set ARM_SUBSCRIPTION_ID", c.Method)
+	}
+	return c, nil
+}
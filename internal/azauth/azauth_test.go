@@ -0,0 +1,189 @@
+package azauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/arm/armfake"
+)
+
+func resolver(vars map[string]string) *Resolver {
+	return &Resolver{
+		Getenv: func(name string) string { return vars[name] },
+		AzureCLIAccount: func(context.Context) (Account, error) {
+			return Account{}, errors.New("az: not logged in")
+		},
+	}
+}
+
+func TestResolveOrder(t *testing.T) {
+	all := map[string]string{
+		"ARM_SUBSCRIPTION_ID":      "sub",
+		"ARM_TENANT_ID":            "tenant",
+		"ARM_CLIENT_ID":            "client",
+		"ARM_CLIENT_SECRET":        "secret",
+		"ARM_OIDC_TOKEN_FILE_PATH": "/var/run/token",
+		"ARM_USE_MSI":              "true",
+	}
+	cli := func(context.Context) (Account, error) {
+		return Account{SubscriptionID: "cli-sub", TenantID: "cli-tenant"}, nil
+	}
+
+	for _, want := range []string{MethodClientSecret, MethodOIDC, MethodManagedIdentity, MethodAzureCLI} {
+		r := resolver(all)
+		r.AzureCLIAccount = cli
+		c, err := r.Resolve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, want, c.Method)
+
+		switch want {
+		case MethodClientSecret:
+			delete(all, "ARM_CLIENT_SECRET")
+		case MethodOIDC:
+			delete(all, "ARM_OIDC_TOKEN_FILE_PATH")
+		case MethodManagedIdentity:
+			delete(all, "ARM_USE_MSI")
+		case MethodAzureCLI:
+			assert.Equal(t, "sub", c.SubscriptionID, "the environment's subscription wins over the CLI default")
+			assert.Equal(t, "tenant", c.TenantID)
+			assert.Empty(t, c.ClientID)
+		}
+	}
+}
+
+func TestResolveAcceptsEitherSubscriptionVariable(t *testing.T) {
+	for _, name := range []string{"ARM_SUBSCRIPTION_ID", "AZURE_SUBSCRIPTION_ID"} {
+		c, err := resolver(map[string]string{name: "sub", "ARM_USE_MSI": "true"}).Resolve(context.Background())
+		require.NoError(t, err, name)
+		assert.Equal(t, "sub", c.SubscriptionID, name)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		vars map[string]string
+		err  string
+	}{
+		{"conflicting subscriptions", map[string]string{"ARM_SUBSCRIPTION_ID": "a", "AZURE_SUBSCRIPTION_ID": "b", "ARM_USE_MSI": "true"}, "name different subscriptions"},
+		{"secret without tenant", map[string]string{"ARM_SUBSCRIPTION_ID": "a", "ARM_CLIENT_ID": "c", "ARM_CLIENT_SECRET": "s"}, "needs ARM_CLIENT_ID and ARM_TENANT_ID"},
+		{"no subscription", map[string]string{"ARM_USE_MSI": "true"}, "no subscription"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := resolver(tc.vars).Resolve(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+			assert.False(t, errors.Is(err, ErrNoCredentials))
+		})
+	}
+
+	_, err := resolver(map[string]string{"ARM_SUBSCRIPTION_ID": "a"}).Resolve(context.Background())
+	assert.True(t, errors.Is(err, ErrNoCredentials))
+}
+
+func TestTerraformEnv(t *testing.T) {
+	c, err := resolver(map[string]string{
+		"AZURE_SUBSCRIPTION_ID":      "sub",
+		"AZURE_TENANT_ID":            "tenant",
+		"AZURE_CLIENT_ID":            "client",
+		"AZURE_FEDERATED_TOKEN_FILE": "/var/run/token",
+	}).Resolve(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"ARM_SUBSCRIPTION_ID":      "sub",
+		"ARM_TENANT_ID":            "tenant",
+		"ARM_CLIENT_ID":            "client",
+		"ARM_CLIENT_SECRET":        "",
+		"ARM_USE_OIDC":             "true",
+		"ARM_OIDC_TOKEN_FILE_PATH": "/var/run/token",
+		"ARM_USE_MSI":              "false",
+		"ARM_USE_CLI":              "false",
+	}, c.TerraformEnv())
+	assert.Equal(t, "OIDC in subscription sub as client", c.String())
+
+	sdk := c.SDKEnv()
+	assert.Equal(t, "client", sdk["AZURE_CLIENT_ID"])
+	assert.Equal(t, "/var/run/token", sdk["AZURE_FEDERATED_TOKEN_FILE"])
+	assert.Empty(t, sdk["AZURE_CLIENT_SECRET"])
+}
+
+func TestOIDCTokenRereadsTheFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	var assertions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tenant/oauth2/v2.0/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client", r.PostForm.Get("client_id"))
+		assert.Equal(t, "https://management.azure.com/.default", r.PostForm.Get("scope"))
+		assertions = append(assertions, r.PostForm.Get("client_assertion"))
+		// Expire at once so the next call fetches again.
+		w.Write([]byte(`{"access_token":"arm-token","expires_in":0}`))
+	}))
+	defer srv.Close()
+
+	r := resolver(map[string]string{
+		"ARM_SUBSCRIPTION_ID":      "sub",
+		"ARM_TENANT_ID":            "tenant",
+		"ARM_CLIENT_ID":            "client",
+		"ARM_OIDC_TOKEN_FILE_PATH": tokenFile,
+	})
+	r.AuthorityHost = srv.URL
+	c, err := r.Resolve(context.Background())
+	require.NoError(t, err)
+
+	for _, jwt := range []string{"first", "second"} {
+		require.NoError(t, os.WriteFile(tokenFile, []byte(jwt+"\n"), 0o600))
+		token, err := c.TokenSource()(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "arm-token", token)
+	}
+	assert.Equal(t, []string{"first", "second"}, assertions)
+}
+
+func TestManagedIdentityTokenIsCached(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		assert.Equal(t, "identity", r.URL.Query().Get("client_id"))
+		w.Write([]byte(`{"access_token":"msi-token","expires_in":"3599"}`))
+	}))
+	defer srv.Close()
+
+	r := resolver(map[string]string{"ARM_SUBSCRIPTION_ID": "sub", "ARM_USE_MSI": "true", "ARM_CLIENT_ID": "identity"})
+	r.IMDSEndpoint = srv.URL
+	c, err := r.Resolve(context.Background())
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		token, err := c.TokenSource()(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token", token)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestFakeWorksWithArmfake(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	srv.AddResourceGroup("rg-demo", "westeurope", nil)
+
+	c := Fake(srv.SubscriptionID)
+	client := c.Client()
+	client.Endpoint = srv.URL
+	groups, err := client.ListResourceGroups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "rg-demo", groups[0].Name)
+	assert.Equal(t, srv.SubscriptionID, c.TerraformEnv()["ARM_SUBSCRIPTION_ID"])
+}
@@ -0,0 +1,197 @@
+package azauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+const (
+	defaultAuthorityHost = "https://login.microsoftonline.com"
+	defaultIMDSEndpoint  = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	// refreshBefore is how long before expiry a cached token is replaced,
+	// so a request never leaves with a token that expires in flight.
+	refreshBefore = 5 * time.Minute
+)
+
+// fetchFunc gets a new token and its expiry.
+type fetchFunc func(ctx context.Context) (string, time.Time, error)
+
+// cached turns fetch into a TokenSource that reuses a token until shortly
+// before it expires. It is safe for concurrent use.
+func cached(fetch fetchFunc) arm.TokenSource {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Until(expires) > refreshBefore {
+			return token, nil
+		}
+		t, exp, err := fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		token, expires = t, exp
+		return token, nil
+	}
+}
+
+// tokenResponse is the token endpoint response shared by Entra ID and
+// IMDS. IMDS sends expires_in as a string, Entra ID as a number.
+type tokenResponse struct {
+	AccessToken string          `json:"access_token"`
+	ExpiresIn   json.RawMessage `json:"expires_in"`
+}
+
+func (t tokenResponse) expiry() time.Time {
+	secs, err := strconv.Atoi(strings.Trim(string(t.ExpiresIn), `"`))
+	if err != nil {
+		return time.Now()
+	}
+	return time.Now().Add(time.Duration(secs) * time.Second)
+}
+
+// clientCredentials returns a TokenSource for the client credentials
+// grant, authenticating with a client secret or, when assertion is set,
+// a federated token.
+func (r *Resolver) clientCredentials(c *Credential, secret func() (string, error), assertion bool) arm.TokenSource {
+	return cached(func(ctx context.Context) (string, time.Time, error) {
+		value, err := secret()
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("azauth: %w", err)
+		}
+		form := url.Values{
+			"grant_type": {"client_credentials"},
+			"client_id":  {c.ClientID},
+			"scope":      {arm.DefaultEndpoint + "/.default"},
+		}
+		if assertion {
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", strings.TrimSpace(value))
+		} else {
+			form.Set("client_secret", value)
+		}
+
+		host := r.AuthorityHost
+		if host == "" {
+			host = os.Getenv("AZURE_AUTHORITY_HOST")
+		}
+		if host == "" {
+			host = defaultAuthorityHost
+		}
+		endpoint := strings.TrimSuffix(host, "/") + "/" + url.PathEscape(c.TenantID) + "/oauth2/v2.0/token"
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r.token(req, c.Method)
+	})
+}
+
+// managedIdentity returns a TokenSource backed by the Instance Metadata
+// Service.
+func (r *Resolver) managedIdentity(c *Credential) arm.TokenSource {
+	return cached(func(ctx context.Context) (string, time.Time, error) {
+		q := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {arm.DefaultEndpoint + "/"},
+		}
+		if c.ClientID != "" {
+			q.Set("client_id", c.ClientID)
+		}
+		endpoint := r.IMDSEndpoint
+		if endpoint == "" {
+			endpoint = defaultIMDSEndpoint
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+q.Encode(), nil)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Metadata", "true")
+		return r.token(req, c.Method)
+	})
+}
+
+// token sends a token request and decodes the response.
+func (r *Resolver) token(req *http.Request, method string) (string, time.Time, error) {
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("azauth: %s token: %w", method, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &e)
+		return "", time.Time{}, fmt.Errorf("azauth: %s token: %s: %s", method, resp.Status, e.Description)
+	}
+	var t tokenResponse
+	if err := json.Unmarshal(body, &t); err != nil || t.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("azauth: %s token: malformed response", method)
+	}
+	return t.AccessToken, t.expiry(), nil
+}
+
+func (r *Resolver) cliAccount(ctx context.Context) (Account, error) {
+	if r.AzureCLIAccount != nil {
+		return r.AzureCLIAccount(ctx)
+	}
+	out, err := exec.CommandContext(ctx, "az", "account", "show", "--output", "json").Output()
+	if err != nil {
+		return Account{}, fmt.Errorf("az account show: %w", err)
+	}
+	var a Account
+	if err := json.Unmarshal(out, &a); err != nil {
+		return Account{}, fmt.Errorf("az account show: %w", err)
+	}
+	return a, nil
+}
+
+// cliToken gets a token from the Azure CLI.
+func cliToken(ctx context.Context) (string, time.Time, error) {
+	out, err := exec.CommandContext(ctx, "az", "account", "get-access-token",
+		"--resource", arm.DefaultEndpoint+"/", "--output", "json").Output()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("azauth: az account get-access-token: %w", err)
+	}
+	var tok struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresOn   int64  `json:"expires_on"`
+	}
+	if err := json.Unmarshal(out, &tok); err != nil {
+		return "", time.Time{}, fmt.Errorf("azauth: parse az token: %w", err)
+	}
+	// Older CLI releases have no expires_on. Their tokens last an hour at
+	// least, so keeping one for ten minutes is safe.
+	exp := time.Unix(tok.ExpiresOn, 0)
+	if tok.ExpiresOn == 0 {
+		exp = time.Now().Add(refreshBefore + 10*time.Minute)
+	}
+	return tok.AccessToken, exp, nil
+}
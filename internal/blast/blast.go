@@ -0,0 +1,235 @@
+// Package blast works out the blast radius of a plan: for every resource
+// the plan changes, which resources, data sources, outputs and modules
+// depend on it, directly or through module inputs and outputs, and what
+// the plan does to each of them.
+//
+// The dependency graph comes from the plan's configuration section, so no
+// state or provider access is needed. Values passed through locals are not
+// described by plan JSON, which means a dependency that only runs through
+// a local is not followed.
+package blast
+
+import (
+	"sort"
+	"strings"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+// Node kinds.
+const (
+	KindResource = "resource"
+	KindData     = "data"
+	KindVariable = "variable"
+	KindOutput   = "output"
+)
+
+// Effects on an affected resource.
+const (
+	EffectReplaced  = "replaced"
+	EffectUpdated   = "updated in place"
+	EffectReread    = "re-read"
+	EffectDeleted   = "deleted"
+	EffectCreated   = "created"
+	EffectUnchanged = "unchanged"
+)
+
+// Graph is the configuration dependency graph. Node names are absolute
+// configuration addresses without instance keys, e.g.
+// module.network.azurerm_subnet.subnet, module.network.var.location or
+// module.network.output.subnet_id.
+type Graph struct {
+	kinds      map[string]string
+	dependents map[string]map[string]bool
+}
+
+// NewGraph builds the graph for a plan's configuration.
+func NewGraph(cfg *plan.Config) *Graph {
+	g := &Graph{kinds: map[string]string{}, dependents: map[string]map[string]bool{}}
+	if cfg == nil {
+		return g
+	}
+	var deferred []explicitDep
+	g.walk("", cfg.RootModule, &deferred)
+
+	// depends_on can name a whole module, and a module call's depends_on
+	// applies to everything inside it, so these are expanded once every
+	// node exists.
+	for _, d := range deferred {
+		for _, node := range g.expand(d.node) {
+			for _, dep := range g.expand(d.dependency) {
+				g.link(node, dep)
+			}
+		}
+	}
+	return g
+}
+
+// explicitDep is a depends_on entry. Either side may be a module path,
+// standing for every node inside that module.
+type explicitDep struct{ node, dependency string }
+
+func (g *Graph) expand(name string) []string {
+	if _, ok := g.kinds[name]; ok {
+		return []string{name}
+	}
+	var out []string
+	for node := range g.kinds {
+		if strings.HasPrefix(node, name+".") {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+func (g *Graph) walk(prefix string, m plan.ConfigModule, deferred *[]explicitDep) {
+	for _, r := range m.Resources {
+		node := prefix + r.Address
+		g.kinds[node] = KindResource
+		if r.Mode == "data" {
+			g.kinds[node] = KindData
+		}
+		for _, ref := range r.References {
+			g.link(node, resolve(prefix, ref))
+		}
+		for _, dep := range r.DependsOn {
+			*deferred = append(*deferred, explicitDep{node: node, dependency: resolveDependsOn(prefix, dep)})
+		}
+	}
+	for name, call := range m.ModuleCalls {
+		child := prefix + "module." + name
+		for input, refs := range call.Inputs {
+			node := child + ".var." + input
+			g.kinds[node] = KindVariable
+			for _, ref := range refs {
+				g.link(node, resolve(prefix, ref))
+			}
+		}
+		for _, dep := range call.DependsOn {
+			*deferred = append(*deferred, explicitDep{node: child, dependency: resolveDependsOn(prefix, dep)})
+		}
+		g.walk(child+".", call.Module, deferred)
+	}
+	for name, out := range m.Outputs {
+		node := prefix + "output." + name
+		g.kinds[node] = KindOutput
+		for _, ref := range out.References {
+			g.link(node, resolve(prefix, ref))
+		}
+	}
+}
+
+// link records that node depends on dependency.
+func (g *Graph) link(node, dependency string) {
+	if dependency == "" || dependency == node {
+		return
+	}
+	if g.dependents[dependency] == nil {
+		g.dependents[dependency] = map[string]bool{}
+	}
+	g.dependents[dependency][node] = true
+}
+
+// resolve turns a reference made inside the module at prefix into a node
+// name, or "" for references the graph does not track.
+func resolve(prefix, ref string) string {
+	parts := strings.Split(stripKeys(ref), ".")
+	switch parts[0] {
+	case "var":
+		if len(parts) >= 2 {
+			return prefix + "var." + parts[1]
+		}
+	case "module":
+		if len(parts) >= 3 {
+			return prefix + "module." + parts[1] + ".output." + parts[2]
+		}
+	case "data":
+		if len(parts) >= 3 {
+			return prefix + "data." + parts[1] + "." + parts[2]
+		}
+	case "local", "path", "terraform", "count", "each", "self":
+	default:
+		if len(parts) >= 2 {
+			return prefix + parts[0] + "." + parts[1]
+		}
+	}
+	return ""
+}
+
+// resolveDependsOn is resolve for depends_on entries, which may name a
+// whole module.
+func resolveDependsOn(prefix, ref string) string {
+	parts := strings.Split(stripKeys(ref), ".")
+	if len(parts) == 2 && parts[0] == "module" {
+		return prefix + strings.Join(parts, ".")
+	}
+	return resolve(prefix, ref)
+}
+
+// stripKeys removes instance keys, so module.apps["web"].azurerm_x.y[0]
+// becomes module.apps.azurerm_x.y.
+func stripKeys(addr string) string {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(addr); i++ {
+		c := addr[i]
+		switch {
+		case quoted:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '"' && depth > 0:
+			quoted = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Dependents returns every node that depends on node, transitively,
+// sorted.
+func (g *Graph) Dependents(node string) []string {
+	seen := map[string]bool{node: true}
+	queue := []string{node}
+	var out []string
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for d := range g.dependents[n] {
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+			out = append(out, d)
+			queue = append(queue, d)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Kind returns the kind of a node, or "" if the graph does not have it.
+func (g *Graph) Kind(node string) string {
+	return g.kinds[node]
+}
+
+// ModulePath returns the module a node belongs to, e.g. "module.network"
+// for module.network.azurerm_subnet.subnet, or "" for the root module.
+func ModulePath(node string) string {
+	parts := strings.Split(node, ".")
+	end := 0
+	for i := 0; i+1 < len(parts); i += 2 {
+		if parts[i] != "module" {
+			break
+		}
+		end = i + 2
+	}
+	return strings.Join(parts[:end], ".")
+}
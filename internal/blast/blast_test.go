@@ -0,0 +1,104 @@
+package blast
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+func loadReport(t *testing.T) (*Report, *plan.Plan) {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	return Analyze(p), p
+}
+
+func impact(t *testing.T, r *Report, address string) Impact {
+	t.Helper()
+	for _, c := range r.Changes {
+		if c.Address == address {
+			return c
+		}
+	}
+	t.Fatalf("no impact for %s", address)
+	return Impact{}
+}
+
+func TestAnalyzeFollowsModuleOutputsAndInputs(t *testing.T) {
+	r, _ := loadReport(t)
+
+	subnet := impact(t, r, "module.network.azurerm_subnet.subnet")
+	assert.Equal(t, EffectUpdated, subnet.Action)
+	// The storage module is affected through depends_on = [module.network].
+	assert.Equal(t, []Affected{
+		{Address: "module.network.azurerm_subnet_network_security_group_association.nsg_association", Kind: KindResource, Effect: EffectReplaced},
+		{Address: "module.storage.azurerm_storage_container.container", Kind: KindResource, Effect: EffectDeleted},
+		{Address: "module.keyvault.azurerm_key_vault.key_vault", Kind: KindResource, Effect: EffectUpdated},
+		{Address: "module.storage.azurerm_storage_account.storage", Kind: KindResource, Effect: EffectUnchanged},
+	}, subnet.Resources)
+	assert.Equal(t, []string{"module.network.output.subnet_id", "output.subnet_id"}, subnet.Outputs)
+	assert.Equal(t, []string{"module.keyvault", "module.storage"}, subnet.Modules)
+}
+
+func TestAnalyzeGroupsInstances(t *testing.T) {
+	r, _ := loadReport(t)
+
+	var addresses []string
+	for _, c := range r.Changes {
+		addresses = append(addresses, c.Address)
+	}
+	assert.Equal(t, []string{
+		"module.keyvault.azurerm_key_vault.key_vault",
+		"module.network.azurerm_subnet.subnet",
+		"module.network.azurerm_subnet_network_security_group_association.nsg_association",
+		"module.storage.azurerm_storage_container.container",
+	}, addresses, "no-ops and reads are not changes; instances share one entry")
+
+	container := impact(t, r, "module.storage.azurerm_storage_container.container")
+	assert.Equal(t, EffectDeleted, container.Action)
+	assert.Empty(t, container.Resources)
+}
+
+func TestGraphModuleDependsOn(t *testing.T) {
+	_, p := loadReport(t)
+	g := NewGraph(p.Config)
+
+	// module "storage" has depends_on = [module.network], so everything in
+	// it depends on everything in the network module.
+	deps := g.Dependents("module.network.azurerm_network_security_group.nsg")
+	assert.Contains(t, deps, "module.storage.azurerm_storage_account.storage")
+	assert.Contains(t, deps, "module.storage.azurerm_storage_container.container")
+}
+
+func TestGraphRereadDataSources(t *testing.T) {
+	_, p := loadReport(t)
+	g := NewGraph(p.Config)
+
+	assert.Equal(t, KindData, g.Kind("module.network.data.azurerm_resource_group.rg"))
+	assert.Contains(t, g.Dependents("azurerm_resource_group.rg"), "module.network.data.azurerm_resource_group.rg")
+	assert.Contains(t, g.Dependents("azurerm_resource_group.rg"), "output.resource_group_name")
+}
+
+func TestStripKeysAndModulePath(t *testing.T) {
+	assert.Equal(t, "module.apps.azurerm_linux_web_app.app", stripKeys(`module.apps["a.b]"].azurerm_linux_web_app.app[0]`))
+	assert.Equal(t, "module.network", ModulePath("module.network.azurerm_subnet.subnet"))
+	assert.Equal(t, "module.a.module.b", ModulePath("module.a.module.b.output.x"))
+	assert.Equal(t, "", ModulePath("azurerm_resource_group.rg"))
+}
+
+func TestWriteText(t *testing.T) {
+	r, _ := loadReport(t)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteText(&out, r.Filter("module.network")))
+	s := out.String()
+	assert.Contains(t, s, "module.network.azurerm_subnet.subnet (updated in place)\n")
+	assert.Regexp(t, `  replaced +module\.network\.azurerm_subnet_network_security_group_association\.nsg_association\n`, s)
+	assert.Regexp(t, `  output +output\.subnet_id\n`, s)
+	assert.Regexp(t, `  modules +module\.keyvault, module\.storage\n`, s)
+	assert.NotContains(t, s, "(deleted)", "changes outside module.network are filtered out")
+}
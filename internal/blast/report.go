@@ -0,0 +1,166 @@
+package blast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+// Report is the blast radius of every change in a plan.
+type Report struct {
+	Changes []Impact `json:"changes"`
+}
+
+// Impact is one changed resource and everything downstream of it.
+type Impact struct {
+	Address string `json:"address"`
+	Action  string `json:"action"`
+
+	Resources []Affected `json:"resources"`
+	Outputs   []string   `json:"outputs"`
+	Modules   []string   `json:"modules"`
+}
+
+// Affected is a resource or data source that depends on a change.
+type Affected struct {
+	Address string `json:"address"`
+	Kind    string `json:"kind"`
+	Effect  string `json:"effect"`
+}
+
+// severity orders plan actions, most disruptive first.
+var severity = map[string]int{
+	EffectReplaced:  0,
+	EffectDeleted:   1,
+	EffectUpdated:   2,
+	EffectCreated:   3,
+	EffectReread:    4,
+	EffectUnchanged: 5,
+}
+
+func effectOf(a plan.Actions) string {
+	switch {
+	case a.Replace():
+		return EffectReplaced
+	case a.Delete():
+		return EffectDeleted
+	case a.Update():
+		return EffectUpdated
+	case a.Create():
+		return EffectCreated
+	case a.Read():
+		return EffectReread
+	}
+	return EffectUnchanged
+}
+
+// Analyze reports, for each resource p changes, the transitive set of
+// resources, outputs and modules that depend on it. Instances of one
+// resource block are reported together under their configuration address,
+// with the most disruptive action among them.
+func Analyze(p *plan.Plan) *Report {
+	g := NewGraph(p.Config)
+
+	effects := map[string]string{}
+	managed := map[string]bool{}
+	for _, rc := range p.ResourceChanges {
+		addr := stripKeys(rc.Address)
+		managed[addr] = rc.Managed()
+		e := effectOf(rc.Actions)
+		if cur, ok := effects[addr]; !ok || severity[e] < severity[cur] {
+			effects[addr] = e
+		}
+	}
+
+	var changed []string
+	for addr, e := range effects {
+		if managed[addr] && e != EffectUnchanged && e != EffectReread {
+			changed = append(changed, addr)
+		}
+	}
+	sort.Strings(changed)
+
+	r := &Report{Changes: []Impact{}}
+	for _, addr := range changed {
+		imp := Impact{Address: addr, Action: effects[addr], Resources: []Affected{}, Outputs: []string{}, Modules: []string{}}
+		modules := map[string]bool{}
+		for _, node := range g.Dependents(addr) {
+			kind := g.Kind(node)
+			switch kind {
+			case KindResource, KindData:
+				effect, ok := effects[node]
+				if !ok {
+					effect = EffectUnchanged
+				}
+				imp.Resources = append(imp.Resources, Affected{Address: node, Kind: kind, Effect: effect})
+			case KindOutput:
+				imp.Outputs = append(imp.Outputs, node)
+			}
+			if m := ModulePath(node); m != "" && m != ModulePath(addr) {
+				modules[m] = true
+			}
+		}
+		for m := range modules {
+			imp.Modules = append(imp.Modules, m)
+		}
+		sort.Strings(imp.Modules)
+		sort.SliceStable(imp.Resources, func(i, j int) bool {
+			return severity[imp.Resources[i].Effect] < severity[imp.Resources[j].Effect]
+		})
+		r.Changes = append(r.Changes, imp)
+	}
+	return r
+}
+
+// Filter keeps the changes whose address starts with prefix, e.g.
+// "module.network".
+func (r *Report) Filter(prefix string) *Report {
+	out := &Report{Changes: []Impact{}}
+	for _, c := range r.Changes {
+		if c.Address == prefix || strings.HasPrefix(c.Address, prefix+".") {
+			out.Changes = append(out.Changes, c)
+		}
+	}
+	return out
+}
+
+// WriteText writes the report for a terminal.
+func WriteText(w io.Writer, r *Report) error {
+	if len(r.Changes) == 0 {
+		_, err := fmt.Fprintln(w, "No resource changes.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, c := range r.Changes {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%s)\n", c.Address, c.Action)
+		if len(c.Resources) == 0 && len(c.Outputs) == 0 {
+			fmt.Fprintln(tw, "  nothing depends on it")
+			continue
+		}
+		for _, a := range c.Resources {
+			fmt.Fprintf(tw, "  %s\t%s\n", a.Effect, a.Address)
+		}
+		for _, o := range c.Outputs {
+			fmt.Fprintf(tw, "  output\t%s\n", o)
+		}
+		if len(c.Modules) > 0 {
+			fmt.Fprintf(tw, "  modules\t%s\n", strings.Join(c.Modules, ", "))
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON.
+func WriteJSON(w io.Writer, r *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
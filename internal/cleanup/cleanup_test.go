@@ -0,0 +1,207 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/safety"
+)
+
+const deployedState = `{"version": 4, "resources": [
+  {"mode": "data", "type": "azurerm_client_config", "name": "current", "instances": [{"attributes": {"id": "x"}}]},
+  {"mode": "managed", "type": "azurerm_resource_group", "name": "main", "instances": [{"attributes": {"id": "/subscriptions/s/resourceGroups/rg-perf-abc"}}]}
+]}`
+
+const dataOnlyState = `{"version": 4, "resources": [
+  {"mode": "data", "type": "azurerm_client_config", "name": "current", "instances": [{"attributes": {"id": "x"}}]}
+]}`
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+}
+
+func TestJournalLifecycle(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), "journal"))
+	require.NoError(t, err)
+	clock := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	j.Now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	second, err := j.Add(Entry{Test: "TestScalability/large", Dir: "/tmp/b"})
+	require.NoError(t, err)
+	first := Entry{Test: "TestPerformanceBenchmarks", Dir: "/tmp/a",
+		Vars: map[string]interface{}{"resource_group_name": "rg-perf-abc", "location": "westeurope", "tags": map[string]interface{}{"a": "b"}}}
+	j.Now = func() time.Time { return time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC) }
+	first, err = j.Add(first)
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^TestScalability_large-\d+-\d+$`, second.ID)
+	assert.Equal(t, os.Getpid(), first.PID)
+	assert.True(t, j.Has(first.ID))
+
+	entries, err := j.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, first.ID, entries[0].ID, "oldest first")
+	assert.Equal(t, []string{"rg-perf-abc"}, entries[0].ResourceGroups())
+
+	second.Vars = map[string]interface{}{"key_vault_name": "kv-renamed"}
+	require.NoError(t, j.Update(second))
+	entries, err = j.List()
+	require.NoError(t, err)
+	assert.Equal(t, "kv-renamed", entries[1].Vars["key_vault_name"])
+
+	require.NoError(t, j.Remove(first.ID))
+	require.NoError(t, j.Remove(first.ID), "removing twice is fine")
+	assert.False(t, j.Has(first.ID))
+	entries, err = j.List()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestPreserveKeepsStateOutOfTheTempDir(t *testing.T) {
+	j, err := Open(t.TempDir())
+	require.NoError(t, err)
+	root := t.TempDir()
+	dir := filepath.Join(root, "test/fixtures/resource-group")
+	write(t, filepath.Join(dir, "main.tf"), "# module\n")
+	write(t, filepath.Join(dir, "terraform.tfstate"), deployedState)
+	write(t, filepath.Join(dir, ".terraform/providers/huge"), "binary")
+	write(t, filepath.Join(root, "modules/naming/main.tf"), "# called module\n")
+
+	e, err := j.Add(Entry{Test: "TestX", Dir: dir, State: filepath.Join(dir, "terraform.tfstate"),
+		VarFiles: []string{filepath.Join(dir, "test.tfvars"), "/etc/elsewhere.tfvars"}})
+	require.NoError(t, err)
+	e, err = j.Preserve(e, root)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(j.Dir, e.ID, "test/fixtures/resource-group"), e.Dir)
+	assert.FileExists(t, e.State)
+	assert.FileExists(t, filepath.Join(j.Dir, e.ID, "modules/naming/main.tf"))
+	assert.NoDirExists(t, filepath.Join(e.Dir, ".terraform"))
+	assert.Equal(t, []string{filepath.Join(e.Dir, "test.tfvars"), "/etc/elsewhere.tfvars"}, e.VarFiles)
+
+	entries, err := j.List()
+	require.NoError(t, err)
+	assert.Equal(t, e.Dir, entries[0].Dir, "the entry on disk points at the copy")
+
+	require.NoError(t, j.Remove(e.ID))
+	assert.NoDirExists(t, filepath.Join(j.Dir, e.ID))
+
+	_, err = j.Preserve(Entry{ID: "x", Dir: "/elsewhere"}, root)
+	assert.ErrorContains(t, err, "is not below")
+}
+
+func TestResume(t *testing.T) {
+	j, err := Open(t.TempDir())
+	require.NoError(t, err)
+	work := t.TempDir()
+	add := func(test, state string) Entry {
+		dir := filepath.Join(work, test)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		e := Entry{Test: test, Dir: dir, State: filepath.Join(dir, "terraform.tfstate")}
+		if state != "" {
+			write(t, e.State, state)
+		}
+		e, err := j.Add(e)
+		require.NoError(t, err)
+		return e
+	}
+	deployed := add("deployed", deployedState)
+	add("never-applied", "")
+	add("data-only", dataOnlyState)
+	broken := add("broken", deployedState)
+	lost, err := j.Add(Entry{Test: "lost", Dir: filepath.Join(work, "gone"), Vars: map[string]interface{}{"resource_group_name": "rg-limits-x"}})
+	require.NoError(t, err)
+	remote, err := j.Add(Entry{Test: "remote", Dir: work, BackendConfig: map[string]interface{}{"key": "test.tfstate"}})
+	require.NoError(t, err)
+	for _, e := range []Entry{
+		{Test: "prod-subscription", Dir: work, Vars: map[string]interface{}{"subscription_id": "FFBF501F-F220-4B59-8D0A-5068D961CC5F"}},
+		{Test: "prod-env", Dir: work, Env: map[string]string{"ARM_SUBSCRIPTION_ID": "ffbf501f-f220-4b59-8d0a-5068d961cc5f"}},
+		{Test: "prod-group", Dir: work, Vars: map[string]interface{}{"resource_group_name": "rg-app-prod"}},
+		{Test: "prod-backend", Dir: work, BackendConfig: map[string]interface{}{"key": "prod.terraform.tfstate"}},
+	} {
+		_, err := j.Add(e)
+		require.NoError(t, err)
+	}
+	denylist := &safety.Denylist{
+		Subscriptions:  []string{"ffbf501f-f220-4b59-8d0a-5068d961cc5f"},
+		BackendKeys:    []string{"*prod*"},
+		ResourceGroups: []string{"*-prod"},
+	}
+	running, err := j.Add(Entry{Test: "running", Dir: work})
+	require.NoError(t, err)
+	running.PID = os.Getppid()
+	require.NoError(t, j.Update(running))
+
+	var destroyed []string
+	destroy := func(_ context.Context, e Entry) error {
+		if e.ID == broken.ID {
+			return errors.New("terraform destroy: exit status 1")
+		}
+		destroyed = append(destroyed, e.Test)
+		return nil
+	}
+
+	var log bytes.Buffer
+	dry := &Resumer{Journal: j, DryRun: true, Denylist: denylist, Destroy: destroy, Log: &log}
+	results, err := dry.Resume(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, destroyed)
+	outcomes := map[string]string{}
+	for _, r := range results {
+		outcomes[r.Entry.Test] = r.Outcome
+	}
+	assert.Equal(t, map[string]string{
+		"deployed": OutcomePending, "never-applied": OutcomeEmpty, "data-only": OutcomeEmpty,
+		"broken": OutcomePending, "lost": OutcomeLost, "remote": OutcomePending,
+		"prod-subscription": OutcomeRefused, "prod-env": OutcomeRefused,
+		"prod-group": OutcomeRefused, "prod-backend": OutcomeRefused,
+	}, outcomes)
+	assert.Contains(t, log.String(), "is still running; skipped")
+	entries, _ := j.List()
+	assert.Len(t, entries, 11, "a dry run removes nothing")
+
+	results, err = (&Resumer{Journal: j, Denylist: denylist, Destroy: destroy}).Resume(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deployed", "remote"}, destroyed)
+	entries, err = j.List()
+	require.NoError(t, err)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.ID)
+	}
+	assert.Len(t, left, 7, "refused entries are kept")
+	assert.Subset(t, left, []string{broken.ID, lost.ID, running.ID})
+	assert.False(t, j.Has(deployed.ID))
+	assert.False(t, j.Has(remote.ID))
+
+	var out bytes.Buffer
+	require.NoError(t, WriteText(&out, results))
+	assert.Contains(t, out.String(), "rg-limits-x")
+	assert.Contains(t, out.String(), "terraform destroy: exit status 1")
+	assert.Contains(t, out.String(), `resource group "rg-app-prod" matches "*-prod"`)
+	out.Reset()
+	require.NoError(t, WriteJSON(&out, nil))
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestSafeEnv(t *testing.T) {
+	assert.Equal(t, map[string]string{"ARM_SUBSCRIPTION_ID": "s", "TF_PLUGIN_CACHE_DIR": "/c"}, SafeEnv(map[string]string{
+		"ARM_SUBSCRIPTION_ID":      "s",
+		"ARM_CLIENT_SECRET":        "x",
+		"ARM_OIDC_TOKEN_FILE_PATH": "/t",
+		"ARM_ACCESS_KEY":           "k",
+		"TF_PLUGIN_CACHE_DIR":      "/c",
+	}))
+	assert.Nil(t, SafeEnv(nil))
+}
@@ -0,0 +1,235 @@
+// Package cleanup keeps a journal of test deployments that may still
+// exist, so they can be destroyed after the test run that created them
+// died.
+//
+// A test that go test kills, on its -timeout or on Ctrl-C, never runs
+// its deferred destroy, and the resource groups it created leak. The
+// harness therefore adds a journal entry before each apply, recording
+// the working directory, the variables and where the state is, and
+// removes it once destroy succeeds. Whatever is left in the journal
+// afterwards was deployed and not destroyed; Resume destroys it.
+package cleanup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is one deployment that has not been destroyed yet.
+type Entry struct {
+	ID   string `json:"id"`
+	Test string `json:"test"`
+
+	// Source is the terraform directory the test named, Dir the working
+	// copy terraform ran in.
+	Source string `json:"source"`
+	Dir    string `json:"dir"`
+
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+	VarFiles []string               `json:"var_files,omitempty"`
+
+	// State is the local state file, or empty when BackendConfig names
+	// a remote backend.
+	State         string                 `json:"state,omitempty"`
+	BackendConfig map[string]interface{} `json:"backend_config,omitempty"`
+
+	// Env is the environment terraform ran with, without credentials.
+	Env map[string]string `json:"env,omitempty"`
+
+	// Binary is the terraform executable the test used, if it chose one.
+	Binary string `json:"binary,omitempty"`
+
+	Created time.Time `json:"created"`
+	PID     int       `json:"pid"`
+}
+
+// ResourceGroups returns the values of the entry's vars that name
+// resource groups, for cleaning up by hand what Resume cannot.
+func (e Entry) ResourceGroups() []string {
+	var groups []string
+	for name, v := range e.Vars {
+		if s, ok := v.(string); ok && s != "" && strings.Contains(name, "resource_group") {
+			groups = append(groups, s)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// secretEnv matches environment variables an entry must not record.
+// Resume runs with the credentials of whoever runs it.
+var secretEnv = regexp.MustCompile(`(?i)SECRET|TOKEN|PASSWORD|KEY`)
+
+// SafeEnv returns env without its credentials.
+func SafeEnv(env map[string]string) map[string]string {
+	out := map[string]string{}
+	for name, value := range env {
+		if !secretEnv.MatchString(name) {
+			out[name] = value
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Journal is a directory holding one JSON file per entry. Each file is
+// written to a temporary name, synced and renamed into place, so a run
+// killed mid-write leaves either the whole entry or none of it.
+type Journal struct {
+	Dir string
+
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Open returns the journal in dir, creating the directory.
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cleanup: %w", err)
+	}
+	return &Journal{Dir: dir}, nil
+}
+
+var unsafeID = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Add writes a new entry, filling in its ID, creation time and process,
+// and returns it.
+func (j *Journal) Add(e Entry) (Entry, error) {
+	now := time.Now
+	if j.Now != nil {
+		now = j.Now
+	}
+	e.Created = now().UTC()
+	e.PID = os.Getpid()
+	e.ID = fmt.Sprintf("%s-%d-%d", strings.Trim(unsafeID.ReplaceAllString(e.Test, "_"), "_"), e.PID, e.Created.UnixNano())
+	return e, j.Update(e)
+}
+
+// Update rewrites an existing entry.
+func (j *Journal) Update(e Entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(j.Dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("cleanup: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), j.file(e.ID))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("cleanup: writing entry %s: %w", e.ID, err)
+	}
+	return nil
+}
+
+// Remove deletes an entry and any working directory Preserve kept for it.
+func (j *Journal) Remove(id string) error {
+	if err := os.Remove(j.file(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cleanup: %w", err)
+	}
+	return os.RemoveAll(j.preserved(id))
+}
+
+// Has reports whether the journal still holds an entry.
+func (j *Journal) Has(id string) bool {
+	_, err := os.Stat(j.file(id))
+	return err == nil
+}
+
+// List returns the journal's entries, oldest first.
+func (j *Journal) List() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(j.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cleanup: %w", err)
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("cleanup: %s: %w", file, err)
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Created.Before(entries[b].Created) })
+	return entries, nil
+}
+
+// Preserve copies the working copy rooted at root, which contains e.Dir,
+// into the journal and points the entry at the copy. The test harness
+// calls it when a test ends without destroying, before the test's
+// temporary directory and the state in it are removed. Provider plugins
+// in .terraform are left behind; Resume runs init again.
+func (j *Journal) Preserve(e Entry, root string) (Entry, error) {
+	rel, err := filepath.Rel(root, e.Dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return e, fmt.Errorf("cleanup: %s is not below %s", e.Dir, root)
+	}
+	dest := j.preserved(e.ID)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		r, _ := filepath.Rel(root, path)
+		target := filepath.Join(dest, r)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0o644)
+	})
+	if err != nil {
+		return e, fmt.Errorf("cleanup: preserving %s: %w", e.Dir, err)
+	}
+
+	moved := func(path string) string {
+		if r, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(r, "..") {
+			return filepath.Join(dest, r)
+		}
+		return path
+	}
+	if e.State != "" {
+		e.State = moved(e.State)
+	}
+	varFiles := make([]string, len(e.VarFiles))
+	for i, f := range e.VarFiles {
+		varFiles[i] = moved(f)
+	}
+	e.VarFiles = varFiles
+	e.Dir = filepath.Join(dest, rel)
+	return e, j.Update(e)
+}
+
+func (j *Journal) file(id string) string      { return filepath.Join(j.Dir, id+".json") }
+func (j *Journal) preserved(id string) string { return filepath.Join(j.Dir, id) }
@@ -0,0 +1,14 @@
+//go:build unix
+
+package cleanup
+
+import "syscall"
+
+// processRunning reports whether a process with the given ID exists.
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
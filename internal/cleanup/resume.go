@@ -0,0 +1,280 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"terraform-advanced-course/internal/safety"
+	"terraform-advanced-course/internal/tfrun"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// Outcomes of resuming one entry.
+const (
+	// OutcomeDestroyed: destroy succeeded and the entry was removed.
+	OutcomeDestroyed = "destroyed"
+
+	// OutcomeEmpty: the state manages no resources, so the apply never
+	// got to create any; the entry was removed.
+	OutcomeEmpty = "nothing to destroy"
+
+	// OutcomeLost: the working directory or local state is gone, so
+	// terraform cannot destroy what the entry deployed. The entry is
+	// kept; its resource groups have to be removed another way.
+	OutcomeLost = "state lost"
+
+	// OutcomeRefused: the entry matches the production denylist, so it
+	// was not destroyed. The entry is kept for a person to look at;
+	// resuming again will refuse it again.
+	OutcomeRefused = "kept: production"
+
+	// OutcomeFailed: destroy failed; the entry is kept to try again.
+	OutcomeFailed = "failed"
+
+	// OutcomePending: a dry run would destroy the entry.
+	OutcomePending = "would destroy"
+)
+
+// Result is what resuming one entry did.
+type Result struct {
+	Entry   Entry  `json:"entry"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Resumer destroys what a journal's entries deployed.
+type Resumer struct {
+	Journal *Journal
+
+	// Binary is the terraform executable for entries that do not name
+	// one. Defaults to "terraform".
+	Binary string
+
+	// DryRun reports what would be destroyed without destroying it.
+	DryRun bool
+
+	// Denylist, if set, is checked against each entry's subscriptions,
+	// workspace, resource groups and backend key before it is destroyed,
+	// as the harness checks them before it applies.
+	Denylist *safety.Denylist
+
+	// Destroy destroys one entry's deployment. Nil runs terraform init
+	// and destroy in the entry's directory.
+	Destroy func(ctx context.Context, e Entry) error
+
+	// Log receives progress lines. Nil discards them.
+	Log io.Writer
+}
+
+// Resume works through every entry in the journal, oldest first, and
+// returns what happened to each. Entries of a process that is still
+// running are skipped: its tests may still destroy them.
+func (r *Resumer) Resume(ctx context.Context) ([]Result, error) {
+	entries, err := r.Journal.List()
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, e := range entries {
+		if e.PID != os.Getpid() && processRunning(e.PID) {
+			r.logf("%s: process %d is still running; skipped", e.ID, e.PID)
+			continue
+		}
+		res := r.resume(ctx, e)
+		r.logf("%s: %s", e.ID, res.Outcome)
+		results = append(results, res)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func (r *Resumer) resume(ctx context.Context, e Entry) Result {
+	res := Result{Entry: e}
+	if r.Denylist != nil {
+		if err := r.Denylist.Check(e.safetyTarget()); err != nil {
+			res.Outcome, res.Error = OutcomeRefused, err.Error()
+			return res
+		}
+	}
+	if _, err := os.Stat(e.Dir); err != nil {
+		res.Outcome, res.Error = OutcomeLost, err.Error()
+		return res
+	}
+	if e.State != "" {
+		st, err := tfstate.Load(e.State)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// Terraform writes no state until the first resource exists.
+			res.Outcome = OutcomeEmpty
+		case err != nil:
+			res.Outcome, res.Error = OutcomeLost, err.Error()
+			return res
+		case !managesAnything(st):
+			res.Outcome = OutcomeEmpty
+		}
+		if res.Outcome == OutcomeEmpty {
+			if !r.DryRun {
+				if err := r.Journal.Remove(e.ID); err != nil {
+					res.Outcome, res.Error = OutcomeFailed, err.Error()
+				}
+			}
+			return res
+		}
+	}
+
+	if r.DryRun {
+		res.Outcome = OutcomePending
+		return res
+	}
+	destroy := r.Destroy
+	if destroy == nil {
+		destroy = r.terraformDestroy
+	}
+	if err := destroy(ctx, e); err != nil {
+		res.Outcome, res.Error = OutcomeFailed, err.Error()
+		return res
+	}
+	res.Outcome = OutcomeDestroyed
+	if err := r.Journal.Remove(e.ID); err != nil {
+		res.Outcome, res.Error = OutcomeFailed, err.Error()
+	}
+	return res
+}
+
+// safetyTarget is what destroying e would touch: the subscriptions in its
+// vars, its environment and the environment destroy runs in, its
+// workspace, its resource groups and its backend key.
+func (e Entry) safetyTarget() safety.Target {
+	var target safety.Target
+	if v, ok := e.Vars["subscription_id"].(string); ok {
+		target.Subscriptions = append(target.Subscriptions, v)
+	}
+	target.Subscriptions = append(target.Subscriptions,
+		e.Env["ARM_SUBSCRIPTION_ID"],
+		os.Getenv("ARM_SUBSCRIPTION_ID"),
+		os.Getenv("AZURE_SUBSCRIPTION_ID"))
+
+	workspace := e.Env["TF_WORKSPACE"]
+	if workspace == "" {
+		workspace = os.Getenv("TF_WORKSPACE")
+	}
+	if workspace == "" {
+		workspace = "default"
+	}
+	target.Workspaces = []string{workspace}
+
+	target.ResourceGroups = e.ResourceGroups()
+	if key, ok := e.BackendConfig["key"].(string); ok {
+		target.BackendKeys = append(target.BackendKeys, key)
+	}
+	return target
+}
+
+func managesAnything(st *tfstate.State) bool {
+	for _, r := range st.Resources {
+		if r.Managed() {
+			return true
+		}
+	}
+	return false
+}
+
+// terraformDestroy runs init and destroy as the test would have, with
+// the entry's vars in a var file next to the working directory.
+func (r *Resumer) terraformDestroy(ctx context.Context, e Entry) error {
+	binary := e.Binary
+	if binary == "" {
+		binary = r.Binary
+	}
+	runner := &tfrun.Runner{Binary: binary, Dir: e.Dir, Stderr: r.Log}
+	for name, value := range e.Env {
+		runner.Env = append(runner.Env, name+"="+value)
+	}
+	sort.Strings(runner.Env)
+
+	initArgs := []string{"-reconfigure"}
+	if len(e.BackendConfig) > 0 {
+		if err := os.Remove(filepath.Join(e.Dir, safety.OverrideFile)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for k, v := range e.BackendConfig {
+			initArgs = append(initArgs, fmt.Sprintf("-backend-config=%s=%v", k, v))
+		}
+	} else if _, err := safety.OverrideBackend(e.Dir); err != nil {
+		// The override is left in place: the directory belongs to the
+		// journal, and a later attempt needs it too.
+		return err
+	}
+	if err := runner.Init(ctx, initArgs...); err != nil {
+		return err
+	}
+
+	var destroyArgs []string
+	for _, f := range e.VarFiles {
+		destroyArgs = append(destroyArgs, "-var-file="+f)
+	}
+	if len(e.Vars) > 0 {
+		varFile := filepath.Join(e.Dir, "zz_cleanup_resume.tfvars.json")
+		data, err := json.Marshal(e.Vars)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(varFile, data, 0o644); err != nil {
+			return err
+		}
+		defer os.Remove(varFile)
+		destroyArgs = append(destroyArgs, "-var-file="+varFile)
+	}
+	return runner.Destroy(ctx, destroyArgs...)
+}
+
+func (r *Resumer) logf(format string, args ...interface{}) {
+	if r.Log != nil {
+		fmt.Fprintf(r.Log, format+"\n", args...)
+	}
+}
+
+// WriteText writes a line per result and, for entries whose state was
+// lost, the resource groups to remove by hand.
+func WriteText(w io.Writer, results []Result) error {
+	if len(results) == 0 {
+		_, err := fmt.Fprintln(w, "The cleanup journal is empty.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEST\tOUTCOME\tRESOURCE GROUPS\tDIR")
+	for _, res := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Entry.Test, res.Outcome,
+			strings.Join(res.Entry.ResourceGroups(), ","), res.Entry.Dir)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			fmt.Fprintf(w, "\n%s (%s): %s\n", res.Entry.ID, res.Outcome, res.Error)
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the results as a JSON array.
+func WriteJSON(w io.Writer, results []Result) error {
+	if results == nil {
+		results = []Result{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,137 @@
+package cost
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+)
+
+// Budget caps the projected monthly cost of everything a test run deploys.
+// It is safe for concurrent use by parallel tests.
+type Budget struct {
+	// Limit is the monthly ceiling for the whole run. Zero or less means
+	// no limit; reservations are still recorded for the summary.
+	Limit float64
+
+	// Currency labels the summary. Defaults to the first estimate's currency.
+	Currency string
+
+	mu      sync.Mutex
+	total   float64
+	entries []BudgetEntry
+}
+
+// BudgetEntry is one reservation attempt.
+type BudgetEntry struct {
+	Name    string
+	Monthly float64
+	Refused bool
+
+	// Released is set when the reservation was given back because the
+	// scenario deployed nothing after all.
+	Released bool
+}
+
+// OverBudgetError is returned by Reserve when a scenario would take the run
+// past its limit.
+type OverBudgetError struct {
+	Name      string
+	Monthly   float64
+	Committed float64
+	Limit     float64
+	Currency  string
+}
+
+func (e *OverBudgetError) Error() string {
+	return fmt.Sprintf("%s: projected %.2f %s/month would bring the run to %.2f, over the %.2f budget",
+		e.Name, e.Monthly, e.Currency, e.Committed+e.Monthly, e.Limit)
+}
+
+// Reserve adds a scenario's estimate to the run total, or refuses it with an
+// *OverBudgetError if that would exceed the limit. Refused scenarios are
+// recorded but do not count towards the total.
+func (b *Budget) Reserve(name string, est *Estimate) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Currency == "" {
+		b.Currency = est.Currency
+	}
+	if b.Limit > 0 && b.total+est.Total > b.Limit {
+		b.entries = append(b.entries, BudgetEntry{Name: name, Monthly: est.Total, Refused: true})
+		return &OverBudgetError{
+			Name:      name,
+			Monthly:   est.Total,
+			Committed: b.total,
+			Limit:     b.Limit,
+			Currency:  b.Currency,
+		}
+	}
+	b.total += est.Total
+	b.entries = append(b.entries, BudgetEntry{Name: name, Monthly: est.Total})
+	return nil
+}
+
+// Release gives back name's latest reservation, for a scenario whose
+// apply failed before it created anything. The entry stays in the summary
+// but no longer counts towards the total. Releasing a name with no
+// reservation does nothing.
+func (b *Budget) Release(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		e := &b.entries[i]
+		if e.Name != name || e.Refused || e.Released {
+			continue
+		}
+		e.Released = true
+		b.total -= e.Monthly
+		return
+	}
+}
+
+// Total returns the projected monthly cost committed so far.
+func (b *Budget) Total() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// Entries returns the reservations in the order they were made.
+func (b *Budget) Entries() []BudgetEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]BudgetEntry(nil), b.entries...)
+}
+
+// WriteSummary writes the projected cost per scenario and the run total.
+// Nothing is written if no scenario was priced.
+func (b *Budget) WriteSummary(w io.Writer) error {
+	entries := b.Entries()
+	if len(entries) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	currency, total, limit := b.Currency, b.total, b.Limit
+	b.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\n=== Projected cost (%s/month) ===\n", currency)
+	for _, e := range entries {
+		status := ""
+		switch {
+		case e.Refused:
+			status = "REFUSED: over budget"
+		case e.Released:
+			status = "released: nothing deployed"
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\n", e.Name, e.Monthly, status)
+	}
+	if limit > 0 {
+		fmt.Fprintf(tw, "Run total\t%.2f\tbudget %.2f\n", total, limit)
+	} else {
+		fmt.Fprintf(tw, "Run total\t%.2f\tno budget set\n", total)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,136 @@
+// Package cost prices Terraform plans from a local, versioned price catalog.
+//
+// Prices are looked up by resource type, region, SKU and replication type,
+// so the estimate follows the same inputs that change the Azure bill:
+// azurerm_service_plan sku_name, azurerm_storage_account account_tier plus
+// account_replication_type, and azurerm_key_vault sku_name. The catalog is a
+// plain JSON file checked into the repo; the copy in this package is
+// embedded as the default and can be overridden per run.
+package cost
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//go:embed catalog.json
+var defaultCatalog []byte
+
+// AnyRegion is the region key of fallback prices.
+const AnyRegion = "*"
+
+// Catalog is a price list.
+type Catalog struct {
+	Version     string `json:"version"`
+	Currency    string `json:"currency"`
+	Description string `json:"description,omitempty"`
+
+	// FreeResourceTypes have no charge of their own, either because Azure
+	// does not bill them or because the cost is carried by another
+	// resource (a web app is billed through its service plan).
+	FreeResourceTypes []string `json:"free_resource_types"`
+
+	Prices []Price `json:"prices"`
+
+	index map[Key]Price
+	free  map[string]bool
+}
+
+// Price is one catalog entry.
+type Price struct {
+	Key
+	Monthly float64 `json:"monthly"`
+}
+
+// Key identifies a price. Replication is only set for storage accounts.
+type Key struct {
+	ResourceType string `json:"resource_type"`
+	Region       string `json:"region"`
+	SKU          string `json:"sku"`
+	Replication  string `json:"replication,omitempty"`
+}
+
+func (k Key) String() string {
+	s := fmt.Sprintf("%s/%s/%s", k.ResourceType, k.Region, k.SKU)
+	if k.Replication != "" {
+		s += "/" + k.Replication
+	}
+	return s
+}
+
+// normalized lower-cases the parts Azure treats case-insensitively, and
+// strips spaces from regions so "West Europe" matches "westeurope".
+func (k Key) normalized() Key {
+	return Key{
+		ResourceType: k.ResourceType,
+		Region:       strings.ToLower(strings.ReplaceAll(k.Region, " ", "")),
+		SKU:          strings.ToLower(k.SKU),
+		Replication:  strings.ToLower(k.Replication),
+	}
+}
+
+// DefaultCatalog returns the catalog embedded in this package.
+func DefaultCatalog() *Catalog {
+	c, err := ParseCatalog(defaultCatalog)
+	if err != nil {
+		panic(fmt.Sprintf("cost: embedded catalog is invalid: %v", err))
+	}
+	return c
+}
+
+// LoadCatalog reads a catalog file.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseCatalog(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ParseCatalog decodes and indexes a catalog.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("cost: %w", err)
+	}
+	if c.Version == "" {
+		return nil, fmt.Errorf("cost: catalog has no version")
+	}
+	c.index = make(map[Key]Price, len(c.Prices))
+	for _, p := range c.Prices {
+		k := p.Key.normalized()
+		if _, dup := c.index[k]; dup {
+			return nil, fmt.Errorf("cost: duplicate price for %s", p.Key)
+		}
+		c.index[k] = p
+	}
+	c.free = map[string]bool{}
+	for _, t := range c.FreeResourceTypes {
+		c.free[t] = true
+	}
+	return &c, nil
+}
+
+// Free reports whether resourceType carries no charge of its own.
+func (c *Catalog) Free(resourceType string) bool {
+	return c.free[resourceType]
+}
+
+// Lookup finds the price for k, falling back to the AnyRegion entry when the
+// region has no price of its own.
+func (c *Catalog) Lookup(k Key) (Price, bool) {
+	n := k.normalized()
+	if p, ok := c.index[n]; ok {
+		return p, true
+	}
+	n.Region = AnyRegion
+	p, ok := c.index[n]
+	return p, ok
+}
@@ -0,0 +1,115 @@
+package cost
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+func TestEstimatePlanTotals(t *testing.T) {
+	p, err := plan.Load("testdata/dev.json")
+	require.NoError(t, err)
+
+	est := EstimatePlan(p, DefaultCatalog(), Options{})
+
+	// The destroyed resource and the data source are not priced.
+	assert.Len(t, est.Lines, 6)
+	assert.Empty(t, est.Unpriced())
+
+	assert.InDelta(t, 13.14, est.ByModule["module.webapp"], 0.001)
+	assert.InDelta(t, 2.08, est.ByModule["module.storage"], 0.001)
+	assert.InDelta(t, 0.03, est.ByModule["module.keyvault"], 0.001)
+	assert.InDelta(t, 0, est.ByModule["root"], 0.001)
+
+	assert.InDelta(t, 15.22, est.ByCostCenter["IT-12345"], 0.001)
+	assert.InDelta(t, 0.03, est.ByCostCenter["SEC-9"], 0.001)
+	assert.InDelta(t, 15.25, est.Total, 0.001)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteText(&out, est))
+	assert.Regexp(t, `module.storage.azurerm_storage_account.storage +westeurope +Standard/LRS +2.08`, out.String())
+	assert.Contains(t, out.String(), "TOTAL  15.25 USD")
+}
+
+func TestCatalogLookupFallsBackToAnyRegion(t *testing.T) {
+	c := DefaultCatalog()
+
+	p, ok := c.Lookup(Key{ResourceType: "azurerm_service_plan", Region: "North Europe", SKU: "p1v2"})
+	require.True(t, ok)
+	assert.Equal(t, "northeurope", p.Region)
+
+	p, ok = c.Lookup(Key{ResourceType: "azurerm_storage_account", Region: "uksouth", SKU: "Standard", Replication: "GRS"})
+	require.True(t, ok)
+	assert.Equal(t, AnyRegion, p.Region)
+
+	_, ok = c.Lookup(Key{ResourceType: "azurerm_service_plan", Region: "uksouth", SKU: "Y1"})
+	assert.False(t, ok)
+}
+
+func TestParseCatalogRejectsDuplicates(t *testing.T) {
+	_, err := ParseCatalog([]byte(`{"version": "1", "prices": [
+		{"resource_type": "azurerm_key_vault", "region": "*", "sku": "standard", "monthly": 1},
+		{"resource_type": "azurerm_key_vault", "region": "*", "sku": "Standard", "monthly": 2}
+	]}`))
+	assert.Error(t, err)
+}
+
+func TestCompareReportsSKUChanges(t *testing.T) {
+	p, err := plan.Load("testdata/upgrade.json")
+	require.NoError(t, err)
+	c := DefaultCatalog()
+
+	cmp := Compare(EstimatePrior(p, c, Options{}), EstimatePlan(p, c, Options{}))
+
+	// The unchanged key vault is left out.
+	require.Len(t, cmp.Deltas, 2)
+	assert.Equal(t, "module.storage.azurerm_storage_account.storage", cmp.Deltas[0].Address)
+	assert.InDelta(t, 2.08, cmp.Deltas[0].Change, 0.001)
+	assert.True(t, cmp.Deltas[1].SKUChanged())
+	assert.InDelta(t, 67.89, cmp.Deltas[1].Change, 0.001)
+	assert.InDelta(t, 69.97, cmp.Change, 0.001)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteMarkdown(&out, cmp, "dev", "prod"))
+	md := out.String()
+	assert.Contains(t, md, "### Cost impact: dev → prod")
+	assert.Contains(t, md, "**15.25 USD → 85.22 USD** (+69.97 USD)")
+	assert.Contains(t, md, "| `module.webapp.azurerm_service_plan.app_service_plan` | B1 13.14 USD | P1v2 81.03 USD | +67.89 USD |")
+}
+
+func TestBudgetRefusesOverLimit(t *testing.T) {
+	b := &Budget{Limit: 100}
+
+	require.NoError(t, b.Reserve("TestScalabilityLimits", &Estimate{Total: 60, Currency: "USD"}))
+	err := b.Reserve("TestResourceLimits", &Estimate{Total: 50, Currency: "USD"})
+	require.Error(t, err)
+	assert.IsType(t, &OverBudgetError{}, err)
+	require.NoError(t, b.Reserve("TestNetworkModule", &Estimate{Total: 0, Currency: "USD"}))
+	assert.InDelta(t, 60, b.Total(), 0.001)
+
+	var out bytes.Buffer
+	require.NoError(t, b.WriteSummary(&out))
+	assert.Contains(t, out.String(), "REFUSED: over budget")
+	assert.Regexp(t, `Run total +60.00 +budget 100.00`, out.String())
+}
+
+func TestBudgetRelease(t *testing.T) {
+	b := &Budget{Limit: 100}
+
+	require.NoError(t, b.Reserve("TestScalabilityLimits", &Estimate{Total: 60, Currency: "USD"}))
+	b.Release("TestScalabilityLimits")
+	b.Release("TestScalabilityLimits")
+	b.Release("TestNeverReserved")
+	assert.InDelta(t, 0, b.Total(), 0.001)
+	require.NoError(t, b.Reserve("TestResourceLimits", &Estimate{Total: 90, Currency: "USD"}),
+		"a released reservation leaves room for others")
+
+	var out bytes.Buffer
+	require.NoError(t, b.WriteSummary(&out))
+	assert.Contains(t, out.String(), "released: nothing deployed")
+	assert.Regexp(t, `Run total +90.00 +budget 100.00`, out.String())
+}
@@ -0,0 +1,146 @@
+package cost
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Delta is the change in monthly cost for one resource address.
+type Delta struct {
+	Address string `json:"address"`
+
+	// Base and Head are nil when the resource only exists on one side.
+	Base *Line `json:"base,omitempty"`
+	Head *Line `json:"head,omitempty"`
+
+	Change float64 `json:"change"`
+}
+
+// SKUChanged reports whether the priced SKU differs between the two sides.
+func (d Delta) SKUChanged() bool {
+	return d.Base != nil && d.Head != nil && d.Base.Key != d.Head.Key
+}
+
+// Comparison is the cost difference between two estimates.
+type Comparison struct {
+	Base   *Estimate `json:"base"`
+	Head   *Estimate `json:"head"`
+	Deltas []Delta   `json:"deltas"`
+	Change float64   `json:"change"`
+}
+
+// Compare matches base and head by resource address. Only addresses whose
+// cost or pricing key changed are reported, sorted by address.
+func Compare(base, head *Estimate) *Comparison {
+	cmp := &Comparison{Base: base, Head: head, Change: head.Total - base.Total}
+
+	addresses := map[string]bool{}
+	for _, l := range base.Lines {
+		addresses[l.Address] = true
+	}
+	for _, l := range head.Lines {
+		addresses[l.Address] = true
+	}
+
+	for addr := range addresses {
+		d := Delta{Address: addr}
+		if l, ok := base.Line(addr); ok {
+			d.Base = &l
+			d.Change -= l.Monthly
+		}
+		if l, ok := head.Line(addr); ok {
+			d.Head = &l
+			d.Change += l.Monthly
+		}
+		if d.Change == 0 && !d.SKUChanged() && !unpricedOnEitherSide(d) {
+			continue
+		}
+		cmp.Deltas = append(cmp.Deltas, d)
+	}
+	sort.Slice(cmp.Deltas, func(i, j int) bool { return cmp.Deltas[i].Address < cmp.Deltas[j].Address })
+	return cmp
+}
+
+// unpricedOnEitherSide keeps added or removed resources that could not be
+// priced, so the report does not hide them behind a zero delta.
+func unpricedOnEitherSide(d Delta) bool {
+	if d.Base != nil && d.Head != nil {
+		return false
+	}
+	for _, l := range []*Line{d.Base, d.Head} {
+		if l != nil && l.Status == StatusUnpriced {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteMarkdown renders a comparison for a pull request comment. baseLabel
+// and headLabel name the two sides, e.g. "dev" and "prod" or "main" and
+// "this PR".
+func WriteMarkdown(w io.Writer, cmp *Comparison, baseLabel, headLabel string) error {
+	cur := cmp.Head.Currency
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "### Cost impact: %s → %s\n\n", baseLabel, headLabel)
+	fmt.Fprintf(&b, "Monthly estimate: **%s → %s** (%s)\n\n",
+		money(cmp.Base.Total, cur), money(cmp.Head.Total, cur), signed(cmp.Change, cur))
+
+	if len(cmp.Deltas) == 0 {
+		b.WriteString("No resource changes affect cost.\n")
+	} else {
+		fmt.Fprintf(&b, "| Resource | %s | %s | Delta |\n", baseLabel, headLabel)
+		b.WriteString("|---|---|---|---:|\n")
+		for _, d := range cmp.Deltas {
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n",
+				d.Address, cell(d.Base, cur), cell(d.Head, cur), signed(d.Change, cur))
+		}
+	}
+
+	var unpriced []string
+	for _, l := range cmp.Head.Unpriced() {
+		unpriced = append(unpriced, fmt.Sprintf("`%s` (%s)", l.Address, l.Note))
+	}
+	if len(unpriced) > 0 {
+		fmt.Fprintf(&b, "\n%d resource(s) could not be priced: %s\n", len(unpriced), strings.Join(unpriced, ", "))
+	}
+	fmt.Fprintf(&b, "\n<sub>Price catalog %s. Estimates use list prices and do not include usage-based charges.</sub>\n",
+		cmp.Head.CatalogVersion)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func cell(l *Line, currency string) string {
+	if l == nil {
+		return "—"
+	}
+	if l.Status == StatusUnpriced {
+		return "?"
+	}
+	sku := l.Key.SKU
+	if l.Key.Replication != "" {
+		sku += " " + l.Key.Replication
+	}
+	if sku == "" {
+		return money(l.Monthly, currency)
+	}
+	return sku + " " + money(l.Monthly, currency)
+}
+
+func money(v float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", v, currency)
+}
+
+func signed(v float64, currency string) string {
+	if math.Abs(v) < 0.005 {
+		return money(0, currency)
+	}
+	if v > 0 {
+		return "+" + money(v, currency)
+	}
+	return money(v, currency)
+}
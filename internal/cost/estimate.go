@@ -0,0 +1,188 @@
+package cost
+
+import (
+	"fmt"
+	"sort"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+// Unassigned is the cost center of resources without a CostCenter tag.
+const Unassigned = "unassigned"
+
+// Line statuses.
+const (
+	StatusPriced   = "priced"
+	StatusFree     = "free"
+	StatusUnpriced = "unpriced"
+)
+
+// pricing names the attributes that select a price for each billable type.
+var pricing = map[string]struct{ sku, replication string }{
+	"azurerm_service_plan":    {sku: "sku_name"},
+	"azurerm_storage_account": {sku: "account_tier", replication: "account_replication_type"},
+	"azurerm_key_vault":       {sku: "sku_name"},
+}
+
+// Options tune an estimate.
+type Options struct {
+	// DefaultRegion is used when neither the resource nor the plan's
+	// location variable says where a resource goes.
+	DefaultRegion string
+}
+
+// Line is the estimated monthly cost of one resource instance.
+type Line struct {
+	Address    string  `json:"address"`
+	Module     string  `json:"module"`
+	Type       string  `json:"type"`
+	Key        Key     `json:"key"`
+	CostCenter string  `json:"cost_center"`
+	Monthly    float64 `json:"monthly"`
+	Status     string  `json:"status"`
+	Note       string  `json:"note,omitempty"`
+}
+
+// Estimate is the monthly cost of the resources on one side of a plan.
+type Estimate struct {
+	CatalogVersion string             `json:"catalog_version"`
+	Currency       string             `json:"currency"`
+	Lines          []Line             `json:"resources"`
+	ByModule       map[string]float64 `json:"by_module"`
+	ByCostCenter   map[string]float64 `json:"by_cost_center"`
+	Total          float64            `json:"total"`
+}
+
+// Unpriced returns the lines the catalog had no price for.
+func (e *Estimate) Unpriced() []Line {
+	var out []Line
+	for _, l := range e.Lines {
+		if l.Status == StatusUnpriced {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// EstimatePlan prices every managed resource that exists once p is applied.
+// Resources being destroyed are left out; replaced resources are priced at
+// their new configuration.
+func EstimatePlan(p *plan.Plan, c *Catalog, opts Options) *Estimate {
+	return estimate(p, c, opts, func(rc plan.ResourceChange) map[string]interface{} { return rc.After })
+}
+
+// EstimatePrior prices the resources as they are before p is applied, so
+// that comparing it with EstimatePlan shows what the plan itself costs.
+// Resources being created are left out.
+func EstimatePrior(p *plan.Plan, c *Catalog, opts Options) *Estimate {
+	return estimate(p, c, opts, func(rc plan.ResourceChange) map[string]interface{} { return rc.Before })
+}
+
+func estimate(p *plan.Plan, c *Catalog, opts Options, side func(plan.ResourceChange) map[string]interface{}) *Estimate {
+	est := &Estimate{
+		CatalogVersion: c.Version,
+		Currency:       c.Currency,
+		ByModule:       map[string]float64{},
+		ByCostCenter:   map[string]float64{},
+	}
+	for _, rc := range p.ResourceChanges {
+		values := side(rc)
+		if !rc.Managed() || values == nil {
+			continue
+		}
+		line := priceResource(rc, values, p, c, opts)
+		est.Lines = append(est.Lines, line)
+		est.ByModule[line.Module] += line.Monthly
+		est.ByCostCenter[line.CostCenter] += line.Monthly
+		est.Total += line.Monthly
+	}
+	sort.Slice(est.Lines, func(i, j int) bool { return est.Lines[i].Address < est.Lines[j].Address })
+	return est
+}
+
+// Line returns the line for address, if the estimate has one.
+func (e *Estimate) Line(address string) (Line, bool) {
+	i := sort.Search(len(e.Lines), func(i int) bool { return e.Lines[i].Address >= address })
+	if i < len(e.Lines) && e.Lines[i].Address == address {
+		return e.Lines[i], true
+	}
+	return Line{}, false
+}
+
+func priceResource(rc plan.ResourceChange, values map[string]interface{}, p *plan.Plan, c *Catalog, opts Options) Line {
+	line := Line{
+		Address:    rc.Address,
+		Module:     rc.ModuleName(),
+		Type:       rc.Type,
+		CostCenter: costCenter(values, p),
+		Key:        Key{ResourceType: rc.Type, Region: region(values, p, opts)},
+	}
+	if c.Free(rc.Type) {
+		line.Status = StatusFree
+		return line
+	}
+
+	attrs, billable := pricing[rc.Type]
+	if !billable {
+		line.Status = StatusUnpriced
+		line.Note = "resource type not in catalog"
+		return line
+	}
+	line.Key.SKU = stringAttr(values, attrs.sku)
+	if attrs.replication != "" {
+		line.Key.Replication = stringAttr(values, attrs.replication)
+	}
+	if line.Key.SKU == "" {
+		line.Status = StatusUnpriced
+		line.Note = attrs.sku + " is unknown until apply"
+		return line
+	}
+
+	price, ok := c.Lookup(line.Key)
+	if !ok {
+		line.Status = StatusUnpriced
+		line.Note = fmt.Sprintf("no price for %s", line.Key)
+		return line
+	}
+	line.Status = StatusPriced
+	line.Monthly = price.Monthly
+	if price.Region == AnyRegion && line.Key.Region != AnyRegion {
+		line.Note = fmt.Sprintf("no %s price, used fallback", line.Key.Region)
+	}
+	return line
+}
+
+// region prefers the resource's own location, then the plan's location
+// variable. Module resources often take their location from a data source
+// that is unknown until the resource group exists.
+func region(values map[string]interface{}, p *plan.Plan, opts Options) string {
+	if loc := stringAttr(values, "location"); loc != "" {
+		return loc
+	}
+	if loc := p.StringVar("location"); loc != "" {
+		return loc
+	}
+	if opts.DefaultRegion != "" {
+		return opts.DefaultRegion
+	}
+	return AnyRegion
+}
+
+// costCenter reads the CostCenter tag set by modules/tagging, falling back
+// to the plan's cost_center variable.
+func costCenter(values map[string]interface{}, p *plan.Plan) string {
+	if tags, ok := values["tags"].(map[string]interface{}); ok {
+		if cc, ok := tags["CostCenter"].(string); ok && cc != "" {
+			return cc
+		}
+	}
+	if cc := p.StringVar("cost_center"); cc != "" {
+		return cc
+	}
+	return Unassigned
+}
+
+func stringAttr(values map[string]interface{}, name string) string {
+	s, _ := values[name].(string)
+	return s
+}
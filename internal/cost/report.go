@@ -0,0 +1,64 @@
+package cost
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// WriteText writes an estimate as aligned tables: one line per resource,
+// then totals per module and per cost center.
+func WriteText(w io.Writer, e *Estimate) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Price catalog %s, %s per month\n\n", e.CatalogVersion, e.Currency)
+
+	fmt.Fprintln(tw, "RESOURCE\tREGION\tSKU\tMONTHLY\tNOTE")
+	for _, l := range e.Lines {
+		sku := l.Key.SKU
+		if l.Key.Replication != "" {
+			sku += "/" + l.Key.Replication
+		}
+		if sku == "" {
+			sku = "-"
+		}
+		monthly := fmt.Sprintf("%.2f", l.Monthly)
+		if l.Status == StatusUnpriced {
+			monthly = "?"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", l.Address, l.Key.Region, sku, monthly, l.Note)
+	}
+
+	fmt.Fprintln(tw, "\nMODULE\tMONTHLY")
+	for _, k := range sortedKeys(e.ByModule) {
+		fmt.Fprintf(tw, "%s\t%.2f\n", k, e.ByModule[k])
+	}
+
+	fmt.Fprintln(tw, "\nCOST CENTER\tMONTHLY")
+	for _, k := range sortedKeys(e.ByCostCenter) {
+		fmt.Fprintf(tw, "%s\t%.2f\n", k, e.ByCostCenter[k])
+	}
+
+	fmt.Fprintf(tw, "\nTOTAL\t%.2f %s\n", e.Total, e.Currency)
+	if n := len(e.Unpriced()); n > 0 {
+		fmt.Fprintf(tw, "%d resource(s) could not be priced and are not included.\n", n)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes an estimate as indented JSON.
+func WriteJSON(w io.Writer, e *Estimate) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+// Package deadline schedules terraform applies against a test's deadline
+// so that there is always time left to destroy what they create.
+//
+// When go test's -timeout fires, the test binary panics and exits at
+// once: deferred destroys never run. A test must therefore not start an
+// apply it cannot finish and tear down in the time left, and an apply
+// running late has to be stopped while destroy can still run. A Schedule
+// works out both from the deadline and an Estimate of how long apply and
+// destroy take, which a Predictor learns from earlier runs.
+package deadline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Estimate is how long one deployment is expected to take.
+type Estimate struct {
+	Apply   time.Duration
+	Destroy time.Duration
+}
+
+// TooLateError is returned for an apply that would not leave time to
+// destroy.
+type TooLateError struct {
+	Remaining time.Duration
+	Needed    Estimate
+	Margin    time.Duration
+}
+
+func (e *TooLateError) Error() string {
+	return fmt.Sprintf("deadline: %s left before the test deadline, but apply is expected to take %s and destroy %s (plus %s to spare)",
+		e.Remaining.Round(time.Second), e.Needed.Apply.Round(time.Second), e.Needed.Destroy.Round(time.Second), e.Margin)
+}
+
+// Schedule is one test's deadline.
+type Schedule struct {
+	// Deadline is when the test binary is killed; the zero time means
+	// there is none.
+	Deadline time.Time
+
+	// Margin is kept free before the deadline for the test to report.
+	Margin time.Duration
+
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (s Schedule) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Remaining returns the time left before the deadline less the margin,
+// and false when there is no deadline.
+func (s Schedule) Remaining() (time.Duration, bool) {
+	if s.Deadline.IsZero() {
+		return 0, false
+	}
+	return s.Deadline.Sub(s.now()) - s.Margin, true
+}
+
+// CanApply returns a *TooLateError when the time left is shorter than
+// the estimated apply and destroy together.
+func (s Schedule) CanApply(est Estimate) error {
+	left, ok := s.Remaining()
+	if !ok || left >= est.Apply+est.Destroy {
+		return nil
+	}
+	return &TooLateError{Remaining: left, Needed: est, Margin: s.Margin}
+}
+
+// ApplyContext returns a context that ends when an apply has to stop to
+// leave est.Destroy for destroy.
+func (s Schedule) ApplyContext(parent context.Context, est Estimate) (context.Context, context.CancelFunc) {
+	if s.Deadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, s.Deadline.Add(-s.Margin-est.Destroy))
+}
+
+// Context returns a context that ends at the deadline less the margin,
+// for destroy and the commands that need no reserve after them.
+func (s Schedule) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	if s.Deadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, s.Deadline.Add(-s.Margin))
+}
+
+// history is how many observations per key and phase a Predictor keeps.
+const history = 5
+
+// Predictor estimates deployments from the durations of earlier runs,
+// kept in a JSON file. It is safe for concurrent use.
+type Predictor struct {
+	// File holds the observations between runs. Empty keeps them in
+	// memory only.
+	File string
+
+	// Default is the estimate for a deployment never observed.
+	Default Estimate
+
+	// Slack scales observed durations, so a slightly slower run still
+	// fits. Zero means 1.25.
+	Slack float64
+
+	mu       sync.Mutex
+	loaded   bool
+	observed map[string]map[string][]time.Duration
+}
+
+// Phases a Predictor observes.
+const (
+	PhaseApply   = "apply"
+	PhaseDestroy = "destroy"
+)
+
+func (p *Predictor) load() {
+	if p.loaded {
+		return
+	}
+	p.loaded = true
+	p.observed = map[string]map[string][]time.Duration{}
+	if p.File == "" {
+		return
+	}
+	data, err := os.ReadFile(p.File)
+	if err != nil {
+		return
+	}
+	// A file that does not parse is treated as empty and rewritten.
+	_ = json.Unmarshal(data, &p.observed)
+}
+
+// Predict returns the estimate for the deployment key: per phase, the
+// longest of its recent durations times the slack, or the default for a
+// phase never observed.
+func (p *Predictor) Predict(key string) Estimate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load()
+	slack := p.Slack
+	if slack == 0 {
+		slack = 1.25
+	}
+	predict := func(phase string, def time.Duration) time.Duration {
+		var longest time.Duration
+		for _, d := range p.observed[key][phase] {
+			if d > longest {
+				longest = d
+			}
+		}
+		if longest == 0 {
+			return def
+		}
+		return time.Duration(float64(longest) * slack).Round(time.Second)
+	}
+	return Estimate{
+		Apply:   predict(PhaseApply, p.Default.Apply),
+		Destroy: predict(PhaseDestroy, p.Default.Destroy),
+	}
+}
+
+// Observe records how long a phase of the deployment key took.
+func (p *Predictor) Observe(key, phase string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load()
+	if p.observed[key] == nil {
+		p.observed[key] = map[string][]time.Duration{}
+	}
+	ds := append(p.observed[key][phase], d)
+	if len(ds) > history {
+		ds = ds[len(ds)-history:]
+	}
+	p.observed[key][phase] = ds
+}
+
+// Save writes the observations to File. Of two processes saving at the
+// same time, the last one wins; either file is a usable history.
+func (p *Predictor) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.File == "" || !p.loaded {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.observed, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", p.File, os.Getpid())
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("deadline: %w", err)
+	}
+	if err := os.Rename(tmp, p.File); err != nil {
+		return fmt.Errorf("deadline: %w", err)
+	}
+	return nil
+}
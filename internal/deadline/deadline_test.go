@@ -0,0 +1,74 @@
+package deadline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s := Schedule{Deadline: now.Add(30 * time.Minute), Margin: time.Minute, Now: func() time.Time { return now }}
+	est := Estimate{Apply: 15 * time.Minute, Destroy: 10 * time.Minute}
+
+	left, ok := s.Remaining()
+	assert.True(t, ok)
+	assert.Equal(t, 29*time.Minute, left)
+	assert.NoError(t, s.CanApply(est))
+
+	now = now.Add(5 * time.Minute)
+	err := s.CanApply(est)
+	var late *TooLateError
+	require.ErrorAs(t, err, &late)
+	assert.Equal(t, 24*time.Minute, late.Remaining)
+	assert.EqualError(t, err, "deadline: 24m0s left before the test deadline, but apply is expected to take 15m0s and destroy 10m0s (plus 1m0s to spare)")
+
+	ctx, cancel := s.ApplyContext(context.Background(), est)
+	defer cancel()
+	d, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, s.Deadline.Add(-11*time.Minute), d, "apply stops in time for destroy")
+
+	ctx, cancel = s.Context(context.Background())
+	defer cancel()
+	d, _ = ctx.Deadline()
+	assert.Equal(t, s.Deadline.Add(-time.Minute), d)
+}
+
+func TestScheduleWithoutDeadline(t *testing.T) {
+	var s Schedule
+	_, ok := s.Remaining()
+	assert.False(t, ok)
+	assert.NoError(t, s.CanApply(Estimate{Apply: time.Hour}))
+	ctx, cancel := s.ApplyContext(context.Background(), Estimate{})
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
+
+func TestPredictor(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "timings.json")
+	def := Estimate{Apply: 15 * time.Minute, Destroy: 10 * time.Minute}
+	p := &Predictor{File: file, Default: def}
+	assert.Equal(t, def, p.Predict("test/fixtures/resource-group"))
+
+	for _, d := range []time.Duration{8 * time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		p.Observe("root", PhaseApply, d)
+	}
+	p.Observe("root", PhaseDestroy, 4*time.Minute)
+	assert.Equal(t, Estimate{Apply: 5 * time.Minute, Destroy: 5 * time.Minute}, p.Predict("root"),
+		"the 8 minute run is older than the last five")
+	require.NoError(t, p.Save())
+
+	again := &Predictor{File: file, Default: def, Slack: 1}
+	assert.Equal(t, Estimate{Apply: 4 * time.Minute, Destroy: 4 * time.Minute}, again.Predict("root"))
+
+	require.NoError(t, os.WriteFile(file, []byte("not json"), 0o644))
+	broken := &Predictor{File: file, Default: def}
+	assert.Equal(t, def, broken.Predict("root"))
+}
@@ -0,0 +1,170 @@
+// Package deploypool deploys several scenarios at once and always tears
+// them down again.
+//
+// Calling terratest's failing helpers from worker goroutines ends the
+// worker with t.FailNow, which the testing package does not allow off the
+// test goroutine, and a test that gives up waiting returns while
+// deployments are still being created. A Pool instead runs each
+// deployment's apply and destroy itself, turns failures and panics into
+// errors on its Result, and does not return until every deployment it
+// started has been destroyed. The caller reports the results from the
+// test goroutine.
+package deploypool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Deployment is one scenario to deploy.
+type Deployment struct {
+	Name string
+
+	// Apply creates the deployment. It is the only required hook.
+	Apply func(ctx context.Context) error
+
+	// Outputs, if set, reads the deployment's outputs after a
+	// successful apply.
+	Outputs func(ctx context.Context) (map[string]string, error)
+
+	// Destroy tears the deployment down. It runs once Apply has
+	// returned, whether Apply succeeded, failed or panicked.
+	Destroy func(ctx context.Context) error
+}
+
+// Result is what happened to one deployment.
+type Result struct {
+	Name string
+
+	// Started is false when the pool was cancelled before the
+	// deployment's turn came; nothing was created then.
+	Started bool
+
+	// Err is the apply or outputs error, or why the deployment never
+	// started.
+	Err        error
+	DestroyErr error
+
+	Outputs map[string]string
+
+	// Applied is how long Apply and Outputs took, Destroyed how long
+	// Destroy took.
+	Applied   time.Duration
+	Destroyed time.Duration
+}
+
+// Failed reports whether the deployment or its teardown failed.
+func (r Result) Failed() bool { return r.Err != nil || r.DestroyErr != nil }
+
+// Pool runs deployments concurrently.
+type Pool struct {
+	// Workers is how many deployments run at once. Zero runs them all
+	// at once.
+	Workers int
+
+	// Timeout bounds each deployment's Apply and Outputs through their
+	// context. Zero means no limit.
+	Timeout time.Duration
+
+	// DestroyTimeout bounds each Destroy. Destroy gets a context of its
+	// own, so a timed-out or cancelled apply is still torn down.
+	DestroyTimeout time.Duration
+}
+
+// Run deploys every deployment and returns their results in the order
+// given. Deployments not yet started when ctx is done are skipped; those
+// already started are still destroyed.
+func (p *Pool) Run(ctx context.Context, deployments []Deployment) []Result {
+	workers := p.Workers
+	if workers <= 0 || workers > len(deployments) {
+		workers = len(deployments)
+	}
+	results := make([]Result, len(deployments))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = p.deploy(ctx, deployments[i])
+			}
+		}()
+	}
+
+feed:
+	for i := range deployments {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			for j := i; j < len(deployments); j++ {
+				results[j] = Result{Name: deployments[j].Name, Err: fmt.Errorf("not started: %w", ctx.Err())}
+			}
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func (p *Pool) deploy(ctx context.Context, d Deployment) Result {
+	r := Result{Name: d.Name, Started: true}
+	if d.Apply == nil {
+		r.Err = errors.New("deploypool: deployment has no Apply")
+		return r
+	}
+
+	applyCtx, cancel := withTimeout(ctx, p.Timeout)
+	start := time.Now()
+	r.Err = call(func() error { return d.Apply(applyCtx) })
+	if r.Err == nil && d.Outputs != nil {
+		r.Err = call(func() (err error) {
+			r.Outputs, err = d.Outputs(applyCtx)
+			return err
+		})
+	}
+	r.Applied = time.Since(start)
+	cancel()
+
+	if d.Destroy != nil {
+		destroyCtx, cancel := withTimeout(context.WithoutCancel(ctx), p.DestroyTimeout)
+		start := time.Now()
+		r.DestroyErr = call(func() error { return d.Destroy(destroyCtx) })
+		r.Destroyed = time.Since(start)
+		cancel()
+	}
+	return r
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// call runs f on a goroutine of its own and returns its error. A panic,
+// or runtime.Goexit from a t.FailNow inside f, becomes an error instead
+// of ending the worker.
+func call(f func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		returned := false
+		defer func() {
+			if v := recover(); v != nil {
+				errc <- fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+			} else if !returned {
+				errc <- errors.New("deployment called runtime.Goexit, as t.FailNow does")
+			}
+		}()
+		err := f()
+		returned = true
+		errc <- err
+	}()
+	return <-errc
+}
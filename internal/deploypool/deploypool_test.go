@@ -0,0 +1,120 @@
+package deploypool
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder tracks which deployments exist, like a subscription would.
+type recorder struct {
+	mu      sync.Mutex
+	live    map[string]bool
+	running int32
+	peak    int32
+}
+
+func (r *recorder) deployment(name string, apply func(ctx context.Context) error) Deployment {
+	return Deployment{
+		Name: name,
+		Apply: func(ctx context.Context) error {
+			n := atomic.AddInt32(&r.running, 1)
+			defer atomic.AddInt32(&r.running, -1)
+			for {
+				p := atomic.LoadInt32(&r.peak)
+				if n <= p || atomic.CompareAndSwapInt32(&r.peak, p, n) {
+					break
+				}
+			}
+			r.mu.Lock()
+			r.live[name] = true
+			r.mu.Unlock()
+			return apply(ctx)
+		},
+		Outputs: func(context.Context) (map[string]string, error) {
+			return map[string]string{"resource_group_name": "rg-" + name}, nil
+		},
+		Destroy: func(context.Context) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.live, name)
+			return nil
+		},
+	}
+}
+
+func TestRunCollectsResultsAndDestroysEverything(t *testing.T) {
+	rec := &recorder{live: map[string]bool{}}
+	ok := func(context.Context) error { time.Sleep(10 * time.Millisecond); return nil }
+	deployments := []Deployment{
+		rec.deployment("a", ok),
+		rec.deployment("b", func(context.Context) error { return errors.New("quota exceeded") }),
+		rec.deployment("c", func(context.Context) error { panic("boom") }),
+		rec.deployment("d", func(context.Context) error { runtime.Goexit(); return nil }),
+		rec.deployment("e", ok),
+	}
+
+	results := (&Pool{Workers: 2}).Run(context.Background(), deployments)
+	require.Len(t, results, 5)
+	assert.Empty(t, rec.live, "every started deployment is destroyed")
+	assert.Equal(t, int32(2), rec.peak)
+
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, map[string]string{"resource_group_name": "rg-a"}, results[0].Outputs)
+	assert.GreaterOrEqual(t, results[0].Applied, 10*time.Millisecond)
+	assert.EqualError(t, results[1].Err, "quota exceeded")
+	assert.Nil(t, results[1].Outputs)
+	assert.ErrorContains(t, results[2].Err, "panic: boom")
+	assert.ErrorContains(t, results[3].Err, "runtime.Goexit")
+	for i, r := range results {
+		assert.Equal(t, deployments[i].Name, r.Name)
+		assert.True(t, r.Started)
+		assert.NoError(t, r.DestroyErr)
+	}
+}
+
+func TestTimedOutApplyIsStillDestroyed(t *testing.T) {
+	destroyed := false
+	var destroyCtxErr error
+	results := (&Pool{Timeout: 10 * time.Millisecond}).Run(context.Background(), []Deployment{{
+		Name: "slow",
+		Apply: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Destroy: func(ctx context.Context) error {
+			destroyed = true
+			destroyCtxErr = ctx.Err()
+			return errors.New("resource group still has locks")
+		},
+	}})
+	assert.ErrorIs(t, results[0].Err, context.DeadlineExceeded)
+	assert.True(t, destroyed)
+	assert.NoError(t, destroyCtxErr, "destroy gets a fresh context")
+	assert.EqualError(t, results[0].DestroyErr, "resource group still has locks")
+	assert.True(t, results[0].Failed())
+}
+
+func TestCancelledPoolSkipsDeploymentsNotStarted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := &recorder{live: map[string]bool{}}
+	results := (&Pool{Workers: 1}).Run(ctx, []Deployment{
+		rec.deployment("first", func(context.Context) error { cancel(); return nil }),
+		rec.deployment("second", func(context.Context) error { return nil }),
+		rec.deployment("third", func(context.Context) error { return nil }),
+	})
+	assert.True(t, results[0].Started)
+	assert.NoError(t, results[0].Err)
+	for _, r := range results[1:] {
+		assert.False(t, r.Started, r.Name)
+		assert.ErrorIs(t, r.Err, context.Canceled, r.Name)
+	}
+	assert.Empty(t, rec.live)
+}
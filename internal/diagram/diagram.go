@@ -0,0 +1,208 @@
+// Package diagram draws the infrastructure as a graph of module
+// boundaries.
+//
+// Resources are collapsed into the top-level module that declares them
+// (validation, naming, tagging, network, storage, webapp, keyvault, with
+// root-module resources under "root"), and dependencies between resources
+// become edges between those modules. The graph can be built from plan
+// JSON, state, `terraform graph` DOT, or any mix of them, and renders to
+// Mermaid, DOT and SVG. Output is deterministic so that diagrams can be
+// committed and diffed.
+package diagram
+
+import (
+	"sort"
+	"strings"
+
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// Root is the boundary of resources declared in the root module.
+const Root = "root"
+
+// Graph is a module-level dependency graph.
+type Graph struct {
+	modules map[string]map[string]int
+	edges   map[Edge]bool
+}
+
+// Module is one boundary and the managed resources inside it.
+type Module struct {
+	Name string
+
+	// Resources counts resource instances by type.
+	Resources map[string]int
+}
+
+// Types returns the module's resource types, sorted.
+func (m Module) Types() []string {
+	types := make([]string, 0, len(m.Resources))
+	for t := range m.Resources {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Edge points from a module to one that depends on it, the way
+// infrastructure flows: the resource group feeds the network.
+type Edge struct {
+	From, To string
+}
+
+// New returns an empty graph.
+func New() *Graph {
+	return &Graph{modules: map[string]map[string]int{}, edges: map[Edge]bool{}}
+}
+
+// AddModule adds a boundary, which may stay empty.
+func (g *Graph) AddModule(name string) {
+	if _, ok := g.modules[name]; !ok {
+		g.modules[name] = map[string]int{}
+	}
+}
+
+// AddResource counts one managed resource instance at address.
+func (g *Graph) AddResource(address, typ string) {
+	b := Boundary(address)
+	if b == "" {
+		return
+	}
+	g.AddModule(b)
+	g.modules[b][typ]++
+}
+
+// AddDependency records that dependent refers to dependency. Both are
+// addresses or references; anything that does not resolve to a module or
+// resource (variables, locals, providers) is ignored, as are references
+// within one boundary.
+func (g *Graph) AddDependency(dependent, dependency string) {
+	to, from := Boundary(dependent), Boundary(dependency)
+	if to == "" || from == "" || to == from {
+		return
+	}
+	g.AddModule(from)
+	g.AddModule(to)
+	g.edges[Edge{From: from, To: to}] = true
+}
+
+// Merge adds other's boundaries and edges to g. Resource counts are only
+// taken for modules g has no resources in, so a plan and the state it was
+// made from are not counted twice.
+func (g *Graph) Merge(other *Graph) {
+	for name, res := range other.modules {
+		g.AddModule(name)
+		if len(g.modules[name]) > 0 {
+			continue
+		}
+		for typ, n := range res {
+			g.modules[name][typ] = n
+		}
+	}
+	for e := range other.edges {
+		g.edges[e] = true
+	}
+}
+
+// Modules returns the boundaries sorted by name.
+func (g *Graph) Modules() []Module {
+	out := make([]Module, 0, len(g.modules))
+	for name, res := range g.modules {
+		out = append(out, Module{Name: name, Resources: res})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Edges returns the edges sorted by source, then target.
+func (g *Graph) Edges() []Edge {
+	out := make([]Edge, 0, len(g.edges))
+	for e := range g.edges {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].From != out[j].From {
+			return out[i].From < out[j].From
+		}
+		return out[i].To < out[j].To
+	})
+	return out
+}
+
+// Boundary returns the top-level module an address or reference belongs
+// to: "network" for module.network.azurerm_subnet.subnet or
+// module.network.subnet_id, Root for azurerm_resource_group.rg.name, and
+// "" for references that are not resources or modules, such as var.location.
+func Boundary(address string) string {
+	parts := strings.Split(address, ".")
+	switch parts[0] {
+	case "module":
+		if len(parts) < 2 {
+			return ""
+		}
+		name := parts[1]
+		if i := strings.IndexByte(name, '['); i >= 0 {
+			name = name[:i]
+		}
+		return name
+	case "var", "local", "path", "terraform", "count", "each", "self", "output", "provider":
+		return ""
+	case "data":
+		if len(parts) < 3 {
+			return ""
+		}
+		return Root
+	}
+	if len(parts) < 2 || strings.HasPrefix(parts[0], "provider[") || !strings.Contains(parts[0], "_") {
+		return ""
+	}
+	return Root
+}
+
+// FromPlan builds a graph of what exists once p is applied. Edges come from
+// the plan's configuration section, so every module call appears even if
+// it declares no resources.
+func FromPlan(p *plan.Plan) *Graph {
+	g := New()
+	for _, rc := range p.ResourceChanges {
+		if !rc.Managed() || rc.Actions.Delete() {
+			continue
+		}
+		g.AddResource(rc.Address, rc.Type)
+	}
+	if p.Config != nil {
+		g.addConfig(p.Config.RootModule)
+	}
+	return g
+}
+
+func (g *Graph) addConfig(root plan.ConfigModule) {
+	for _, r := range root.Resources {
+		for _, ref := range append(r.References, r.DependsOn...) {
+			g.AddDependency(r.Address, ref)
+		}
+	}
+	for name, call := range root.ModuleCalls {
+		g.AddModule(name)
+		for _, ref := range append(call.References, call.DependsOn...) {
+			g.AddDependency("module."+name, ref)
+		}
+	}
+}
+
+// FromState builds a graph from the resources in st and the dependencies
+// recorded with them.
+func FromState(st *tfstate.State) *Graph {
+	g := New()
+	for _, r := range st.Resources {
+		if !r.Managed() {
+			continue
+		}
+		g.AddResource(r.Address, r.Type)
+		for _, dep := range r.DependsOn {
+			g.AddDependency(r.Address, dep)
+		}
+	}
+	return g
+}
@@ -0,0 +1,169 @@
+package diagram
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+func loadGraph(t *testing.T) *Graph {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	g := FromPlan(p)
+
+	f, err := os.Open("testdata/graph.dot")
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, g.AddTerraformGraph(f))
+	return g
+}
+
+func TestBoundary(t *testing.T) {
+	cases := map[string]string{
+		"module.network.azurerm_subnet.subnet":                "network",
+		"module.network":                                      "network",
+		"module.tagging.tags":                                 "tagging",
+		`module.apps["web"].azurerm_linux_web_app.x`:          "apps",
+		"azurerm_resource_group.rg.name":                      Root,
+		"data.azurerm_client_config.current":                  Root,
+		"var.location":                                        "",
+		"local.environment":                                   "",
+		`provider["registry.terraform.io/hashicorp/azurerm"]`: "",
+		"root": "",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, Boundary(in), in)
+	}
+}
+
+func TestFromPlanCollapsesToModules(t *testing.T) {
+	g := loadGraph(t)
+
+	var names []string
+	byName := map[string]Module{}
+	for _, m := range g.Modules() {
+		names = append(names, m.Name)
+		byName[m.Name] = m
+	}
+	assert.Equal(t, []string{"keyvault", "naming", "network", "root", "storage", "tagging", "validation", "webapp"}, names)
+
+	assert.Equal(t, map[string]int{"null_resource": 2}, byName["naming"].Resources)
+	assert.Equal(t, map[string]int{"azurerm_subnet": 1, "azurerm_virtual_network": 1}, byName["network"].Resources,
+		"data sources are not drawn")
+	assert.Equal(t, map[string]int{"azurerm_storage_account": 1}, byName["storage"].Resources,
+		"deleted resources are not drawn")
+	assert.Empty(t, byName["webapp"].Resources, "terraform graph adds boundaries, not instances")
+
+	assert.Equal(t, []Edge{
+		{From: "network", To: "keyvault"},
+		{From: "root", To: "keyvault"},
+		{From: "root", To: "network"},
+		{From: "root", To: "storage"},
+		{From: "root", To: "webapp"},
+		{From: "tagging", To: "network"},
+		{From: "tagging", To: "root"},
+	}, g.Edges())
+}
+
+func TestFromState(t *testing.T) {
+	st := &tfstate.State{Resources: []tfstate.Resource{
+		{Address: "azurerm_resource_group.rg", Mode: "managed", Type: "azurerm_resource_group"},
+		{Address: "module.storage.azurerm_storage_account.storage", Mode: "managed", Type: "azurerm_storage_account",
+			DependsOn: []string{"azurerm_resource_group.rg", "module.storage.data.azurerm_resource_group.rg"}},
+	}}
+	g := FromState(st)
+	assert.Equal(t, []Edge{{From: "root", To: "storage"}}, g.Edges())
+}
+
+func TestStyleOf(t *testing.T) {
+	assert.Equal(t, "network", StyleOf(Module{Resources: map[string]int{"azurerm_subnet": 1, "azurerm_virtual_network": 1}}).Class)
+	assert.Equal(t, "web", StyleOf(Module{Resources: map[string]int{"azurerm_service_plan": 1, "azurerm_linux_web_app": 1}}).Class)
+	assert.Equal(t, "security", StyleOf(Module{Resources: map[string]int{"azurerm_key_vault_secret": 3}}).Class)
+	assert.True(t, StyleOf(Module{Name: "validation"}).Dashed)
+}
+
+func TestRenderIsDeterministic(t *testing.T) {
+	for _, format := range []string{FormatMermaid, FormatDOT, FormatSVG} {
+		var first, second bytes.Buffer
+		require.NoError(t, Write(&first, loadGraph(t), format))
+		require.NoError(t, Write(&second, loadGraph(t), format))
+		assert.Equal(t, first.String(), second.String(), format)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMermaid(&out, loadGraph(t)))
+
+	s := out.String()
+	assert.Contains(t, s, "flowchart TD\n")
+	assert.Contains(t, s, `  m_naming["<b>naming</b><br/>null_resource ×2"]:::logic`)
+	assert.Contains(t, s, `  m_network["<b>network</b><br/>subnet<br/>virtual_network"]:::network`)
+	assert.Contains(t, s, "  classDef security fill:#FDE7E9,stroke:#A4262C,color:#1B1A19\n")
+	assert.Contains(t, s, "  m_root --> m_network\n")
+}
+
+func TestWriteDOT(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteDOT(&out, loadGraph(t)))
+
+	s := out.String()
+	assert.Contains(t, s, `  "storage" [label="storage\nstorage_account", fillcolor="#FFF4CE", color="#986F0B", style="rounded,filled"];`)
+	assert.Contains(t, s, `  "tagging" -> "root";`)
+}
+
+func TestWriteSVG(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteSVG(&out, loadGraph(t)))
+
+	// The output must be well-formed XML.
+	dec := xml.NewDecoder(bytes.NewReader(out.Bytes()))
+	groups := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local == "g" {
+			groups++
+		}
+	}
+	assert.Equal(t, 8, groups)
+	assert.Contains(t, out.String(), `id="module-keyvault"`)
+}
+
+func TestDepthsPlacesDependenciesAbove(t *testing.T) {
+	g := loadGraph(t)
+	d := depths(g.Modules(), g.Edges())
+	assert.Equal(t, 0, d["tagging"])
+	assert.Equal(t, 1, d["root"])
+	assert.Equal(t, 2, d["network"])
+	assert.Equal(t, 3, d["keyvault"])
+}
+
+func TestMergeDoesNotDoubleCount(t *testing.T) {
+	g := New()
+	g.AddResource("module.storage.azurerm_storage_account.storage", "azurerm_storage_account")
+
+	other := New()
+	other.AddResource("module.storage.azurerm_storage_account.storage", "azurerm_storage_account")
+	other.AddResource("azurerm_resource_group.rg", "azurerm_resource_group")
+	other.AddDependency("module.storage.azurerm_storage_account.storage", "azurerm_resource_group.rg")
+	g.Merge(other)
+
+	mods := g.Modules()
+	require.Len(t, mods, 2)
+	assert.Equal(t, map[string]int{"azurerm_resource_group": 1}, mods[0].Resources)
+	assert.Equal(t, map[string]int{"azurerm_storage_account": 1}, mods[1].Resources)
+	assert.Equal(t, []Edge{{From: Root, To: "storage"}}, g.Edges())
+}
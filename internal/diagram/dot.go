@@ -0,0 +1,49 @@
+package diagram
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// graphLine matches a node or edge statement in `terraform graph` output:
+//
+//	"[root] module.network.azurerm_subnet.subnet (expand)" -> "[root] azurerm_resource_group.rg (expand)"
+//	"azurerm_resource_group.rg" [label="azurerm_resource_group.rg"];
+var graphLine = regexp.MustCompile(`^\s*"((?:[^"\\]|\\.)*)"\s*(?:->\s*"((?:[^"\\]|\\.)*)")?`)
+
+// AddTerraformGraph merges the output of `terraform graph` into g. Nodes
+// add their module boundary and edges add dependencies; resource counts
+// are left to plan or state input, since the graph has no instances.
+func (g *Graph) AddTerraformGraph(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		m := graphLine.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		from := graphNode(m[1])
+		if m[2] == "" {
+			if b := Boundary(from); b != "" {
+				g.AddModule(b)
+			}
+			continue
+		}
+		// terraform graph edges point from a node to what it depends on.
+		g.AddDependency(from, graphNode(m[2]))
+	}
+	return sc.Err()
+}
+
+// graphNode strips the decorations older terraform versions add to node
+// names, e.g. "[root] module.network (close)" becomes "module.network".
+func graphNode(s string) string {
+	s = strings.ReplaceAll(s, `\"`, `"`)
+	s = strings.TrimPrefix(s, "[root] ")
+	if i := strings.Index(s, " ("); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package diagram
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Output formats.
+const (
+	FormatMermaid = "mermaid"
+	FormatDOT     = "dot"
+	FormatSVG     = "svg"
+)
+
+// Write renders g in the named format.
+func Write(w io.Writer, g *Graph, format string) error {
+	switch format {
+	case FormatMermaid:
+		return WriteMermaid(w, g)
+	case FormatDOT:
+		return WriteDOT(w, g)
+	case FormatSVG:
+		return WriteSVG(w, g)
+	default:
+		return fmt.Errorf("diagram: unknown format %q", format)
+	}
+}
+
+// WriteMermaid renders g as a Mermaid flowchart for Markdown docs.
+func WriteMermaid(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	modules := g.Modules()
+	for _, s := range usedStyles(modules) {
+		fmt.Fprintf(&b, "  classDef %s fill:%s,stroke:%s,color:#1B1A19", s.Class, s.Fill, s.Stroke)
+		if s.Dashed {
+			b.WriteString(",stroke-dasharray:4 3")
+		}
+		b.WriteString("\n")
+	}
+	for _, m := range modules {
+		text := lines(m)
+		text[0] = "<b>" + text[0] + "</b>"
+		fmt.Fprintf(&b, "  %s[\"%s\"]:::%s\n", nodeID(m.Name), strings.Join(text, "<br/>"), StyleOf(m).Class)
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "  %s --> %s\n", nodeID(e.From), nodeID(e.To))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteDOT renders g for Graphviz.
+func WriteDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph infrastructure {\n")
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Segoe UI\", fontsize=11];\n")
+	b.WriteString("  edge [color=\"#605E5C\"];\n")
+	for _, m := range g.Modules() {
+		s := StyleOf(m)
+		style := "rounded,filled"
+		if s.Dashed {
+			style += ",dashed"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q, fillcolor=%q, color=%q, style=%q];\n",
+			m.Name, strings.Join(lines(m), "\n"), s.Fill, s.Stroke, style)
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "  %q -> %q;\n", e.From, e.To)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func usedStyles(modules []Module) []Style {
+	used := map[string]Style{}
+	for _, m := range modules {
+		s := StyleOf(m)
+		used[s.Class] = s
+	}
+	out := make([]Style, 0, len(used))
+	for _, s := range used {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Class < out[j].Class })
+	return out
+}
+
+// nodeID makes a Mermaid-safe identifier. Module names are already
+// identifiers, but "end" and friends are Mermaid keywords.
+func nodeID(name string) string {
+	return "m_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,92 @@
+package diagram
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Style is how a boundary is drawn, chosen from the Azure service family
+// of the resources inside it.
+type Style struct {
+	Class  string // CSS / Mermaid class name
+	Fill   string
+	Stroke string
+	Dashed bool
+}
+
+// Styles in priority order: a module with resources from several families
+// takes the first one it contains the most of.
+var styles = []Style{
+	{Class: "web", Fill: "#E5F1FB", Stroke: "#0078D4"},
+	{Class: "storage", Fill: "#FFF4CE", Stroke: "#986F0B"},
+	{Class: "security", Fill: "#FDE7E9", Stroke: "#A4262C"},
+	{Class: "network", Fill: "#DFF6DD", Stroke: "#107C10"},
+	{Class: "management", Fill: "#F3F2F1", Stroke: "#605E5C"},
+	{Class: "logic", Fill: "#FFFFFF", Stroke: "#8A8886", Dashed: true},
+}
+
+// families maps resource types to a style class. Types not listed fall
+// back to prefix rules in family.
+var families = map[string]string{
+	"azurerm_resource_group":                            "management",
+	"azurerm_service_plan":                              "web",
+	"azurerm_linux_web_app":                             "web",
+	"azurerm_windows_web_app":                           "web",
+	"azurerm_storage_account":                           "storage",
+	"azurerm_storage_container":                         "storage",
+	"azurerm_key_vault":                                 "security",
+	"azurerm_virtual_network":                           "network",
+	"azurerm_subnet":                                    "network",
+	"azurerm_network_security_group":                    "network",
+	"azurerm_subnet_network_security_group_association": "network",
+	"null_resource":                                     "logic",
+}
+
+func family(typ string) string {
+	if f, ok := families[typ]; ok {
+		return f
+	}
+	switch {
+	case strings.HasPrefix(typ, "azurerm_key_vault"):
+		return "security"
+	case strings.HasPrefix(typ, "azurerm_storage"):
+		return "storage"
+	case strings.Contains(typ, "network") || strings.Contains(typ, "subnet"):
+		return "network"
+	case strings.Contains(typ, "web_app") || strings.HasPrefix(typ, "azurerm_app_service"):
+		return "web"
+	case strings.HasPrefix(typ, "azurerm_"):
+		return "management"
+	}
+	return "logic"
+}
+
+// StyleOf picks the style for a module. Modules without resources, such as
+// validation and tagging, are drawn as logic-only boundaries.
+func StyleOf(m Module) Style {
+	counts := map[string]int{}
+	for typ, n := range m.Resources {
+		counts[family(typ)] += n
+	}
+	best, bestN := styles[len(styles)-1], 0
+	for _, s := range styles {
+		if counts[s.Class] > bestN {
+			best, bestN = s, counts[s.Class]
+		}
+	}
+	return best
+}
+
+// lines is the text of a module's box: its name, then one line per
+// resource type without the provider prefix.
+func lines(m Module) []string {
+	out := []string{m.Name}
+	for _, typ := range m.Types() {
+		label := strings.TrimPrefix(typ, "azurerm_")
+		if n := m.Resources[typ]; n > 1 {
+			label = fmt.Sprintf("%s ×%d", label, n)
+		}
+		out = append(out, label)
+	}
+	return out
+}
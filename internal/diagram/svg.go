@@ -0,0 +1,144 @@
+package diagram
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// SVG layout, in pixels.
+const (
+	boxWidth   = 200
+	lineHeight = 16
+	boxPadding = 12
+	colGap     = 40
+	rowGap     = 56
+	margin     = 20
+)
+
+type box struct {
+	m       Module
+	x, y, h int
+	text    []string
+	row     int
+}
+
+// WriteSVG renders g as a standalone SVG image. Modules are placed in rows
+// by dependency depth, so everything a module depends on sits above it,
+// and sorted by name within a row.
+func WriteSVG(w io.Writer, g *Graph) error {
+	modules := g.Modules()
+	edges := g.Edges()
+	depth := depths(modules, edges)
+
+	var rows [][]*box
+	boxes := map[string]*box{}
+	for _, m := range modules {
+		d := depth[m.Name]
+		for len(rows) <= d {
+			rows = append(rows, nil)
+		}
+		text := lines(m)
+		b := &box{m: m, text: text, h: 2*boxPadding + len(text)*lineHeight, row: d}
+		rows[d] = append(rows[d], b)
+		boxes[m.Name] = b
+	}
+
+	widest := 0
+	for _, row := range rows {
+		if len(row) > widest {
+			widest = len(row)
+		}
+	}
+	width := 2*margin + widest*boxWidth + max(widest-1, 0)*colGap
+	y := margin
+	for _, row := range rows {
+		rowWidth := len(row)*boxWidth + max(len(row)-1, 0)*colGap
+		x := (width - rowWidth) / 2
+		rowHeight := 0
+		for _, b := range row {
+			b.x, b.y = x, y
+			x += boxWidth + colGap
+			if b.h > rowHeight {
+				rowHeight = b.h
+			}
+		}
+		y += rowHeight + rowGap
+	}
+	height := y - rowGap + margin
+	if len(rows) == 0 {
+		height = 2 * margin
+	}
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"Segoe UI, sans-serif\" font-size=\"12\">\n",
+		width, height, width, height)
+	s.WriteString("  <defs>\n")
+	s.WriteString("    <marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto-start-reverse\">\n")
+	s.WriteString("      <path d=\"M 0 0 L 10 5 L 0 10 z\" fill=\"#605E5C\"/>\n")
+	s.WriteString("    </marker>\n")
+	s.WriteString("  </defs>\n")
+
+	for _, e := range edges {
+		from, to := boxes[e.From], boxes[e.To]
+		x1, y1 := from.x+boxWidth/2, from.y+from.h
+		x2, y2 := to.x+boxWidth/2, to.y
+		if to.row <= from.row {
+			// Only possible with a cycle between modules; draw it from the
+			// side so it is still visible.
+			x1, y1 = from.x+boxWidth, from.y+from.h/2
+			x2, y2 = to.x+boxWidth, to.y+to.h/2
+		}
+		fmt.Fprintf(&s, "  <line class=\"edge\" x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#605E5C\" marker-end=\"url(#arrow)\"/>\n",
+			x1, y1, x2, y2)
+	}
+
+	for _, m := range modules {
+		b := boxes[m.Name]
+		st := StyleOf(m)
+		dash := ""
+		if st.Dashed {
+			dash = " stroke-dasharray=\"4 3\""
+		}
+		fmt.Fprintf(&s, "  <g class=\"module %s\" id=\"module-%s\">\n", st.Class, html.EscapeString(m.Name))
+		fmt.Fprintf(&s, "    <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"6\" fill=\"%s\" stroke=\"%s\"%s/>\n",
+			b.x, b.y, boxWidth, b.h, st.Fill, st.Stroke, dash)
+		for i, line := range b.text {
+			weight := ""
+			if i == 0 {
+				weight = " font-weight=\"bold\""
+			}
+			fmt.Fprintf(&s, "    <text x=\"%d\" y=\"%d\" text-anchor=\"middle\"%s>%s</text>\n",
+				b.x+boxWidth/2, b.y+boxPadding+(i+1)*lineHeight-4, weight, html.EscapeString(line))
+		}
+		s.WriteString("  </g>\n")
+	}
+	s.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, s.String())
+	return err
+}
+
+// depths assigns each module the length of the longest dependency chain
+// above it. Relaxation stops after len(modules) rounds, which bounds the
+// work if the modules form a cycle.
+func depths(modules []Module, edges []Edge) map[string]int {
+	d := make(map[string]int, len(modules))
+	for _, m := range modules {
+		d[m.Name] = 0
+	}
+	for round := 0; round < len(modules); round++ {
+		changed := false
+		for _, e := range edges {
+			if d[e.To] < d[e.From]+1 && d[e.From]+1 < len(modules) {
+				d[e.To] = d[e.From] + 1
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return d
+}
@@ -0,0 +1,243 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+func checkTerraform(ctx context.Context, e Env, cfg *tfconfig.Config) Result {
+	r := Result{Check: "terraform"}
+	out, err := e.Terraform(ctx, "version", "-json")
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("cannot run terraform: %v", err)
+		r.Remediation = fmt.Sprintf("Install a Terraform release matching %q and put it on PATH.", cfg.RequiredVersion)
+		return r
+	}
+	var v struct {
+		Version string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(out, &v); err != nil || v.Version == "" {
+		r.Status = StatusFail
+		r.Detail = "cannot read the output of terraform version -json"
+		r.Remediation = "Terraform older than 0.13 has no -json output; upgrade it."
+		return r
+	}
+	if cfg.RequiredVersion == "" {
+		r.Status = StatusOK
+		r.Detail = v.Version
+		return r
+	}
+
+	have, err := version.NewVersion(v.Version)
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("unrecognized terraform version %q", v.Version)
+		return r
+	}
+	want, err := version.NewConstraint(cfg.RequiredVersion)
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("invalid required_version %q: %v", cfg.RequiredVersion, err)
+		r.Remediation = "Fix required_version in the root module's terraform block."
+		return r
+	}
+	if !want.Check(have) {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("%s does not satisfy required_version %q", v.Version, cfg.RequiredVersion)
+		r.Remediation = fmt.Sprintf("Install a Terraform release matching %q, e.g. with tfenv or from https://developer.hashicorp.com/terraform/install.", cfg.RequiredVersion)
+		return r
+	}
+	r.Status = StatusOK
+	r.Detail = fmt.Sprintf("%s satisfies %q", v.Version, cfg.RequiredVersion)
+	return r
+}
+
+func checkLockFile(e Env) Result {
+	r := Result{Check: "lock file"}
+	path := filepath.Join(e.Dir, tfconfig.LockFile)
+	locked, err := tfconfig.LoadLock(path)
+	if err != nil {
+		r.Status = StatusFail
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+			r.Detail = tfconfig.LockFile + " is missing"
+		} else {
+			r.Detail = err.Error()
+		}
+		r.Remediation = "Run terraform init in the root module and commit " + tfconfig.LockFile + ",\nso every run installs the same provider versions."
+		return r
+	}
+	var providers []string
+	for _, p := range locked {
+		providers = append(providers, strings.TrimPrefix(p.Source, "registry.terraform.io/"))
+	}
+	if len(providers) == 0 {
+		r.Status = StatusWarn
+		r.Detail = tfconfig.LockFile + " pins no providers"
+		r.Remediation = "Run terraform init to record the providers the configuration uses."
+		return r
+	}
+	r.Status = StatusOK
+	r.Detail = "pins " + strings.Join(providers, ", ")
+	return r
+}
+
+// credentialVars are the variables azauth reads. Only their names are
+// ever reported.
+var credentialVars = []string{
+	"ARM_SUBSCRIPTION_ID",
+	"AZURE_SUBSCRIPTION_ID",
+	"ARM_TENANT_ID",
+	"ARM_CLIENT_ID",
+	"ARM_CLIENT_SECRET",
+	"ARM_OIDC_TOKEN_FILE_PATH",
+	"AZURE_FEDERATED_TOKEN_FILE",
+	"ARM_USE_MSI",
+}
+
+func checkCredentials(e Env, cred *azauth.Credential, err error) Result {
+	r := Result{Check: "credentials"}
+	var set []string
+	for _, name := range credentialVars {
+		if e.Getenv(name) != "" {
+			set = append(set, name)
+		}
+	}
+	vars := "none of the ARM_* variables are set"
+	if len(set) > 0 {
+		vars = "set: " + strings.Join(set, ", ")
+	}
+
+	switch {
+	case errors.Is(err, azauth.ErrNoCredentials):
+		r.Status = StatusWarn
+		r.Detail = vars + ", and the Azure CLI is not logged in"
+		r.Remediation = "Run az login, or export ARM_SUBSCRIPTION_ID, ARM_TENANT_ID, ARM_CLIENT_ID\nand ARM_CLIENT_SECRET for a service principal."
+	case err != nil:
+		r.Status = StatusFail
+		r.Detail = strings.TrimPrefix(err.Error(), "azauth: ")
+		r.Remediation = "Fix or unset the variables above. Credentials resolve in this order: client secret,\nOIDC token file, managed identity (ARM_USE_MSI=true), Azure CLI."
+	default:
+		r.Status = StatusOK
+		r.Detail = fmt.Sprintf("%s (%s)", cred, vars)
+	}
+	return r
+}
+
+func checkBackend(ctx context.Context, e Env, cfg *tfconfig.Config) Result {
+	r := Result{Check: "backend"}
+	switch cfg.Backend {
+	case "", "local":
+		r.Status = StatusOK
+		r.Detail = "local state; nothing to reach"
+		return r
+	case "azurerm":
+	default:
+		r.Status = StatusWarn
+		r.Detail = fmt.Sprintf("%s backend is not checked", cfg.Backend)
+		return r
+	}
+
+	account := cfg.BackendConfig["storage_account_name"]
+	if account == "" {
+		r.Status = StatusWarn
+		r.Detail = "azurerm backend has no storage_account_name; it is given at init time and not checked"
+		return r
+	}
+	addr := net.JoinHostPort(account+".blob.core.windows.net", "443")
+	conn, err := e.Dial(ctx, "tcp", addr)
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("cannot reach %s: %v", addr, err)
+		r.Remediation = fmt.Sprintf("Check that storage account %s exists and that its firewall, your VPN or proxy\nallow this machine. For offline work run terraform init -backend=false.", account)
+		return r
+	}
+	conn.Close()
+	r.Status = StatusOK
+	r.Detail = fmt.Sprintf("azurerm state in %s/%s reachable", account, cfg.BackendConfig["container_name"])
+	return r
+}
+
+var cliConfigSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "plugin_cache_dir"}},
+}
+
+func checkPluginCache(e Env) Result {
+	r := Result{Check: "plugin cache"}
+	dir, source := e.Getenv("TF_PLUGIN_CACHE_DIR"), "TF_PLUGIN_CACHE_DIR"
+	if dir == "" {
+		source = e.Getenv("TF_CLI_CONFIG_FILE")
+		if source == "" && e.Home != "" {
+			source = filepath.Join(e.Home, ".terraformrc")
+		}
+		dir = cliConfigCacheDir(source)
+	}
+	if dir == "" {
+		r.Status = StatusWarn
+		r.Detail = "not configured; every init downloads its providers again"
+		r.Remediation = "export TF_PLUGIN_CACHE_DIR=\"$HOME/.terraform.d/plugin-cache\"\nmkdir -p \"$TF_PLUGIN_CACHE_DIR\""
+		return r
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		r.Status = StatusWarn
+		r.Detail = fmt.Sprintf("%s (from %s) does not exist, so terraform ignores it", dir, source)
+		r.Remediation = fmt.Sprintf("mkdir -p %q", dir)
+		return r
+	}
+	r.Status = StatusOK
+	r.Detail = fmt.Sprintf("%s (from %s)", dir, source)
+	return r
+}
+
+// cliConfigCacheDir returns plugin_cache_dir from a CLI configuration file,
+// or "" when the file does not exist or does not set it.
+func cliConfigCacheDir(path string) string {
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	f, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return ""
+	}
+	content, _, _ := f.Body.PartialContent(cliConfigSchema)
+	if attr, ok := content.Attributes["plugin_cache_dir"]; ok {
+		return tfconfig.StringValue(attr)
+	}
+	return ""
+}
+
+// checkLiveTests mirrors azureCredential in test/, which skips the live
+// tests when azauth finds no credentials and fails them on bad ones.
+func checkLiveTests(cred *azauth.Credential, err error) Result {
+	r := Result{Check: "live tests"}
+	switch {
+	case errors.Is(err, azauth.ErrNoCredentials):
+		r.Status = StatusWarn
+		r.Detail = "will skip: no Azure credentials"
+		r.Remediation = "Log in or set credentials (see above) to run them; they create and destroy\nreal resources."
+	case err != nil:
+		r.Status = StatusFail
+		r.Detail = "will fail: the credentials do not resolve"
+		r.Remediation = "Fix the credentials check first."
+	default:
+		r.Status = StatusOK
+		r.Detail = fmt.Sprintf("will run in subscription %s (performance tests still skip under -short)", cred.SubscriptionID)
+	}
+	return r
+}
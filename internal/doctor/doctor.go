@@ -0,0 +1,147 @@
+// Package doctor checks that a workstation or CI runner is set up to plan
+// this project and run its live tests.
+//
+// Every check reports what it found and, when something is missing, what
+// to do about it. Checks only read: they never run init, log in or write
+// configuration.
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+// Statuses, from best to worst.
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Check       string `json:"check"`
+	Status      string `json:"status"`
+	Detail      string `json:"detail"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Env is what the checks look at. The zero value of each hook means the
+// real thing, so tests can replace only what they need.
+type Env struct {
+	// Dir is the root module directory.
+	Dir string
+
+	// Getenv looks up environment variables.
+	Getenv func(string) string
+
+	// Terraform runs the terraform binary and returns its stdout.
+	Terraform func(ctx context.Context, args ...string) ([]byte, error)
+
+	// Dial opens a TCP connection, for the backend check.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// AzureCLIAccount returns the Azure CLI's logged-in account, for
+	// credential resolution. Nil runs az account show.
+	AzureCLIAccount func(ctx context.Context) (azauth.Account, error)
+
+	// Home is the user's home directory, where terraform looks for its
+	// CLI configuration.
+	Home string
+}
+
+func (e *Env) defaults() {
+	if e.Dir == "" {
+		e.Dir = "."
+	}
+	if e.Getenv == nil {
+		e.Getenv = os.Getenv
+	}
+	if e.Terraform == nil {
+		e.Terraform = func(ctx context.Context, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, "terraform", args...).Output()
+		}
+	}
+	if e.Dial == nil {
+		d := &net.Dialer{Timeout: 5 * time.Second}
+		e.Dial = d.DialContext
+	}
+	if e.Home == "" {
+		e.Home, _ = os.UserHomeDir()
+	}
+}
+
+// Run runs every check in order.
+func Run(ctx context.Context, e Env) []Result {
+	e.defaults()
+	cfg, err := tfconfig.Load(e.Dir)
+	if err != nil {
+		return []Result{{
+			Check:       "configuration",
+			Status:      StatusFail,
+			Detail:      err.Error(),
+			Remediation: "Run the doctor from the root module, or pass -dir.",
+		}}
+	}
+	resolver := &azauth.Resolver{Getenv: e.Getenv, AzureCLIAccount: e.AzureCLIAccount}
+	cred, credErr := resolver.Resolve(ctx)
+	return []Result{
+		checkTerraform(ctx, e, cfg),
+		checkLockFile(e),
+		checkCredentials(e, cred, credErr),
+		checkBackend(ctx, e, cfg),
+		checkPluginCache(e),
+		checkLiveTests(cred, credErr),
+	}
+}
+
+// Passed reports whether no check failed. Warnings pass.
+func Passed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+var marks = map[string]string{StatusOK: "✓", StatusWarn: "!", StatusFail: "✗"}
+
+// WriteText writes one line per check, with remediation indented below
+// the checks that need it.
+func WriteText(w io.Writer, results []Result) error {
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s %-14s %s\n", marks[r.Status], r.Check, r.Detail); err != nil {
+			return err
+		}
+		if r.Remediation != "" {
+			for _, line := range strings.Split(r.Remediation, "\n") {
+				if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the results with an overall "passed" flag.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(struct {
+		Passed bool     `json:"passed"`
+		Checks []Result `json:"checks"`
+	}{Passed(results), results})
+}
@@ -0,0 +1,201 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+const mainTF = `
+terraform {
+  required_version = ">= 1.8.0"
+  backend "azurerm" {
+    storage_account_name = "tfstatedemo"
+    container_name       = "tfstate"
+  }
+}
+`
+
+const lockHCL = `
+provider "registry.terraform.io/hashicorp/azurerm" {
+  version = "4.30.0"
+}
+provider "registry.terraform.io/hashicorp/random" {
+  version = "3.7.2"
+}
+`
+
+// testEnv is a root module where every check passes.
+func testEnv(t *testing.T, vars map[string]string) (Env, *[]string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(mainTF), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tfconfig.LockFile), []byte(lockHCL), 0o644))
+	cache := filepath.Join(dir, "plugin-cache")
+	require.NoError(t, os.Mkdir(cache, 0o755))
+	if _, ok := vars["TF_PLUGIN_CACHE_DIR"]; !ok {
+		vars["TF_PLUGIN_CACHE_DIR"] = cache
+	}
+
+	var dialed []string
+	return Env{
+		Dir:    dir,
+		Home:   dir,
+		Getenv: func(name string) string { return vars[name] },
+		Terraform: func(ctx context.Context, args ...string) ([]byte, error) {
+			return []byte(`{"terraform_version":"1.9.5","platform":"linux_amd64"}`), nil
+		},
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		},
+		AzureCLIAccount: notLoggedIn,
+	}, &dialed
+}
+
+func notLoggedIn(context.Context) (azauth.Account, error) {
+	return azauth.Account{}, errors.New("az: not logged in")
+}
+
+func byCheck(results []Result) map[string]Result {
+	out := make(map[string]Result, len(results))
+	for _, r := range results {
+		out[r.Check] = r
+	}
+	return out
+}
+
+func TestRunHealthySetup(t *testing.T) {
+	env, dialed := testEnv(t, map[string]string{
+		"ARM_SUBSCRIPTION_ID":   "sub-1",
+		"AZURE_SUBSCRIPTION_ID": "sub-1",
+		"ARM_TENANT_ID":         "tenant",
+		"ARM_CLIENT_ID":         "client",
+		"ARM_CLIENT_SECRET":     "s3cret",
+	})
+	results := Run(context.Background(), env)
+	require.Len(t, results, 6)
+	for _, r := range results {
+		assert.Equal(t, StatusOK, r.Status, "%s: %s", r.Check, r.Detail)
+		assert.Empty(t, r.Remediation, r.Check)
+	}
+	assert.True(t, Passed(results))
+	assert.Equal(t, []string{"tfstatedemo.blob.core.windows.net:443"}, *dialed)
+
+	got := byCheck(results)
+	assert.Equal(t, `1.9.5 satisfies ">= 1.8.0"`, got["terraform"].Detail)
+	assert.Equal(t, "pins hashicorp/azurerm, hashicorp/random", got["lock file"].Detail)
+	assert.Equal(t, "client secret in subscription sub-1 as client (set: ARM_SUBSCRIPTION_ID, AZURE_SUBSCRIPTION_ID, ARM_TENANT_ID, ARM_CLIENT_ID, ARM_CLIENT_SECRET)", got["credentials"].Detail)
+	assert.NotContains(t, got["credentials"].Detail, "s3cret")
+}
+
+func TestRunReportsProblemsWithRemediation(t *testing.T) {
+	env, _ := testEnv(t, map[string]string{"ARM_SUBSCRIPTION_ID": "sub-1", "TF_PLUGIN_CACHE_DIR": ""})
+	env.Terraform = func(ctx context.Context, args ...string) ([]byte, error) {
+		return []byte(`{"terraform_version":"1.5.7"}`), nil
+	}
+	env.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("no such host")
+	}
+	require.NoError(t, os.Remove(filepath.Join(env.Dir, tfconfig.LockFile)))
+
+	results := Run(context.Background(), env)
+	assert.False(t, Passed(results))
+	got := byCheck(results)
+
+	assert.Equal(t, StatusFail, got["terraform"].Status)
+	assert.Contains(t, got["terraform"].Remediation, `">= 1.8.0"`)
+	assert.Equal(t, StatusFail, got["lock file"].Status)
+	assert.Equal(t, ".terraform.lock.hcl is missing", got["lock file"].Detail)
+	assert.Equal(t, StatusFail, got["backend"].Status)
+	assert.Contains(t, got["backend"].Remediation, "tfstatedemo")
+	assert.Equal(t, StatusWarn, got["plugin cache"].Status)
+	assert.Contains(t, got["plugin cache"].Remediation, "TF_PLUGIN_CACHE_DIR")
+	assert.Equal(t, StatusWarn, got["credentials"].Status)
+	assert.Contains(t, got["credentials"].Remediation, "az login")
+	assert.Equal(t, StatusWarn, got["live tests"].Status)
+	assert.Equal(t, "will skip: no Azure credentials", got["live tests"].Detail)
+}
+
+func TestCredentialsAndLiveTests(t *testing.T) {
+	loggedIn := func(context.Context) (azauth.Account, error) {
+		return azauth.Account{SubscriptionID: "cli-sub", TenantID: "t"}, nil
+	}
+	cases := []struct {
+		name   string
+		vars   map[string]string
+		cli    func(context.Context) (azauth.Account, error)
+		status string
+		live   string
+		detail string
+	}{
+		{"none", map[string]string{}, notLoggedIn, StatusWarn, StatusWarn, "none of the ARM_*"},
+		{"cli", map[string]string{}, loggedIn, StatusOK, StatusOK, "Azure CLI in subscription cli-sub"},
+		{"oidc", map[string]string{"ARM_SUBSCRIPTION_ID": "s", "ARM_OIDC_TOKEN_FILE_PATH": "/token", "ARM_CLIENT_ID": "c", "ARM_TENANT_ID": "t"}, notLoggedIn, StatusOK, StatusOK, "OIDC in subscription s as c"},
+		{"msi", map[string]string{"AZURE_SUBSCRIPTION_ID": "s", "ARM_USE_MSI": "true"}, notLoggedIn, StatusOK, StatusOK, "managed identity"},
+		{"secret without tenant", map[string]string{"ARM_SUBSCRIPTION_ID": "s", "ARM_CLIENT_ID": "c", "ARM_CLIENT_SECRET": "x"}, notLoggedIn, StatusFail, StatusFail, "needs ARM_CLIENT_ID and ARM_TENANT_ID"},
+		{"different subscriptions", map[string]string{"ARM_SUBSCRIPTION_ID": "a", "AZURE_SUBSCRIPTION_ID": "b"}, loggedIn, StatusFail, StatusFail, "different subscriptions"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, _ := testEnv(t, tc.vars)
+			env.AzureCLIAccount = tc.cli
+			got := byCheck(Run(context.Background(), env))
+
+			assert.Equal(t, tc.status, got["credentials"].Status, got["credentials"].Detail)
+			assert.Contains(t, got["credentials"].Detail, tc.detail)
+			if tc.status != StatusOK {
+				assert.NotEmpty(t, got["credentials"].Remediation)
+			}
+			assert.Equal(t, tc.live, got["live tests"].Status, got["live tests"].Detail)
+		})
+	}
+}
+
+func TestPluginCacheFromCLIConfig(t *testing.T) {
+	home := t.TempDir()
+	cache := filepath.Join(home, "cache")
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".terraformrc"),
+		[]byte("plugin_cache_dir = \""+cache+"\"\nprovider_installation {\n  direct {}\n}\n"), 0o644))
+	env := Env{Home: home, Getenv: func(string) string { return "" }}
+
+	r := checkPluginCache(env)
+	assert.Equal(t, StatusWarn, r.Status)
+	assert.Contains(t, r.Detail, "does not exist")
+
+	require.NoError(t, os.Mkdir(cache, 0o755))
+	r = checkPluginCache(env)
+	assert.Equal(t, StatusOK, r.Status)
+	assert.Equal(t, cache+" (from "+filepath.Join(home, ".terraformrc")+")", r.Detail)
+}
+
+func TestWriteJSON(t *testing.T) {
+	results := []Result{{Check: "terraform", Status: StatusOK, Detail: "1.9.5"}, {Check: "backend", Status: StatusFail, Detail: "down", Remediation: "fix it"}}
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, results))
+
+	var got struct {
+		Passed bool
+		Checks []Result
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.False(t, got.Passed)
+	assert.Equal(t, results, got.Checks)
+
+	buf.Reset()
+	require.NoError(t, WriteText(&buf, results))
+	assert.Equal(t, "✓ terraform      1.9.5\n✗ backend        down\n    fix it\n", buf.String())
+}
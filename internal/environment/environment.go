@@ -0,0 +1,167 @@
+// Package environment loads the environments/*.tfvars files and pairs each
+// with the terraform workspace it is applied in.
+//
+// The Makefile selects the workspace named after the var file, dev for
+// environments/dev.tfvars, and every tool that plans an environment does
+// the same, so they all see the same state.
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/tfrun"
+)
+
+// Dir is where the root module keeps its var files.
+const Dir = "environments"
+
+// Environment is one var file.
+type Environment struct {
+	// Name is the var file's base name, e.g. "dev".
+	Name string
+
+	// VarFile is the absolute path of the var file.
+	VarFile string
+
+	// Workspace is the terraform workspace, Name unless overridden.
+	Workspace string
+
+	// Vars holds the var file's values, decoded as encoding/json would.
+	Vars map[string]interface{}
+}
+
+// Load reads every var file under root/environments, sorted by name.
+func Load(root string) ([]*Environment, error) {
+	files, err := filepath.Glob(filepath.Join(root, Dir, "*.tfvars"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("environment: no var files in %s", filepath.Join(root, Dir))
+	}
+	sort.Strings(files)
+	out := make([]*Environment, 0, len(files))
+	for _, f := range files {
+		env, err := LoadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, env)
+	}
+	return out, nil
+}
+
+// Get returns one environment, named either like "dev" or by the path of
+// its var file.
+func Get(root, name string) (*Environment, error) {
+	if strings.HasSuffix(name, ".tfvars") {
+		return LoadFile(name)
+	}
+	path := filepath.Join(root, Dir, name+".tfvars")
+	if _, err := os.Stat(path); err != nil {
+		envs, _ := Load(root)
+		names := make([]string, 0, len(envs))
+		for _, e := range envs {
+			names = append(names, e.Name)
+		}
+		return nil, fmt.Errorf("environment: unknown environment %q (have %s)", name, strings.Join(names, ", "))
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads one var file.
+func LoadFile(path string) (*Environment, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := parseVars(abs)
+	if err != nil {
+		return nil, err
+	}
+	name := tfrun.WorkspaceFor(abs)
+	return &Environment{Name: name, VarFile: abs, Workspace: name, Vars: vars}, nil
+}
+
+func parseVars(path string) (map[string]interface{}, error) {
+	f, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("environment: %s", diags.Error())
+	}
+	attrs, diags := f.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("environment: %s", diags.Error())
+	}
+	vars := make(map[string]interface{}, len(attrs))
+	for name, attr := range attrs {
+		v, err := attrValue(attr)
+		if err != nil {
+			return nil, fmt.Errorf("environment: %s: %s: %w", path, name, err)
+		}
+		vars[name] = v
+	}
+	return vars, nil
+}
+
+// attrValue evaluates a var file value. Var files hold literals only, so
+// there is no evaluation context.
+func attrValue(attr *hcl.Attribute) (interface{}, error) {
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s", diags.Error())
+	}
+	data, err := ctyjson.SimpleJSONValue{Value: val}.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// StringVar returns a string variable, or "" when it is unset or not a
+// string.
+func (e *Environment) StringVar(name string) string {
+	s, _ := e.Vars[name].(string)
+	return s
+}
+
+// Runner returns a terraform runner for the root module at dir, in the
+// environment's workspace.
+func (e *Environment) Runner(dir string) *tfrun.Runner {
+	return &tfrun.Runner{Dir: dir, Workspace: e.Workspace}
+}
+
+// Args returns the terraform arguments that select the var file. The path
+// is absolute because terraform resolves it relative to -chdir.
+func (e *Environment) Args() []string {
+	return []string{"-var-file=" + e.VarFile}
+}
+
+// PlanJSON plans the root module at dir for the environment, with extra
+// arguments such as -refresh-only, and returns show -json output.
+func (e *Environment) PlanJSON(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return e.Runner(dir).PlanJSON(ctx, append(e.Args(), args...)...)
+}
+
+// Plan is PlanJSON, parsed.
+func (e *Environment) Plan(ctx context.Context, dir string, args ...string) (*plan.Plan, error) {
+	data, err := e.PlanJSON(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	return plan.ParseJSON(data)
+}
@@ -0,0 +1,49 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRepositoryEnvironments(t *testing.T) {
+	envs, err := Load("../..")
+	require.NoError(t, err)
+	require.Len(t, envs, 2)
+
+	dev := envs[0]
+	assert.Equal(t, "dev", dev.Name)
+	assert.Equal(t, "dev", dev.Workspace)
+	assert.True(t, filepath.IsAbs(dev.VarFile))
+	assert.Equal(t, "westeurope", dev.StringVar("location"))
+	assert.Equal(t, "mytfstoragehiddedev", dev.StringVar("storage_account_name"))
+	assert.Equal(t, []string{"-var-file=" + dev.VarFile}, dev.Args())
+
+	assert.Equal(t, "prod", envs[1].Name)
+}
+
+func TestGet(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, Dir), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, Dir, "test.tfvars"), []byte(`
+location = "northeurope"
+tags     = { Owner = "platform", Tier = 2 }
+zones    = ["1", "2"]
+`), 0o644))
+
+	env, err := Get(root, "test")
+	require.NoError(t, err)
+	assert.Equal(t, "test", env.Workspace)
+	assert.Equal(t, map[string]interface{}{"Owner": "platform", "Tier": float64(2)}, env.Vars["tags"])
+	assert.Equal(t, []interface{}{"1", "2"}, env.Vars["zones"])
+
+	byPath, err := Get(root, filepath.Join(root, Dir, "test.tfvars"))
+	require.NoError(t, err)
+	assert.Equal(t, env, byPath)
+
+	_, err = Get(root, "staging")
+	assert.ErrorContains(t, err, `unknown environment "staging" (have test)`)
+}
@@ -0,0 +1,168 @@
+// Package guard stops plans that would destroy stateful resources.
+//
+// A key vault or storage account that is deleted or replaced takes its
+// secrets, blobs and containers with it. The guard lists every delete or
+// replace of a protected resource and refuses the plan unless the caller
+// supplies the override token for exactly that set of changes. The token
+// is derived from the changes themselves, so an override approved for one
+// plan does not carry over to a different one.
+package guard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+// DefaultProtected is the protected list used when none is configured.
+var DefaultProtected = []string{
+	"azurerm_key_vault",
+	"azurerm_storage_account",
+	"azurerm_storage_container",
+}
+
+// Guard checks plans against a protected-resource list.
+type Guard struct {
+	// Protected holds resource types or address patterns. An entry
+	// containing a dot is matched against the instance address, otherwise
+	// against the resource type. "*" matches any run of characters, e.g.
+	// "module.keyvault.*" or "azurerm_storage_*".
+	Protected []string
+}
+
+// New returns a guard for patterns, or for DefaultProtected when patterns
+// is empty.
+func New(patterns ...string) *Guard {
+	if len(patterns) == 0 {
+		patterns = DefaultProtected
+	}
+	return &Guard{Protected: patterns}
+}
+
+// Violation is one destructive change to a protected resource.
+type Violation struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Action  string `json:"action"`
+
+	// Rule is the protected entry that matched.
+	Rule string `json:"rule"`
+}
+
+// Result is the outcome of checking a plan.
+type Result struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Check lists the deletes and replacements of protected resources in p,
+// sorted by address.
+func (g *Guard) Check(p *plan.Plan) *Result {
+	res := &Result{}
+	for _, rc := range p.ResourceChanges {
+		if !rc.Managed() || !rc.Actions.Destroys() {
+			continue
+		}
+		rule, ok := g.match(rc)
+		if !ok {
+			continue
+		}
+		action := "delete"
+		if rc.Actions.Replace() {
+			action = "replace"
+		}
+		res.Violations = append(res.Violations, Violation{
+			Address: rc.Address,
+			Type:    rc.Type,
+			Action:  action,
+			Rule:    rule,
+		})
+	}
+	sort.Slice(res.Violations, func(i, j int) bool { return res.Violations[i].Address < res.Violations[j].Address })
+	return res
+}
+
+func (g *Guard) match(rc plan.ResourceChange) (string, bool) {
+	for _, pattern := range g.Protected {
+		subject := rc.Type
+		if strings.Contains(pattern, ".") {
+			subject = rc.Address
+		}
+		if globMatch(pattern, subject) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// globMatch matches s against a pattern where "*" is the only wildcard.
+// Addresses contain brackets and quotes, so path.Match's character
+// classes would get in the way.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(s)
+}
+
+// Token is the override that approves exactly these violations. It is
+// empty when there is nothing to approve.
+func (r *Result) Token() string {
+	if len(r.Violations) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, v := range r.Violations {
+		fmt.Fprintf(h, "%s %s\n", v.Action, v.Address)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// Err returns nil if the plan is safe or override matches Token, and an
+// *BlockedError otherwise.
+func (r *Result) Err(override string) error {
+	if len(r.Violations) == 0 || override == r.Token() {
+		return nil
+	}
+	return &BlockedError{Result: r, Override: override}
+}
+
+// BlockedError is returned when protected resources would be destroyed
+// without a matching override.
+type BlockedError struct {
+	Result   *Result
+	Override string
+}
+
+func (e *BlockedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "plan destroys %d protected resource(s):", len(e.Result.Violations))
+	for _, v := range e.Result.Violations {
+		fmt.Fprintf(&b, "\n  %s %s (protected by %q)", v.Action, v.Address, v.Rule)
+	}
+	if e.Override != "" {
+		fmt.Fprintf(&b, "\noverride token %q does not match this plan", e.Override)
+	}
+	fmt.Fprintf(&b, "\nto proceed anyway, supply override token %s", e.Result.Token())
+	return b.String()
+}
+
+// TestingT is the part of *testing.T that Require needs.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// Require fails the test if p destroys a protected resource without a
+// matching override.
+func (g *Guard) Require(t TestingT, p *plan.Plan, override string) {
+	t.Helper()
+	if err := g.Check(p).Err(override); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package guard
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+func rc(address, typ string, actions ...string) plan.ResourceChange {
+	return plan.ResourceChange{Address: address, Mode: "managed", Type: typ, Actions: plan.Actions(actions)}
+}
+
+var destructive = &plan.Plan{ResourceChanges: []plan.ResourceChange{
+	rc("module.storage.azurerm_storage_account.storage", "azurerm_storage_account", "delete", "create"),
+	rc("module.keyvault.azurerm_key_vault.key_vault", "azurerm_key_vault", "update"),
+	rc("module.storage.azurerm_storage_container.container", "azurerm_storage_container", "delete"),
+	rc("module.webapp.azurerm_service_plan.app_service_plan", "azurerm_service_plan", "delete", "create"),
+	{Address: "module.keyvault.data.azurerm_key_vault.kv", Mode: "data", Type: "azurerm_key_vault", Actions: plan.Actions{"delete"}},
+}}
+
+func TestCheckDefaults(t *testing.T) {
+	res := New().Check(destructive)
+	assert.Equal(t, []Violation{
+		{Address: "module.storage.azurerm_storage_account.storage", Type: "azurerm_storage_account", Action: "replace", Rule: "azurerm_storage_account"},
+		{Address: "module.storage.azurerm_storage_container.container", Type: "azurerm_storage_container", Action: "delete", Rule: "azurerm_storage_container"},
+	}, res.Violations)
+}
+
+func TestCheckAddressPatterns(t *testing.T) {
+	g := New("module.webapp.*", `module.apps["prod"].*`)
+	p := &plan.Plan{ResourceChanges: []plan.ResourceChange{
+		rc("module.storage.azurerm_storage_account.storage", "azurerm_storage_account", "delete"),
+		rc("module.webapp.azurerm_service_plan.app_service_plan", "azurerm_service_plan", "create", "delete"),
+		rc(`module.apps["prod"].azurerm_linux_web_app.app`, "azurerm_linux_web_app", "delete"),
+		rc(`module.apps["dev"].azurerm_linux_web_app.app`, "azurerm_linux_web_app", "delete"),
+	}}
+
+	res := g.Check(p)
+	require.Len(t, res.Violations, 2)
+	assert.Equal(t, `module.apps["prod"].azurerm_linux_web_app.app`, res.Violations[0].Address)
+	assert.Equal(t, "module.webapp.azurerm_service_plan.app_service_plan", res.Violations[1].Address)
+	assert.Equal(t, "replace", res.Violations[1].Action)
+}
+
+func TestOverrideToken(t *testing.T) {
+	res := New().Check(destructive)
+
+	err := res.Err("")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "replace module.storage.azurerm_storage_account.storage")
+	assert.Contains(t, err.Error(), "supply override token "+res.Token())
+
+	assert.NoError(t, res.Err(res.Token()))
+
+	// A token approved for a different set of changes does not apply.
+	other := New().Check(&plan.Plan{ResourceChanges: destructive.ResourceChanges[:1]})
+	assert.NotEqual(t, res.Token(), other.Token())
+	assert.Error(t, res.Err(other.Token()))
+}
+
+func TestSafePlan(t *testing.T) {
+	res := New().Check(&plan.Plan{ResourceChanges: []plan.ResourceChange{
+		rc("module.keyvault.azurerm_key_vault.key_vault", "azurerm_key_vault", "update"),
+	}})
+	assert.Empty(t, res.Token())
+	assert.NoError(t, res.Err(""))
+}
+
+type fakeT struct{ failed string }
+
+func (f *fakeT) Helper()                                   {}
+func (f *fakeT) Fatalf(format string, args ...interface{}) { f.failed = fmt.Sprintf(format, args...) }
+
+func TestRequire(t *testing.T) {
+	ft := &fakeT{}
+	New().Require(ft, destructive, "")
+	assert.Contains(t, ft.failed, "plan destroys 2 protected resource(s)")
+
+	ft = &fakeT{}
+	New().Require(ft, destructive, New().Check(destructive).Token())
+	assert.Empty(t, ft.failed)
+}
@@ -0,0 +1,137 @@
+// Package importgen turns discovered Azure resources into Terraform 1.5+
+// import blocks.
+//
+// Each resource is mapped to its azurerm resource type and, where the root
+// configuration has a slot for it, to the matching module address, so that
+// `terraform plan` picks the resource up without further edits. Resources
+// that do not fit an existing slot get a root-level address and a starter
+// resource block filled from the properties Resource Manager reported.
+package importgen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+// Mapping describes how an ARM resource type is managed in this repo.
+type Mapping struct {
+	// ResourceType is the azurerm resource type.
+	ResourceType string
+
+	// Address is where the root configuration manages the single instance
+	// of this type, empty when there is no such slot.
+	Address string
+}
+
+// mappings is keyed by lower-cased ARM type.
+var mappings = map[string]Mapping{
+	"microsoft.resources/resourcegroups":                        {"azurerm_resource_group", "azurerm_resource_group.rg"},
+	"microsoft.network/virtualnetworks":                         {"azurerm_virtual_network", "module.network.azurerm_virtual_network.vnet"},
+	"microsoft.network/virtualnetworks/subnets":                 {"azurerm_subnet", "module.network.azurerm_subnet.subnet"},
+	"microsoft.network/networksecuritygroups":                   {"azurerm_network_security_group", "module.network.azurerm_network_security_group.nsg"},
+	"microsoft.storage/storageaccounts":                         {"azurerm_storage_account", "module.storage.azurerm_storage_account.storage"},
+	"microsoft.storage/storageaccounts/blobservices/containers": {"azurerm_storage_container", "module.storage.azurerm_storage_container.container"},
+	"microsoft.web/serverfarms":                                 {"azurerm_service_plan", "module.webapp.azurerm_service_plan.app_service_plan"},
+	"microsoft.web/sites":                                       {"azurerm_linux_web_app", "module.webapp.azurerm_linux_web_app.web_app"},
+	"microsoft.keyvault/vaults":                                 {"azurerm_key_vault", "module.keyvault.azurerm_key_vault.key_vault"},
+}
+
+// Lookup returns the mapping for res, if the type is supported.
+func Lookup(res arm.Resource) (Mapping, bool) {
+	m, ok := mappings[strings.ToLower(res.Type)]
+	if !ok {
+		return Mapping{}, false
+	}
+	// Windows web apps share the Microsoft.Web/sites type but not the
+	// module slot, which is a Linux app. An unknown kind is assumed Linux.
+	kind := strings.ToLower(res.Kind)
+	if m.ResourceType == "azurerm_linux_web_app" && kind != "" && !strings.Contains(kind, "linux") {
+		return Mapping{ResourceType: "azurerm_windows_web_app"}, true
+	}
+	return m, true
+}
+
+// Import is one generated import.
+type Import struct {
+	Resource     arm.Resource
+	ResourceType string
+
+	// Address is the import target.
+	Address string
+
+	// Configured is true when Address points at a resource block the
+	// configuration already declares, in which case no starter block is
+	// needed.
+	Configured bool
+}
+
+// Generator assigns addresses to discovered resources.
+type Generator struct {
+	// Occupied holds addresses already present in state. Module slots in
+	// this set are not reused.
+	Occupied map[string]bool
+}
+
+// Plan assigns an address to each supported resource and returns the
+// imports along with the resources that have no azurerm mapping. Resources
+// are processed in ID order so the output is stable.
+func (g *Generator) Plan(resources []arm.Resource) ([]Import, []arm.Resource) {
+	sorted := append([]arm.Resource(nil), resources...)
+	for i := range sorted {
+		if sorted[i].Type == "" {
+			if rid, err := arm.ParseID(sorted[i].ID); err == nil {
+				sorted[i].Type = rid.Type()
+				sorted[i].Name = rid.Name()
+			}
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return arm.NormalizeID(sorted[i].ID) < arm.NormalizeID(sorted[j].ID)
+	})
+
+	used := map[string]bool{}
+	for addr := range g.Occupied {
+		used[addr] = true
+	}
+
+	var (
+		imports     []Import
+		unsupported []arm.Resource
+	)
+	for _, res := range sorted {
+		m, ok := Lookup(res)
+		if !ok {
+			unsupported = append(unsupported, res)
+			continue
+		}
+		imp := Import{Resource: res, ResourceType: m.ResourceType}
+		if m.Address != "" && !used[m.Address] {
+			imp.Address = m.Address
+			imp.Configured = true
+		} else {
+			imp.Address = uniqueAddress(m.ResourceType, res.Name, used)
+		}
+		used[imp.Address] = true
+		imports = append(imports, imp)
+	}
+	return imports, unsupported
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// uniqueAddress derives a root-level address from the resource name.
+func uniqueAddress(resourceType, name string, used map[string]bool) string {
+	label := strings.Trim(invalidLabelChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') {
+		label = "r_" + label
+	}
+	addr := resourceType + "." + label
+	for i := 2; used[addr]; i++ {
+		addr = fmt.Sprintf("%s.%s_%d", resourceType, label, i)
+	}
+	return addr
+}
@@ -0,0 +1,83 @@
+package importgen
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/arm"
+	"terraform-advanced-course/internal/arm/armfake"
+)
+
+func TestPlanUsesModuleSlotsOnce(t *testing.T) {
+	const rg = "/subscriptions/s/resourceGroups/myTFResourceGroup-dev"
+	gen := &Generator{Occupied: map[string]bool{
+		"module.keyvault.azurerm_key_vault.key_vault": true,
+	}}
+
+	imports, unsupported := gen.Plan([]arm.Resource{
+		{ID: rg + "/providers/Microsoft.Storage/storageAccounts/stb"},
+		{ID: rg + "/providers/Microsoft.Storage/storageAccounts/sta"},
+		{ID: rg + "/providers/Microsoft.KeyVault/vaults/kv-demo"},
+		{ID: rg + "/providers/Microsoft.Insights/components/appi"},
+	})
+
+	require.Len(t, imports, 3)
+	assert.Equal(t, "azurerm_key_vault.kv_demo", imports[0].Address)
+	assert.False(t, imports[0].Configured)
+	assert.Equal(t, "module.storage.azurerm_storage_account.storage", imports[1].Address)
+	assert.True(t, imports[1].Configured)
+	assert.Equal(t, "azurerm_storage_account.stb", imports[2].Address)
+
+	require.Len(t, unsupported, 1)
+	assert.Equal(t, "Microsoft.Insights/components", unsupported[0].Type)
+}
+
+func TestWriteStarterBlockFromObservedProperties(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	srv.AddResourceGroup("myTFResourceGroup-dev", "westeurope", nil)
+	kv := srv.PutResource("myTFResourceGroup-dev", arm.Resource{
+		Type: "Microsoft.KeyVault/vaults",
+		Name: "kv-handmade",
+		Tags: map[string]string{"Owner": "ops"},
+		Properties: map[string]interface{}{
+			"tenantId":                  "tenant",
+			"sku":                       map[string]interface{}{"name": "Standard"},
+			"softDeleteRetentionInDays": 7,
+			"enablePurgeProtection":     false,
+		},
+	})
+	sa := srv.PutResource("myTFResourceGroup-dev", arm.Resource{
+		Type: "Microsoft.Storage/storageAccounts",
+		Name: "mytfstoragehiddedev",
+		SKU:  &arm.SKU{Name: "Standard_GRS"},
+	})
+
+	var resources []arm.Resource
+	for _, id := range []string{kv.ID, sa.ID} {
+		res, err := srv.Client().GetResource(context.Background(), id)
+		require.NoError(t, err)
+		resources = append(resources, res)
+	}
+
+	gen := &Generator{Occupied: map[string]bool{"module.keyvault.azurerm_key_vault.key_vault": true}}
+	imports, _ := gen.Plan(resources)
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, imports))
+	hcl := out.String()
+
+	assert.Contains(t, hcl, "to = azurerm_key_vault.kv_handmade")
+	assert.Contains(t, hcl, `resource "azurerm_key_vault" "kv_handmade" {`)
+	assert.Contains(t, hcl, `sku_name                   = "standard"`)
+	assert.Contains(t, hcl, "soft_delete_retention_days = 7")
+	assert.Contains(t, hcl, `Owner = "ops"`)
+
+	assert.Contains(t, hcl, "to = module.storage.azurerm_storage_account.storage")
+	assert.Contains(t, hcl, `#   account_replication_type = "GRS"`)
+	assert.NotContains(t, hcl, `resource "azurerm_storage_account"`)
+}
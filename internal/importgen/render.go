@@ -0,0 +1,247 @@
+package importgen
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+// attribute is one observed argument for a starter block.
+type attribute struct {
+	name  string
+	value cty.Value
+}
+
+// Write renders imports as HCL. Configured imports get only an import
+// block, preceded by a comment with the observed values the module inputs
+// must match to avoid a replacement. The rest also get a starter resource
+// block.
+func Write(w io.Writer, imports []Import) error {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	for i, imp := range imports {
+		if i > 0 {
+			body.AppendNewline()
+		}
+		attrs := observed(imp)
+
+		if imp.Configured && len(attrs) > 0 {
+			body.AppendUnstructuredTokens(comment(fmt.Sprintf("%s already declares %s. Observed values:", configFile(imp.Address), imp.ResourceType)))
+			for _, a := range attrs {
+				body.AppendUnstructuredTokens(comment("  " + a.name + " = " + inline(a.value)))
+			}
+		}
+
+		traversal, diags := hclsyntax.ParseTraversalAbs([]byte(imp.Address), "", hcl.InitialPos)
+		if diags.HasErrors() {
+			return fmt.Errorf("importgen: bad address %q: %s", imp.Address, diags.Error())
+		}
+		block := body.AppendNewBlock("import", nil).Body()
+		block.SetAttributeTraversal("to", traversal)
+		block.SetAttributeValue("id", cty.StringVal(imp.Resource.ID))
+
+		if imp.Configured {
+			continue
+		}
+		body.AppendNewline()
+		labels := strings.SplitN(imp.Address, ".", 2)
+		res := body.AppendNewBlock("resource", labels).Body()
+		for _, a := range attrs {
+			res.SetAttributeValue(a.name, a.value)
+		}
+		if imp.ResourceType == "azurerm_linux_web_app" || imp.ResourceType == "azurerm_windows_web_app" {
+			res.AppendNewBlock("site_config", nil)
+		}
+	}
+
+	_, err := w.Write(hclwrite.Format(f.Bytes()))
+	return err
+}
+
+// WriteUnsupported lists resources without an azurerm mapping as comments,
+// so they are not silently dropped from the generated file.
+func WriteUnsupported(w io.Writer, resources []arm.Resource) error {
+	for _, res := range resources {
+		if _, err := fmt.Fprintf(w, "# Not imported, no azurerm mapping for %s: %s\n", res.Type, res.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func comment(text string) hclwrite.Tokens {
+	return hclwrite.Tokens{{Type: hclsyntax.TokenComment, Bytes: []byte("# " + text + "\n")}}
+}
+
+// inline renders v on a single line for use in a comment.
+func inline(v cty.Value) string {
+	switch {
+	case v.Type().IsMapType():
+		var pairs []string
+		for it := v.ElementIterator(); it.Next(); {
+			k, e := it.Element()
+			pairs = append(pairs, fmt.Sprintf("%s = %s", k.AsString(), inline(e)))
+		}
+		return "{ " + strings.Join(pairs, ", ") + " }"
+	case v.Type().IsListType():
+		var items []string
+		for it := v.ElementIterator(); it.Next(); {
+			_, e := it.Element()
+			items = append(items, inline(e))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return string(hclwrite.TokensForValue(v).Bytes())
+	}
+}
+
+func configFile(address string) string {
+	if strings.HasPrefix(address, "module.") {
+		return "modules/" + strings.SplitN(address, ".", 3)[1]
+	}
+	return "main.tf"
+}
+
+// observed derives resource arguments from what Resource Manager reported.
+// Only arguments that can be read back reliably are included; the rest are
+// left for the author to fill in after the first plan.
+func observed(imp Import) []attribute {
+	res := imp.Resource
+	rid, _ := arm.ParseID(res.ID)
+
+	var attrs []attribute
+	add := func(name string, v cty.Value) {
+		if !v.IsNull() {
+			attrs = append(attrs, attribute{name, v})
+		}
+	}
+	str := func(s string) cty.Value {
+		if s == "" {
+			return cty.NilVal
+		}
+		return cty.StringVal(s)
+	}
+
+	add("name", str(res.Name))
+	switch imp.ResourceType {
+	case "azurerm_resource_group":
+		add("location", str(res.Location))
+	case "azurerm_subnet":
+		add("resource_group_name", str(rid.ResourceGroup))
+		add("virtual_network_name", str(rid.Parent().Name()))
+		prefixes := stringList(prop(res.Properties, "addressPrefixes"))
+		if p, ok := prop(res.Properties, "addressPrefix").(string); ok && p != "" {
+			prefixes = append(prefixes, p)
+		}
+		add("address_prefixes", listVal(prefixes))
+	case "azurerm_storage_container":
+		add("storage_account_id", str(rid.Parent().Parent().String()))
+		access := "private"
+		switch strings.ToLower(fmt.Sprint(prop(res.Properties, "publicAccess"))) {
+		case "blob":
+			access = "blob"
+		case "container":
+			access = "container"
+		}
+		add("container_access_type", cty.StringVal(access))
+	default:
+		add("resource_group_name", str(rid.ResourceGroup))
+		add("location", str(res.Location))
+	}
+
+	switch imp.ResourceType {
+	case "azurerm_virtual_network":
+		add("address_space", listVal(stringList(prop(res.Properties, "addressSpace", "addressPrefixes"))))
+	case "azurerm_storage_account":
+		if res.SKU != nil {
+			if parts := strings.SplitN(res.SKU.Name, "_", 2); len(parts) == 2 {
+				add("account_tier", str(parts[0]))
+				add("account_replication_type", str(parts[1]))
+			}
+		}
+	case "azurerm_service_plan":
+		osType := "Windows"
+		if strings.Contains(strings.ToLower(res.Kind), "linux") {
+			osType = "Linux"
+		}
+		add("os_type", cty.StringVal(osType))
+		if res.SKU != nil {
+			add("sku_name", str(res.SKU.Name))
+		}
+	case "azurerm_linux_web_app", "azurerm_windows_web_app":
+		if id, ok := prop(res.Properties, "serverFarmId").(string); ok {
+			add("service_plan_id", str(id))
+		}
+		if b, ok := prop(res.Properties, "httpsOnly").(bool); ok {
+			add("https_only", cty.BoolVal(b))
+		}
+	case "azurerm_key_vault":
+		if s, ok := prop(res.Properties, "tenantId").(string); ok {
+			add("tenant_id", str(s))
+		}
+		if s, ok := prop(res.Properties, "sku", "name").(string); ok {
+			add("sku_name", str(strings.ToLower(s)))
+		}
+		if n, ok := prop(res.Properties, "softDeleteRetentionInDays").(float64); ok {
+			add("soft_delete_retention_days", cty.NumberIntVal(int64(n)))
+		}
+		if b, ok := prop(res.Properties, "enablePurgeProtection").(bool); ok {
+			add("purge_protection_enabled", cty.BoolVal(b))
+		}
+		if b, ok := prop(res.Properties, "enableRbacAuthorization").(bool); ok {
+			add("enable_rbac_authorization", cty.BoolVal(b))
+		}
+	}
+
+	if len(res.Tags) > 0 && imp.ResourceType != "azurerm_subnet" && imp.ResourceType != "azurerm_storage_container" {
+		tags := make(map[string]cty.Value, len(res.Tags))
+		for k, v := range res.Tags {
+			tags[k] = cty.StringVal(v)
+		}
+		add("tags", cty.MapVal(tags))
+	}
+	return attrs
+}
+
+// prop walks nested property maps.
+func prop(props map[string]interface{}, path ...string) interface{} {
+	var cur interface{} = props
+	for _, key := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func listVal(items []string) cty.Value {
+	if len(items) == 0 {
+		return cty.NilVal
+	}
+	vals := make([]cty.Value, len(items))
+	for i, s := range items {
+		vals[i] = cty.StringVal(s)
+	}
+	return cty.ListVal(vals)
+}
@@ -0,0 +1,275 @@
+// Package janitor deletes the resource groups test runs leaked.
+//
+// A test run that crashes, is killed or loses its state leaves its
+// resource groups behind, and only the cleanup journal of the machine it
+// ran on knows about them. The janitor instead looks at the subscription:
+// a resource group is the harness's when its name matches one of the
+// harness's naming patterns (rg-perf-*, rg-concurrent-* and so on) or
+// when it carries the TTLTag the harness puts on what it deploys. It is
+// stale once the time in that tag has passed. A group with a harness
+// name and no tag predates the tag, or was created by a run that did not
+// set it, and is stale as well.
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+// TTLTag holds the time, in RFC 3339, after which a test deployment may be
+// deleted.
+const TTLTag = "terratest-expires"
+
+// DefaultPatterns are the names the tests give their resource groups.
+var DefaultPatterns = []string{
+	"rg-terratest-shared-*",
+	"rg-perf-*",
+	"rg-scale-*",
+	"rg-limits-*",
+	"rg-concurrent-*",
+}
+
+// Groups lists and deletes resource groups. *arm.Client implements it.
+type Groups interface {
+	ListResourceGroups(ctx context.Context) ([]arm.ResourceGroup, error)
+	DeleteResourceGroup(ctx context.Context, name string) error
+}
+
+// Actions taken on a resource group.
+const (
+	ActionKept        = "kept"
+	ActionWouldDelete = "would delete"
+	ActionDeleted     = "deleted"
+	ActionFailed      = "failed"
+)
+
+// Group is a resource group the harness created.
+type Group struct {
+	Name     string            `json:"name"`
+	Location string            `json:"location,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+
+	// Pattern is the naming pattern the name matched, if any.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Expires is the time in the group's TTLTag, if it has a valid one.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	Stale  bool   `json:"stale"`
+	Reason string `json:"reason"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a Run.
+type Report struct {
+	DryRun  bool      `json:"dry_run"`
+	Started time.Time `json:"started"`
+	Groups  []Group   `json:"groups"`
+}
+
+// Count returns how many groups had action.
+func (r Report) Count(action string) int {
+	n := 0
+	for _, g := range r.Groups {
+		if g.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Janitor finds and deletes stale test resource groups.
+type Janitor struct {
+	Groups Groups
+
+	// Patterns are shell-style resource group name patterns. Nil means
+	// DefaultPatterns.
+	Patterns []string
+
+	// Workers bounds the deletes in flight at once. Zero means 4.
+	Workers int
+
+	// DryRun reports what would be deleted without deleting it.
+	DryRun bool
+
+	// Now defaults to time.Now.
+	Now func() time.Time
+
+	// Log receives a line per delete, if non-nil.
+	Log io.Writer
+}
+
+func (j *Janitor) now() time.Time {
+	if j.Now != nil {
+		return j.Now()
+	}
+	return time.Now()
+}
+
+// Find returns the subscription's harness resource groups, sorted by
+// name, with Stale and Reason set. Groups Azure is already deleting are
+// left out.
+func (j *Janitor) Find(ctx context.Context) ([]Group, error) {
+	patterns := j.Patterns
+	if patterns == nil {
+		patterns = DefaultPatterns
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("janitor: bad resource group pattern %q: %w", p, err)
+		}
+	}
+	all, err := j.Groups.ListResourceGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("janitor: list resource groups: %w", err)
+	}
+
+	now := j.now()
+	var found []Group
+	for _, rg := range all {
+		if rg.Properties != nil && strings.EqualFold(rg.Properties.ProvisioningState, "Deleting") {
+			continue
+		}
+		g := Group{Name: rg.Name, Location: rg.Location, Tags: rg.Tags}
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, rg.Name); ok {
+				g.Pattern = p
+				break
+			}
+		}
+		ttl, tagged := rg.Tags[TTLTag]
+		if g.Pattern == "" && !tagged {
+			continue
+		}
+		switch expires, err := time.Parse(time.RFC3339, ttl); {
+		case !tagged:
+			g.Stale = true
+			g.Reason = fmt.Sprintf("name matches %s and it has no %s tag", g.Pattern, TTLTag)
+		case err != nil:
+			g.Reason = fmt.Sprintf("%s tag %q is not an RFC 3339 time", TTLTag, ttl)
+		case now.Before(expires):
+			g.Expires = &expires
+			g.Reason = fmt.Sprintf("expires in %s", expires.Sub(now).Round(time.Minute))
+		default:
+			g.Expires = &expires
+			g.Stale = true
+			g.Reason = fmt.Sprintf("expired %s ago", now.Sub(expires).Round(time.Minute))
+		}
+		found = append(found, g)
+	}
+	sort.Slice(found, func(a, b int) bool { return found[a].Name < found[b].Name })
+	return found, nil
+}
+
+// Run finds the harness resource groups and deletes the stale ones, at
+// most Workers at a time. A failed delete is recorded in its group and
+// does not stop the others; the error returned is only for failing to
+// list the groups.
+func (j *Janitor) Run(ctx context.Context) (Report, error) {
+	report := Report{DryRun: j.DryRun, Started: j.now().UTC()}
+	groups, err := j.Find(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Groups = groups
+
+	workers := j.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	var (
+		wg    sync.WaitGroup
+		logMu sync.Mutex
+		slots = make(chan struct{}, workers)
+	)
+	for i := range groups {
+		g := &groups[i]
+		switch {
+		case !g.Stale:
+			g.Action = ActionKept
+			continue
+		case j.DryRun:
+			g.Action = ActionWouldDelete
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				g.Action, g.Error = ActionFailed, ctx.Err().Error()
+				return
+			}
+			defer func() { <-slots }()
+
+			err := j.Groups.DeleteResourceGroup(ctx, g.Name)
+			if err != nil && !arm.IsNotFound(err) {
+				g.Action, g.Error = ActionFailed, err.Error()
+			} else {
+				g.Action = ActionDeleted
+			}
+			if j.Log != nil {
+				logMu.Lock()
+				if g.Error != "" {
+					fmt.Fprintf(j.Log, "%s: %s\n", g.Name, g.Error)
+				} else {
+					fmt.Fprintf(j.Log, "%s: deleted\n", g.Name)
+				}
+				logMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return report, nil
+}
+
+// WriteText writes the report as an aligned table.
+func WriteText(w io.Writer, r Report) error {
+	if len(r.Groups) == 0 {
+		_, err := fmt.Fprintln(w, "No test resource groups found.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE GROUP\tLOCATION\tACTION\tREASON")
+	for _, g := range r.Groups {
+		reason := g.Reason
+		if g.Error != "" {
+			reason += ": " + g.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", g.Name, g.Location, g.Action, reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	var err error
+	if r.DryRun {
+		_, err = fmt.Fprintf(w, "\n%d resource group(s) would be deleted, %d kept.\n",
+			r.Count(ActionWouldDelete), r.Count(ActionKept))
+	} else {
+		_, err = fmt.Fprintf(w, "\n%d resource group(s) deleted, %d failed, %d kept.\n",
+			r.Count(ActionDeleted), r.Count(ActionFailed), r.Count(ActionKept))
+	}
+	return err
+}
+
+// WriteJSON writes the report as indented JSON.
+func WriteJSON(w io.Writer, r Report) error {
+	if r.Groups == nil {
+		r.Groups = []Group{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
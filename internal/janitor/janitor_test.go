@@ -0,0 +1,173 @@
+package janitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/arm"
+	"terraform-advanced-course/internal/arm/armfake"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func ttl(t time.Time) map[string]string {
+	return map[string]string{TTLTag: t.Format(time.RFC3339)}
+}
+
+func seed(srv *armfake.Server) {
+	srv.AddResourceGroup("rg-perf-old", "westeurope", ttl(now.Add(-2*time.Hour)))
+	srv.AddResourceGroup("rg-scale-running", "westeurope", ttl(now.Add(3*time.Hour)))
+	srv.AddResourceGroup("rg-concurrent-0-abc", "westeurope", nil)
+	srv.AddResourceGroup("rg-module-fixture", "westeurope", ttl(now.Add(-time.Minute)))
+	srv.AddResourceGroup("rg-limits-garbled", "westeurope", map[string]string{TTLTag: "tomorrow"})
+	srv.AddResourceGroup("myTFResourceGroup-dev", "westeurope", nil)
+}
+
+func TestFind(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	srv.PageSize = 2
+	seed(srv)
+
+	j := &Janitor{Groups: srv.Client(), Now: func() time.Time { return now }}
+	groups, err := j.Find(context.Background())
+	require.NoError(t, err)
+
+	byName := map[string]Group{}
+	for _, g := range groups {
+		byName[g.Name] = g
+	}
+	require.Len(t, byName, 5, "myTFResourceGroup-dev is not the harness's")
+
+	assert.True(t, byName["rg-perf-old"].Stale)
+	assert.Equal(t, "rg-perf-*", byName["rg-perf-old"].Pattern)
+	assert.Equal(t, "expired 2h0m0s ago", byName["rg-perf-old"].Reason)
+
+	assert.False(t, byName["rg-scale-running"].Stale)
+	assert.Equal(t, "expires in 3h0m0s", byName["rg-scale-running"].Reason)
+
+	assert.True(t, byName["rg-concurrent-0-abc"].Stale, "a harness name without a tag is stale")
+	assert.Nil(t, byName["rg-concurrent-0-abc"].Expires)
+
+	assert.True(t, byName["rg-module-fixture"].Stale, "the tag alone marks a harness group")
+	assert.Empty(t, byName["rg-module-fixture"].Pattern)
+
+	assert.False(t, byName["rg-limits-garbled"].Stale, "an unreadable tag is kept")
+}
+
+func TestRunDryRun(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	seed(srv)
+
+	j := &Janitor{Groups: srv.Client(), DryRun: true, Now: func() time.Time { return now }}
+	report, err := j.Run(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, srv.DeletedResourceGroups())
+	assert.Equal(t, 3, report.Count(ActionWouldDelete))
+	assert.Equal(t, 2, report.Count(ActionKept))
+
+	var out bytes.Buffer
+	require.NoError(t, WriteText(&out, report))
+	assert.Contains(t, out.String(), "rg-perf-old")
+	assert.Contains(t, out.String(), "3 resource group(s) would be deleted, 2 kept.")
+}
+
+func TestRunDeletesStaleGroups(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	seed(srv)
+	srv.LockResourceGroup("rg-module-fixture")
+
+	var log bytes.Buffer
+	j := &Janitor{Groups: srv.Client(), Now: func() time.Time { return now }, Log: &log}
+	report, err := j.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"rg-perf-old", "rg-concurrent-0-abc"}, srv.DeletedResourceGroups())
+	assert.Equal(t, 2, report.Count(ActionDeleted))
+	assert.Equal(t, 1, report.Count(ActionFailed))
+	assert.Contains(t, log.String(), "ScopeLocked")
+
+	var out bytes.Buffer
+	require.NoError(t, WriteJSON(&out, report))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Len(t, decoded.Groups, 5)
+	for _, g := range decoded.Groups {
+		if g.Name == "rg-module-fixture" {
+			assert.Equal(t, ActionFailed, g.Action)
+			assert.Contains(t, g.Error, "ScopeLocked")
+		}
+	}
+
+	remaining, err := srv.Client().ListResourceGroups(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, remaining, 4)
+}
+
+// countingGroups records the most deletes in flight at once.
+type countingGroups struct {
+	Groups
+	mu             sync.Mutex
+	inFlight, peak int
+}
+
+func (c *countingGroups) DeleteResourceGroup(ctx context.Context, name string) error {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.peak {
+		c.peak = c.inFlight
+	}
+	c.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	return c.Groups.DeleteResourceGroup(ctx, name)
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		srv.AddResourceGroup("rg-perf-"+name, "westeurope", nil)
+	}
+
+	groups := &countingGroups{Groups: srv.Client()}
+	j := &Janitor{Groups: groups, Workers: 3}
+	report, err := j.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 8, report.Count(ActionDeleted))
+	assert.LessOrEqual(t, groups.peak, 3)
+	assert.Len(t, srv.DeletedResourceGroups(), 8)
+}
+
+func TestFindSkipsGroupsBeingDeleted(t *testing.T) {
+	groups := staticGroups{{Name: "rg-perf-x", Properties: &arm.ResourceGroupProperties{ProvisioningState: "Deleting"}}}
+	found, err := (&Janitor{Groups: groups}).Find(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestFindRejectsBadPatterns(t *testing.T) {
+	_, err := (&Janitor{Groups: staticGroups{}, Patterns: []string{"rg-["}}).Find(context.Background())
+	assert.Error(t, err)
+}
+
+type staticGroups []arm.ResourceGroup
+
+func (s staticGroups) ListResourceGroups(context.Context) ([]arm.ResourceGroup, error) {
+	return s, nil
+}
+
+func (s staticGroups) DeleteResourceGroup(context.Context, string) error { return nil }
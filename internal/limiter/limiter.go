@@ -0,0 +1,182 @@
+// Package limiter caps how many terraform commands of each phase run at
+// once across a test process.
+//
+// Parallel tests that all apply at the same moment run into ARM request
+// throttling and subscription quotas long before the machine is busy.
+// Init and plan are cheaper for ARM than apply and destroy, so each phase
+// has its own budget, and a test waiting for an apply slot does not hold
+// up another one that only wants to init.
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Phases with their own budgets.
+const (
+	PhaseInit    = "init"
+	PhasePlan    = "plan"
+	PhaseApply   = "apply"
+	PhaseDestroy = "destroy"
+)
+
+// Phases lists the phases in the order terraform runs them.
+var Phases = []string{PhaseInit, PhasePlan, PhaseApply, PhaseDestroy}
+
+// Parse reads a budget specification such as "init=8,plan=4,apply=2".
+// A bare number sets every phase; later entries override earlier ones, so
+// "4,apply=1" allows four of everything but a single apply. Zero means
+// unlimited. Phases the specification leaves out are unlimited too.
+func Parse(spec string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, named := strings.Cut(part, "=")
+		if !named {
+			name, value = "", part
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("limiter: %q: want a count of zero or more", part)
+		}
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			for _, p := range Phases {
+				limits[p] = n
+			}
+		case isPhase(name):
+			limits[name] = n
+		default:
+			return nil, fmt.Errorf("limiter: %q: unknown phase %q (want %s)", part, name, strings.Join(Phases, ", "))
+		}
+	}
+	return limits, nil
+}
+
+func isPhase(name string) bool {
+	for _, p := range Phases {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats is what one phase has done so far.
+type Stats struct {
+	Limit   int
+	Runs    int
+	Waited  time.Duration
+	MaxWait time.Duration
+	Ran     time.Duration
+}
+
+// Limiter holds a semaphore per phase.
+type Limiter struct {
+	slots map[string]chan struct{}
+
+	mu    sync.Mutex
+	stats map[string]*Stats
+}
+
+// New returns a limiter with the given budgets. Phases without a positive
+// budget are not limited.
+func New(limits map[string]int) *Limiter {
+	l := &Limiter{slots: map[string]chan struct{}{}, stats: map[string]*Stats{}}
+	for _, p := range Phases {
+		l.stats[p] = &Stats{Limit: limits[p]}
+		if n := limits[p]; n > 0 {
+			l.slots[p] = make(chan struct{}, n)
+		}
+	}
+	return l
+}
+
+// Acquire waits for a slot in phase and returns how long it waited, and a
+// release function that records how long the slot was held. It gives up
+// when ctx is done.
+func (l *Limiter) Acquire(ctx context.Context, phase string) (release func(), waited time.Duration, err error) {
+	if !isPhase(phase) {
+		return nil, 0, fmt.Errorf("limiter: unknown phase %q", phase)
+	}
+	start := time.Now()
+	slots := l.slots[phase]
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, time.Since(start), fmt.Errorf("limiter: waiting for a %s slot: %w", phase, ctx.Err())
+		}
+	}
+	waited = time.Since(start)
+	acquired := time.Now()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ran := time.Since(acquired)
+			if slots != nil {
+				<-slots
+			}
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			s := l.stats[phase]
+			s.Runs++
+			s.Waited += waited
+			s.Ran += ran
+			if waited > s.MaxWait {
+				s.MaxWait = waited
+			}
+		})
+	}, waited, nil
+}
+
+// Stats returns a copy of each phase's statistics.
+func (l *Limiter) Stats() map[string]Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]Stats, len(l.stats))
+	for p, s := range l.stats {
+		out[p] = *s
+	}
+	return out
+}
+
+// WriteSummary writes a line per phase that ran, or nothing when none did.
+func (l *Limiter) WriteSummary(w io.Writer) error {
+	stats := l.Stats()
+	phases := make([]string, 0, len(stats))
+	for _, p := range Phases {
+		if stats[p].Runs > 0 {
+			phases = append(phases, p)
+		}
+	}
+	if len(phases) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\n=== Terraform concurrency ===")
+	fmt.Fprintln(tw, "phase\tlimit\truns\tqueued\tmax wait\tterraform")
+	for _, p := range phases {
+		s := stats[p]
+		limit := "none"
+		if s.Limit > 0 {
+			limit = strconv.Itoa(s.Limit)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", p, limit, s.Runs,
+			s.Waited.Round(time.Second), s.MaxWait.Round(time.Second), s.Ran.Round(time.Second))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,107 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	limits, err := Parse("init=8, plan=4,apply=2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"init": 8, "plan": 4, "apply": 2}, limits)
+
+	limits, err = Parse("4,apply=1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"init": 4, "plan": 4, "apply": 1, "destroy": 4}, limits)
+
+	limits, err = Parse("")
+	require.NoError(t, err)
+	assert.Empty(t, limits)
+
+	_, err = Parse("refresh=2")
+	assert.ErrorContains(t, err, `unknown phase "refresh"`)
+	_, err = Parse("apply=-1")
+	assert.ErrorContains(t, err, "want a count of zero or more")
+}
+
+func TestAcquireCapsEachPhaseSeparately(t *testing.T) {
+	l := New(map[string]int{PhaseApply: 2})
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, _, err := l.Acquire(context.Background(), PhaseApply)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer release()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+
+	// Init is unlimited, so it never queues behind the applies.
+	release, waited, err := l.Acquire(context.Background(), PhaseInit)
+	require.NoError(t, err)
+	assert.Less(t, waited, 10*time.Millisecond)
+	release()
+	release()
+
+	wg.Wait()
+	assert.Equal(t, int32(2), peak)
+	stats := l.Stats()
+	assert.Equal(t, 6, stats[PhaseApply].Runs)
+	assert.Greater(t, stats[PhaseApply].MaxWait, 30*time.Millisecond, "the last pair waited for two rounds")
+	assert.Equal(t, 1, stats[PhaseInit].Runs, "a second release is a no-op")
+}
+
+func TestAcquireGivesUpWithTheContext(t *testing.T) {
+	l := New(map[string]int{PhaseDestroy: 1})
+	release, _, err := l.Acquire(context.Background(), PhaseDestroy)
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = l.Acquire(ctx, PhaseDestroy)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, _, err = l.Acquire(context.Background(), "refresh")
+	assert.Error(t, err)
+}
+
+func TestWriteSummary(t *testing.T) {
+	l := New(map[string]int{PhaseApply: 2})
+	var buf bytes.Buffer
+	require.NoError(t, l.WriteSummary(&buf))
+	assert.Empty(t, buf.String())
+
+	for _, p := range []string{PhaseInit, PhaseApply} {
+		release, _, err := l.Acquire(context.Background(), p)
+		require.NoError(t, err)
+		release()
+	}
+	require.NoError(t, l.WriteSummary(&buf))
+	assert.Equal(t, `
+=== Terraform concurrency ===
+phase  limit  runs  queued  max wait  terraform
+init   none   1     0s      0s        0s
+apply  2      1     0s      0s        0s
+`, buf.String())
+}
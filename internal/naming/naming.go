@@ -0,0 +1,89 @@
+// Package naming checks resource names against Azure's naming rules
+// before terraform gets to them.
+//
+// The rules are the ones modules/validation and the module variable
+// validations enforce, plus the character rules Azure applies at create
+// time, which otherwise only surface as a failed apply.
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Rule is the naming rule for one root module variable.
+type Rule struct {
+	Variable string
+	Min, Max int
+
+	// Pattern is the allowed form, described by Description.
+	Pattern     *regexp.Regexp
+	Description string
+}
+
+// Rules are the rules for the root module's name variables.
+var Rules = []Rule{
+	{"resource_group_name", 1, 90, regexp.MustCompile(`^[-\w.()]*[-\w()]$`),
+		"letters, digits, underscores, hyphens, periods and parentheses, not ending in a period"},
+	{"virtual_network_name", 2, 64, regexp.MustCompile(`^[a-zA-Z0-9][-\w.]*\w$`),
+		"letters, digits, underscores, hyphens and periods, starting with a letter or digit and ending with a letter, digit or underscore"},
+	{"subnet_name", 1, 80, regexp.MustCompile(`^[a-zA-Z0-9]([-\w.]*\w)?$`),
+		"letters, digits, underscores, hyphens and periods, starting with a letter or digit and ending with a letter, digit or underscore"},
+	{"nsg_name", 1, 80, regexp.MustCompile(`^[a-zA-Z0-9]([-\w.]*\w)?$`),
+		"letters, digits, underscores, hyphens and periods, starting with a letter or digit and ending with a letter, digit or underscore"},
+	{"storage_account_name", 3, 24, regexp.MustCompile(`^[a-z0-9]+$`),
+		"lowercase letters and digits only"},
+	{"storage_container_name", 3, 63, regexp.MustCompile(`^[a-z0-9]([a-z0-9]|-[a-z0-9])*$`),
+		"lowercase letters, digits and single hyphens, starting and ending with a letter or digit"},
+	{"app_service_plan_name", 1, 40, regexp.MustCompile(`^[a-zA-Z0-9-]+$`),
+		"letters, digits and hyphens"},
+	{"web_app_name", 2, 60, regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`),
+		"letters, digits and hyphens, not starting or ending with a hyphen"},
+	{"key_vault_name", 3, 24, regexp.MustCompile(`^[a-zA-Z]([a-zA-Z0-9]|-[a-zA-Z0-9])*$`),
+		"letters, digits and single hyphens, starting with a letter and ending with a letter or digit"},
+}
+
+// Violation is a name that breaks its rule.
+type Violation struct {
+	Variable string
+	Value    string
+	Message  string
+}
+
+// Check checks every variable in vars that has a rule. A variable that is
+// missing or not a string is reported, since the root module has no
+// default for any of them.
+func Check(vars map[string]interface{}) []Violation {
+	var out []Violation
+	for _, r := range Rules {
+		raw, ok := vars[r.Variable]
+		if !ok {
+			out = append(out, Violation{Variable: r.Variable, Message: "is not set"})
+			continue
+		}
+		v, ok := raw.(string)
+		if !ok {
+			out = append(out, Violation{Variable: r.Variable, Message: fmt.Sprintf("must be a string, not %T", raw)})
+			continue
+		}
+		out = append(out, r.Check(v)...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Variable < out[j].Variable })
+	return out
+}
+
+// Check checks one value against the rule.
+func (r Rule) Check(v string) []Violation {
+	var out []Violation
+	if n := utf8.RuneCountInString(v); n < r.Min || n > r.Max {
+		out = append(out, Violation{Variable: r.Variable, Value: v,
+			Message: fmt.Sprintf("%q is %d characters; must be %d-%d", v, n, r.Min, r.Max)})
+	}
+	if !r.Pattern.MatchString(v) {
+		out = append(out, Violation{Variable: r.Variable, Value: v,
+			Message: fmt.Sprintf("%q must contain %s", v, r.Description)})
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validVars() map[string]interface{} {
+	return map[string]interface{}{
+		"resource_group_name":    "myTFResourceGroup-dev",
+		"virtual_network_name":   "myTFVnet-dev",
+		"subnet_name":            "myTFSubnet-dev",
+		"nsg_name":               "myTFNetworkSecurityGroup-dev",
+		"storage_account_name":   "mytfstoragehiddedev",
+		"storage_container_name": "demo-container-dev",
+		"app_service_plan_name":  "myTFAppServicePlan-dev",
+		"web_app_name":           "mytfwebapphiddedev",
+		"key_vault_name":         "mytfkeyvaulthiddedev",
+	}
+}
+
+func TestCheckAcceptsValidNames(t *testing.T) {
+	assert.Empty(t, Check(validVars()))
+}
+
+func TestCheckReportsEachRule(t *testing.T) {
+	vars := validVars()
+	vars["storage_account_name"] = "MyStorage-Account-Name-Too-Long"
+	vars["key_vault_name"] = "1kv--bad"
+	vars["storage_container_name"] = "ab"
+	delete(vars, "web_app_name")
+	vars["subnet_name"] = 42.0
+
+	got := Check(vars)
+	require.Len(t, got, 6)
+
+	assert.Equal(t, "key_vault_name", got[0].Variable)
+	assert.Contains(t, got[0].Message, "starting with a letter")
+
+	assert.Equal(t, "storage_account_name", got[1].Variable)
+	assert.Equal(t, `"MyStorage-Account-Name-Too-Long" is 31 characters; must be 3-24`, got[1].Message)
+	assert.Equal(t, "storage_account_name", got[2].Variable)
+	assert.Contains(t, got[2].Message, "lowercase letters and digits only")
+
+	assert.Equal(t, "storage_container_name", got[3].Variable)
+	assert.Contains(t, got[3].Message, "is 2 characters")
+
+	assert.Equal(t, Violation{Variable: "subnet_name", Message: "must be a string, not float64"}, got[4])
+	assert.Equal(t, Violation{Variable: "web_app_name", Message: "is not set"}, got[5])
+}
@@ -0,0 +1,166 @@
+// Package orphans finds live Azure resources that no Terraform state
+// manages.
+//
+// A resource is an orphan when it exists in a resource group the course
+// deploys into (myTFResourceGroup-dev, the rg-terratest-* groups and so on)
+// but its ID does not appear in any of the supplied states. That is usually
+// something created by hand in the portal, or left behind by a test run whose
+// state was lost.
+package orphans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"terraform-advanced-course/internal/arm"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// Orphan is a live resource with no matching state entry.
+type Orphan struct {
+	ResourceGroup string            `json:"resource_group"`
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	Location      string            `json:"location,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// ManagedIDs returns the normalized IDs of every managed resource in states.
+func ManagedIDs(states ...*tfstate.State) map[string]bool {
+	ids := map[string]bool{}
+	for _, st := range states {
+		for _, r := range st.Resources {
+			if !r.Managed() || r.ID() == "" {
+				continue
+			}
+			ids[arm.NormalizeID(r.ID())] = true
+		}
+	}
+	return ids
+}
+
+// Find lists the resources in each resource group and returns the ones whose
+// IDs are not in managed. Results are sorted by resource group, type and name.
+func Find(ctx context.Context, inspector arm.Inspector, resourceGroups []string, managed map[string]bool) ([]Orphan, error) {
+	var found []Orphan
+	for _, rg := range resourceGroups {
+		resources, err := inspector.ListResources(ctx, rg)
+		if err != nil {
+			return nil, fmt.Errorf("list resources in %s: %w", rg, err)
+		}
+		for _, res := range resources {
+			if managed[arm.NormalizeID(res.ID)] {
+				continue
+			}
+			found = append(found, Orphan{
+				ResourceGroup: rg,
+				ID:            res.ID,
+				Name:          res.Name,
+				Type:          res.Type,
+				Location:      res.Location,
+				Tags:          res.Tags,
+			})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.ResourceGroup != b.ResourceGroup {
+			return a.ResourceGroup < b.ResourceGroup
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return found, nil
+}
+
+// ExpandResourceGroups resolves shell-style patterns such as rg-terratest-*
+// against the resource groups in the subscription. Plain names are passed
+// through unchanged so a missing group still surfaces as a not-found error.
+func ExpandResourceGroups(ctx context.Context, inspector arm.Inspector, patterns []string) ([]string, error) {
+	var (
+		names  []string
+		groups []arm.ResourceGroup
+		listed bool
+		seen   = map[string]bool{}
+	)
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if !seen[strings.ToLower(pattern)] {
+				seen[strings.ToLower(pattern)] = true
+				names = append(names, pattern)
+			}
+			continue
+		}
+		if !listed {
+			var err error
+			if groups, err = inspector.ListResourceGroups(ctx); err != nil {
+				return nil, fmt.Errorf("list resource groups: %w", err)
+			}
+			listed = true
+		}
+		for _, g := range groups {
+			ok, err := path.Match(pattern, g.Name)
+			if err != nil {
+				return nil, fmt.Errorf("bad resource group pattern %q: %w", pattern, err)
+			}
+			if ok && !seen[strings.ToLower(g.Name)] {
+				seen[strings.ToLower(g.Name)] = true
+				names = append(names, g.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// WriteText writes orphans as an aligned table.
+func WriteText(w io.Writer, found []Orphan) error {
+	if len(found) == 0 {
+		_, err := fmt.Fprintln(w, "No unmanaged resources found.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE GROUP\tTYPE\tNAME\tTAGS")
+	for _, o := range found {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.ResourceGroup, o.Type, o.Name, formatTags(o.Tags))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d unmanaged resource(s) found.\n", len(found))
+	return err
+}
+
+// WriteJSON writes orphans as an indented JSON array.
+func WriteJSON(w io.Writer, found []Orphan) error {
+	if found == nil {
+		found = []Orphan{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(found)
+}
+
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + tags[k]
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,63 @@
+package orphans
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/arm/armfake"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+func TestFindReportsUnmanagedResources(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	srv.PageSize = 1
+
+	srv.AddResourceGroup("myTFResourceGroup-dev", "westeurope", nil)
+	storage := srv.AddResource("myTFResourceGroup-dev", "Microsoft.Storage/storageAccounts", "mytfstoragehiddedev", nil)
+	srv.AddResource("myTFResourceGroup-dev", "Microsoft.Web/sites", "handmade-site", map[string]string{"Owner": "someone"})
+
+	// The provider reports resourcegroups in lower case and IDs may carry a
+	// trailing slash; matching must not care about either.
+	st := &tfstate.State{Resources: []tfstate.Resource{{
+		Address: "module.storage.azurerm_storage_account.storage",
+		Mode:    "managed",
+		Type:    "azurerm_storage_account",
+		Values:  map[string]interface{}{"id": strings.Replace(storage.ID, "/resourceGroups/", "/resourcegroups/", 1) + "/"},
+	}}}
+
+	found, err := Find(context.Background(), srv.Client(), []string{"myTFResourceGroup-dev"}, ManagedIDs(st))
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "handmade-site", found[0].Name)
+	assert.Equal(t, "Microsoft.Web/sites", found[0].Type)
+	assert.Equal(t, map[string]string{"Owner": "someone"}, found[0].Tags)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteText(&out, found))
+	assert.Contains(t, out.String(), "Owner=someone")
+	assert.Contains(t, out.String(), "1 unmanaged resource(s) found.")
+}
+
+func TestExpandResourceGroups(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+
+	srv.AddResourceGroup("rg-terratest-shared-abc", "westeurope", nil)
+	srv.AddResourceGroup("rg-terratest-shared-def", "westeurope", nil)
+	srv.AddResourceGroup("myTFResourceGroup-prod", "westeurope", nil)
+
+	groups, err := ExpandResourceGroups(context.Background(), srv.Client(),
+		[]string{"rg-terratest-*", "myTFResourceGroup-dev"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rg-terratest-shared-abc", "rg-terratest-shared-def", "myTFResourceGroup-dev"}, groups)
+
+	// myTFResourceGroup-dev does not exist, which must surface as an error.
+	_, err = Find(context.Background(), srv.Client(), groups, nil)
+	assert.Error(t, err)
+}
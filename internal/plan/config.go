@@ -0,0 +1,163 @@
+package plan
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Config is the configuration section of a plan: which resources and
+// module calls each module declares and what their expressions refer to.
+type Config struct {
+	RootModule ConfigModule
+}
+
+// ConfigModule is one module's declarations.
+type ConfigModule struct {
+	Resources   []ConfigResource
+	ModuleCalls map[string]ModuleCall
+	Outputs     map[string]ConfigOutput
+}
+
+// ConfigOutput is an output block.
+type ConfigOutput struct {
+	References []string
+	Sensitive  bool
+}
+
+// ConfigResource is a resource block. Its address is relative to the
+// module that declares it.
+type ConfigResource struct {
+	Address string
+	Mode    string
+	Type    string
+	Name    string
+
+	// References lists every address the block's expressions refer to,
+	// e.g. "azurerm_resource_group.rg.name" or "var.location", sorted and
+	// without duplicates.
+	References []string
+
+	DependsOn []string
+}
+
+// ModuleCall is a module block.
+type ModuleCall struct {
+	Source string
+
+	// References lists what the call's input expressions refer to, in the
+	// calling module's namespace.
+	References []string
+
+	// Inputs breaks References down by input variable.
+	Inputs map[string][]string
+
+	DependsOn []string
+
+	Module ConfigModule
+}
+
+type jsonConfigModule struct {
+	Resources []struct {
+		Address     string          `json:"address"`
+		Mode        string          `json:"mode"`
+		Type        string          `json:"type"`
+		Name        string          `json:"name"`
+		Expressions json.RawMessage `json:"expressions"`
+		CountExpr   json.RawMessage `json:"count_expression"`
+		ForEachExpr json.RawMessage `json:"for_each_expression"`
+		DependsOn   []string        `json:"depends_on"`
+	} `json:"resources"`
+	ModuleCalls map[string]struct {
+		Source      string                     `json:"source"`
+		Expressions map[string]json.RawMessage `json:"expressions"`
+		CountExpr   json.RawMessage            `json:"count_expression"`
+		ForEachExpr json.RawMessage            `json:"for_each_expression"`
+		DependsOn   []string                   `json:"depends_on"`
+		Module      jsonConfigModule           `json:"module"`
+	} `json:"module_calls"`
+	Outputs map[string]struct {
+		Expression json.RawMessage `json:"expression"`
+		Sensitive  bool            `json:"sensitive"`
+		DependsOn  []string        `json:"depends_on"`
+	} `json:"outputs"`
+}
+
+func (m jsonConfigModule) normalize() ConfigModule {
+	out := ConfigModule{ModuleCalls: map[string]ModuleCall{}, Outputs: map[string]ConfigOutput{}}
+	for _, r := range m.Resources {
+		out.Resources = append(out.Resources, ConfigResource{
+			Address:    r.Address,
+			Mode:       r.Mode,
+			Type:       r.Type,
+			Name:       r.Name,
+			References: references(r.Expressions, r.CountExpr, r.ForEachExpr),
+			DependsOn:  r.DependsOn,
+		})
+	}
+	for name, c := range m.ModuleCalls {
+		call := ModuleCall{
+			Source:    c.Source,
+			Inputs:    map[string][]string{},
+			DependsOn: c.DependsOn,
+			Module:    c.Module.normalize(),
+		}
+		all := []json.RawMessage{c.CountExpr, c.ForEachExpr}
+		for input, expr := range c.Expressions {
+			call.Inputs[input] = references(expr)
+			all = append(all, expr)
+		}
+		call.References = references(all...)
+		out.ModuleCalls[name] = call
+	}
+	for name, o := range m.Outputs {
+		out.Outputs[name] = ConfigOutput{
+			References: append(references(o.Expression), o.DependsOn...),
+			Sensitive:  o.Sensitive,
+		}
+	}
+	return out
+}
+
+// references collects the "references" lists found anywhere in expression
+// JSON. Nested blocks appear as lists of expression objects, so the walk
+// is recursive.
+func references(exprs ...json.RawMessage) []string {
+	seen := map[string]bool{}
+	for _, raw := range exprs {
+		if len(raw) == 0 {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			continue
+		}
+		collectReferences(v, seen)
+	}
+	out := make([]string, 0, len(seen))
+	for ref := range seen {
+		out = append(out, ref)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func collectReferences(v interface{}, seen map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if refs, ok := child.([]interface{}); ok && key == "references" {
+				for _, ref := range refs {
+					if s, ok := ref.(string); ok {
+						seen[s] = true
+					}
+				}
+				continue
+			}
+			collectReferences(child, seen)
+		}
+	case []interface{}:
+		for _, child := range v {
+			collectReferences(child, seen)
+		}
+	}
+}
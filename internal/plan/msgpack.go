@@ -0,0 +1,234 @@
+package plan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// unknown stands for a value that is only known after apply. Terraform's
+// msgpack encoding marks such values with an extension type.
+type unknown struct{}
+
+// decodeMsgpack decodes a value in terraform's msgpack encoding without its
+// schema. Numbers come back as float64, like encoding/json, so values read
+// from a saved plan compare equal to the same values from show -json.
+// Attributes of dynamic type are encoded as a [type, value] pair whose type
+// is binary JSON; the pair is unwrapped to its value.
+func decodeMsgpack(b []byte) (interface{}, error) {
+	r := &msgpackReader{b: b}
+	v, err := r.value()
+	if err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	return v, nil
+}
+
+type msgpackReader struct {
+	b []byte
+	i int
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || r.i+n > len(r.b) {
+		return nil, fmt.Errorf("truncated value at offset %d", r.i)
+	}
+	out := r.b[r.i : r.i+n]
+	r.i += n
+	return out, nil
+}
+
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (r *msgpackReader) int(size int) (int64, error) {
+	u, err := r.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int64(int8(u)), nil
+	case 2:
+		return int64(int16(u)), nil
+	case 4:
+		return int64(int32(u)), nil
+	}
+	return int64(u), nil
+}
+
+func (r *msgpackReader) value() (interface{}, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return r.mapValue(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return r.array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return r.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return r.next(int(n))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return r.ext(int(n))
+	case 0xca:
+		u, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := r.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := r.uint(1 << (c - 0xcc))
+		return float64(u), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n, err := r.int(1 << (c - 0xd0))
+		return float64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.array(int(n))
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.mapValue(int(n))
+	}
+	return nil, fmt.Errorf("unsupported type byte 0x%02x at offset %d", c, r.i-1)
+}
+
+func (r *msgpackReader) str(n int) (interface{}, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// ext skips an extension's type and payload. The only extensions terraform
+// writes are unknown values, with or without refinements.
+func (r *msgpackReader) ext(n int) (interface{}, error) {
+	if _, err := r.next(1 + n); err != nil {
+		return nil, err
+	}
+	return unknown{}, nil
+}
+
+func (r *msgpackReader) array(n int) (interface{}, error) {
+	out := make([]interface{}, 0, n)
+	for k := 0; k < n; k++ {
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if _, ok := dynamicType(out); ok {
+		return out[1], nil
+	}
+	return out, nil
+}
+
+// dynamicType recognizes the [type, value] pair of a dynamically typed
+// value. Strings are never encoded as binary, so a binary first element is
+// unambiguous.
+func dynamicType(v []interface{}) ([]byte, bool) {
+	if len(v) != 2 {
+		return nil, false
+	}
+	ty, ok := v[0].([]byte)
+	return ty, ok
+}
+
+func (r *msgpackReader) mapValue(n int) (interface{}, error) {
+	out := make(map[string]interface{}, n)
+	for k := 0; k < n; k++ {
+		key, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		out[fmt.Sprint(key)] = v
+	}
+	return out, nil
+}
+
+// splitUnknown replaces unknown values in v with nil and returns the
+// after_unknown mirror show -json would give: true for unknown values,
+// objects holding only the keys that are or contain unknowns, and lists
+// with one entry per element.
+func splitUnknown(v interface{}) (interface{}, interface{}) {
+	switch v := v.(type) {
+	case unknown:
+		return nil, true
+	case map[string]interface{}:
+		vals := make(map[string]interface{}, len(v))
+		marks := map[string]interface{}{}
+		for k, child := range v {
+			val, mark := splitUnknown(child)
+			vals[k] = val
+			if mark != false {
+				marks[k] = mark
+			}
+		}
+		return vals, marks
+	case []interface{}:
+		vals := make([]interface{}, len(v))
+		marks := make([]interface{}, len(v))
+		for i, child := range v {
+			vals[i], marks[i] = splitUnknown(child)
+		}
+		return vals, marks
+	}
+	return v, false
+}
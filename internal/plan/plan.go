@@ -0,0 +1,253 @@
+// Package plan holds a normalized model of a Terraform plan.
+//
+// The model mirrors the parts of `terraform show -json` output that the
+// tooling needs (resource changes, variables and the configuration's
+// references) in plain Go types, so cost, policy and review tools can share
+// one reader. Plan files written by `terraform plan -out` can be read
+// directly, without terraform.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Plan is a parsed Terraform plan.
+type Plan struct {
+	// FormatVersion is the show -json format version, empty for a plan
+	// read from a plan file.
+	FormatVersion    string
+	TerraformVersion string
+
+	// Variables holds the input variable values the plan was made with.
+	Variables map[string]interface{}
+
+	ResourceChanges []ResourceChange
+
+	// ResourceDrift lists objects that changed outside terraform since
+	// the last apply, found while refreshing. Actions are "update" or
+	// "delete".
+	ResourceDrift []ResourceChange
+
+	// Config is the configuration the plan was made from, nil when the
+	// input has no configuration section.
+	Config *Config
+}
+
+// ResourceChange is the planned change for one resource instance.
+type ResourceChange struct {
+	Address string
+
+	// Module is the module path, empty for the root module.
+	Module string
+
+	Mode         string // "managed" or "data"
+	Type         string
+	Name         string
+	Index        interface{}
+	ProviderName string
+
+	Actions Actions
+
+	// Before and After are the attribute values either side of the change.
+	// Before is nil for creates and After is nil for deletes.
+	Before map[string]interface{}
+	After  map[string]interface{}
+
+	// AfterUnknown mirrors After, with true for values only known after
+	// apply.
+	AfterUnknown interface{}
+
+	// BeforeSensitive and AfterSensitive mirror Before and After, with
+	// true for values that must not be displayed.
+	BeforeSensitive interface{}
+	AfterSensitive  interface{}
+
+	// ReplacePaths lists the attribute paths that force a replacement,
+	// each a sequence of attribute names and list indexes.
+	ReplacePaths [][]interface{}
+
+	// ActionReason is terraform's reason for the action, e.g.
+	// "replace_because_cannot_update", or "" when there is none.
+	ActionReason string
+}
+
+// Managed reports whether the change is for a managed resource.
+func (rc ResourceChange) Managed() bool {
+	return rc.Mode == "managed"
+}
+
+// ModuleName returns the module path, or "root" for the root module.
+func (rc ResourceChange) ModuleName() string {
+	if rc.Module == "" {
+		return "root"
+	}
+	return rc.Module
+}
+
+// Actions is the list of actions Terraform will take, e.g. ["create"] or
+// ["delete", "create"] for a replacement.
+type Actions []string
+
+func (a Actions) is(actions ...string) bool {
+	if len(a) != len(actions) {
+		return false
+	}
+	for i := range a {
+		if a[i] != actions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NoOp reports whether nothing changes.
+func (a Actions) NoOp() bool { return a.is("no-op") }
+
+// Read reports whether a data source is read during apply.
+func (a Actions) Read() bool { return a.is("read") }
+
+// Create reports whether the resource is only created.
+func (a Actions) Create() bool { return a.is("create") }
+
+// Update reports whether the resource is updated in place.
+func (a Actions) Update() bool { return a.is("update") }
+
+// Delete reports whether the resource is only destroyed.
+func (a Actions) Delete() bool { return a.is("delete") }
+
+// Replace reports whether the resource is destroyed and recreated, in
+// either order.
+func (a Actions) Replace() bool {
+	return a.is("delete", "create") || a.is("create", "delete")
+}
+
+// Destroys reports whether the existing object is destroyed, either by a
+// delete or a replacement.
+func (a Actions) Destroys() bool { return a.Delete() || a.Replace() }
+
+// String formats the actions the way plan output does, e.g. "delete, create".
+func (a Actions) String() string { return strings.Join(a, ", ") }
+
+// Load reads `terraform show -json` output for a saved plan, or the plan
+// file itself (see ParseSaved). A path of "-" reads standard input.
+func Load(path string) (*Plan, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if IsSaved(data) {
+		sp, err := ParseSaved(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return sp.Plan, nil
+	}
+	p, err := ParseJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+type jsonPlan struct {
+	FormatVersion    string `json:"format_version"`
+	TerraformVersion string `json:"terraform_version"`
+	Variables        map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"variables"`
+	ResourceChanges []jsonResourceChange `json:"resource_changes"`
+	ResourceDrift   []jsonResourceChange `json:"resource_drift"`
+	Configuration   *struct {
+		RootModule jsonConfigModule `json:"root_module"`
+	} `json:"configuration"`
+}
+
+type jsonResourceChange struct {
+	Address       string      `json:"address"`
+	ModuleAddress string      `json:"module_address"`
+	Mode          string      `json:"mode"`
+	Type          string      `json:"type"`
+	Name          string      `json:"name"`
+	Index         interface{} `json:"index"`
+	ProviderName  string      `json:"provider_name"`
+	Change        struct {
+		Actions         []string               `json:"actions"`
+		Before          map[string]interface{} `json:"before"`
+		After           map[string]interface{} `json:"after"`
+		AfterUnknown    interface{}            `json:"after_unknown"`
+		BeforeSensitive interface{}            `json:"before_sensitive"`
+		AfterSensitive  interface{}            `json:"after_sensitive"`
+		ReplacePaths    [][]interface{}        `json:"replace_paths"`
+	} `json:"change"`
+	ActionReason string `json:"action_reason"`
+}
+
+// ParseJSON decodes `terraform show -json` output for a saved plan.
+func ParseJSON(data []byte) (*Plan, error) {
+	var raw jsonPlan
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("plan: %w", err)
+	}
+	if raw.FormatVersion == "" {
+		return nil, fmt.Errorf("plan: missing format_version, not terraform show -json output")
+	}
+
+	p := &Plan{
+		FormatVersion:    raw.FormatVersion,
+		TerraformVersion: raw.TerraformVersion,
+		Variables:        map[string]interface{}{},
+	}
+	for name, v := range raw.Variables {
+		p.Variables[name] = v.Value
+	}
+	for _, rc := range raw.ResourceChanges {
+		p.ResourceChanges = append(p.ResourceChanges, rc.normalize())
+	}
+	for _, rc := range raw.ResourceDrift {
+		p.ResourceDrift = append(p.ResourceDrift, rc.normalize())
+	}
+	if raw.Configuration != nil {
+		p.Config = &Config{RootModule: raw.Configuration.RootModule.normalize()}
+	}
+	return p, nil
+}
+
+func (rc jsonResourceChange) normalize() ResourceChange {
+	return ResourceChange{
+		Address:      rc.Address,
+		Module:       rc.ModuleAddress,
+		Mode:         rc.Mode,
+		Type:         rc.Type,
+		Name:         rc.Name,
+		Index:        rc.Index,
+		ProviderName: rc.ProviderName,
+		Actions:      Actions(rc.Change.Actions),
+		Before:       rc.Change.Before,
+		After:        rc.Change.After,
+		AfterUnknown: rc.Change.AfterUnknown,
+
+		BeforeSensitive: rc.Change.BeforeSensitive,
+		AfterSensitive:  rc.Change.AfterSensitive,
+		ReplacePaths:    rc.Change.ReplacePaths,
+		ActionReason:    rc.ActionReason,
+	}
+}
+
+// StringVar returns a string input variable, or "" when it is unset or not
+// a string.
+func (p *Plan) StringVar(name string) string {
+	s, _ := p.Variables[name].(string)
+	return s
+}
@@ -0,0 +1,570 @@
+package plan
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// SavedPlan is the content of a plan file written by `terraform plan -out`.
+//
+// A plan file is a zip archive holding the plan itself in protocol buffers,
+// the state it was made against and a snapshot of the configuration.
+// Reading it needs neither terraform nor provider credentials, but values
+// are decoded without provider schemas, and the configuration snapshot is
+// HCL rather than JSON, so Plan.Config is always nil.
+type SavedPlan struct {
+	Plan *Plan
+
+	// PlanFormatVersion is the plan file format, 3 for terraform 1.x.
+	PlanFormatVersion uint64
+
+	Backend Backend
+
+	// PriorState is the refreshed state the plan was made against, the
+	// state that apply will check has not moved.
+	PriorState *tfstate.State
+
+	// PrevRunState is the state as the previous run left it, before
+	// refresh.
+	PrevRunState *tfstate.State
+}
+
+// Backend is the backend a saved plan must be applied with.
+type Backend struct {
+	Type      string
+	Workspace string
+
+	// Config holds the backend block's arguments. Unset arguments are
+	// present with a nil value.
+	Config map[string]interface{}
+}
+
+// Plan file zip entries.
+const (
+	savedPlanEntry  = "tfplan"
+	savedStateEntry = "tfstate"
+	savedPrevEntry  = "tfstate-prev"
+)
+
+// IsSaved reports whether data looks like a plan file rather than JSON.
+func IsSaved(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// LoadSaved reads a plan file written by `terraform plan -out`.
+func LoadSaved(path string) (*SavedPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := ParseSaved(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sp, nil
+}
+
+// ParseSaved decodes a plan file.
+func ParseSaved(data []byte) (*SavedPlan, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("plan: not a plan file: %w", err)
+	}
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		switch f.Name {
+		case savedPlanEntry, savedStateEntry, savedPrevEntry:
+		default:
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("plan: %s: %w", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("plan: %s: %w", f.Name, err)
+		}
+		entries[f.Name] = b
+	}
+	if entries[savedPlanEntry] == nil {
+		return nil, fmt.Errorf("plan: plan file has no %s entry", savedPlanEntry)
+	}
+
+	sp, err := decodeSavedPlan(entries[savedPlanEntry])
+	if err != nil {
+		return nil, fmt.Errorf("plan: %w", err)
+	}
+	if b := entries[savedStateEntry]; b != nil {
+		if sp.PriorState, err = tfstate.Parse(b); err != nil {
+			return nil, fmt.Errorf("plan: %s: %w", savedStateEntry, err)
+		}
+	}
+	if b := entries[savedPrevEntry]; b != nil {
+		if sp.PrevRunState, err = tfstate.Parse(b); err != nil {
+			return nil, fmt.Errorf("plan: %s: %w", savedPrevEntry, err)
+		}
+	}
+	return sp, nil
+}
+
+// pbField is one field of a protocol buffers message. Varints are in
+// Varint, length-delimited fields in Bytes.
+type pbField struct {
+	Num    protowire.Number
+	Varint uint64
+	Bytes  []byte
+}
+
+// pbFields splits a message into its fields. Fields of other wire types
+// are skipped; the plan format does not use them for anything read here.
+func pbFields(b []byte) ([]pbField, error) {
+	var out []pbField
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := pbField{Num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.Varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// Field numbers from terraform's planfile.proto.
+const (
+	pbPlanVersion          = 1
+	pbPlanVariables        = 2
+	pbPlanResourceChanges  = 3
+	pbPlanResourceDrift    = 18
+	pbPlanBackend          = 13
+	pbPlanTerraformVersion = 14
+
+	pbBackendType      = 1
+	pbBackendConfig    = 2
+	pbBackendWorkspace = 3
+
+	pbDynamicMsgpack = 1
+
+	pbChangeAddr            = 13
+	pbChangeProvider        = 8
+	pbChangeChange          = 9
+	pbChangeRequiredReplace = 11
+	pbChangeActionReason    = 12
+
+	pbChangeAction          = 1
+	pbChangeValues          = 2
+	pbChangeBeforeSensitive = 3
+	pbChangeAfterSensitive  = 4
+
+	pbPathSteps         = 1
+	pbStepAttributeName = 1
+	pbStepElementKey    = 2
+)
+
+// planFormatVersion is the plan file format this reader understands.
+const planFormatVersion = 3
+
+// protoActions maps planfile.proto's Action enum to show -json actions.
+var protoActions = map[uint64]Actions{
+	0: {"no-op"},
+	1: {"create"},
+	2: {"read"},
+	3: {"update"},
+	5: {"delete"},
+	6: {"delete", "create"},
+	7: {"create", "delete"},
+	8: {"forget"},
+}
+
+// protoActionReasons maps planfile.proto's ResourceInstanceActionReason
+// enum to show -json action_reason values.
+var protoActionReasons = map[uint64]string{
+	1:  "replace_because_tainted",
+	2:  "replace_by_request",
+	3:  "replace_because_cannot_update",
+	4:  "delete_because_no_resource_config",
+	5:  "delete_because_wrong_repetition",
+	6:  "delete_because_count_index",
+	7:  "delete_because_each_key",
+	8:  "delete_because_no_module",
+	9:  "replace_by_triggers",
+	10: "read_because_config_unknown",
+	11: "read_because_dependency_pending",
+	12: "delete_because_no_move_target",
+	13: "read_because_check_nested",
+}
+
+func decodeSavedPlan(b []byte) (*SavedPlan, error) {
+	fields, err := pbFields(b)
+	if err != nil {
+		return nil, err
+	}
+	sp := &SavedPlan{Plan: &Plan{Variables: map[string]interface{}{}}}
+	for _, f := range fields {
+		if f.Num == pbPlanVersion {
+			sp.PlanFormatVersion = f.Varint
+		}
+	}
+	if sp.PlanFormatVersion != planFormatVersion {
+		return nil, fmt.Errorf("unsupported plan file format %d", sp.PlanFormatVersion)
+	}
+
+	for _, f := range fields {
+		switch f.Num {
+		case pbPlanTerraformVersion:
+			sp.Plan.TerraformVersion = string(f.Bytes)
+		case pbPlanVariables:
+			name, value, err := decodeVariable(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, err)
+			}
+			sp.Plan.Variables[name] = value
+		case pbPlanResourceChanges:
+			rc, err := decodeResourceChange(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("resource %s: %w", rc.Address, err)
+			}
+			sp.Plan.ResourceChanges = append(sp.Plan.ResourceChanges, rc)
+		case pbPlanResourceDrift:
+			rc, err := decodeResourceChange(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("drift %s: %w", rc.Address, err)
+			}
+			sp.Plan.ResourceDrift = append(sp.Plan.ResourceDrift, rc)
+		case pbPlanBackend:
+			if sp.Backend, err = decodeBackend(f.Bytes); err != nil {
+				return nil, fmt.Errorf("backend: %w", err)
+			}
+		}
+	}
+	return sp, nil
+}
+
+// decodeVariable decodes a variables map entry.
+func decodeVariable(b []byte) (string, interface{}, error) {
+	fields, err := pbFields(b)
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		name  string
+		value interface{}
+	)
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			name = string(f.Bytes)
+		case 2:
+			if value, err = decodeDynamicValue(f.Bytes); err != nil {
+				return name, nil, err
+			}
+		}
+	}
+	value, _ = splitUnknown(value)
+	return name, value, nil
+}
+
+func decodeDynamicValue(b []byte) (interface{}, error) {
+	fields, err := pbFields(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if f.Num == pbDynamicMsgpack {
+			return decodeMsgpack(f.Bytes)
+		}
+	}
+	return nil, nil
+}
+
+func decodeBackend(b []byte) (Backend, error) {
+	var be Backend
+	fields, err := pbFields(b)
+	if err != nil {
+		return be, err
+	}
+	for _, f := range fields {
+		switch f.Num {
+		case pbBackendType:
+			be.Type = string(f.Bytes)
+		case pbBackendWorkspace:
+			be.Workspace = string(f.Bytes)
+		case pbBackendConfig:
+			v, err := decodeDynamicValue(f.Bytes)
+			if err != nil {
+				return be, err
+			}
+			be.Config, _ = v.(map[string]interface{})
+		}
+	}
+	return be, nil
+}
+
+func decodeResourceChange(b []byte) (ResourceChange, error) {
+	var rc ResourceChange
+	fields, err := pbFields(b)
+	if err != nil {
+		return rc, err
+	}
+	for _, f := range fields {
+		switch f.Num {
+		case pbChangeAddr:
+			rc.Address = string(f.Bytes)
+			rc.Module, rc.Mode, rc.Type, rc.Name, rc.Index = parseAddress(rc.Address)
+		case pbChangeProvider:
+			rc.ProviderName = providerName(string(f.Bytes))
+		case pbChangeActionReason:
+			rc.ActionReason = protoActionReasons[f.Varint]
+		case pbChangeRequiredReplace:
+			path, err := decodePath(f.Bytes)
+			if err != nil {
+				return rc, err
+			}
+			rc.ReplacePaths = append(rc.ReplacePaths, path)
+		}
+	}
+	for _, f := range fields {
+		if f.Num == pbChangeChange {
+			if err := decodeChange(f.Bytes, &rc); err != nil {
+				return rc, err
+			}
+		}
+	}
+	return rc, nil
+}
+
+// decodeChange fills in the actions, values and sensitivity marks. A plan
+// file stores only the values an action needs: the after value for a
+// create, the before value for a delete or no-op, and both otherwise.
+func decodeChange(b []byte, rc *ResourceChange) error {
+	fields, err := pbFields(b)
+	if err != nil {
+		return err
+	}
+	var (
+		values                []interface{}
+		beforeSens, afterSens [][]interface{}
+		action                uint64
+	)
+	for _, f := range fields {
+		switch f.Num {
+		case pbChangeAction:
+			action = f.Varint
+		case pbChangeValues:
+			v, err := decodeDynamicValue(f.Bytes)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		case pbChangeBeforeSensitive, pbChangeAfterSensitive:
+			path, err := decodePath(f.Bytes)
+			if err != nil {
+				return err
+			}
+			if f.Num == pbChangeBeforeSensitive {
+				beforeSens = append(beforeSens, path)
+			} else {
+				afterSens = append(afterSens, path)
+			}
+		}
+	}
+
+	actions, ok := protoActions[action]
+	if !ok {
+		return fmt.Errorf("unknown action %d", action)
+	}
+	rc.Actions = actions
+
+	var before, after interface{}
+	switch {
+	case actions.NoOp() && len(values) == 1:
+		before, after = values[0], values[0]
+	case actions.Create() && len(values) == 1:
+		after = values[0]
+	case (actions.Delete() || actions.is("forget")) && len(values) == 1:
+		before = values[0]
+	case len(values) == 2:
+		before, after = values[0], values[1]
+	default:
+		return fmt.Errorf("%d values for %s", len(values), actions)
+	}
+	before, _ = splitUnknown(before)
+	after, rc.AfterUnknown = splitUnknown(after)
+	rc.Before, _ = before.(map[string]interface{})
+	rc.After, _ = after.(map[string]interface{})
+	if rc.After == nil {
+		rc.AfterUnknown = false
+	}
+	rc.BeforeSensitive = sensitiveMarks(beforeSens)
+	rc.AfterSensitive = sensitiveMarks(afterSens)
+	return nil
+}
+
+// decodePath decodes an attribute path into the attribute names and
+// element keys show -json uses for replace_paths.
+func decodePath(b []byte) ([]interface{}, error) {
+	fields, err := pbFields(b)
+	if err != nil {
+		return nil, err
+	}
+	path := []interface{}{}
+	for _, f := range fields {
+		if f.Num != pbPathSteps {
+			continue
+		}
+		steps, err := pbFields(f.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range steps {
+			switch s.Num {
+			case pbStepAttributeName:
+				path = append(path, string(s.Bytes))
+			case pbStepElementKey:
+				key, err := decodeDynamicValue(s.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				path = append(path, key)
+			}
+		}
+	}
+	return path, nil
+}
+
+// sensitiveMarks turns a list of sensitive paths into the mirror object
+// show -json gives: true at each sensitive path, with lists padded with
+// false up to the sensitive element.
+func sensitiveMarks(paths [][]interface{}) interface{} {
+	root := interface{}(map[string]interface{}{})
+	for _, p := range paths {
+		root = markPath(root, p)
+	}
+	return root
+}
+
+func markPath(node interface{}, path []interface{}) interface{} {
+	if len(path) == 0 {
+		return true
+	}
+	switch step := path[0].(type) {
+	case string:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+		}
+		m[step] = markPath(m[step], path[1:])
+		return m
+	case float64:
+		l, _ := node.([]interface{})
+		for len(l) <= int(step) {
+			l = append(l, false)
+		}
+		l[int(step)] = markPath(l[int(step)], path[1:])
+		return l
+	}
+	return node
+}
+
+// providerName extracts the provider source address from a provider
+// configuration address such as
+// module.x.provider["registry.terraform.io/hashicorp/azurerm"].alias.
+func providerName(addr string) string {
+	start := strings.Index(addr, `["`)
+	end := strings.LastIndex(addr, `"]`)
+	if start < 0 || end < start {
+		return addr
+	}
+	return addr[start+2 : end]
+}
+
+// parseAddress splits a resource instance address, e.g.
+// module.apps["web"].azurerm_linux_web_app.app[0], into its module path,
+// mode, type, name and instance key.
+func parseAddress(addr string) (module, mode, typ, name string, index interface{}) {
+	parts := splitAddress(addr)
+	i := 0
+	var modules []string
+	for i+2 < len(parts) && parts[i] == "module" {
+		modules = append(modules, parts[i], parts[i+1])
+		i += 2
+	}
+	module = strings.Join(modules, ".")
+	mode = "managed"
+	if i < len(parts) && parts[i] == "data" {
+		mode = "data"
+		i++
+	}
+	if i+1 >= len(parts) {
+		return module, mode, "", "", nil
+	}
+	typ = parts[i]
+	name = parts[i+1]
+	if k := strings.IndexByte(name, '['); k >= 0 {
+		key := strings.TrimSuffix(name[k+1:], "]")
+		name = name[:k]
+		if s, err := strconv.Unquote(key); err == nil {
+			index = s
+		} else if n, err := strconv.ParseFloat(key, 64); err == nil {
+			index = n
+		}
+	}
+	return module, mode, typ, name, index
+}
+
+// splitAddress splits an address at dots outside instance keys. A module
+// step keeps its key, so module.apps["web"] is the pair "module",
+// `apps["web"]`.
+func splitAddress(addr string) []string {
+	var (
+		parts  []string
+		start  int
+		depth  int
+		quoted bool
+	)
+	for i := 0; i < len(addr); i++ {
+		c := addr[i]
+		switch {
+		case quoted:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '"' && depth > 0:
+			quoted = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0:
+			parts = append(parts, addr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, addr[start:])
+}
@@ -0,0 +1,182 @@
+package plan
+
+import (
+	"archive/zip"
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestLoadSavedPlanFile(t *testing.T) {
+	sp, err := LoadSaved("testdata/tfplan")
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(3), sp.PlanFormatVersion)
+	assert.Equal(t, "1.12.1", sp.Plan.TerraformVersion)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", sp.Plan.StringVar("subscription_id"))
+
+	assert.Equal(t, "azurerm", sp.Backend.Type)
+	assert.Equal(t, "default", sp.Backend.Workspace)
+	assert.Equal(t, "prod.terraform.tfstate", sp.Backend.Config["key"])
+	assert.Equal(t, "tfstate2", sp.Backend.Config["container_name"])
+
+	require.NotNil(t, sp.PriorState)
+	assert.Equal(t, uint64(16), sp.PriorState.Serial)
+	assert.Equal(t, "7ddb8baa-9fe1-e6af-6691-d5568c80a772", sp.PriorState.Lineage)
+	require.NotNil(t, sp.PrevRunState)
+
+	require.Len(t, sp.Plan.ResourceChanges, 3)
+	rc := sp.Plan.ResourceChanges[0]
+	assert.Equal(t, "module.naming.null_resource.storage_account_name", rc.Address)
+	assert.Equal(t, "module.naming", rc.Module)
+	assert.Equal(t, "null_resource", rc.Type)
+	assert.Equal(t, "storage_account_name", rc.Name)
+	assert.Equal(t, "registry.terraform.io/hashicorp/null", rc.ProviderName)
+	assert.True(t, rc.Actions.NoOp())
+	assert.Equal(t, rc.Before, rc.After)
+	assert.Equal(t, map[string]interface{}{"name": "tfstdev01"}, rc.After["triggers"])
+
+	// Load accepts plan files as well as show -json output.
+	p, err := Load("testdata/tfplan")
+	require.NoError(t, err)
+	assert.Len(t, p.ResourceChanges, 3)
+}
+
+func TestParseSavedReplacement(t *testing.T) {
+	change := pbVarint(nil, pbChangeAction, 6)
+	change = pbBytes(change, pbChangeValues, dynamicValue(map[string]interface{}{
+		"name": "app-old", "id": "x", "secret": "s", "tags": map[string]interface{}{"env": "dev"},
+	}))
+	change = pbBytes(change, pbChangeValues, dynamicValue(map[string]interface{}{
+		"name": "app-new", "id": unknown{}, "secret": "s", "tags": map[string]interface{}{"env": "dev"},
+	}))
+	change = pbBytes(change, pbChangeAfterSensitive, path("secret"))
+
+	rc := pbBytes(nil, pbChangeAddr, []byte(`module.apps["web"].azurerm_linux_web_app.app[0]`))
+	rc = pbBytes(rc, pbChangeProvider, []byte(`module.apps.provider["registry.terraform.io/hashicorp/azurerm"]`))
+	rc = pbBytes(rc, pbChangeChange, change)
+	rc = pbBytes(rc, pbChangeRequiredReplace, path("name"))
+	rc = pbVarint(rc, pbChangeActionReason, 3)
+
+	variable := pbBytes(nil, 1, []byte("environment"))
+	variable = pbBytes(variable, 2, pbBytes(nil, pbDynamicMsgpack, msgpack([]interface{}{[]byte(`"string"`), "dev"})))
+
+	backend := pbBytes(nil, pbBackendType, []byte("local"))
+	backend = pbBytes(backend, pbBackendConfig, dynamicValue(map[string]interface{}{"path": nil}))
+	backend = pbBytes(backend, pbBackendWorkspace, []byte("dev"))
+
+	tfplan := pbVarint(nil, pbPlanVersion, 3)
+	tfplan = pbBytes(tfplan, pbPlanVariables, variable)
+	tfplan = pbBytes(tfplan, pbPlanResourceChanges, rc)
+	tfplan = pbBytes(tfplan, pbPlanBackend, backend)
+	tfplan = pbBytes(tfplan, pbPlanTerraformVersion, []byte("1.8.5"))
+
+	sp, err := ParseSaved(zipFile(t, map[string][]byte{
+		"tfplan":  tfplan,
+		"tfstate": []byte(`{"version": 4, "serial": 7, "lineage": "abc", "resources": []}`),
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "dev", sp.Plan.StringVar("environment"))
+	assert.Equal(t, Backend{Type: "local", Workspace: "dev", Config: map[string]interface{}{"path": nil}}, sp.Backend)
+	assert.Equal(t, uint64(7), sp.PriorState.Serial)
+	assert.Nil(t, sp.PrevRunState)
+
+	require.Len(t, sp.Plan.ResourceChanges, 1)
+	got := sp.Plan.ResourceChanges[0]
+	assert.Equal(t, `module.apps["web"]`, got.Module)
+	assert.Equal(t, "managed", got.Mode)
+	assert.Equal(t, "azurerm_linux_web_app", got.Type)
+	assert.Equal(t, "app", got.Name)
+	assert.Equal(t, float64(0), got.Index)
+	assert.Equal(t, "registry.terraform.io/hashicorp/azurerm", got.ProviderName)
+	assert.True(t, got.Actions.Replace())
+	assert.Equal(t, "replace_because_cannot_update", got.ActionReason)
+	assert.Equal(t, [][]interface{}{{"name"}}, got.ReplacePaths)
+
+	assert.Equal(t, "x", got.Before["id"])
+	assert.Nil(t, got.After["id"])
+	assert.Equal(t, map[string]interface{}{"id": true, "tags": map[string]interface{}{}}, got.AfterUnknown)
+	assert.Equal(t, map[string]interface{}{"secret": true}, got.AfterSensitive)
+	assert.Equal(t, map[string]interface{}{}, got.BeforeSensitive)
+}
+
+func TestParseSavedRejectsOtherFormats(t *testing.T) {
+	_, err := ParseSaved(zipFile(t, map[string][]byte{"tfplan": pbVarint(nil, pbPlanVersion, 2)}))
+	assert.ErrorContains(t, err, "unsupported plan file format 2")
+
+	_, err = ParseSaved([]byte(`{"format_version": "1.2"}`))
+	assert.ErrorContains(t, err, "not a plan file")
+}
+
+func pbVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func pbBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func dynamicValue(v interface{}) []byte {
+	return pbBytes(nil, pbDynamicMsgpack, msgpack(v))
+}
+
+func path(attrs ...string) []byte {
+	var b []byte
+	for _, a := range attrs {
+		b = pbBytes(b, pbPathSteps, pbBytes(nil, pbStepAttributeName, []byte(a)))
+	}
+	return b
+}
+
+// msgpack encodes the handful of shapes the tests need.
+func msgpack(v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return []byte{0xc0}
+	case unknown:
+		return []byte{0xd4, 0, 0}
+	case string:
+		return append([]byte{0xa0 | byte(len(v))}, v...)
+	case []byte:
+		return append([]byte{0xc4, byte(len(v))}, v...)
+	case []interface{}:
+		out := []byte{0x90 | byte(len(v))}
+		for _, e := range v {
+			out = append(out, msgpack(e)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := []byte{0x80 | byte(len(v))}
+		for _, k := range keys {
+			out = append(out, msgpack(k)...)
+			out = append(out, msgpack(v[k])...)
+		}
+		return out
+	}
+	panic("msgpack: unsupported test value")
+}
+
+func zipFile(t *testing.T, entries map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range entries {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,203 @@
+// Package plansign ties an apply to the plan that was reviewed.
+//
+// Re-planning at apply time can apply something nobody reviewed: a merged
+// change, a provider release or someone else's apply may have happened in
+// between. Instead the reviewed plan file is kept, together with an
+// Approval recording its content hash and the state it was made against,
+// optionally signed with a local ed25519 key. Before applying, Verify
+// checks that the plan file is the approved one and that the state has not
+// moved since.
+package plansign
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// hashPrefix names the hash algorithm in hash strings.
+const hashPrefix = "sha256:"
+
+// Hash returns the canonical content hash of a plan file, e.g.
+// "sha256:3a7f…". It covers the name and content of every entry in the
+// archive, in name order, so it does not change when the file is re-zipped
+// with other timestamps or compression.
+func Hash(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("plansign: not a plan file: %w", err)
+	}
+	files := append([]*zip.File(nil), zr.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	h := sha256.New()
+	for _, f := range files {
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("plansign: %s: %w", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("plansign: %s: %w", f.Name, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", f.Name, len(content))
+		h.Write(content)
+	}
+	return hashPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Approval records what was reviewed. It is written next to the plan file
+// as JSON.
+type Approval struct {
+	PlanHash         string `json:"plan_hash"`
+	TerraformVersion string `json:"terraform_version"`
+	Workspace        string `json:"workspace"`
+
+	// StateSerial and StateLineage identify the state the plan was made
+	// against. Lineage is empty for a workspace without state.
+	StateSerial  uint64 `json:"state_serial"`
+	StateLineage string `json:"state_lineage"`
+
+	// KeyID and Signature are set by Sign.
+	KeyID     string `json:"key_id,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// New describes a plan file for approval.
+func New(data []byte) (*Approval, error) {
+	hash, err := Hash(data)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := plan.ParseSaved(data)
+	if err != nil {
+		return nil, err
+	}
+	a := &Approval{
+		PlanHash:         hash,
+		TerraformVersion: sp.Plan.TerraformVersion,
+		Workspace:        sp.Backend.Workspace,
+	}
+	if sp.PriorState != nil {
+		a.StateSerial = sp.PriorState.Serial
+		a.StateLineage = sp.PriorState.Lineage
+	}
+	return a, nil
+}
+
+// payload is the text a signature covers.
+func (a *Approval) payload() []byte {
+	return []byte(fmt.Sprintf("terraform plan approval v1\nplan_hash %s\nterraform_version %s\nworkspace %s\nstate_serial %d\nstate_lineage %s\n",
+		a.PlanHash, a.TerraformVersion, a.Workspace, a.StateSerial, a.StateLineage))
+}
+
+// Sign signs the approval with key.
+func (a *Approval) Sign(key ed25519.PrivateKey) {
+	a.KeyID = KeyID(key.Public().(ed25519.PublicKey))
+	a.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, a.payload()))
+}
+
+// Load reads an approval file.
+func Load(path string) (*Approval, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var a Approval
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &a, nil
+}
+
+// Write writes the approval as indented JSON.
+func (a *Approval) Write(path string) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Verification failures. Verify wraps them with the details.
+var (
+	ErrHashMismatch = errors.New("plan file does not match the approved hash")
+	ErrUnsigned     = errors.New("approval is not signed")
+	ErrBadSignature = errors.New("approval signature is not valid")
+	ErrWorkspace    = errors.New("plan was made for another workspace")
+	ErrStateMoved   = errors.New("state has changed since the plan was made")
+)
+
+// Expect is what Verify checks an approval against.
+type Expect struct {
+	// Hash, when set, is the hash the reviewer approved, e.g. from a
+	// pull request comment. It must match as well as the approval's own.
+	Hash string
+
+	// PublicKey, when set, requires the approval to be signed by it.
+	PublicKey ed25519.PublicKey
+
+	// Workspace, when set, is the workspace about to be applied to.
+	Workspace string
+
+	// State is the workspace's current state, nil when it has none.
+	State *tfstate.State
+}
+
+// Verify checks that data is the plan file a approves and that applying
+// it now would apply what was reviewed.
+func Verify(data []byte, a *Approval, e Expect) error {
+	got, err := New(data)
+	if err != nil {
+		return err
+	}
+	if got.PlanHash != a.PlanHash {
+		return fmt.Errorf("%w: plan is %s, approval is for %s", ErrHashMismatch, got.PlanHash, a.PlanHash)
+	}
+	if e.Hash != "" && e.Hash != a.PlanHash {
+		return fmt.Errorf("%w: plan is %s, reviewer approved %s", ErrHashMismatch, got.PlanHash, e.Hash)
+	}
+
+	if e.PublicKey != nil {
+		if a.Signature == "" {
+			return ErrUnsigned
+		}
+		sig, err := base64.StdEncoding.DecodeString(a.Signature)
+		if err != nil || !ed25519.Verify(e.PublicKey, a.payload(), sig) {
+			return fmt.Errorf("%w for key %s", ErrBadSignature, KeyID(e.PublicKey))
+		}
+	}
+
+	// The hash covers the plan file, not the approval's description of it.
+	if *got != (Approval{PlanHash: a.PlanHash, TerraformVersion: a.TerraformVersion, Workspace: a.Workspace, StateSerial: a.StateSerial, StateLineage: a.StateLineage}) {
+		return fmt.Errorf("%w: approval does not describe the plan file", ErrHashMismatch)
+	}
+
+	if e.Workspace != "" && e.Workspace != a.Workspace {
+		return fmt.Errorf("%w: plan is for %q, applying to %q", ErrWorkspace, a.Workspace, e.Workspace)
+	}
+
+	var serial uint64
+	var lineage string
+	if e.State != nil {
+		serial, lineage = e.State.Serial, e.State.Lineage
+	}
+	if serial != a.StateSerial || lineage != a.StateLineage {
+		return fmt.Errorf("%w: planned against serial %d lineage %q, now serial %d lineage %q",
+			ErrStateMoved, a.StateSerial, a.StateLineage, serial, lineage)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package plansign
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// tfplan is a minimal plan message: format version 3 and a backend in the
+// dev workspace.
+var tfplan = []byte{0x08, 0x03, 0x6a, 0x05, 0x1a, 0x03, 'd', 'e', 'v'}
+
+const priorState = `{"version": 4, "serial": 16, "lineage": "7ddb8baa", "resources": []}`
+
+type entry struct{ name, content string }
+
+func planFile(t *testing.T, modified time.Time, entries ...entry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modified})
+		require.NoError(t, err)
+		_, err = w.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestHashIgnoresArchiveLayout(t *testing.T) {
+	a := planFile(t, time.Unix(0, 0), entry{"tfplan", string(tfplan)}, entry{"tfstate", priorState})
+	b := planFile(t, time.Now(), entry{"tfstate", priorState}, entry{"tfplan", string(tfplan)})
+	c := planFile(t, time.Unix(0, 0), entry{"tfplan", string(tfplan)}, entry{"tfstate", priorState + " "})
+
+	ha, err := Hash(a)
+	require.NoError(t, err)
+	hb, err := Hash(b)
+	require.NoError(t, err)
+	hc, err := Hash(c)
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, ha)
+	assert.Equal(t, ha, hb)
+	assert.NotEqual(t, ha, hc)
+}
+
+func TestNewDescribesPlan(t *testing.T) {
+	a, err := New(planFile(t, time.Now(), entry{"tfplan", string(tfplan)}, entry{"tfstate", priorState}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "dev", a.Workspace)
+	assert.Equal(t, uint64(16), a.StateSerial)
+	assert.Equal(t, "7ddb8baa", a.StateLineage)
+	assert.Empty(t, a.Signature)
+}
+
+func TestVerify(t *testing.T) {
+	data := planFile(t, time.Now(), entry{"tfplan", string(tfplan)}, entry{"tfstate", priorState})
+	current := &tfstate.State{Serial: 16, Lineage: "7ddb8baa"}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	approve := func(sign bool) *Approval {
+		a, err := New(data)
+		require.NoError(t, err)
+		if sign {
+			a.Sign(priv)
+		}
+		return a
+	}
+
+	assert.NoError(t, Verify(data, approve(false), Expect{State: current}))
+
+	path := filepath.Join(t.TempDir(), "tfplan.approval.json")
+	require.NoError(t, approve(true).Write(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.NoError(t, Verify(data, loaded, Expect{Hash: loaded.PlanHash, PublicKey: pub, State: current}))
+	assert.NoError(t, Verify(data, approve(true), Expect{PublicKey: pub, Workspace: "dev", State: current}))
+
+	other := planFile(t, time.Now(), entry{"tfplan", string(tfplan)}, entry{"tfstate", `{"version": 4, "serial": 17, "lineage": "7ddb8baa"}`})
+	assert.ErrorIs(t, Verify(other, approve(false), Expect{State: current}), ErrHashMismatch)
+	assert.ErrorIs(t, Verify(data, approve(false), Expect{Hash: "sha256:00", State: current}), ErrHashMismatch)
+
+	assert.ErrorIs(t, Verify(data, approve(false), Expect{PublicKey: pub, State: current}), ErrUnsigned)
+	assert.ErrorIs(t, Verify(data, approve(true), Expect{PublicKey: otherPub, State: current}), ErrBadSignature)
+
+	tampered := approve(true)
+	tampered.StateSerial = 17
+	assert.ErrorIs(t, Verify(data, tampered, Expect{PublicKey: pub, State: current}), ErrBadSignature)
+	assert.ErrorIs(t, Verify(data, tampered, Expect{State: current}), ErrHashMismatch)
+
+	assert.ErrorIs(t, Verify(data, approve(false), Expect{Workspace: "prod", State: current}), ErrWorkspace)
+
+	moved := &tfstate.State{Serial: 17, Lineage: "7ddb8baa"}
+	err = Verify(data, approve(false), Expect{State: moved})
+	assert.ErrorIs(t, err, ErrStateMoved)
+	assert.ErrorContains(t, err, "now serial 17")
+	assert.ErrorIs(t, Verify(data, approve(false), Expect{}), ErrStateMoved)
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	privPEM, pubPEM, err := GenerateKey()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "plan-signing.pem")
+	pubPath := filepath.Join(dir, "plan-signing.pub")
+	require.NoError(t, os.WriteFile(privPath, privPEM, 0o600))
+	require.NoError(t, os.WriteFile(pubPath, pubPEM, 0o644))
+
+	priv, err := LoadPrivateKey(privPath)
+	require.NoError(t, err)
+	pub, err := LoadPublicKey(pubPath)
+	require.NoError(t, err)
+	assert.Equal(t, priv.Public(), pub)
+
+	_, err = LoadPublicKey(privPath)
+	assert.ErrorContains(t, err, "no PUBLIC KEY PEM block")
+}
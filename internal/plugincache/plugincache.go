@@ -0,0 +1,333 @@
+// Package plugincache manages a terraform provider plugin cache shared by
+// parallel tests and by several test processes at once.
+//
+// Terraform reads TF_PLUGIN_CACHE_DIR without locking it, and two inits
+// installing the same provider into it at the same time can leave a
+// broken entry behind. A Cache therefore installs providers under an
+// exclusive file lock, before the init of a working directory that needs
+// them runs, and that init then only reads. Terraform installs into a
+// staging directory, from which each provider is renamed into the cache
+// whole, so that checking for a provider without the lock never sees one
+// half extracted.
+package plugincache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+// LockFile is the dependency lock file terraform init writes.
+const LockFile = tfconfig.LockFile
+
+// lockName is the file in the cache directory the cross-process lock is
+// taken on. Terraform ignores files at the top of the cache.
+const lockName = ".harness.lock"
+
+// Provider is one provider release pinned by a lock file.
+type Provider struct {
+	// Source is the full source address, such as
+	// registry.terraform.io/hashicorp/azurerm.
+	Source  string
+	Version string
+}
+
+func (p Provider) String() string { return p.Source + " " + p.Version }
+
+// LockedProviders returns the providers a lock file pins.
+func LockedProviders(file string) ([]Provider, error) {
+	locked, err := tfconfig.LoadLock(file)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Provider, len(locked))
+	for i, p := range locked {
+		out[i] = Provider{Source: p.Source, Version: p.Version}
+	}
+	return out, nil
+}
+
+// Stats counts, per provider a working directory needed, whether the
+// cache already had it.
+type Stats struct {
+	Hits   int
+	Misses int
+}
+
+// Cache is a plugin cache directory.
+type Cache struct {
+	// Dir is the cache directory, the value for TF_PLUGIN_CACHE_DIR.
+	Dir string
+
+	// Binary is the terraform or tofu executable. Defaults to "terraform".
+	Binary string
+
+	// Platform is the os_arch directory terraform installs into.
+	// Defaults to the running platform.
+	Platform string
+
+	// Terraform runs the binary in dir with env added to the process
+	// environment and returns its combined output. Nil runs Binary.
+	Terraform func(ctx context.Context, dir string, env []string, args ...string) ([]byte, error)
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Open returns the cache in dir, creating the directory if needed.
+func Open(dir string) (*Cache, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, fmt.Errorf("plugincache: %w", err)
+	}
+	return &Cache{Dir: abs}, nil
+}
+
+// Has reports whether p is installed in the cache for c's platform.
+func (c *Cache) Has(p Provider) bool {
+	info, err := os.Stat(filepath.Join(c.Dir, filepath.FromSlash(p.Source), p.Version, c.platform()))
+	return err == nil && info.IsDir()
+}
+
+func (c *Cache) platform() string {
+	if c.Platform != "" {
+		return c.Platform
+	}
+	return runtime.GOOS + "_" + runtime.GOARCH
+}
+
+// Lock takes the cache's exclusive lock, waiting for other goroutines and
+// processes to release it.
+func (c *Cache) Lock() (unlock func() error, err error) {
+	f, err := os.OpenFile(filepath.Join(c.Dir, lockName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("plugincache: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("plugincache: locking %s: %w", f.Name(), err)
+	}
+	return func() error {
+		err := unlockFile(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// Warm installs the providers the cache does not have yet and returns
+// those it installed. It holds the lock throughout, so each provider is
+// downloaded once however many tests or processes ask for it.
+func (c *Cache) Warm(ctx context.Context, providers []Provider) ([]Provider, error) {
+	unlock, err := c.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return c.warm(ctx, providers)
+}
+
+func (c *Cache) warm(ctx context.Context, providers []Provider) ([]Provider, error) {
+	missing := c.missing(providers)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	// A module can require only one version of each provider, so
+	// different versions of one source are installed in separate rounds.
+	for rest := missing; len(rest) > 0; {
+		var round, later []Provider
+		seen := map[string]bool{}
+		for _, p := range rest {
+			if seen[p.Source] {
+				later = append(later, p)
+				continue
+			}
+			seen[p.Source] = true
+			round = append(round, p)
+		}
+		if err := c.install(ctx, round); err != nil {
+			return nil, err
+		}
+		rest = later
+	}
+	if still := c.missing(missing); len(still) > 0 {
+		return nil, fmt.Errorf("plugincache: terraform init did not cache %s for %s", still[0], c.platform())
+	}
+	return missing, nil
+}
+
+// missing returns the distinct providers the cache does not have, sorted.
+func (c *Cache) missing(providers []Provider) []Provider {
+	seen := map[Provider]bool{}
+	var out []Provider
+	for _, p := range providers {
+		if !seen[p] && !c.Has(p) {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out
+}
+
+// install runs init in a scratch module that requires exactly providers.
+func (c *Cache) install(ctx context.Context, providers []Provider) error {
+	dir, err := os.MkdirTemp("", "plugincache-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var b strings.Builder
+	b.WriteString("terraform {\n  required_providers {\n")
+	for i, p := range providers {
+		fmt.Fprintf(&b, "    p%d = {\n      source  = %q\n      version = %q\n    }\n", i, p.Source, "= "+p.Version)
+	}
+	b.WriteString("  }\n}\n")
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	return c.init(ctx, dir)
+}
+
+// init runs terraform init in dir with a staging directory next to the
+// cache as its plugin cache, and then moves what it installed into the
+// cache.
+func (c *Cache) init(ctx context.Context, dir string) error {
+	staging, err := os.MkdirTemp(filepath.Dir(c.Dir), "."+filepath.Base(c.Dir)+"-staging-")
+	if err != nil {
+		return fmt.Errorf("plugincache: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	run := c.Terraform
+	if run == nil {
+		run = c.exec
+	}
+	out, err := run(ctx, dir, []string{"TF_PLUGIN_CACHE_DIR=" + staging}, "init", "-backend=false", "-input=false", "-no-color")
+	if err != nil {
+		return fmt.Errorf("plugincache: terraform init in %s: %w\n%s", dir, err, bytes.TrimSpace(out))
+	}
+	return c.promote(staging)
+}
+
+// promote renames each provider package in staging, laid out as
+// host/namespace/type/version/platform, into the cache. A rename within
+// one file system is atomic, so a package is either absent from the cache
+// or complete.
+func (c *Cache) promote(staging string) error {
+	packages, err := filepath.Glob(filepath.Join(staging, "*", "*", "*", "*", "*"))
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		rel, err := filepath.Rel(staging, pkg)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(c.Dir, rel)
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("plugincache: %w", err)
+		}
+		if err := os.Rename(pkg, target); err != nil {
+			return fmt.Errorf("plugincache: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Cache) exec(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	binary := c.Binary
+	if binary == "" {
+		binary = "terraform"
+	}
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+// Prepare makes sure every provider the working directory dir needs is in
+// the cache, so that its own init with TF_PLUGIN_CACHE_DIR set only reads
+// from it. Providers come from dir's lock file. A directory without one
+// is initialized under the lock, without its backend; terraform cannot
+// take unlocked providers from the cache, so they all count as misses.
+func (c *Cache) Prepare(ctx context.Context, dir string) error {
+	lockPath := filepath.Join(dir, LockFile)
+	if _, err := os.Stat(lockPath); os.IsNotExist(err) {
+		unlock, err := c.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := c.init(ctx, dir); err != nil {
+			return err
+		}
+		// The providers dir's init linked are in the staging directory,
+		// which is gone; its own init links them from the cache instead.
+		if err := os.RemoveAll(filepath.Join(dir, ".terraform", "providers")); err != nil {
+			return fmt.Errorf("plugincache: %w", err)
+		}
+		providers, err := LockedProviders(lockPath)
+		if err != nil {
+			return err
+		}
+		c.count(0, len(providers))
+		return nil
+	}
+
+	providers, err := LockedProviders(lockPath)
+	if err != nil {
+		return err
+	}
+	missing := c.missing(providers)
+	if len(missing) > 0 {
+		if _, err := c.Warm(ctx, missing); err != nil {
+			return err
+		}
+	}
+	c.count(len(providers)-len(missing), len(missing))
+	return nil
+}
+
+func (c *Cache) count(hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Hits += hits
+	c.stats.Misses += misses
+}
+
+// Stats returns the hits and misses Prepare has counted.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// WriteSummary writes the hit and miss counts, or nothing when Prepare
+// was never called.
+func (c *Cache) WriteSummary(w io.Writer) error {
+	s := c.Stats()
+	if s.Hits+s.Misses == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "\n=== Provider plugin cache (%s) ===\n%d hit(s), %d miss(es)\n", c.Dir, s.Hits, s.Misses)
+	return err
+}
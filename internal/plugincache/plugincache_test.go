@@ -0,0 +1,166 @@
+package plugincache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lockHCL = `
+provider "registry.terraform.io/hashicorp/azurerm" {
+  version     = "4.30.0"
+  constraints = "~> 4.0"
+  hashes      = ["h1:aN9QLfigAA5fLNBqRwx0u7QWUMSQGKeQZQ/iiG5Umw8="]
+}
+
+provider "registry.terraform.io/hashicorp/null" {
+  version = "3.2.4"
+}
+`
+
+var requirement = regexp.MustCompile(`source  = "([^"]+)"\s+version = "= ([^"]+)"`)
+
+// fakeCache returns a cache whose terraform installs what the scratch
+// module requires into its plugin cache, as init does, and records each
+// run. No package it installs is visible in the cache while it runs.
+func fakeCache(t *testing.T) (*Cache, *[][]Provider) {
+	t.Helper()
+	c, err := Open(filepath.Join(t.TempDir(), "cache"))
+	require.NoError(t, err)
+	c.Platform = "linux_amd64"
+
+	var mu sync.Mutex
+	var runs [][]Provider
+	c.Terraform = func(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+		require.Len(t, env, 1)
+		staging := strings.TrimPrefix(env[0], "TF_PLUGIN_CACHE_DIR=")
+		assert.NotEqual(t, c.Dir, staging, "terraform must not extract into the cache itself")
+		assert.Equal(t, []string{"init", "-backend=false", "-input=false", "-no-color"}, args)
+		var installed []Provider
+		if main, err := os.ReadFile(filepath.Join(dir, "main.tf")); err == nil {
+			for _, m := range requirement.FindAllStringSubmatch(string(main), -1) {
+				installed = append(installed, Provider{m[1], m[2]})
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, LockFile)); os.IsNotExist(err) && len(installed) == 0 {
+			installed = []Provider{{"registry.terraform.io/hashicorp/random", "3.7.2"}}
+			os.WriteFile(filepath.Join(dir, LockFile), []byte(`provider "registry.terraform.io/hashicorp/random" {
+  version = "3.7.2"
+}`), 0o644)
+		}
+		for _, p := range installed {
+			pkg := filepath.Join(staging, p.Source, p.Version, "linux_amd64")
+			require.NoError(t, os.MkdirAll(pkg, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(pkg, "terraform-provider"), nil, 0o755))
+			assert.False(t, c.Has(p), "%s is visible in the cache before it is complete", p)
+		}
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, ".terraform", "providers"), 0o755))
+		mu.Lock()
+		runs = append(runs, installed)
+		mu.Unlock()
+		return nil, nil
+	}
+	return c, &runs
+}
+
+func TestLockedProviders(t *testing.T) {
+	file := filepath.Join(t.TempDir(), LockFile)
+	require.NoError(t, os.WriteFile(file, []byte(lockHCL), 0o644))
+	providers, err := LockedProviders(file)
+	require.NoError(t, err)
+	assert.Equal(t, []Provider{
+		{"registry.terraform.io/hashicorp/azurerm", "4.30.0"},
+		{"registry.terraform.io/hashicorp/null", "3.2.4"},
+	}, providers)
+}
+
+func TestWarmInstallsEachProviderOnce(t *testing.T) {
+	c, runs := fakeCache(t)
+	azurerm3 := Provider{"registry.terraform.io/hashicorp/azurerm", "3.117.0"}
+	azurerm4 := Provider{"registry.terraform.io/hashicorp/azurerm", "4.30.0"}
+	null := Provider{"registry.terraform.io/hashicorp/null", "3.2.4"}
+
+	installed, err := c.Warm(context.Background(), []Provider{azurerm4, null, azurerm3, azurerm4})
+	require.NoError(t, err)
+	assert.Equal(t, []Provider{azurerm3, azurerm4, null}, installed)
+	assert.Equal(t, [][]Provider{{azurerm3, null}, {azurerm4}}, *runs, "one version of a source per round")
+
+	installed, err = c.Warm(context.Background(), []Provider{null, azurerm4})
+	require.NoError(t, err)
+	assert.Empty(t, installed)
+	assert.Len(t, *runs, 2)
+}
+
+func TestWarmFailsWhenInitDoesNotCache(t *testing.T) {
+	c, _ := fakeCache(t)
+	c.Platform = "darwin_arm64"
+	_, err := c.Warm(context.Background(), []Provider{{"registry.terraform.io/hashicorp/null", "3.2.4"}})
+	assert.ErrorContains(t, err, "did not cache registry.terraform.io/hashicorp/null 3.2.4 for darwin_arm64")
+
+	c.Terraform = func(context.Context, string, []string, ...string) ([]byte, error) {
+		return []byte("Error: Failed to query available provider packages\n"), errors.New("exit status 1")
+	}
+	_, err = c.Warm(context.Background(), []Provider{{"registry.terraform.io/hashicorp/random", "3.7.2"}})
+	assert.ErrorContains(t, err, "Failed to query available provider packages")
+}
+
+func TestPrepareCountsHitsAndMisses(t *testing.T) {
+	c, runs := fakeCache(t)
+	locked := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(locked, LockFile), []byte(lockHCL), 0o644))
+
+	require.NoError(t, c.Prepare(context.Background(), locked))
+	require.NoError(t, c.Prepare(context.Background(), locked))
+	assert.Equal(t, Stats{Hits: 2, Misses: 2}, c.Stats())
+	assert.Len(t, *runs, 1)
+
+	unlocked := t.TempDir()
+	require.NoError(t, c.Prepare(context.Background(), unlocked))
+	assert.Equal(t, Stats{Hits: 2, Misses: 3}, c.Stats())
+	assert.FileExists(t, filepath.Join(unlocked, LockFile))
+	assert.NoDirExists(t, filepath.Join(unlocked, ".terraform", "providers"))
+	assert.FileExists(t, filepath.Join(c.Dir, "registry.terraform.io/hashicorp/random/3.7.2/linux_amd64/terraform-provider"))
+	staging, _ := filepath.Glob(filepath.Join(filepath.Dir(c.Dir), ".cache-staging-*"))
+	assert.Empty(t, staging)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WriteSummary(&buf))
+	assert.Equal(t, "\n=== Provider plugin cache ("+c.Dir+") ===\n2 hit(s), 3 miss(es)\n", buf.String())
+}
+
+func TestLockExcludesOtherHolders(t *testing.T) {
+	c, err := Open(t.TempDir())
+	require.NoError(t, err)
+	unlock, err := c.Lock()
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := c.Lock()
+		if assert.NoError(t, err) {
+			close(acquired)
+			unlock()
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second holder got the lock while the first held it")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, unlock())
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second holder never got the lock")
+	}
+}
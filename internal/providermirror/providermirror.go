@@ -0,0 +1,415 @@
+// Package providermirror assembles a filesystem provider mirror for runs
+// without network access.
+//
+// The providers come from a local directory of release archives, as
+// published on releases.hashicorp.com
+// (terraform-provider-azurerm_4.30.0_linux_amd64.zip). Which providers
+// and versions go into the mirror is decided by the configuration: every
+// required_providers entry of every module, pinned to the version in the
+// modules' .terraform.lock.hcl files. Each archive must match one of the
+// checksums its lock file records before it is copied, so the mirror
+// holds exactly what an online init would have installed.
+package providermirror
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+// DefaultRegistry is the registry host of source addresses that name none.
+const DefaultRegistry = "registry.terraform.io"
+
+// Requirement is a provider release the configuration needs.
+type Requirement struct {
+	// Source is the full source address.
+	Source string
+
+	// Version is the release a lock file pins.
+	Version string
+
+	// Hashes are the checksums the lock files accept for it.
+	Hashes []string
+
+	// Modules are the directories that install it, relative to the root.
+	Modules []string
+}
+
+// Type returns the provider type, the last part of its source.
+func (r Requirement) Type() string { return path.Base(r.Source) }
+
+// NormalizeSource returns the full source address terraform uses for a
+// required_providers source, or for a local name when source is empty.
+func NormalizeSource(source, localName string) string {
+	if source == "" {
+		source = "hashicorp/" + localName
+	}
+	source = strings.ToLower(source)
+	if strings.Count(source, "/") == 1 {
+		source = DefaultRegistry + "/" + source
+	}
+	return source
+}
+
+// Modules returns every directory under root, root included, that holds
+// .tf files. Hidden directories, .terraform among them, are skipped.
+func Modules(root string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), ".tf") {
+			dir := filepath.Dir(p)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// Requirements reads required_providers and the lock file of every module
+// under root, and returns each provider release the modules install: the
+// version its lock file pins, which must meet the module's constraint.
+// A module without a lock file entry for a provider installs the newest
+// release another lock file pins that meets its constraint, as init would
+// from the mirror. A provider no lock file pins is an error.
+func Requirements(root string) ([]Requirement, error) {
+	dirs, err := Modules(root)
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ source, version string }
+	pinned := map[key]*Requirement{}
+	type unlocked struct{ module, source, constraint string }
+	var floating []unlocked
+
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		cfg, err := tfconfig.Load(dir)
+		if err != nil {
+			return nil, fmt.Errorf("providermirror: %w", err)
+		}
+
+		locks := map[string]tfconfig.LockedProvider{}
+		lockFile := filepath.Join(dir, tfconfig.LockFile)
+		if _, err := os.Stat(lockFile); err == nil {
+			locked, err := tfconfig.LoadLock(lockFile)
+			if err != nil {
+				return nil, fmt.Errorf("providermirror: %w", err)
+			}
+			for _, p := range locked {
+				locks[p.Source] = p
+			}
+		}
+
+		for name, req := range cfg.RequiredProviders {
+			source := NormalizeSource(req.Source, name)
+			lock, ok := locks[source]
+			if !ok {
+				floating = append(floating, unlocked{rel, source, req.Version})
+				continue
+			}
+			if ok, err := satisfies(lock.Version, req.Version); err != nil {
+				return nil, fmt.Errorf("providermirror: %s: %w", rel, err)
+			} else if !ok {
+				return nil, fmt.Errorf("providermirror: %s pins %s %s, which does not satisfy %q", path.Join(rel, tfconfig.LockFile), source, lock.Version, req.Version)
+			}
+			k := key{source, lock.Version}
+			r, ok := pinned[k]
+			if !ok {
+				r = &Requirement{Source: source, Version: lock.Version}
+				pinned[k] = r
+			}
+			r.Hashes = union(r.Hashes, lock.Hashes)
+			r.Modules = append(r.Modules, rel)
+		}
+	}
+
+	for _, f := range floating {
+		var best *Requirement
+		for k, r := range pinned {
+			if k.source != f.source {
+				continue
+			}
+			if ok, err := satisfies(r.Version, f.constraint); err != nil {
+				return nil, fmt.Errorf("providermirror: %s: %w", f.module, err)
+			} else if ok && (best == nil || newer(r.Version, best.Version)) {
+				best = r
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("providermirror: %s (required by %s) is not pinned by any lock file at a version meeting %q; run terraform init there and commit the lock file", f.source, f.module, f.constraint)
+		}
+		best.Modules = append(best.Modules, f.module)
+	}
+
+	out := make([]Requirement, 0, len(pinned))
+	for _, r := range pinned {
+		sort.Strings(r.Modules)
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Source != out[j].Source {
+			return out[i].Source < out[j].Source
+		}
+		return newer(out[j].Version, out[i].Version)
+	})
+	return out, nil
+}
+
+// satisfies reports whether version v meets constraint, which may be empty.
+func satisfies(v, constraint string) (bool, error) {
+	have, err := version.NewVersion(v)
+	if err != nil {
+		return false, fmt.Errorf("version %q: %w", v, err)
+	}
+	if constraint == "" {
+		return true, nil
+	}
+	want, err := version.NewConstraint(constraint)
+	if err != nil {
+		return false, fmt.Errorf("version constraint %q: %w", constraint, err)
+	}
+	return want.Check(have), nil
+}
+
+// newer reports whether version a is newer than b. Both were parsed by
+// satisfies already.
+func newer(a, b string) bool {
+	va, _ := version.NewVersion(a)
+	vb, _ := version.NewVersion(b)
+	return va.GreaterThan(vb)
+}
+
+func union(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	out := append([]string(nil), a...)
+	for _, h := range a {
+		seen[h] = true
+	}
+	for _, h := range b {
+		if !seen[h] {
+			seen[h] = true
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// Artifact is a provider release archive.
+type Artifact struct {
+	Type     string
+	Version  string
+	Platform string
+	Path     string
+}
+
+var artifactName = regexp.MustCompile(`^terraform-provider-([a-z0-9-]+)_v?([0-9][^_]*)_([a-z0-9]+_[a-z0-9]+)\.zip$`)
+
+// FindArtifacts returns the provider archives anywhere under dir.
+func FindArtifacts(dir string) ([]Artifact, error) {
+	var out []Artifact
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if m := artifactName.FindStringSubmatch(d.Name()); m != nil && d.Type().IsRegular() {
+			out = append(out, Artifact{Type: m[1], Version: m[2], Platform: m[3], Path: p})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Entry is one archive placed in the mirror.
+type Entry struct {
+	Source   string `json:"source"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+
+	// Hash is the lock file checksum the archive matched.
+	Hash string `json:"hash"`
+
+	// Path is the archive's path in the mirror.
+	Path string `json:"path"`
+}
+
+// Build copies the archive of every requirement for every platform into
+// the mirror directory, in terraform's packed layout, after checking it
+// against the lock file checksums. It stops at the first requirement
+// without an archive or with one that does not match.
+func Build(reqs []Requirement, artifacts []Artifact, mirror string, platforms []string) ([]Entry, error) {
+	types := map[string]string{}
+	for _, r := range reqs {
+		if other, ok := types[r.Type()]; ok && other != r.Source {
+			return nil, fmt.Errorf("providermirror: %s and %s have the same type, so their archives cannot be told apart", other, r.Source)
+		}
+		types[r.Type()] = r.Source
+	}
+
+	var out []Entry
+	for _, r := range reqs {
+		for _, platform := range platforms {
+			a, ok := findArtifact(artifacts, r, platform)
+			if !ok {
+				return nil, fmt.Errorf("providermirror: no archive for %s %s on %s (want terraform-provider-%s_%s_%s.zip)", r.Source, r.Version, platform, r.Type(), r.Version, platform)
+			}
+			hash, err := verify(a.Path, r.Hashes)
+			if err != nil {
+				return nil, fmt.Errorf("providermirror: %s %s on %s: %w", r.Source, r.Version, platform, err)
+			}
+			dst := filepath.Join(mirror, filepath.FromSlash(r.Source), filepath.Base(a.Path))
+			if err := copyFile(a.Path, dst); err != nil {
+				return nil, fmt.Errorf("providermirror: %w", err)
+			}
+			out = append(out, Entry{Source: r.Source, Version: r.Version, Platform: platform, Hash: hash, Path: dst})
+		}
+	}
+	return out, nil
+}
+
+func findArtifact(artifacts []Artifact, r Requirement, platform string) (Artifact, bool) {
+	for _, a := range artifacts {
+		if a.Type == r.Type() && a.Version == r.Version && a.Platform == platform {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// verify returns the checksum in accepted that the archive matches, in
+// either scheme terraform records: zh: is the SHA-256 of the zip file,
+// h1: the hash of the files inside it.
+func verify(file string, accepted []string) (string, error) {
+	if len(accepted) == 0 {
+		return "", fmt.Errorf("the lock file records no checksums to verify %s against", filepath.Base(file))
+	}
+	zh, err := zipHash(file)
+	if err != nil {
+		return "", err
+	}
+	h1, err := contentHash(file)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range accepted {
+		if h == zh || h == h1 {
+			return h, nil
+		}
+	}
+	return "", fmt.Errorf("%s matches none of the lock file's checksums (it has %s, %s)", filepath.Base(file), zh, h1)
+}
+
+func zipHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "zh:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contentHash is terraform's h1: scheme, the Go module dirhash of the
+// archive's files: a SHA-256 over lines of "<file sha256>  <name>",
+// sorted by name.
+func contentHash(file string) (string, error) {
+	z, err := zip.OpenReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer z.Close()
+	files := make([]*zip.File, len(z.File))
+	copy(files, z.File)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	summary := sha256.New()
+	for _, zf := range files {
+		if strings.Contains(zf.Name, "\n") {
+			return "", fmt.Errorf("%s: file name with a newline", file)
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), zf.Name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// WriteCLIConfig writes a terraform CLI configuration that installs every
+// provider from the mirror and nothing from the network. Point
+// TF_CLI_CONFIG_FILE at it.
+func WriteCLIConfig(w io.Writer, mirror string) error {
+	abs, err := filepath.Abs(mirror)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, `# Generated by providermirror. Providers come only from the mirror below;
+# with no direct block, terraform never contacts a registry.
+provider_installation {
+  filesystem_mirror {
+    path = %q
+  }
+}
+`, filepath.ToSlash(abs))
+	return err
+}
@@ -0,0 +1,142 @@
+package providermirror
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nullH1 is terraform's h1: hash of the archive nullArchive builds,
+// computed independently of contentHash.
+const nullH1 = "h1:kzCrr43V3cRZL6VWXP8km/al36zpnpkyGFGjMytU+Y0="
+
+func nullArchive(t *testing.T, dir, platform string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	w, err := z.Create("terraform-provider-null_v3.2.4_x5")
+	require.NoError(t, err)
+	w.Write([]byte("provider binary\n"))
+	require.NoError(t, z.Close())
+
+	file := filepath.Join(dir, "terraform-provider-null_3.2.4_"+platform+".zip")
+	require.NoError(t, os.WriteFile(file, buf.Bytes(), 0o644))
+	sum := sha256.Sum256(buf.Bytes())
+	return file, "zh:" + hex.EncodeToString(sum[:])
+}
+
+func TestRequirementsOfThisRepository(t *testing.T) {
+	reqs, err := Requirements("../..")
+	require.NoError(t, err)
+
+	got := map[string]Requirement{}
+	for _, r := range reqs {
+		got[r.Source+" "+r.Version] = r
+	}
+	azurerm := got["registry.terraform.io/hashicorp/azurerm 4.30.0"]
+	assert.Contains(t, azurerm.Modules, ".")
+	assert.Contains(t, azurerm.Modules, "modules/keyvault")
+	assert.Contains(t, azurerm.Hashes, "h1:aN9QLfigAA5fLNBqRwx0u7QWUMSQGKeQZQ/iiG5Umw8=")
+	assert.Equal(t, []string{"test/fixtures/resource-group", "test/fixtures/security-test"},
+		got["registry.terraform.io/hashicorp/azurerm 3.117.1"].Modules, "security-test has no lock file and asks for ~> 3.0")
+	assert.Equal(t, []string{".", "test/fixtures/minimal-validation"}, got["registry.terraform.io/hashicorp/null 3.2.4"].Modules)
+	assert.Len(t, reqs, 3)
+}
+
+func TestRequirementsErrors(t *testing.T) {
+	write := func(t *testing.T, file, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	}
+	main := `terraform {
+  required_providers {
+    null = {
+      source  = "hashicorp/null"
+      version = "~> 3.2"
+    }
+  }
+}`
+	lock := func(v string) string {
+		return `provider "registry.terraform.io/hashicorp/null" {
+  version = "` + v + `"
+  hashes  = ["zh:00"]
+}`
+	}
+
+	t.Run("not locked", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, filepath.Join(root, "a/main.tf"), main)
+		_, err := Requirements(root)
+		assert.ErrorContains(t, err, "registry.terraform.io/hashicorp/null (required by a) is not pinned by any lock file")
+	})
+	t.Run("no pinned release meets the constraint", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, filepath.Join(root, "a/main.tf"), main)
+		write(t, filepath.Join(root, "b/main.tf"), strings.Replace(main, "~> 3.2", "~> 3.1.0", 1))
+		write(t, filepath.Join(root, "b/.terraform.lock.hcl"), lock("3.1.0"))
+		_, err := Requirements(root)
+		assert.ErrorContains(t, err, `(required by a) is not pinned by any lock file at a version meeting "~> 3.2"`)
+	})
+	t.Run("constraint not met", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, filepath.Join(root, "main.tf"), main)
+		write(t, filepath.Join(root, ".terraform.lock.hcl"), lock("3.1.0"))
+		_, err := Requirements(root)
+		assert.ErrorContains(t, err, `does not satisfy "~> 3.2"`)
+	})
+}
+
+func TestBuildVerifiesAndCopies(t *testing.T) {
+	artifacts := t.TempDir()
+	linux, linuxZH := nullArchive(t, artifacts, "linux_amd64")
+	nullArchive(t, filepath.Join(artifacts), "darwin_arm64")
+	found, err := FindArtifacts(artifacts)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+
+	req := Requirement{Source: "registry.terraform.io/hashicorp/null", Version: "3.2.4", Hashes: []string{"zh:0000", linuxZH}}
+	mirror := t.TempDir()
+	entries, err := Build([]Requirement{req}, found, mirror, []string{"linux_amd64"})
+	require.NoError(t, err)
+	want := filepath.Join(mirror, "registry.terraform.io/hashicorp/null/terraform-provider-null_3.2.4_linux_amd64.zip")
+	assert.Equal(t, []Entry{{Source: req.Source, Version: "3.2.4", Platform: "linux_amd64", Hash: linuxZH, Path: want}}, entries)
+	assert.FileExists(t, want)
+
+	// The darwin archive has the same contents, so it matches by h1:.
+	req.Hashes = []string{nullH1}
+	entries, err = Build([]Requirement{req}, found, mirror, []string{"linux_amd64", "darwin_arm64"})
+	require.NoError(t, err)
+	assert.Equal(t, nullH1, entries[1].Hash)
+
+	req.Hashes = []string{"zh:0000"}
+	_, err = Build([]Requirement{req}, found, mirror, []string{"linux_amd64"})
+	assert.ErrorContains(t, err, "matches none of the lock file's checksums")
+
+	_, err = Build([]Requirement{req}, found, mirror, []string{"windows_amd64"})
+	assert.ErrorContains(t, err, "want terraform-provider-null_3.2.4_windows_amd64.zip")
+
+	require.NoError(t, os.Remove(linux))
+	_, err = Build([]Requirement{req}, found, mirror, []string{"linux_amd64"})
+	assert.Error(t, err)
+}
+
+func TestWriteCLIConfig(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCLIConfig(&buf, "/srv/mirror"))
+	assert.Contains(t, buf.String(), "filesystem_mirror {\n    path = \"/srv/mirror\"\n  }")
+	assert.False(t, strings.Contains(buf.String(), "direct {"))
+}
+
+func TestNormalizeSource(t *testing.T) {
+	assert.Equal(t, "registry.terraform.io/hashicorp/azurerm", NormalizeSource("hashicorp/azurerm", "azurerm"))
+	assert.Equal(t, "registry.terraform.io/hashicorp/null", NormalizeSource("", "null"))
+	assert.Equal(t, "example.com/acme/thing", NormalizeSource("Example.com/acme/thing", "thing"))
+}
@@ -0,0 +1,192 @@
+// Package report is the output shared by the infra subcommands.
+//
+// A check produces a Report: the findings it made for one environment and
+// whether it passed. Every subcommand writes reports in the same text,
+// JSON and Markdown forms, so CI can parse any of them the same way and a
+// developer reads them the same way in a terminal.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// Severities, most serious first. A report fails when it has an error.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+var severityRank = map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+
+// Report is one check's result for one environment.
+type Report struct {
+	Command     string `json:"command"`
+	Environment string `json:"environment,omitempty"`
+	Workspace   string `json:"workspace,omitempty"`
+
+	Findings []Finding `json:"findings"`
+
+	// Details carries the check's own data, e.g. a cost estimate, for
+	// JSON consumers.
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Finding is one thing a check found.
+type Finding struct {
+	Severity string `json:"severity"`
+
+	// Address is the resource or variable the finding is about, if any.
+	Address string `json:"address,omitempty"`
+
+	Message string `json:"message"`
+}
+
+// New starts a report.
+func New(command, environment, workspace string) *Report {
+	return &Report{Command: command, Environment: environment, Workspace: workspace, Findings: []Finding{}}
+}
+
+// Add records a finding.
+func (r *Report) Add(severity, address, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{Severity: severity, Address: address, Message: fmt.Sprintf(format, args...)})
+}
+
+// Passed reports whether the check found no errors.
+func (r *Report) Passed() bool {
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON adds "passed" so consumers need not work it out.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	type plain Report
+	return json.Marshal(struct {
+		*plain
+		Passed bool `json:"passed"`
+	}{(*plain)(r), r.Passed()})
+}
+
+// Sort orders findings by severity, then address.
+func (r *Report) Sort() {
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		return a.Address < b.Address
+	})
+}
+
+// Passed reports whether every report passed.
+func Passed(reports []*Report) bool {
+	for _, r := range reports {
+		if !r.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckFormat returns an error for names Write does not know.
+func CheckFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON, FormatMarkdown:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (want %s, %s or %s)", format, FormatText, FormatJSON, FormatMarkdown)
+}
+
+// Write writes reports in format. JSON output is always a list, so one
+// environment and several parse the same way.
+func Write(w io.Writer, format string, reports []*Report) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	case FormatMarkdown:
+		return writeMarkdown(w, reports)
+	case FormatText:
+		return writeText(w, reports)
+	}
+	return CheckFormat(format)
+}
+
+func (r *Report) title() string {
+	if r.Environment == "" {
+		return r.Command
+	}
+	return r.Command + " (" + r.Environment + ")"
+}
+
+func (r *Report) status() string {
+	if r.Passed() {
+		return "PASSED"
+	}
+	return "FAILED"
+}
+
+func writeText(w io.Writer, reports []*Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "=== %s: %s ===\n", r.title(), r.status())
+		if len(r.Findings) == 0 {
+			fmt.Fprintln(tw, "  no findings")
+			continue
+		}
+		for _, f := range r.Findings {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", f.Severity, f.Address, f.Message)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeMarkdown(w io.Writer, reports []*Report) error {
+	var b strings.Builder
+	for i, r := range reports {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "### %s: %s\n\n", r.title(), r.status())
+		if len(r.Findings) == 0 {
+			b.WriteString("No findings.\n")
+			continue
+		}
+		b.WriteString("| Severity | Address | Message |\n|---|---|---|\n")
+		for _, f := range r.Findings {
+			addr := ""
+			if f.Address != "" {
+				addr = "`" + f.Address + "`"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", f.Severity, addr, cell(f.Message))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// cell escapes a value for a Markdown table cell.
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
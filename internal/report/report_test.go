@@ -0,0 +1,55 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sample() []*Report {
+	dev := New("validate-names", "dev", "dev")
+	dev.Add(SeverityWarning, "var.web_app_name", "is %d characters", 58)
+	dev.Add(SeverityError, "var.storage_account_name", "must be lowercase | digits")
+	dev.Sort()
+	prod := New("validate-names", "prod", "prod")
+	return []*Report{dev, prod}
+}
+
+func TestPassed(t *testing.T) {
+	reports := sample()
+	assert.False(t, reports[0].Passed())
+	assert.True(t, reports[1].Passed())
+	assert.False(t, Passed(reports))
+	assert.Equal(t, SeverityError, reports[0].Findings[0].Severity)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, FormatJSON, sample()))
+
+	var got []map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	require.Len(t, got, 2)
+	assert.Equal(t, "dev", got[0]["environment"])
+	assert.Equal(t, false, got[0]["passed"])
+	assert.Equal(t, true, got[1]["passed"])
+	assert.Equal(t, []interface{}{}, got[1]["findings"])
+}
+
+func TestWriteTextAndMarkdown(t *testing.T) {
+	var text bytes.Buffer
+	require.NoError(t, Write(&text, FormatText, sample()))
+	assert.Contains(t, text.String(), "=== validate-names (dev): FAILED ===")
+	assert.Contains(t, text.String(), "error    var.storage_account_name")
+	assert.Contains(t, text.String(), "=== validate-names (prod): PASSED ===\n  no findings")
+
+	var md bytes.Buffer
+	require.NoError(t, Write(&md, FormatMarkdown, sample()))
+	assert.Contains(t, md.String(), "### validate-names (dev): FAILED")
+	assert.Contains(t, md.String(), "| error | `var.storage_account_name` | must be lowercase \\| digits |")
+
+	assert.ErrorContains(t, Write(&md, "yaml", nil), `unknown format "yaml"`)
+}
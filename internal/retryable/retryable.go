@@ -0,0 +1,306 @@
+// Package retryable recognises the transient errors azurerm reports and
+// retries the terraform commands that hit them.
+//
+// Terratest's RetryableTerraformErrors retries on any matching pattern
+// after a fixed pause, and a catch-all pattern retries real configuration
+// errors too. The catalog here only lists errors known to go away on
+// their own, grouped into classes that each have their own retry budget:
+// throttling wants a long, growing pause, while a resource that is not
+// visible yet right after its create usually shows up within seconds.
+// Pauses grow exponentially with jitter, so parallel tests throttled at
+// the same moment do not all come back at the same moment.
+package retryable
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Class is one kind of transient error and how to retry it.
+type Class struct {
+	Name string
+
+	// Patterns are regular expressions matched against the command's
+	// error and output.
+	Patterns []*regexp.Regexp
+
+	// Phases limits the class to these terraform commands, such as
+	// "apply"; empty means every command.
+	Phases []string
+
+	// Attempts is how many times a command is run in total before the
+	// error is returned.
+	Attempts int
+
+	// BaseDelay is the pause before the first retry; each later retry
+	// doubles it, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// match returns the text a pattern of c matched in s, if any.
+func (c *Class) match(s string) string {
+	for _, p := range c.Patterns {
+		if m := p.FindString(s); m != "" {
+			return m
+		}
+	}
+	return ""
+}
+
+func (c *Class) appliesTo(phase string) bool {
+	if len(c.Phases) == 0 {
+		return true
+	}
+	for _, p := range c.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay is the pause before retry number retry (1 for the first) of
+// class c: half the exponential backoff plus up to as much again of
+// jitter, with jitter in [0, 1).
+func (c *Class) Delay(retry int, jitter float64) time.Duration {
+	d := float64(c.BaseDelay) * math.Pow(2, float64(retry-1))
+	if c.MaxDelay > 0 && d > float64(c.MaxDelay) {
+		d = float64(c.MaxDelay)
+	}
+	return time.Duration(d/2 + jitter*d/2)
+}
+
+// Catalog is an ordered list of classes; the first one that matches wins.
+type Catalog []*Class
+
+// Classify returns the class of a failed command's error and output, and
+// the text that matched, or nil when the error is not transient.
+func (c Catalog) Classify(phase, text string) (*Class, string) {
+	for _, class := range c {
+		if !class.appliesTo(phase) {
+			continue
+		}
+		if m := class.match(text); m != "" {
+			return class, m
+		}
+	}
+	return nil, ""
+}
+
+// TerratestErrors returns the catalog's patterns in the form of
+// terraform.Options.RetryableTerraformErrors, for code that retries
+// through terratest rather than a Retrier. Terratest retries every
+// command on a fixed pause, so phases and backoff do not carry over.
+func (c Catalog) TerratestErrors() map[string]string {
+	out := map[string]string{}
+	for _, class := range c {
+		for _, p := range class.Patterns {
+			out[p.String()] = "transient Azure error (" + class.Name + ")"
+		}
+	}
+	return out
+}
+
+// Default is the catalog of transient azurerm errors. Both the messages
+// of the current SDK ("unexpected status 429 (429 Too Many Requests)")
+// and of the autorest one used by azurerm 3.x ("StatusCode=429") are
+// matched.
+var Default = Catalog{
+	{
+		Name: "throttled",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`unexpected status 429\b|StatusCode=429\b`),
+			regexp.MustCompile(`\b(?:TooManyRequests|SubscriptionRequestsThrottled|ResourceGroupRequestsThrottled|TenantRequestsThrottled)\b`),
+		},
+		Attempts:  6,
+		BaseDelay: 15 * time.Second,
+		MaxDelay:  2 * time.Minute,
+	},
+	{
+		// A resource that was just created is not always visible to the
+		// next request that refers to it, and a new service principal
+		// takes a while to replicate to role assignments.
+		Name: "not found after create",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`unexpected status 404 \(404 Not Found\) with error: (?:ResourceNotFound|ParentResourceNotFound|ResourceGroupNotFound|NotFound)\b`),
+			regexp.MustCompile(`StatusCode=404\b.*Code="(?:ResourceNotFound|ParentResourceNotFound|ResourceGroupNotFound|NotFound)"`),
+			regexp.MustCompile(`\bPrincipalNotFound\b`),
+		},
+		Phases:    []string{"apply"},
+		Attempts:  4,
+		BaseDelay: 10 * time.Second,
+		MaxDelay:  time.Minute,
+	},
+	{
+		// Creating a key vault whose name a just-deleted vault still
+		// holds fails until the purge has gone through.
+		Name: "soft-deleted key vault",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)vault with the same name already exists in deleted state`),
+			regexp.MustCompile(`(?i)existing soft-deleted key vault exists with the name`),
+			regexp.MustCompile(`(?i)key vault .* is currently being (?:deleted|purged)`),
+		},
+		Phases:    []string{"apply"},
+		Attempts:  4,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  3 * time.Minute,
+	},
+	{
+		Name: "server error",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`unexpected status 5\d\d\b|StatusCode=5\d\d\b`),
+			regexp.MustCompile(`\b(?:InternalServerError|ServiceUnavailable|GatewayTimeout|BadGateway)\b`),
+			regexp.MustCompile(`Code="(?:InternalError|InternalServerError|ServerTimeout)"`),
+		},
+		Attempts:  4,
+		BaseDelay: 10 * time.Second,
+		MaxDelay:  time.Minute,
+	},
+}
+
+// Retry is one retry a Retrier made.
+type Retry struct {
+	Phase   string
+	Class   string
+	Attempt int
+	Match   string
+	Delay   time.Duration
+}
+
+func (r Retry) String() string {
+	return fmt.Sprintf("terraform %s failed with a transient error (%s: %q); retry %d in %s",
+		r.Phase, r.Class, r.Match, r.Attempt, r.Delay.Round(time.Second))
+}
+
+// Retrier runs commands and retries those that fail with an error from
+// its catalog. It is safe for concurrent use.
+type Retrier struct {
+	Catalog Catalog
+
+	// Sleep waits for d or until ctx is done. Nil sleeps on a timer.
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	// Jitter returns a number in [0, 1). Nil uses math/rand.
+	Jitter func() float64
+
+	mu      sync.Mutex
+	retries map[string]int
+}
+
+// Do runs run, a terraform command of phase that returns its output, and
+// runs it again as long as it fails with a transient error and the
+// error's class has attempts left. Each retry is passed to logf before
+// the pause. The last attempt's output and error are returned.
+func (r *Retrier) Do(ctx context.Context, phase string, logf func(Retry), run func() (string, error)) (string, error) {
+	return r.DoReplanning(ctx, phase, logf, nil, run)
+}
+
+// DoReplanning is Do for an apply of a saved plan. An apply that fails
+// part way has already changed the state, which makes terraform refuse
+// the saved plan as stale, so replan writes a new one after each pause
+// and before the apply runs again. A replan that fails ends the retries
+// with its error. A nil replan makes DoReplanning the same as Do.
+func (r *Retrier) DoReplanning(ctx context.Context, phase string, logf func(Retry), replan func() error, run func() (string, error)) (string, error) {
+	tries := map[*Class]int{}
+	for {
+		out, err := run()
+		if err == nil {
+			return out, nil
+		}
+		class, match := r.Catalog.Classify(phase, err.Error()+"\n"+out)
+		if class == nil {
+			return out, err
+		}
+		tries[class]++
+		if tries[class] >= class.Attempts {
+			return out, fmt.Errorf("%w (gave up after %d attempts failed with %s errors)", err, tries[class], class.Name)
+		}
+
+		retry := Retry{Phase: phase, Class: class.Name, Attempt: tries[class], Match: match,
+			Delay: class.Delay(tries[class], r.jitter())}
+		r.record(class.Name)
+		if logf != nil {
+			logf(retry)
+		}
+		if serr := r.sleep(ctx, retry.Delay); serr != nil {
+			return out, fmt.Errorf("%w (not retried: %v)", err, serr)
+		}
+		if replan != nil {
+			if perr := replan(); perr != nil {
+				return out, fmt.Errorf("%w (not retried: planning again failed: %v)", err, perr)
+			}
+		}
+	}
+}
+
+func (r *Retrier) jitter() float64 {
+	if r.Jitter != nil {
+		return r.Jitter()
+	}
+	return rand.Float64()
+}
+
+func (r *Retrier) sleep(ctx context.Context, d time.Duration) error {
+	if r.Sleep != nil {
+		return r.Sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Retrier) record(class string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.retries == nil {
+		r.retries = map[string]int{}
+	}
+	r.retries[class]++
+}
+
+// Retries returns how many retries were made per class.
+func (r *Retrier) Retries() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]int, len(r.retries))
+	for c, n := range r.retries {
+		out[c] = n
+	}
+	return out
+}
+
+// WriteSummary writes the retries per class, or nothing when there were
+// none.
+func (r *Retrier) WriteSummary(w io.Writer) error {
+	retries := r.Retries()
+	if len(retries) == 0 {
+		return nil
+	}
+	classes := make([]string, 0, len(retries))
+	for c := range retries {
+		classes = append(classes, c)
+	}
+	sort.Strings(classes)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\n=== Retried terraform errors ===")
+	fmt.Fprintln(tw, "class\tretries")
+	for _, c := range classes {
+		fmt.Fprintf(tw, "%s\t%d\n", c, retries[c])
+	}
+	return tw.Flush()
+}
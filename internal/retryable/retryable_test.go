@@ -0,0 +1,186 @@
+package retryable
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultClassifies(t *testing.T) {
+	cases := []struct {
+		phase, text, class string
+	}{
+		{"apply", `Error: creating Resource Group "rg-x": unexpected status 429 (429 Too Many Requests) with error: TooManyRequests`, "throttled"},
+		{"plan", `resources.GroupsClient#Get: Failure responding to request: StatusCode=429 -- Original Error: autorest/azure: Code="SubscriptionRequestsThrottled"`, "throttled"},
+		{"apply", `Error: retrieving Subnet: unexpected status 404 (404 Not Found) with error: ResourceNotFound: The Resource 'Microsoft.Network/virtualNetworks/vnet-x' under resource group 'rg-x' was not found.`, "not found after create"},
+		{"apply", `authorization.RoleAssignmentsClient#Create: StatusCode=400 -- Code="PrincipalNotFound" Message="Principal 1234 does not exist in the directory"`, "not found after create"},
+		{"apply", `keyvault.VaultsClient#CreateOrUpdate: StatusCode=409 -- Code="ConflictError" Message="A vault with the same name already exists in deleted state. You need to either recover or purge existing key vault."`, "soft-deleted key vault"},
+		{"apply", `Error: creating Storage Account: unexpected status 503 (503 Service Unavailable) with error: ServiceUnavailable`, "server error"},
+		{"destroy", `network.SubnetsClient#Delete: StatusCode=500 -- Code="InternalServerError"`, "server error"},
+	}
+	for _, c := range cases {
+		class, match := Default.Classify(c.phase, c.text)
+		if assert.NotNil(t, class, c.text) {
+			assert.Equal(t, c.class, class.Name, c.text)
+			assert.Contains(t, c.text, match)
+		}
+	}
+
+	for _, text := range []string{
+		`Error: Unsupported argument on main.tf line 12: An argument named "locaton" is not expected here.`,
+		`Error: creating Storage Account: unexpected status 400 (400 Bad Request) with error: AccountNameInvalid`,
+		`Error: Invalid value for variable "environment"`,
+	} {
+		class, _ := Default.Classify("apply", text)
+		assert.Nil(t, class, text)
+	}
+
+	class, _ := Default.Classify("plan", `unexpected status 404 (404 Not Found) with error: ResourceGroupNotFound: Resource group 'rg-x' could not be found.`)
+	assert.Nil(t, class, "a missing resource at plan time is not transient")
+}
+
+func TestDelayBacksOffWithJitter(t *testing.T) {
+	c := &Class{BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+	assert.Equal(t, 5*time.Second, c.Delay(1, 0))
+	assert.Equal(t, 10*time.Second, c.Delay(1, 1))
+	assert.Equal(t, 15*time.Second, c.Delay(2, 0.5))
+	assert.Equal(t, 20*time.Second, c.Delay(3, 0))
+	assert.Equal(t, 30*time.Second, c.Delay(5, 0), "capped at MaxDelay")
+}
+
+func TestRetrierDo(t *testing.T) {
+	var slept []time.Duration
+	r := &Retrier{
+		Catalog: Default,
+		Sleep:   func(_ context.Context, d time.Duration) error { slept = append(slept, d); return nil },
+		Jitter:  func() float64 { return 0 },
+	}
+	throttled := errors.New("error while running command: exit status 1; unexpected status 429 (429 Too Many Requests)")
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		slept = nil
+		var logged []Retry
+		calls := 0
+		out, err := r.Do(context.Background(), "apply", func(r Retry) { logged = append(logged, r) }, func() (string, error) {
+			calls++
+			if calls < 3 {
+				return "", throttled
+			}
+			return "Apply complete!", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Apply complete!", out)
+		assert.Equal(t, []time.Duration{7500 * time.Millisecond, 15 * time.Second}, slept)
+		require.Len(t, logged, 2)
+		assert.Equal(t, Retry{Phase: "apply", Class: "throttled", Attempt: 2, Match: "unexpected status 429", Delay: 15 * time.Second}, logged[1])
+		assert.Contains(t, logged[0].String(), `terraform apply failed with a transient error (throttled: "unexpected status 429"); retry 1 in 8s`)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		_, err := r.Do(context.Background(), "apply", nil, func() (string, error) {
+			calls++
+			return "", errors.New(`Error: Unsupported argument`)
+		})
+		assert.EqualError(t, err, "Error: Unsupported argument")
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("gives up after the class's attempts", func(t *testing.T) {
+		calls := 0
+		_, err := r.Do(context.Background(), "apply", nil, func() (string, error) {
+			calls++
+			return "", throttled
+		})
+		assert.ErrorIs(t, err, throttled)
+		assert.ErrorContains(t, err, "gave up after 6 attempts failed with throttled errors")
+		assert.Equal(t, 6, calls)
+	})
+
+	t.Run("stops when ctx is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		calls := 0
+		_, err := (&Retrier{Catalog: Default}).Do(ctx, "apply", nil, func() (string, error) {
+			calls++
+			return "", throttled
+		})
+		assert.ErrorIs(t, err, throttled)
+		assert.ErrorContains(t, err, "not retried: context canceled")
+		assert.Equal(t, 1, calls)
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteSummary(&buf))
+	assert.Contains(t, buf.String(), "=== Retried terraform errors ===")
+	assert.Contains(t, buf.String(), "throttled  7")
+}
+
+func TestRetrierDoReplanning(t *testing.T) {
+	r := &Retrier{
+		Catalog: Default,
+		Sleep:   func(context.Context, time.Duration) error { return nil },
+	}
+	serverError := errors.New("error while running command: exit status 1; unexpected status 503 (503 Service Unavailable)")
+	stale := errors.New("Error: Saved plan is stale")
+
+	t.Run("plans again before each retry", func(t *testing.T) {
+		// The saved plan goes stale as soon as an apply has changed
+		// anything; only a new plan can be applied after that.
+		var steps []string
+		fresh := true
+		out, err := r.DoReplanning(context.Background(), "apply", nil,
+			func() error {
+				steps = append(steps, "plan")
+				fresh = true
+				return nil
+			},
+			func() (string, error) {
+				steps = append(steps, "apply")
+				if !fresh {
+					return "", stale
+				}
+				fresh = false
+				if len(steps) < 4 {
+					return "", serverError
+				}
+				return "Apply complete!", nil
+			})
+		require.NoError(t, err)
+		assert.Equal(t, "Apply complete!", out)
+		assert.Equal(t, []string{"apply", "plan", "apply", "plan", "apply"}, steps)
+	})
+
+	t.Run("stops when planning again fails", func(t *testing.T) {
+		applies := 0
+		_, err := r.DoReplanning(context.Background(), "apply", nil,
+			func() error { return errors.New("Error: Invalid reference") },
+			func() (string, error) {
+				applies++
+				return "", serverError
+			})
+		assert.ErrorIs(t, err, serverError)
+		assert.ErrorContains(t, err, "planning again failed: Error: Invalid reference")
+		assert.Equal(t, 1, applies)
+	})
+
+	t.Run("does not plan without a retry", func(t *testing.T) {
+		plans := 0
+		_, err := r.DoReplanning(context.Background(), "apply", nil,
+			func() error { plans++; return nil },
+			func() (string, error) { return "", stale })
+		assert.ErrorIs(t, err, stale)
+		assert.Zero(t, plans)
+	})
+}
+
+func TestTerratestErrors(t *testing.T) {
+	errs := Default.TerratestErrors()
+	assert.NotContains(t, errs, ".*")
+	assert.Contains(t, errs[`\bPrincipalNotFound\b`], "not found after create")
+}
@@ -0,0 +1,64 @@
+package safety
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// OverrideFile is the backend override OverrideBackend writes. Terraform
+// merges *_override.tf files after the rest of the configuration, so its
+// backend replaces any the directory declares.
+const OverrideFile = "zz_harness_backend_override.tf"
+
+var overrideContent = []byte(`# Written by the test harness (internal/safety) and removed when the tests
+# using this directory finish. It keeps their state local, whatever backend
+# the configuration declares.
+terraform {
+  backend "local" {}
+}
+`)
+
+var (
+	overrideMu    sync.Mutex
+	overrideUsers = map[string]int{}
+)
+
+// OverrideBackend writes the local backend override into dir and returns
+// a function that releases it. Concurrent tests may share a directory:
+// the file stays until the last of them releases it.
+//
+// Run terraform init with -reconfigure afterwards, since a directory that
+// was initialized with its own backend would otherwise ask to migrate.
+func OverrideBackend(dir string) (release func(), err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(abs, OverrideFile)
+
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	if overrideUsers[abs] == 0 {
+		if existing, err := os.ReadFile(file); err != nil || !bytes.Equal(existing, overrideContent) {
+			if err := os.WriteFile(file, overrideContent, 0o644); err != nil {
+				return nil, err
+			}
+		}
+	}
+	overrideUsers[abs]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			overrideMu.Lock()
+			defer overrideMu.Unlock()
+			overrideUsers[abs]--
+			if overrideUsers[abs] == 0 {
+				delete(overrideUsers, abs)
+				os.Remove(file)
+			}
+		})
+	}, nil
+}
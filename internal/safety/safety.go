@@ -0,0 +1,106 @@
+// Package safety keeps the test harness away from production.
+//
+// Before a test runs terraform, the harness checks everything the test
+// could touch against a denylist of production subscriptions, backend
+// state keys, workspaces and resource groups, and refuses to run on any
+// match. Independently of the denylist, OverrideBackend swaps whatever
+// backend a working directory declares for local state, so a test never
+// writes to a shared state file by accident.
+package safety
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Denylist holds glob patterns, as in path.Match, for values that mark
+// production. Matching ignores case, as Azure does for names and IDs.
+type Denylist struct {
+	Subscriptions  []string `json:"subscriptions"`
+	BackendKeys    []string `json:"backend_keys"`
+	Workspaces     []string `json:"workspaces"`
+	ResourceGroups []string `json:"resource_groups"`
+}
+
+// LoadDenylist reads a denylist from a JSON file.
+func LoadDenylist(file string) (*Denylist, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var d Denylist
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("safety: %s: %w", file, err)
+	}
+	for _, p := range d.all() {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("safety: %s: bad pattern %q", file, p)
+		}
+	}
+	return &d, nil
+}
+
+func (d *Denylist) all() []string {
+	var out []string
+	for _, l := range [][]string{d.Subscriptions, d.BackendKeys, d.Workspaces, d.ResourceGroups} {
+		out = append(out, l...)
+	}
+	return out
+}
+
+// Target is what a test run could touch. Empty values are ignored.
+type Target struct {
+	Subscriptions  []string
+	BackendKeys    []string
+	Workspaces     []string
+	ResourceGroups []string
+}
+
+// Match is one value that matched the denylist.
+type Match struct {
+	Kind    string
+	Value   string
+	Pattern string
+}
+
+// RefusedError lists every production match in a target.
+type RefusedError struct {
+	Matches []Match
+}
+
+func (e *RefusedError) Error() string {
+	parts := make([]string, len(e.Matches))
+	for i, m := range e.Matches {
+		parts[i] = fmt.Sprintf("%s %q matches %q", m.Kind, m.Value, m.Pattern)
+	}
+	return "refusing to run against production: " + strings.Join(parts, "; ")
+}
+
+// Check returns a *RefusedError when any value in t matches the denylist.
+func (d *Denylist) Check(t Target) error {
+	var matches []Match
+	check := func(kind string, values, patterns []string) {
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			for _, p := range patterns {
+				if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(v)); ok {
+					matches = append(matches, Match{Kind: kind, Value: v, Pattern: p})
+					break
+				}
+			}
+		}
+	}
+	check("subscription", t.Subscriptions, d.Subscriptions)
+	check("backend key", t.BackendKeys, d.BackendKeys)
+	check("workspace", t.Workspaces, d.Workspaces)
+	check("resource group", t.ResourceGroups, d.ResourceGroups)
+	if len(matches) > 0 {
+		return &RefusedError{Matches: matches}
+	}
+	return nil
+}
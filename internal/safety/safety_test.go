@@ -0,0 +1,78 @@
+package safety
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	d := &Denylist{
+		Subscriptions:  []string{"ffbf501f-f220-4b59-8d0a-5068d961cc5f"},
+		BackendKeys:    []string{"*prod*"},
+		Workspaces:     []string{"prod", "prod-*"},
+		ResourceGroups: []string{"myTFResourceGroup", "*-prod"},
+	}
+	require.NoError(t, d.Check(Target{
+		Subscriptions:  []string{"00000000-0000-0000-0000-000000000000", ""},
+		BackendKeys:    []string{"test.terraform.tfstate"},
+		Workspaces:     []string{"default", "staging"},
+		ResourceGroups: []string{"rg-terratest-abc123", "myTFResourceGroup-dev"},
+	}))
+
+	err := d.Check(Target{
+		Subscriptions:  []string{"FFBF501F-F220-4B59-8D0A-5068D961CC5F"},
+		BackendKeys:    []string{"prod.terraform.tfstate"},
+		Workspaces:     []string{"prod-eu"},
+		ResourceGroups: []string{"mytfresourcegroup", "rg-app-prod", "rg-app-dev"},
+	})
+	var refused *RefusedError
+	require.True(t, errors.As(err, &refused))
+	assert.Equal(t, []Match{
+		{"subscription", "FFBF501F-F220-4B59-8D0A-5068D961CC5F", "ffbf501f-f220-4b59-8d0a-5068d961cc5f"},
+		{"backend key", "prod.terraform.tfstate", "*prod*"},
+		{"workspace", "prod-eu", "prod-*"},
+		{"resource group", "mytfresourcegroup", "myTFResourceGroup"},
+		{"resource group", "rg-app-prod", "*-prod"},
+	}, refused.Matches)
+	assert.Contains(t, err.Error(), `workspace "prod-eu" matches "prod-*"`)
+}
+
+func TestLoadDenylist(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "denylist.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"workspaces": ["prod"], "resource_groups": ["*-prod"]}`), 0o644))
+	d, err := LoadDenylist(file)
+	require.NoError(t, err)
+	assert.Equal(t, &Denylist{Workspaces: []string{"prod"}, ResourceGroups: []string{"*-prod"}}, d)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"workspaces": ["[prod"]}`), 0o644))
+	_, err = LoadDenylist(file)
+	assert.ErrorContains(t, err, `bad pattern "[prod"`)
+
+	_, err = LoadDenylist(filepath.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOverrideBackendIsSharedUntilLastRelease(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, OverrideFile)
+
+	first, err := OverrideBackend(dir)
+	require.NoError(t, err)
+	second, err := OverrideBackend(dir)
+	require.NoError(t, err)
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `backend "local" {}`)
+
+	first()
+	first()
+	assert.FileExists(t, file, "released twice by the same caller")
+	second()
+	assert.NoFileExists(t, file)
+}
@@ -0,0 +1,113 @@
+package softdelete
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one purge in a Journal.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Test     string    `json:"test,omitempty"`
+	Name     string    `json:"name"`
+	Location string    `json:"location"`
+	VaultID  string    `json:"vault_id,omitempty"`
+}
+
+// Journal is an append-only record of the key vaults a run purged, one
+// JSON object per line. Purges cannot be undone, so each is written
+// before it is requested and survives a run that is killed half way.
+type Journal struct {
+	File string
+
+	// Now defaults to time.Now.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Record appends e to the journal file, setting its time.
+func (j *Journal) Record(e Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now
+	if j.Now != nil {
+		now = j.Now
+	}
+	e.Time = now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("softdelete: journal: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("softdelete: journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("softdelete: journal: %w", err)
+	}
+	j.entries = append(j.entries, e)
+	return nil
+}
+
+// Entries returns what this Journal recorded, not earlier runs' entries
+// in the same file.
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Entry(nil), j.entries...)
+}
+
+// ReadJournal reads every entry in a journal file. A missing file has
+// none.
+func ReadJournal(file string) ([]Entry, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("softdelete: %s:%d: %w", file, n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// WriteSummary writes the vaults this Journal recorded, or nothing when
+// it recorded none.
+func (j *Journal) WriteSummary(w io.Writer) error {
+	entries := j.Entries()
+	if len(entries) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\n=== Purged soft-deleted key vaults (%s) ===\n", j.File)
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", e.Name, e.Location, e.Test); err != nil {
+			return err
+		}
+	}
+	return nil
+}
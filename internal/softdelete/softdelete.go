@@ -0,0 +1,210 @@
+// Package softdelete keeps tests from colliding with soft-deleted key
+// vaults.
+//
+// A deleted key vault keeps its name for its whole retention period (7
+// days for the course's vaults, up to 90 elsewhere), and key vault names
+// are global. A test that reuses a name, or runs again with a name
+// derived from a fixed seed, then fails at apply with "a vault with the
+// same name already exists in deleted state". A Resolver looks for such a
+// vault before apply and, depending on its Policy, picks a new name or
+// purges the deleted vault, recording every purge in a Journal. Azure
+// purges in the background, so a Resolver waits until the deleted vault
+// is gone before it lets the name be used.
+package softdelete
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"terraform-advanced-course/internal/arm"
+)
+
+// Policy says what to do about a name a soft-deleted vault holds.
+type Policy string
+
+// Policies.
+const (
+	// PolicyRename deploys under a new name and leaves the deleted vault
+	// alone.
+	PolicyRename Policy = "rename"
+
+	// PolicyPurge purges the deleted vault so its name can be reused. A
+	// purge-protected vault cannot be purged and is renamed around.
+	PolicyPurge Policy = "purge"
+
+	// PolicyFail refuses to deploy.
+	PolicyFail Policy = "fail"
+)
+
+// ParsePolicy reads a policy name.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case PolicyRename, PolicyPurge, PolicyFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("softdelete: unknown policy %q (want rename, purge or fail)", s)
+}
+
+// Vaults is the part of arm.Client a Resolver needs.
+type Vaults interface {
+	ListDeletedVaults(ctx context.Context) ([]arm.DeletedVault, error)
+	GetDeletedVault(ctx context.Context, location, name string) (arm.DeletedVault, error)
+	PurgeDeletedVault(ctx context.Context, location, name string) error
+}
+
+// Actions a Resolution reports.
+const (
+	ActionNone    = "none"
+	ActionRenamed = "renamed"
+	ActionPurged  = "purged"
+)
+
+// Resolution is what a Resolver did about one name.
+type Resolution struct {
+	// Name is the name to deploy with.
+	Name string
+
+	Action string
+
+	// Collision is the deleted vault that held the requested name, if
+	// any.
+	Collision *arm.DeletedVault
+
+	// Reason explains a rename under PolicyPurge.
+	Reason string
+}
+
+// Resolver checks key vault names against the subscription's soft-deleted
+// vaults.
+type Resolver struct {
+	Vaults Vaults
+	Policy Policy
+
+	// Journal, if set, records each purge before it is requested.
+	Journal *Journal
+
+	// Suffix returns the random part of a new name. Nil uses four
+	// lower-case letters and digits.
+	Suffix func() string
+
+	// PollInterval is how often a purge is checked for completion. Zero
+	// means 10 seconds.
+	PollInterval time.Duration
+}
+
+// maxNameLen is the longest key vault name Azure accepts.
+const maxNameLen = 24
+
+// Resolve checks name and returns the name to deploy with. test names
+// the test for the journal. A purge is waited for until ctx ends.
+func (r *Resolver) Resolve(ctx context.Context, test, name string) (Resolution, error) {
+	deleted, err := r.Vaults.ListDeletedVaults(ctx)
+	if err != nil {
+		return Resolution{}, fmt.Errorf("softdelete: listing deleted key vaults: %w", err)
+	}
+	held := map[string]arm.DeletedVault{}
+	for _, v := range deleted {
+		held[strings.ToLower(v.Name)] = v
+	}
+	v, ok := held[strings.ToLower(name)]
+	if !ok {
+		return Resolution{Name: name, Action: ActionNone}, nil
+	}
+
+	switch r.Policy {
+	case PolicyFail:
+		return Resolution{}, fmt.Errorf("softdelete: key vault name %q is held by a soft-deleted vault in %s until %s",
+			name, v.Properties.Location, purgeDate(v))
+	case PolicyPurge:
+		if !v.Properties.PurgeProtectionEnabled {
+			if err := r.purge(ctx, test, v); err != nil {
+				return Resolution{}, err
+			}
+			return Resolution{Name: name, Action: ActionPurged, Collision: &v}, nil
+		}
+	case PolicyRename:
+	default:
+		return Resolution{}, fmt.Errorf("softdelete: unknown policy %q", r.Policy)
+	}
+
+	renamed, err := r.rename(name, held)
+	if err != nil {
+		return Resolution{}, err
+	}
+	res := Resolution{Name: renamed, Action: ActionRenamed, Collision: &v}
+	if r.Policy == PolicyPurge {
+		res.Reason = "purge protection is enabled until " + purgeDate(v)
+	}
+	return res, nil
+}
+
+func (r *Resolver) purge(ctx context.Context, test string, v arm.DeletedVault) error {
+	if r.Journal != nil {
+		if err := r.Journal.Record(Entry{Test: test, Name: v.Name, Location: v.Properties.Location, VaultID: v.Properties.VaultID}); err != nil {
+			return err
+		}
+	}
+	if err := r.Vaults.PurgeDeletedVault(ctx, v.Properties.Location, v.Name); err != nil {
+		return fmt.Errorf("softdelete: purging deleted key vault %q: %w", v.Name, err)
+	}
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	for {
+		_, err := r.Vaults.GetDeletedVault(ctx, v.Properties.Location, v.Name)
+		switch {
+		case arm.IsNotFound(err):
+			return nil
+		case err != nil:
+			return fmt.Errorf("softdelete: waiting for the purge of deleted key vault %q: %w", v.Name, err)
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("softdelete: waiting for the purge of deleted key vault %q: %w", v.Name, ctx.Err())
+		}
+	}
+}
+
+// rename returns name with a random suffix that no deleted vault holds,
+// shortened to fit if need be. Key vault names may only use letters,
+// digits and single hyphens, and must end in a letter or digit.
+func (r *Resolver) rename(name string, held map[string]arm.DeletedVault) (string, error) {
+	for i := 0; i < 10; i++ {
+		suffix := r.suffix()
+		base := name
+		if n := maxNameLen - len(suffix) - 1; len(base) > n {
+			base = base[:n]
+		}
+		candidate := strings.TrimRight(base, "-") + "-" + suffix
+		if _, taken := held[strings.ToLower(candidate)]; !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("softdelete: no free name found for key vault %q", name)
+}
+
+func (r *Resolver) suffix() string {
+	if r.Suffix != nil {
+		return r.Suffix()
+	}
+	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 4)
+	for i := range b {
+		b[i] = charset[rand.Intn(len(charset))]
+	}
+	return string(b)
+}
+
+func purgeDate(v arm.DeletedVault) string {
+	if v.Properties.ScheduledPurgeDate == "" {
+		return "its retention period ends"
+	}
+	return v.Properties.ScheduledPurgeDate
+}
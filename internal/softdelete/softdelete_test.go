@@ -0,0 +1,111 @@
+package softdelete
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/arm/armfake"
+)
+
+func TestResolve(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	srv.PageSize = 1
+	srv.PurgePolls = 2
+	srv.AddDeletedVault("kv-sec-abc123", "westeurope", false)
+	srv.AddDeletedVault("backup-test-kv-x1y2z3", "westus2", true)
+	srv.AddDeletedVault("kv-sec-abc123-0000", "westeurope", false)
+
+	journal := &Journal{File: filepath.Join(t.TempDir(), "purges.jsonl"),
+		Now: func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }}
+	suffixes := []string{"0000", "q7k2"}
+	resolver := func(p Policy) *Resolver {
+		return &Resolver{Vaults: srv.Client(), Policy: p, Journal: journal, PollInterval: time.Millisecond, Suffix: func() string {
+			s := suffixes[0]
+			suffixes = append(suffixes[1:], s)
+			return s
+		}}
+	}
+	ctx := context.Background()
+
+	res, err := resolver(PolicyRename).Resolve(ctx, "TestX", "kv-free")
+	require.NoError(t, err)
+	assert.Equal(t, Resolution{Name: "kv-free", Action: ActionNone}, res)
+
+	res, err = resolver(PolicyRename).Resolve(ctx, "TestX", "KV-SEC-ABC123")
+	require.NoError(t, err)
+	assert.Equal(t, ActionRenamed, res.Action)
+	assert.Equal(t, "KV-SEC-ABC123-q7k2", res.Name, "the first suffix is taken too")
+	assert.Equal(t, "kv-sec-abc123", res.Collision.Name)
+
+	_, err = resolver(PolicyFail).Resolve(ctx, "TestX", "kv-sec-abc123")
+	assert.ErrorContains(t, err, `key vault name "kv-sec-abc123" is held by a soft-deleted vault in westeurope`)
+
+	res, err = resolver(PolicyPurge).Resolve(ctx, "TestSecurity", "kv-sec-abc123")
+	require.NoError(t, err)
+	assert.Equal(t, ActionPurged, res.Action)
+	assert.Equal(t, "kv-sec-abc123", res.Name)
+	assert.Equal(t, []string{"kv-sec-abc123"}, srv.Purged())
+	deleted, err := srv.Client().ListDeletedVaults(ctx)
+	require.NoError(t, err)
+	for _, v := range deleted {
+		assert.NotEqual(t, "kv-sec-abc123", v.Name, "Resolve returned before the purge finished")
+	}
+
+	// Purge protection leaves nothing to purge, so the name is avoided.
+	suffixes = []string{"zz99"}
+	res, err = resolver(PolicyPurge).Resolve(ctx, "TestBackupConfiguration", "backup-test-kv-x1y2z3")
+	require.NoError(t, err)
+	assert.Equal(t, ActionRenamed, res.Action)
+	assert.Equal(t, "backup-test-kv-x1y2-zz99", res.Name)
+	assert.Len(t, res.Name, maxNameLen)
+	assert.Contains(t, res.Reason, "purge protection")
+	assert.Equal(t, []string{"kv-sec-abc123"}, srv.Purged())
+
+	entries, err := ReadJournal(journal.File)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{
+		Time: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), Test: "TestSecurity", Name: "kv-sec-abc123", Location: "westeurope",
+		VaultID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/deleted/providers/Microsoft.KeyVault/vaults/kv-sec-abc123",
+	}}, entries)
+	assert.Equal(t, entries, journal.Entries())
+
+	var buf bytes.Buffer
+	require.NoError(t, journal.WriteSummary(&buf))
+	assert.Contains(t, buf.String(), "kv-sec-abc123\twesteurope\tTestSecurity")
+}
+
+func TestResolveStopsWaitingForAPurgeAtContextEnd(t *testing.T) {
+	srv := armfake.New("")
+	defer srv.Close()
+	srv.PurgePolls = 1000
+	srv.AddDeletedVault("kv-slow", "westeurope", false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r := &Resolver{Vaults: srv.Client(), Policy: PolicyPurge, PollInterval: time.Millisecond}
+	_, err := r.Resolve(ctx, "TestX", "kv-slow")
+	assert.ErrorContains(t, err, `waiting for the purge of deleted key vault "kv-slow"`)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"kv-slow"}, srv.Purged())
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy(" Purge ")
+	require.NoError(t, err)
+	assert.Equal(t, PolicyPurge, p)
+	_, err = ParsePolicy("recover")
+	assert.ErrorContains(t, err, `unknown policy "recover"`)
+}
+
+func TestReadJournalMissingFile(t *testing.T) {
+	entries, err := ReadJournal(filepath.Join(t.TempDir(), "none.jsonl"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
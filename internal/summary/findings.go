@@ -0,0 +1,148 @@
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"terraform-advanced-course/internal/cost"
+)
+
+// Finding sources.
+const (
+	SourcePolicy = "policy"
+	SourceCost   = "cost"
+)
+
+// Finding is a note from another check about one resource.
+type Finding struct {
+	Source string `json:"source"`
+
+	// Address is the resource the finding is about. When empty, Attach
+	// looks for a changed resource's address inside Message.
+	Address string `json:"address,omitempty"`
+
+	Message string `json:"message"`
+}
+
+// Attach adds findings to the changes they are about. Findings for
+// resources the plan does not change are kept in s.Unattached.
+func (s *Summary) Attach(findings ...Finding) {
+	byAddress := map[string]*Change{}
+	var addresses []string
+	for _, m := range s.Modules {
+		for _, c := range m.Changes {
+			byAddress[c.Address] = c
+			addresses = append(addresses, c.Address)
+		}
+	}
+	// Longest first, so module.storage.azurerm_storage_account.storage is
+	// preferred over a shorter address it happens to contain.
+	sort.Slice(addresses, func(i, j int) bool { return len(addresses[i]) > len(addresses[j]) })
+
+	for _, f := range findings {
+		addr := f.Address
+		if addr == "" {
+			for _, a := range addresses {
+				if strings.Contains(f.Message, a) {
+					addr = a
+					break
+				}
+			}
+		}
+		if c, ok := byAddress[addr]; ok {
+			c.Findings = append(c.Findings, f)
+			continue
+		}
+		s.Unattached = append(s.Unattached, f)
+	}
+}
+
+// CostFindings turns each priced delta of a cost comparison into a
+// finding, e.g. "+67.89 USD/month (B1 → P1v2)".
+func CostFindings(cmp *cost.Comparison) []Finding {
+	var out []Finding
+	for _, d := range cmp.Deltas {
+		msg := signedMoney(d.Change, cmp.Head.Currency) + "/month"
+		if d.SKUChanged() {
+			msg += fmt.Sprintf(" (%s → %s)", skuLabel(d.Base.Key), skuLabel(d.Head.Key))
+		}
+		if d.Head != nil && d.Head.Status == cost.StatusUnpriced {
+			msg = "not priced: " + d.Head.Note
+		}
+		out = append(out, Finding{Source: SourceCost, Address: d.Address, Message: msg})
+	}
+	return out
+}
+
+func signedMoney(v float64, currency string) string {
+	if v > 0 {
+		return fmt.Sprintf("+%.2f %s", v, currency)
+	}
+	return fmt.Sprintf("%.2f %s", v, currency)
+}
+
+func skuLabel(k cost.Key) string {
+	if k.Replication != "" {
+		return k.SKU + " " + k.Replication
+	}
+	return k.SKU
+}
+
+// ParsePolicyFindings reads policy violations in any of the shapes the
+// repository produces: a JSON list of messages, the report written by
+// scripts/validate_policies.py, or raw `opa eval --format json` output.
+func ParsePolicyFindings(data []byte) ([]Finding, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("policy findings: %w", err)
+	}
+	if report, ok := v.(map[string]interface{}); ok {
+		switch {
+		case report["violations"] != nil:
+			v = report["violations"]
+		case report["result"] != nil:
+			v = report["result"]
+		default:
+			return nil, fmt.Errorf("policy findings: expected a list, a validation report or opa eval output")
+		}
+	}
+
+	var msgs []string
+	collectMessages(v, &msgs)
+	sort.Strings(msgs)
+	out := make([]Finding, 0, len(msgs))
+	for i, m := range msgs {
+		if i > 0 && msgs[i-1] == m {
+			continue
+		}
+		out = append(out, Finding{Source: SourcePolicy, Message: m})
+	}
+	return out, nil
+}
+
+// collectMessages gathers deny messages from nested OPA results, where
+// they sit under expressions[].value, possibly keyed by package.
+func collectMessages(v interface{}, out *[]string) {
+	switch v := v.(type) {
+	case string:
+		*out = append(*out, v)
+	case []interface{}:
+		for _, e := range v {
+			collectMessages(e, out)
+		}
+	case map[string]interface{}:
+		if exprs, ok := v["expressions"]; ok {
+			collectMessages(exprs, out)
+			return
+		}
+		if value, ok := v["value"]; ok {
+			collectMessages(value, out)
+			return
+		}
+		for _, e := range v {
+			collectMessages(e, out)
+		}
+	}
+}
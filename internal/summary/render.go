@@ -0,0 +1,183 @@
+package summary
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxValue is the longest value shown before it is truncated.
+const maxValue = 120
+
+var symbols = map[string]string{
+	ActionCreate:  "+",
+	ActionUpdate:  "~",
+	ActionReplace: "-/+",
+	ActionDelete:  "-",
+}
+
+// CountsText describes counts the way a plan's closing line does, e.g.
+// "2 to add, 1 to change, 1 to replace".
+func CountsText(counts map[string]int) string {
+	var parts []string
+	for _, a := range []struct{ action, verb string }{
+		{ActionCreate, "add"},
+		{ActionUpdate, "change"},
+		{ActionReplace, "replace"},
+		{ActionDelete, "destroy"},
+	} {
+		if n := counts[a.action]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d to %s", n, a.verb))
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteMarkdown renders s for a pull request comment.
+func WriteMarkdown(w io.Writer, s *Summary) error {
+	var b strings.Builder
+	b.WriteString("### Terraform plan\n\n")
+	if s.Empty() {
+		b.WriteString("No changes. Infrastructure matches the configuration.\n")
+	} else {
+		fmt.Fprintf(&b, "**%s**\n", CountsText(s.Counts))
+	}
+
+	for _, m := range s.Modules {
+		fmt.Fprintf(&b, "\n#### %s — %s\n\n", code(m.Name), CountsText(m.Counts))
+		for _, c := range m.Changes {
+			fmt.Fprintf(&b, "- %s %s", code(symbols[c.Action]), code(c.Address))
+			if c.Reason != "" {
+				fmt.Fprintf(&b, " — replaced: %s", c.Reason)
+			}
+			b.WriteString("\n")
+			for _, a := range c.Attributes {
+				fmt.Fprintf(&b, "  - %s: %s", code(a.Path), transition(a, code))
+				if a.ForcesReplacement {
+					b.WriteString(" **forces replacement**")
+				}
+				b.WriteString("\n")
+			}
+			for _, f := range c.Findings {
+				fmt.Fprintf(&b, "  - **%s:** %s\n", f.Source, f.Message)
+			}
+		}
+	}
+
+	if len(s.Unattached) > 0 {
+		b.WriteString("\n#### Other findings\n\n")
+		for _, f := range s.Unattached {
+			fmt.Fprintf(&b, "- **%s:** %s\n", f.Source, f.Message)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// transition formats an attribute change, leaving out the side that does
+// not exist.
+func transition(a Attribute, quote func(string) string) string {
+	switch {
+	case a.Before == "":
+		return "added " + quote(truncate(a.After))
+	case a.After == "":
+		return "removed " + quote(truncate(a.Before))
+	}
+	return quote(truncate(a.Before)) + " → " + quote(truncate(a.After))
+}
+
+func truncate(s string) string {
+	if utf8.RuneCountInString(s) <= maxValue {
+		return s
+	}
+	return string([]rune(s)[:maxValue-1]) + "…"
+}
+
+// code wraps s in a Markdown code span, widening the fence if s contains
+// backticks.
+func code(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+var htmlTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"counts":   CountsText,
+	"symbol":   func(action string) string { return symbols[action] },
+	"truncate": truncate,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Terraform plan summary</title>
+<style>
+  body { font-family: "Segoe UI", Arial, sans-serif; margin: 0; padding: 20px; color: #1b1a19; }
+  h1, h2 { color: #0078d4; }
+  .summary { background-color: #f0f0f0; padding: 15px; border-radius: 5px; margin-bottom: 20px; }
+  .change { border-left: 4px solid #8a8886; padding: 6px 12px; margin-bottom: 10px; }
+  .create { border-color: #107c10; }
+  .update { border-color: #ca5010; }
+  .replace { border-color: #d13438; background-color: #fdf2f2; }
+  .delete { border-color: #a4262c; background-color: #fdf2f2; }
+  .symbol { font-weight: bold; display: inline-block; min-width: 2.5em; }
+  .reason { color: #605e5c; }
+  .forces { color: #d13438; font-weight: bold; }
+  .finding { margin: 4px 0; }
+  .finding.policy { color: #a4262c; }
+  .finding.cost { color: #986f0b; }
+  code { font-family: Consolas, Monaco, "Andale Mono", monospace; }
+  ul { margin: 4px 0; }
+</style>
+</head>
+<body>
+<h1>Terraform plan</h1>
+<div class="summary"><strong>{{counts .Counts}}</strong></div>
+{{- range .Modules}}
+<h2><code>{{.Name}}</code> — {{counts .Counts}}</h2>
+{{- range .Changes}}
+<div class="change {{.Action}}">
+  <span class="symbol">{{symbol .Action}}</span><code>{{.Address}}</code>
+  {{- if .Reason}} <span class="reason">— replaced: {{.Reason}}</span>{{end}}
+  {{- if .Attributes}}
+  <ul>
+  {{- range .Attributes}}
+    <li><code>{{.Path}}</code>:
+      {{- if not .Before}} added <code>{{truncate .After}}</code>
+      {{- else if not .After}} removed <code>{{truncate .Before}}</code>
+      {{- else}} <code>{{truncate .Before}}</code> → <code>{{truncate .After}}</code>{{end}}
+      {{- if .ForcesReplacement}} <span class="forces">forces replacement</span>{{end}}</li>
+  {{- end}}
+  </ul>
+  {{- end}}
+  {{- range .Findings}}
+  <div class="finding {{.Source}}"><strong>{{.Source}}:</strong> {{.Message}}</div>
+  {{- end}}
+</div>
+{{- end}}
+{{- end}}
+{{- if .Unattached}}
+<h2>Other findings</h2>
+{{- range .Unattached}}
+<div class="finding {{.Source}}"><strong>{{.Source}}:</strong> {{.Message}}</div>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders s as a standalone HTML page, in the style of the
+// policy validation report.
+func WriteHTML(w io.Writer, s *Summary) error {
+	return htmlTemplate.Execute(w, s)
+}
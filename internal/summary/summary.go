@@ -0,0 +1,341 @@
+// Package summary turns a plan into a review-friendly summary for pull
+// requests: changes grouped per module and action, the attributes that
+// actually change, why replacements happen, and policy and cost findings
+// next to the resources they are about. Sensitive values are never
+// rendered.
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"terraform-advanced-course/internal/plan"
+)
+
+// Actions, in the order they are listed within a module: the riskiest
+// first.
+const (
+	ActionReplace = "replace"
+	ActionDelete  = "delete"
+	ActionUpdate  = "update"
+	ActionCreate  = "create"
+)
+
+var actionOrder = map[string]int{ActionReplace: 0, ActionDelete: 1, ActionUpdate: 2, ActionCreate: 3}
+
+// Placeholders shown instead of values.
+const (
+	Sensitive  = "(sensitive value)"
+	KnownAfter = "(known after apply)"
+)
+
+// Summary is a plan grouped for review.
+type Summary struct {
+	Modules []*Module
+
+	// Counts is the number of changes per action across all modules.
+	Counts map[string]int
+
+	// Unattached holds findings that matched no changed resource.
+	Unattached []Finding
+}
+
+// Module is the changes in one module, ordered by action then address.
+type Module struct {
+	Name    string
+	Changes []*Change
+	Counts  map[string]int
+}
+
+// Change is one resource instance that the plan changes.
+type Change struct {
+	Address string
+	Type    string
+	Action  string
+
+	// Reason explains a replacement, e.g. "cannot update in place".
+	Reason string
+
+	// Attributes lists what changes for updates and replacements.
+	Attributes []Attribute
+
+	Findings []Finding
+}
+
+// Attribute is one changed leaf value.
+type Attribute struct {
+	Path   string
+	Before string
+	After  string
+
+	// ForcesReplacement is set for paths listed in replace_paths.
+	ForcesReplacement bool
+}
+
+// Build groups p's managed resource changes. No-ops and data source reads
+// are left out.
+func Build(p *plan.Plan) *Summary {
+	s := &Summary{Counts: map[string]int{}}
+	modules := map[string]*Module{}
+	for _, rc := range p.ResourceChanges {
+		if !rc.Managed() {
+			continue
+		}
+		action := actionOf(rc.Actions)
+		if action == "" {
+			continue
+		}
+		c := &Change{Address: rc.Address, Type: rc.Type, Action: action}
+		if action == ActionReplace || action == ActionUpdate {
+			c.Attributes = attributes(rc)
+		}
+		if action == ActionReplace {
+			c.Reason = replaceReason(rc)
+		}
+
+		name := rc.ModuleName()
+		m, ok := modules[name]
+		if !ok {
+			m = &Module{Name: name, Counts: map[string]int{}}
+			modules[name] = m
+			s.Modules = append(s.Modules, m)
+		}
+		m.Changes = append(m.Changes, c)
+		m.Counts[action]++
+		s.Counts[action]++
+	}
+
+	sort.Slice(s.Modules, func(i, j int) bool {
+		// The root module first, then module paths in order.
+		a, b := s.Modules[i].Name, s.Modules[j].Name
+		if (a == "root") != (b == "root") {
+			return a == "root"
+		}
+		return a < b
+	})
+	for _, m := range s.Modules {
+		sort.Slice(m.Changes, func(i, j int) bool {
+			a, b := m.Changes[i], m.Changes[j]
+			if a.Action != b.Action {
+				return actionOrder[a.Action] < actionOrder[b.Action]
+			}
+			return a.Address < b.Address
+		})
+	}
+	return s
+}
+
+// Empty reports whether the plan changes nothing.
+func (s *Summary) Empty() bool {
+	return len(s.Modules) == 0
+}
+
+func actionOf(a plan.Actions) string {
+	switch {
+	case a.Replace():
+		return ActionReplace
+	case a.Delete():
+		return ActionDelete
+	case a.Update():
+		return ActionUpdate
+	case a.Create():
+		return ActionCreate
+	}
+	return ""
+}
+
+var reasons = map[string]string{
+	"replace_because_cannot_update": "cannot update in place",
+	"replace_because_tainted":       "tainted",
+	"replace_by_request":            "requested with -replace",
+	"replace_by_triggers":           "replace_triggered_by",
+}
+
+// replaceReason combines terraform's action reason with the attributes
+// that force the replacement.
+func replaceReason(rc plan.ResourceChange) string {
+	reason := reasons[rc.ActionReason]
+	if reason == "" {
+		reason = strings.ReplaceAll(strings.TrimPrefix(rc.ActionReason, "replace_"), "_", " ")
+	}
+	var paths []string
+	for _, p := range rc.ReplacePaths {
+		paths = append(paths, formatPath(p))
+	}
+	sort.Strings(paths)
+	switch {
+	case reason == "" && len(paths) == 0:
+		return ""
+	case len(paths) == 0:
+		return reason
+	case reason == "":
+		return "forced by " + strings.Join(paths, ", ")
+	}
+	return reason + ", forced by " + strings.Join(paths, ", ")
+}
+
+// attributes diffs the leaves of Before and After.
+func attributes(rc plan.ResourceChange) []Attribute {
+	before := map[string]leaf{}
+	flatten(nil, rc.Before, rc.BeforeSensitive, nil, before)
+	after := map[string]leaf{}
+	flatten(nil, rc.After, rc.AfterSensitive, rc.AfterUnknown, after)
+
+	paths := map[string][]interface{}{}
+	for k, l := range before {
+		paths[k] = l.path
+	}
+	for k, l := range after {
+		paths[k] = l.path
+	}
+
+	var out []Attribute
+	for key, path := range paths {
+		b, hadB := before[key]
+		a, hadA := after[key]
+		if hadA && hadB && a.equal(b) {
+			continue
+		}
+		attr := Attribute{Path: key, ForcesReplacement: forcesReplacement(path, rc.ReplacePaths)}
+		attr.Before = b.String(hadB)
+		attr.After = a.String(hadA)
+		out = append(out, attr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// leaf is one scalar value after flattening.
+type leaf struct {
+	path      []interface{}
+	value     interface{}
+	sensitive bool
+	unknown   bool
+}
+
+func (l leaf) equal(o leaf) bool {
+	if l.unknown || o.unknown {
+		return false
+	}
+	if l.sensitive != o.sensitive {
+		return false
+	}
+	return fmt.Sprint(l.value) == fmt.Sprint(o.value)
+}
+
+// String renders the value, or a placeholder when it is sensitive,
+// unknown or absent.
+func (l leaf) String(present bool) string {
+	switch {
+	case !present:
+		return ""
+	case l.sensitive:
+		return Sensitive
+	case l.unknown:
+		return KnownAfter
+	case l.value == nil:
+		return "null"
+	}
+	b, _ := json.Marshal(l.value)
+	return string(b)
+}
+
+// flatten walks a value alongside its sensitivity and unknown marks. A
+// mark of true applies to the whole subtree beneath it.
+func flatten(path []interface{}, v, sensitive, unknown interface{}, out map[string]leaf) {
+	if sensitive == true || unknown == true {
+		// Sensitive values keep their value so a change can still be
+		// detected; String never renders it.
+		p := append([]interface{}(nil), path...)
+		out[formatPath(p)] = leaf{path: p, value: v, sensitive: sensitive == true, unknown: unknown == true && sensitive != true}
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// Unknown keys can exist only in the marks, e.g. a computed
+		// attribute that is null in After.
+		if u, ok := unknown.(map[string]interface{}); ok {
+			for k := range u {
+				if _, ok := v[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+		}
+		for _, k := range keys {
+			flatten(append(path, k), v[k], child(sensitive, k), child(unknown, k), out)
+		}
+		return
+	case []interface{}:
+		for i, e := range v {
+			flatten(append(path, float64(i)), e, child(sensitive, i), child(unknown, i), out)
+		}
+		return
+	}
+	if v == nil && len(path) == 0 {
+		return
+	}
+	p := append([]interface{}(nil), path...)
+	out[formatPath(p)] = leaf{path: p, value: v}
+}
+
+func child(marks interface{}, key interface{}) interface{} {
+	switch m := marks.(type) {
+	case map[string]interface{}:
+		if k, ok := key.(string); ok {
+			return m[k]
+		}
+	case []interface{}:
+		if i, ok := key.(int); ok && i < len(m) {
+			return m[i]
+		}
+	}
+	return nil
+}
+
+// forcesReplacement reports whether path is at or beneath one of the
+// replace paths.
+func forcesReplacement(path []interface{}, replacePaths [][]interface{}) bool {
+	for _, rp := range replacePaths {
+		if len(rp) > len(path) {
+			continue
+		}
+		match := true
+		for i := range rp {
+			if fmt.Sprint(rp[i]) != fmt.Sprint(path[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPath renders a path the way terraform does in plan output, e.g.
+// site_config[0].minimum_tls_version or tags.Environment.
+func formatPath(path []interface{}) string {
+	var b strings.Builder
+	for i, step := range path {
+		switch s := step.(type) {
+		case float64:
+			b.WriteString("[" + strconv.FormatFloat(s, 'f', -1, 64) + "]")
+		case int:
+			b.WriteString("[" + strconv.Itoa(s) + "]")
+		case string:
+			if i > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
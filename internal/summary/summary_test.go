@@ -0,0 +1,162 @@
+package summary
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/cost"
+	"terraform-advanced-course/internal/plan"
+)
+
+func loadSummary(t *testing.T) (*Summary, *plan.Plan) {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	return Build(p), p
+}
+
+func change(t *testing.T, s *Summary, address string) *Change {
+	t.Helper()
+	for _, m := range s.Modules {
+		for _, c := range m.Changes {
+			if c.Address == address {
+				return c
+			}
+		}
+	}
+	t.Fatalf("no change for %s", address)
+	return nil
+}
+
+func TestBuildGroupsByModuleAndAction(t *testing.T) {
+	s, _ := loadSummary(t)
+
+	var names []string
+	for _, m := range s.Modules {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"module.storage", "module.webapp"}, names, "no-ops and reads are left out")
+	assert.Equal(t, map[string]int{ActionCreate: 1, ActionUpdate: 1, ActionReplace: 1, ActionDelete: 1}, s.Counts)
+
+	storage := s.Modules[0]
+	assert.Equal(t, ActionDelete, storage.Changes[0].Action, "deletes are listed before creates")
+	assert.Equal(t, ActionCreate, storage.Changes[1].Action)
+	assert.Empty(t, storage.Changes[1].Attributes, "creates do not list attributes")
+}
+
+func TestReplaceReasonAndForcedPaths(t *testing.T) {
+	s, _ := loadSummary(t)
+	c := change(t, s, "module.webapp.azurerm_service_plan.app_service_plan")
+
+	assert.Equal(t, "cannot update in place, forced by os_type", c.Reason)
+	assert.Equal(t, []Attribute{
+		{Path: "id", Before: `"/subscriptions/x/asp"`, After: KnownAfter},
+		{Path: "os_type", Before: `"Linux"`, After: `"Windows"`, ForcesReplacement: true},
+		{Path: "sku_name", Before: `"B1"`, After: `"P1v2"`},
+	}, c.Attributes)
+}
+
+func TestAttributesMaskSensitiveValues(t *testing.T) {
+	s, _ := loadSummary(t)
+	c := change(t, s, "module.webapp.azurerm_linux_web_app.web_app")
+
+	assert.Equal(t, []Attribute{
+		{Path: "app_settings.DB_PASSWORD", Before: Sensitive, After: Sensitive},
+		{Path: "outbound_ip_addresses", After: KnownAfter},
+		{Path: "site_config[0].minimum_tls_version", Before: `"1.0"`, After: `"1.2"`},
+		{Path: "tags.Owner", After: `"platform"`},
+	}, c.Attributes)
+
+	var md, page bytes.Buffer
+	require.NoError(t, WriteMarkdown(&md, s))
+	require.NoError(t, WriteHTML(&page, s))
+	for _, out := range []string{md.String(), page.String()} {
+		assert.NotContains(t, out, "hunter2")
+		assert.NotContains(t, out, "correct-horse")
+	}
+}
+
+func TestAttachFindings(t *testing.T) {
+	s, p := loadSummary(t)
+
+	data, err := os.ReadFile("testdata/opa.json")
+	require.NoError(t, err)
+	policy, err := ParsePolicyFindings(data)
+	require.NoError(t, err)
+	require.Len(t, policy, 3)
+
+	catalog := cost.DefaultCatalog()
+	cmp := cost.Compare(cost.EstimatePrior(p, catalog, cost.Options{}), cost.EstimatePlan(p, catalog, cost.Options{}))
+	s.Attach(policy...)
+	s.Attach(CostFindings(cmp)...)
+
+	web := change(t, s, "module.webapp.azurerm_linux_web_app.web_app")
+	require.Len(t, web.Findings, 1)
+	assert.Equal(t, SourcePolicy, web.Findings[0].Source)
+
+	asp := change(t, s, "module.webapp.azurerm_service_plan.app_service_plan")
+	require.Len(t, asp.Findings, 1)
+	assert.Equal(t, Finding{Source: SourceCost, Address: asp.Address, Message: "+67.89 USD/month (B1 → P1v2)"}, asp.Findings[0])
+
+	sa := change(t, s, "module.storage.azurerm_storage_account.storage")
+	assert.Len(t, sa.Findings, 2, "one policy and one cost finding")
+
+	require.Len(t, s.Unattached, 1, "the resource group is not changed")
+	assert.Contains(t, s.Unattached[0].Message, "azurerm_resource_group.rg")
+}
+
+func TestParsePolicyFindingsShapes(t *testing.T) {
+	list, err := ParsePolicyFindings([]byte(`["b", "a", "a"]`))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{{Source: SourcePolicy, Message: "a"}, {Source: SourcePolicy, Message: "b"}}, list)
+
+	report, err := ParsePolicyFindings([]byte(`{"violation_count": 1, "violations": [{"expressions": [{"value": ["x"], "text": "data.terraform.deny"}]}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Finding{{Source: SourcePolicy, Message: "x"}}, report)
+
+	_, err = ParsePolicyFindings([]byte(`{"unexpected": true}`))
+	assert.Error(t, err)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	s, _ := loadSummary(t)
+	s.Attach(Finding{Source: SourcePolicy, Message: "module.webapp.azurerm_linux_web_app.web_app must use minimum TLS version 1.2"})
+
+	var out bytes.Buffer
+	require.NoError(t, WriteMarkdown(&out, s))
+	md := out.String()
+
+	assert.Contains(t, md, "**1 to add, 1 to change, 1 to replace, 1 to destroy**\n")
+	assert.Contains(t, md, "#### `module.webapp` — 1 to change, 1 to replace\n")
+	assert.Contains(t, md, "- `-/+` `module.webapp.azurerm_service_plan.app_service_plan` — replaced: cannot update in place, forced by os_type\n")
+	assert.Contains(t, md, "  - `os_type`: `\"Linux\"` → `\"Windows\"` **forces replacement**\n")
+	assert.Contains(t, md, "  - `tags.Owner`: added `\"platform\"`\n")
+	assert.Contains(t, md, "  - **policy:** module.webapp.azurerm_linux_web_app.web_app must use minimum TLS version 1.2\n")
+}
+
+func TestWriteMarkdownNoChanges(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMarkdown(&out, Build(&plan.Plan{})))
+	assert.Contains(t, out.String(), "No changes.")
+}
+
+func TestWriteHTMLEscapes(t *testing.T) {
+	s, _ := loadSummary(t)
+	s.Attach(Finding{Source: SourcePolicy, Address: "module.storage.azurerm_storage_container.legacy", Message: "<script>alert(1)</script>"})
+
+	var out bytes.Buffer
+	require.NoError(t, WriteHTML(&out, s))
+	assert.Contains(t, out.String(), `<div class="change replace">`)
+	assert.Contains(t, out.String(), "&lt;script&gt;")
+	assert.NotContains(t, out.String(), "<script>")
+}
+
+func TestCode(t *testing.T) {
+	assert.Equal(t, "`a`", code("a"))
+	assert.Equal(t, "``a`b``", code("a`b"))
+	assert.Equal(t, "`` `a ``", code("`a"))
+}
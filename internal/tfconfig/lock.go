@@ -0,0 +1,71 @@
+package tfconfig
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// LockFile is the dependency lock file terraform init writes.
+const LockFile = ".terraform.lock.hcl"
+
+// LockedProvider is one provider block of a dependency lock file.
+type LockedProvider struct {
+	// Source is the full source address, such as
+	// registry.terraform.io/hashicorp/azurerm.
+	Source  string
+	Version string
+
+	// Hashes are the package checksums terraform accepts, in the
+	// h1: (package contents) and zh: (zip file) schemes.
+	Hashes []string
+}
+
+var (
+	lockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "provider", LabelNames: []string{"source"}}},
+	}
+	lockedProviderSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "version"}, {Name: "hashes"}},
+	}
+)
+
+// LoadLock reads the providers a dependency lock file pins.
+func LoadLock(file string) ([]LockedProvider, error) {
+	f, diags := hclparse.NewParser().ParseHCLFile(file)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("tfconfig: %s", diags.Error())
+	}
+	content, _, diags := f.Body.PartialContent(lockSchema)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("tfconfig: %s", diags.Error())
+	}
+	var out []LockedProvider
+	for _, b := range content.Blocks {
+		attrs, _, _ := b.Body.PartialContent(lockedProviderSchema)
+		p := LockedProvider{Source: b.Labels[0]}
+		if attr, ok := attrs.Attributes["version"]; ok {
+			p.Version = StringValue(attr)
+		}
+		if p.Version == "" {
+			return nil, fmt.Errorf("tfconfig: %s: provider %s has no version", file, p.Source)
+		}
+		if attr, ok := attrs.Attributes["hashes"]; ok {
+			v, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !v.CanIterateElements() {
+				return nil, fmt.Errorf("tfconfig: %s: provider %s: hashes is not a list of strings", file, p.Source)
+			}
+			for it := v.ElementIterator(); it.Next(); {
+				_, h := it.Element()
+				if h.IsNull() || h.Type() != cty.String {
+					return nil, fmt.Errorf("tfconfig: %s: provider %s: hashes is not a list of strings", file, p.Source)
+				}
+				p.Hashes = append(p.Hashes, h.AsString())
+			}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
@@ -0,0 +1,193 @@
+// Package tfconfig reads the settings in a module's terraform blocks, and
+// the modules it calls, without running terraform.
+package tfconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Config is what a module's terraform blocks declare.
+type Config struct {
+	RequiredVersion string
+
+	// Backend is empty when the module has no backend block, which
+	// means the local backend.
+	Backend       string
+	BackendConfig map[string]string
+
+	// RequiredProviders are the required_providers entries by local name.
+	RequiredProviders map[string]ProviderRequirement
+
+	// ModuleSources are the local paths, relative to the module, that
+	// its module blocks call, in file order and without duplicates.
+	ModuleSources []string
+}
+
+// ProviderRequirement is one required_providers entry, as written.
+type ProviderRequirement struct {
+	// Source is empty when the entry gives none, which terraform reads
+	// as hashicorp/<local name>.
+	Source string
+
+	// Version is the version constraint, or "".
+	Version string
+}
+
+var (
+	fileSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "terraform"},
+			{Type: "module", LabelNames: []string{"name"}},
+		},
+	}
+	moduleSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "source"}},
+	}
+	terraformSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "required_version"}},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "backend", LabelNames: []string{"type"}},
+			{Type: "required_providers"},
+		},
+	}
+)
+
+// Load reads the terraform blocks of every .tf file in dir, override
+// files included, in the order terraform merges them.
+func Load(dir string) (*Config, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("tfconfig: no .tf files in %s", dir)
+	}
+	// Override files are merged last, whatever their names.
+	sort.SliceStable(files, func(i, j int) bool {
+		if oi, oj := IsOverride(files[i]), IsOverride(files[j]); oi != oj {
+			return oj
+		}
+		return files[i] < files[j]
+	})
+
+	cfg := &Config{}
+	parser := hclparse.NewParser()
+	for _, path := range files {
+		f, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("tfconfig: %s", diags.Error())
+		}
+		content, _, diags := f.Body.PartialContent(fileSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("tfconfig: %s", diags.Error())
+		}
+		for _, block := range content.Blocks {
+			if block.Type == "module" {
+				m, _, _ := block.Body.PartialContent(moduleSchema)
+				if attr, ok := m.Attributes["source"]; ok {
+					cfg.addModuleSource(StringValue(attr))
+				}
+				continue
+			}
+			tf, _, diags := block.Body.PartialContent(terraformSchema)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("tfconfig: %s", diags.Error())
+			}
+			if attr, ok := tf.Attributes["required_version"]; ok {
+				cfg.RequiredVersion = StringValue(attr)
+			}
+			for _, b := range tf.Blocks {
+				switch b.Type {
+				case "backend":
+					cfg.Backend = b.Labels[0]
+					cfg.BackendConfig = stringAttrs(b.Body)
+				case "required_providers":
+					cfg.addRequiredProviders(b.Body)
+				}
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// addRequiredProviders records the entries of a required_providers block.
+// An entry is an object with source and version, or, in the form older
+// configurations use, just a version string.
+func (c *Config) addRequiredProviders(body hcl.Body) {
+	attrs, _ := body.JustAttributes()
+	if c.RequiredProviders == nil {
+		c.RequiredProviders = map[string]ProviderRequirement{}
+	}
+	for name, attr := range attrs {
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || v.IsNull() || !v.IsWhollyKnown() {
+			continue
+		}
+		var req ProviderRequirement
+		switch {
+		case v.Type() == cty.String:
+			req.Version = v.AsString()
+		case v.Type().IsObjectType():
+			for field, dst := range map[string]*string{"source": &req.Source, "version": &req.Version} {
+				if v.Type().HasAttribute(field) {
+					if a := v.GetAttr(field); !a.IsNull() && a.Type() == cty.String {
+						*dst = a.AsString()
+					}
+				}
+			}
+		default:
+			continue
+		}
+		c.RequiredProviders[name] = req
+	}
+}
+
+// addModuleSource records source if it is a local path. Terraform only
+// treats sources starting with ./ or ../ as local.
+func (c *Config) addModuleSource(source string) {
+	if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		return
+	}
+	for _, s := range c.ModuleSources {
+		if s == source {
+			return
+		}
+	}
+	c.ModuleSources = append(c.ModuleSources, source)
+}
+
+// IsOverride reports whether path is an override file.
+func IsOverride(path string) bool {
+	base := filepath.Base(path)
+	return base == "override.tf" || strings.HasSuffix(base, "_override.tf")
+}
+
+// stringAttrs returns the literal string attributes of a body. Anything
+// that needs evaluating is left out.
+func stringAttrs(body hcl.Body) map[string]string {
+	attrs, _ := body.JustAttributes()
+	out := make(map[string]string, len(attrs))
+	for name, attr := range attrs {
+		if v := StringValue(attr); v != "" {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+// StringValue returns an attribute's literal string value, or "" when it
+// is not a literal string.
+func StringValue(attr *hcl.Attribute) string {
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+		return ""
+	}
+	return v.AsString()
+}
@@ -0,0 +1,72 @@
+package tfconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRootModule(t *testing.T) {
+	cfg, err := Load("../..")
+	require.NoError(t, err)
+	assert.Equal(t, ">= 1.8.0", cfg.RequiredVersion)
+	assert.Equal(t, "azurerm", cfg.Backend)
+	assert.Equal(t, "prod.terraform.tfstate", cfg.BackendConfig["key"])
+	assert.Equal(t, "terraformstatehidde", cfg.BackendConfig["storage_account_name"])
+	assert.Equal(t, []string{
+		"./modules/validation",
+		"./modules/naming",
+		"./modules/tagging",
+		"./modules/network",
+		"./modules/storage",
+		"./modules/webapp",
+		"./modules/keyvault",
+	}, cfg.ModuleSources)
+}
+
+func TestLoadKeepsOnlyLocalModuleSources(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+module "a" {
+  source = "../shared"
+}
+module "b" {
+  source = "Azure/naming/azurerm"
+}
+module "c" {
+  source = "git::https://example.com/modules.git//net"
+}
+module "d" {
+  source = "../shared"
+}
+`), 0o644))
+	cfg, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"../shared"}, cfg.ModuleSources)
+}
+
+func TestLoadAppliesOverridesLast(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("a_override.tf", `terraform {
+  backend "local" {}
+}`)
+	write("backend.tf", `terraform {
+  backend "azurerm" {
+    key = "prod.tfstate"
+  }
+}`)
+
+	cfg, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "local", cfg.Backend)
+	assert.Empty(t, cfg.BackendConfig)
+
+	_, err = Load(t.TempDir())
+	assert.Error(t, err)
+}
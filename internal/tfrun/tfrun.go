@@ -0,0 +1,140 @@
+// Package tfrun runs the terraform CLI for tools that need a fresh plan
+// rather than one handed to them.
+package tfrun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Runner runs terraform in one working directory.
+type Runner struct {
+	// Binary defaults to "terraform".
+	Binary string
+
+	// Dir is the root module directory.
+	Dir string
+
+	// Workspace, when set, is selected through TF_WORKSPACE so the
+	// directory's persisted workspace is left alone.
+	Workspace string
+
+	// Env is added to the process environment, as NAME=value.
+	Env []string
+
+	// Stderr receives terraform's diagnostics. Defaults to os.Stderr.
+	Stderr io.Writer
+}
+
+// Plan runs `terraform plan -out` with extra arguments and returns the
+// path of the saved plan file, which lives in a temporary directory the
+// caller should remove.
+func (r *Runner) Plan(ctx context.Context, args ...string) (string, error) {
+	dir, err := os.MkdirTemp("", "tfrun-")
+	if err != nil {
+		return "", err
+	}
+	planFile := filepath.Join(dir, "tfplan")
+	planArgs := append([]string{"plan", "-input=false", "-lock=false", "-out=" + planFile}, args...)
+	if _, err := r.run(ctx, planArgs...); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return planFile, nil
+}
+
+// SavePlan runs `terraform plan -out=planFile` with extra arguments. Unlike
+// Plan it takes the state lock, because the plan is meant to be applied.
+func (r *Runner) SavePlan(ctx context.Context, planFile string, args ...string) error {
+	planArgs := append([]string{"plan", "-input=false", "-out=" + planFile}, args...)
+	return r.stream(ctx, planArgs...)
+}
+
+// Apply applies a saved plan file, streaming terraform's output.
+func (r *Runner) Apply(ctx context.Context, planFile string) error {
+	return r.stream(ctx, "apply", "-input=false", planFile)
+}
+
+// Init runs `terraform init` with extra arguments, streaming its output.
+func (r *Runner) Init(ctx context.Context, args ...string) error {
+	return r.stream(ctx, append([]string{"init", "-input=false"}, args...)...)
+}
+
+// Destroy runs `terraform destroy -auto-approve` with extra arguments,
+// streaming its output.
+func (r *Runner) Destroy(ctx context.Context, args ...string) error {
+	return r.stream(ctx, append([]string{"destroy", "-auto-approve", "-input=false"}, args...)...)
+}
+
+// StatePull returns the workspace's current raw state, or nil when it has
+// none yet.
+func (r *Runner) StatePull(ctx context.Context) ([]byte, error) {
+	out, err := r.run(ctx, "state", "pull")
+	if err != nil || len(bytes.TrimSpace(out)) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ShowJSON runs `terraform show -json` on a saved plan file.
+func (r *Runner) ShowJSON(ctx context.Context, planFile string) ([]byte, error) {
+	return r.run(ctx, "show", "-json", planFile)
+}
+
+// PlanJSON plans with extra arguments and returns the plan as JSON.
+func (r *Runner) PlanJSON(ctx context.Context, args ...string) ([]byte, error) {
+	planFile, err := r.Plan(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(filepath.Dir(planFile))
+	return r.ShowJSON(ctx, planFile)
+}
+
+func (r *Runner) run(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	if err := r.exec(ctx, &stdout, args...); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// stream runs terraform with its output going to os.Stdout.
+func (r *Runner) stream(ctx context.Context, args ...string) error {
+	return r.exec(ctx, os.Stdout, args...)
+}
+
+func (r *Runner) exec(ctx context.Context, stdout io.Writer, args ...string) error {
+	binary := r.Binary
+	if binary == "" {
+		binary = "terraform"
+	}
+	cmd := exec.CommandContext(ctx, binary, append([]string{"-chdir=" + r.Dir}, args...)...)
+	cmd.Env = append(os.Environ(), r.Env...)
+	if r.Workspace != "" {
+		cmd.Env = append(cmd.Env, "TF_WORKSPACE="+r.Workspace)
+	}
+	cmd.Env = append(cmd.Env, "TF_IN_AUTOMATION=1")
+
+	cmd.Stdout = stdout
+	cmd.Stderr = r.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("terraform %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// WorkspaceFor returns the workspace the Makefile uses for a var file,
+// e.g. "dev" for environments/dev.tfvars.
+func WorkspaceFor(varFile string) string {
+	return strings.TrimSuffix(filepath.Base(varFile), filepath.Ext(varFile))
+}
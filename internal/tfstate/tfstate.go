@@ -0,0 +1,221 @@
+// Package tfstate reads Terraform state into a flat list of resource
+// instances.
+//
+// Both the raw state file (version 4, as stored by the backend or written
+// next to a module by local runs) and the `terraform show -json` rendering
+// are accepted, so tools do not need to care which one they were handed.
+package tfstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// State is a parsed Terraform state.
+type State struct {
+	TerraformVersion string
+	Serial           uint64
+	Lineage          string
+	Resources        []Resource
+}
+
+// Resource is a single resource instance in state.
+type Resource struct {
+	// Address is the full instance address, e.g.
+	// module.storage.azurerm_storage_account.storage.
+	Address string
+
+	// Module is the module path, empty for the root module.
+	Module string
+
+	Mode         string // "managed" or "data"
+	Type         string
+	Name         string
+	ProviderName string
+
+	// Index is the count or for_each key, nil when neither is used.
+	Index interface{}
+
+	Values map[string]interface{}
+
+	// DependsOn lists the absolute addresses of the resources this one
+	// depended on when it was last applied.
+	DependsOn []string
+}
+
+// ID returns the provider ID attribute, which for azurerm is the ARM
+// resource ID.
+func (r Resource) ID() string {
+	id, _ := r.Values["id"].(string)
+	return id
+}
+
+// Managed reports whether the instance is a managed resource rather than a
+// data source.
+func (r Resource) Managed() bool {
+	return r.Mode == "managed"
+}
+
+// Load reads a state file from disk. A path of "-" reads standard input.
+func Load(path string) (*State, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	st, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return st, nil
+}
+
+// Parse decodes either a raw state file or `terraform show -json` output.
+func Parse(data []byte) (*State, error) {
+	var probe struct {
+		Version       *int   `json:"version"`
+		FormatVersion string `json:"format_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("tfstate: %w", err)
+	}
+	switch {
+	case probe.FormatVersion != "":
+		return parseShowJSON(data)
+	case probe.Version != nil:
+		if *probe.Version != 4 {
+			return nil, fmt.Errorf("tfstate: unsupported state version %d", *probe.Version)
+		}
+		return parseRaw(data)
+	default:
+		return nil, fmt.Errorf("tfstate: input is neither a state file nor show -json output")
+	}
+}
+
+type rawState struct {
+	TerraformVersion string `json:"terraform_version"`
+	Serial           uint64 `json:"serial"`
+	Lineage          string `json:"lineage"`
+	Resources        []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Provider  string `json:"provider"`
+		Instances []struct {
+			IndexKey     interface{}            `json:"index_key"`
+			Attributes   map[string]interface{} `json:"attributes"`
+			Dependencies []string               `json:"dependencies"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+func parseRaw(data []byte) (*State, error) {
+	var raw rawState
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("tfstate: %w", err)
+	}
+	st := &State{
+		TerraformVersion: raw.TerraformVersion,
+		Serial:           raw.Serial,
+		Lineage:          raw.Lineage,
+	}
+	for _, r := range raw.Resources {
+		for _, inst := range r.Instances {
+			st.Resources = append(st.Resources, Resource{
+				Address:      Address(r.Module, r.Mode, r.Type, r.Name, inst.IndexKey),
+				Module:       r.Module,
+				Mode:         r.Mode,
+				Type:         r.Type,
+				Name:         r.Name,
+				ProviderName: r.Provider,
+				Index:        inst.IndexKey,
+				Values:       inst.Attributes,
+				DependsOn:    inst.Dependencies,
+			})
+		}
+	}
+	return st, nil
+}
+
+type showModule struct {
+	Address   string `json:"address"`
+	Resources []struct {
+		Address      string                 `json:"address"`
+		Mode         string                 `json:"mode"`
+		Type         string                 `json:"type"`
+		Name         string                 `json:"name"`
+		Index        interface{}            `json:"index"`
+		ProviderName string                 `json:"provider_name"`
+		Values       map[string]interface{} `json:"values"`
+		DependsOn    []string               `json:"depends_on"`
+	} `json:"resources"`
+	ChildModules []showModule `json:"child_modules"`
+}
+
+func parseShowJSON(data []byte) (*State, error) {
+	var show struct {
+		TerraformVersion string `json:"terraform_version"`
+		Values           *struct {
+			RootModule showModule `json:"root_module"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &show); err != nil {
+		return nil, fmt.Errorf("tfstate: %w", err)
+	}
+	st := &State{TerraformVersion: show.TerraformVersion}
+	if show.Values != nil {
+		st.appendModule(show.Values.RootModule)
+	}
+	return st, nil
+}
+
+func (st *State) appendModule(m showModule) {
+	for _, r := range m.Resources {
+		st.Resources = append(st.Resources, Resource{
+			Address:      r.Address,
+			Module:       m.Address,
+			Mode:         r.Mode,
+			Type:         r.Type,
+			Name:         r.Name,
+			ProviderName: r.ProviderName,
+			Index:        r.Index,
+			Values:       r.Values,
+			DependsOn:    r.DependsOn,
+		})
+	}
+	for _, child := range m.ChildModules {
+		st.appendModule(child)
+	}
+}
+
+// Address builds a resource instance address from its parts.
+func Address(module, mode, typ, name string, index interface{}) string {
+	addr := typ + "." + name
+	if mode == "data" {
+		addr = "data." + addr
+	}
+	if module != "" {
+		addr = module + "." + addr
+	}
+	switch k := index.(type) {
+	case nil:
+	case string:
+		addr += "[" + strconv.Quote(k) + "]"
+	case float64:
+		addr += "[" + strconv.FormatFloat(k, 'f', -1, 64) + "]"
+	default:
+		addr += fmt.Sprintf("[%v]", k)
+	}
+	return addr
+}
@@ -0,0 +1,63 @@
+package tfstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRawState(t *testing.T) {
+	st, err := Parse([]byte(`{
+		"version": 4,
+		"terraform_version": "1.8.5",
+		"serial": 12,
+		"lineage": "3f0c1c2e",
+		"resources": [
+			{"mode": "managed", "type": "azurerm_resource_group", "name": "rg",
+			 "provider": "provider[\"registry.terraform.io/hashicorp/azurerm\"]",
+			 "instances": [{"attributes": {"id": "/subscriptions/x/resourceGroups/rg"}}]},
+			{"module": "module.keyvault", "mode": "data", "type": "azurerm_client_config", "name": "current",
+			 "instances": [{"attributes": {"tenant_id": "t"}}]},
+			{"module": "module.storage", "mode": "managed", "type": "azurerm_storage_container", "name": "c",
+			 "instances": [{"index_key": "logs", "attributes": {"id": "c1"}}, {"index_key": 0, "attributes": {"id": "c2"}}]}
+		]
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(12), st.Serial)
+	assert.Equal(t, "3f0c1c2e", st.Lineage)
+	require.Len(t, st.Resources, 4)
+	assert.Equal(t, "azurerm_resource_group.rg", st.Resources[0].Address)
+	assert.Equal(t, "/subscriptions/x/resourceGroups/rg", st.Resources[0].ID())
+	assert.Equal(t, "module.keyvault.data.azurerm_client_config.current", st.Resources[1].Address)
+	assert.False(t, st.Resources[1].Managed())
+	assert.Equal(t, `module.storage.azurerm_storage_container.c["logs"]`, st.Resources[2].Address)
+	assert.Equal(t, "module.storage.azurerm_storage_container.c[0]", st.Resources[3].Address)
+}
+
+func TestParseShowJSON(t *testing.T) {
+	st, err := Parse([]byte(`{
+		"format_version": "1.0",
+		"terraform_version": "1.8.5",
+		"values": {"root_module": {
+			"resources": [{"address": "azurerm_resource_group.rg", "mode": "managed",
+				"type": "azurerm_resource_group", "name": "rg", "values": {"id": "rg-id"}}],
+			"child_modules": [{"address": "module.storage", "resources": [
+				{"address": "module.storage.azurerm_storage_account.storage", "mode": "managed",
+				 "type": "azurerm_storage_account", "name": "storage", "values": {"id": "sa-id"}}]}]
+		}}
+	}`))
+	require.NoError(t, err)
+
+	require.Len(t, st.Resources, 2)
+	assert.Equal(t, "module.storage", st.Resources[1].Module)
+	assert.Equal(t, "sa-id", st.Resources[1].ID())
+}
+
+func TestParseRejectsUnknownInput(t *testing.T) {
+	_, err := Parse([]byte(`{"version": 3}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"foo": 1}`))
+	assert.Error(t, err)
+}
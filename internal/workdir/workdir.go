@@ -0,0 +1,144 @@
+// Package workdir makes private working copies of terraform modules.
+//
+// Terraform keeps .terraform, the lock file and local state next to the
+// configuration, so two tests running in the same module directory at
+// once clobber each other. Copy gives each test its own copy of the
+// module together with every local module it calls, laid out as in the
+// source tree so that relative sources such as ../modules/naming still
+// resolve.
+package workdir
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"terraform-advanced-course/internal/safety"
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+// Copy copies the module in dir and the local modules it calls,
+// recursively, into dest, and returns the path of dir's copy. Paths below
+// dest mirror the paths below the modules' closest common directory.
+//
+// Only the files directly in each module directory are copied. Working
+// files are left out: .terraform, state and state backups, the harness
+// backend override and crash logs, so the copy starts uninitialized.
+func Copy(dir, dest string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	modules, err := localModules(root)
+	if err != nil {
+		return "", err
+	}
+
+	base := modules[0]
+	for _, m := range modules[1:] {
+		base = commonDir(base, m)
+	}
+	for _, m := range modules {
+		rel, err := filepath.Rel(base, m)
+		if err != nil {
+			return "", err
+		}
+		if err := copyFiles(m, filepath.Join(dest, rel)); err != nil {
+			return "", err
+		}
+	}
+	rel, err := filepath.Rel(base, root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dest, rel), nil
+}
+
+// localModules returns dir and every local module it calls, directly or
+// through other local modules, as absolute paths with dir first.
+func localModules(dir string) ([]string, error) {
+	seen := map[string]bool{dir: true}
+	out := []string{dir}
+	for i := 0; i < len(out); i++ {
+		cfg, err := tfconfig.Load(out[i])
+		if err != nil {
+			return nil, fmt.Errorf("workdir: %w", err)
+		}
+		for _, source := range cfg.ModuleSources {
+			m := filepath.Join(out[i], filepath.FromSlash(source))
+			if !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+			}
+		}
+	}
+	return out, nil
+}
+
+// commonDir returns the deepest directory containing both a and b.
+func commonDir(a, b string) string {
+	for {
+		if rel, err := filepath.Rel(a, b); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return a
+		}
+		parent := filepath.Dir(a)
+		if parent == a {
+			return a
+		}
+		a = parent
+	}
+}
+
+// skip reports whether a file is terraform's working state rather than
+// part of the configuration.
+func skip(name string) bool {
+	switch {
+	case name == ".terraform.tfstate.lock.info", name == safety.OverrideFile, name == "crash.log":
+		return true
+	case strings.HasSuffix(name, ".tfstate"), strings.HasSuffix(name, ".tfstate.backup"):
+		return true
+	}
+	return false
+}
+
+func copyFiles(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || skip(e.Name()) {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,74 @@
+package workdir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/safety"
+)
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+}
+
+func TestCopyFollowsRelativeModuleSources(t *testing.T) {
+	src := t.TempDir()
+	write(t, filepath.Join(src, "test/fixtures/app/main.tf"), `module "net" {
+  source = "../../../modules/network"
+}
+module "registry" {
+  source = "Azure/naming/azurerm"
+}`)
+	write(t, filepath.Join(src, "test/fixtures/app/terraform.tfstate"), "{}")
+	write(t, filepath.Join(src, "test/fixtures/app", safety.OverrideFile), "")
+	write(t, filepath.Join(src, "test/fixtures/app/.terraform/modules/modules.json"), "{}")
+	write(t, filepath.Join(src, "modules/network/main.tf"), `module "naming" {
+  source = "../naming"
+}`)
+	write(t, filepath.Join(src, "modules/network/.terraform.lock.hcl"), "")
+	write(t, filepath.Join(src, "modules/naming/main.tf"), `module "back" {
+  source = "../network"
+}`)
+	write(t, filepath.Join(src, "modules/unused/main.tf"), "")
+
+	dest := t.TempDir()
+	dir, err := Copy(filepath.Join(src, "test/fixtures/app"), dest)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dest, "test/fixtures/app"), dir)
+
+	var got []string
+	require.NoError(t, filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dest, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return err
+	}))
+	assert.ElementsMatch(t, []string{
+		"test/fixtures/app/main.tf",
+		"modules/network/main.tf",
+		"modules/network/.terraform.lock.hcl",
+		"modules/naming/main.tf",
+	}, got)
+}
+
+func TestCopyModuleWithoutLocalSources(t *testing.T) {
+	src := t.TempDir()
+	write(t, filepath.Join(src, "main.tf"), `variable "name" {}`)
+	write(t, filepath.Join(src, "prod.tfvars"), `name = "x"`)
+
+	dest := t.TempDir()
+	dir, err := Copy(src, dest)
+	require.NoError(t, err)
+	assert.Equal(t, dest, dir)
+	assert.FileExists(t, filepath.Join(dest, "prod.tfvars"))
+
+	_, err = Copy(filepath.Join(src, "missing"), t.TempDir())
+	assert.ErrorContains(t, err, "workdir: tfconfig: no .tf files")
+}
@@ -58,6 +58,7 @@ module "tagging" {
   owner             = var.owner
   cost_center       = var.cost_center
   terraform_version = "v1.12"
+  tags              = var.tags
 }
 
 resource "azurerm_resource_group" "rg" {
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/cleanup"
+)
+
+const defaultCleanupJournal = ".cleanup-journal"
+
+var (
+	cleanupJournalOnce sync.Once
+	cleanupJournal     *cleanup.Journal
+	cleanupJournalErr  error
+)
+
+// runJournal returns the run's cleanup journal, or nil when
+// TEST_CLEANUP_JOURNAL is "off". TEST_CLEANUP_JOURNAL names its
+// directory otherwise.
+func runJournal() (*cleanup.Journal, error) {
+	cleanupJournalOnce.Do(func() {
+		dir := os.Getenv("TEST_CLEANUP_JOURNAL")
+		switch dir {
+		case "off":
+			return
+		case "":
+			dir = defaultCleanupJournal
+		}
+		cleanupJournal, cleanupJournalErr = cleanup.Open(dir)
+	})
+	return cleanupJournal, cleanupJournalErr
+}
+
+var (
+	journaledMu sync.Mutex
+
+	// journaled holds the entries of the deployments applied and not yet
+	// destroyed, by working directory. A working copy belongs to one
+	// test, but its subtests may apply it in one and destroy it in
+	// another.
+	journaled = map[string]cleanup.Entry{}
+)
+
+// journalApply records options' deployment in the cleanup journal before
+// it is applied. Applying the same directory again updates its entry. If
+// the test that owns the working copy ends without destroying it, the
+// copy with its state is kept in the journal for
+// `go run ./cmd/testcleanup resume`.
+func journalApply(t *testing.T, options *terraform.Options) error {
+	t.Helper()
+	j, err := runJournal()
+	if j == nil {
+		return err
+	}
+	dir, err := filepath.Abs(options.TerraformDir)
+	if err != nil {
+		return err
+	}
+	owner := t
+	origin, copied := workingCopyOrigin(dir)
+	if copied {
+		owner = origin.owner
+	}
+	e := cleanup.Entry{
+		Test:          owner.Name(),
+		Source:        dir,
+		Dir:           dir,
+		Vars:          options.Vars,
+		BackendConfig: options.BackendConfig,
+		Env:           cleanup.SafeEnv(options.EnvVars),
+		Binary:        options.TerraformBinary,
+	}
+	if copied {
+		e.Source = origin.source
+	}
+	for _, f := range options.VarFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(dir, f)
+		}
+		e.VarFiles = append(e.VarFiles, f)
+	}
+	if len(options.BackendConfig) == 0 {
+		e.State = localStatePath(dir, options)
+	}
+
+	journaledMu.Lock()
+	defer journaledMu.Unlock()
+	if prev, ok := journaled[dir]; ok {
+		e.ID, e.Created, e.PID = prev.ID, prev.Created, prev.PID
+		journaled[dir] = e
+		return j.Update(e)
+	}
+	if e, err = j.Add(e); err != nil {
+		return err
+	}
+	journaled[dir] = e
+	// Registered after the copy's own cleanup, so it runs before the copy
+	// is removed.
+	owner.Cleanup(func() {
+		journaledMu.Lock()
+		e, ok := journaled[dir]
+		delete(journaled, dir)
+		journaledMu.Unlock()
+		if !ok || !j.Has(e.ID) {
+			return
+		}
+		if copied {
+			if _, err := j.Preserve(e, origin.root); err != nil {
+				owner.Errorf("keeping the state of an undestroyed deployment: %v", err)
+				return
+			}
+		}
+		owner.Logf("%s was not destroyed; it is recorded in %s as %s. Run `go run ./cmd/testcleanup resume` to destroy it.",
+			e.Source, j.Dir, e.ID)
+	})
+	return nil
+}
+
+// journalDestroyed removes options' deployment from the cleanup journal
+// after a successful destroy.
+func journalDestroyed(t *testing.T, options *terraform.Options) error {
+	t.Helper()
+	j, err := runJournal()
+	if j == nil {
+		return err
+	}
+	dir, err := filepath.Abs(options.TerraformDir)
+	if err != nil {
+		return err
+	}
+	journaledMu.Lock()
+	defer journaledMu.Unlock()
+	e, ok := journaled[dir]
+	if !ok {
+		return nil
+	}
+	delete(journaled, dir)
+	return j.Remove(e.ID)
+}
+
+// localStatePath is where the local backend keeps the state of the
+// workspace options select.
+func localStatePath(dir string, options *terraform.Options) string {
+	workspace := options.EnvVars["TF_WORKSPACE"]
+	if workspace == "" {
+		workspace = os.Getenv("TF_WORKSPACE")
+	}
+	if workspace == "" || workspace == "default" {
+		return filepath.Join(dir, "terraform.tfstate")
+	}
+	return filepath.Join(dir, "terraform.tfstate.d", workspace, "terraform.tfstate")
+}
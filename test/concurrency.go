@@ -0,0 +1,252 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/deadline"
+	"terraform-advanced-course/internal/limiter"
+	"terraform-advanced-course/internal/retryable"
+)
+
+// defaultConcurrency keeps a full parallel run under ARM's write throttling
+// and the subscription's quotas while letting the cheap phases overlap.
+const defaultConcurrency = "init=8,plan=4,apply=2,destroy=4"
+
+// terraformLimiter caps the terraform commands of each phase running at
+// once across the whole test run. TEST_TERRAFORM_CONCURRENCY overrides
+// the budgets, e.g. "apply=1" or "0" for no limits. A malformed value
+// leaves terraformLimiterErr set for TestMain to report.
+var terraformLimiter, terraformLimiterErr = newTerraformLimiter()
+
+func newTerraformLimiter() (*limiter.Limiter, error) {
+	spec, ok := os.LookupEnv("TEST_TERRAFORM_CONCURRENCY")
+	if !ok {
+		spec = defaultConcurrency
+	}
+	limits, err := limiter.Parse(spec)
+	if err != nil {
+		return limiter.New(nil), fmt.Errorf("TEST_TERRAFORM_CONCURRENCY=%q: %w", spec, err)
+	}
+	return limiter.New(limits), nil
+}
+
+// terraformRetrier retries terraform commands that fail with one of the
+// transient Azure errors in retryable.Default.
+var terraformRetrier = &retryable.Retrier{Catalog: retryable.Default}
+
+// inSlot runs one terraform phase once the limiter has a slot for it, and
+// logs how long the test queued apart from how long terraform ran. A
+// command that fails with a transient Azure error is run again after a
+// backoff, which it waits out without holding the slot. Neither waiting
+// for a slot nor a backoff outlasts ctx.
+func inSlot(ctx context.Context, t *testing.T, phase string, run func() error) error {
+	t.Helper()
+	return inSlotReplanning(ctx, t, phase, nil, run)
+}
+
+// inSlotReplanning is inSlot for applying a saved plan: before running
+// the apply again it runs replan, in a plan slot, to replace the plan the
+// failed attempt left stale. A nil replan makes it inSlot.
+func inSlotReplanning(ctx context.Context, t *testing.T, phase string, replan, run func() error) error {
+	t.Helper()
+	slotted := func(phase string, run func() error) (string, error) {
+		release, waited, err := terraformLimiter.Acquire(ctx, phase)
+		if err != nil {
+			return "", err
+		}
+		start := time.Now()
+		err = run()
+		release()
+		t.Logf("terraform %s: queued %s, ran %s", phase, waited.Round(time.Millisecond), time.Since(start).Round(time.Millisecond))
+		return "", err
+	}
+	var again func() error
+	if replan != nil {
+		again = func() error {
+			_, err := slotted(limiter.PhasePlan, replan)
+			return err
+		}
+	}
+	_, err := terraformRetrier.DoReplanning(ctx, phase,
+		func(r retryable.Retry) { t.Log(r) },
+		again,
+		func() (string, error) { return slotted(phase, run) })
+	return err
+}
+
+// The tf* helpers are the terratest functions of the same names, with
+// each phase run through terraformLimiter and stopped at the test's
+// deadline. Tests use them instead of calling terratest directly. The
+// *ContextE variants also stop at ctx: waiting for a slot or a retry
+// always, and the apply and destroy commands themselves by interrupting
+// terraform.
+
+func tfInit(t *testing.T, options *terraform.Options) string {
+	t.Helper()
+	out, err := tfInitE(t, options)
+	require.NoError(t, err)
+	return out
+}
+
+func tfInitE(t *testing.T, options *terraform.Options) (string, error) {
+	t.Helper()
+	return tfInitContextE(context.Background(), t, options)
+}
+
+func tfInitContextE(ctx context.Context, t *testing.T, options *terraform.Options) (out string, err error) {
+	t.Helper()
+	ctx, cancel := testSchedule(t).Context(ctx)
+	defer cancel()
+	err = inSlot(ctx, t, limiter.PhaseInit, func() error {
+		out, err = terraform.InitE(t, options)
+		return err
+	})
+	return out, err
+}
+
+func tfApply(t *testing.T, options *terraform.Options) string {
+	t.Helper()
+	out, err := tfApplyE(t, options)
+	require.NoError(t, err)
+	return out
+}
+
+// tfApplyE refuses to start an apply that is not expected to finish and
+// be destroyed before the test's deadline, and interrupts one that runs
+// into the time destroy needs. It first renames or purges around
+// soft-deleted key vaults, unless it applies a saved plan, which has its
+// names already, and records the deployment in the cleanup journal. A
+// saved plan is planned again before a retry, since the failed apply has
+// made it stale.
+func tfApplyE(t *testing.T, options *terraform.Options) (string, error) {
+	t.Helper()
+	return tfApplyContextE(context.Background(), t, options)
+}
+
+func tfApplyContextE(ctx context.Context, t *testing.T, options *terraform.Options) (out string, err error) {
+	t.Helper()
+	est, err := checkApplyDeadline(t, options)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := testSchedule(t).ApplyContext(ctx, est)
+	defer cancel()
+	if options.PlanFilePath == "" {
+		if err := avoidSoftDeletedVaults(ctx, t, options); err != nil {
+			return "", err
+		}
+	}
+	if err := journalApply(t, options); err != nil {
+		return "", err
+	}
+	var replan func() error
+	if options.PlanFilePath != "" {
+		replan = func() error {
+			_, err := runTerraformE(ctx, t, options, terraform.FormatArgs(options, "plan", "-input=false", "-lock=false")...)
+			return err
+		}
+	}
+	err = inSlotReplanning(ctx, t, limiter.PhaseApply, replan, func() error {
+		start := time.Now()
+		out, err = runTerraformE(ctx, t, options, terraform.FormatArgs(options, "apply", "-input=false", "-auto-approve")...)
+		if err == nil {
+			terraformTimings.Observe(timingKey(options), deadline.PhaseApply, time.Since(start))
+		}
+		return err
+	})
+	return out, err
+}
+
+func tfInitAndApply(t *testing.T, options *terraform.Options) string {
+	t.Helper()
+	out, err := tfInitAndApplyE(t, options)
+	require.NoError(t, err)
+	return out
+}
+
+func tfInitAndApplyE(t *testing.T, options *terraform.Options) (string, error) {
+	t.Helper()
+	if _, err := tfInitE(t, options); err != nil {
+		return "", err
+	}
+	return tfApplyE(t, options)
+}
+
+func tfInitAndPlan(t *testing.T, options *terraform.Options) string {
+	t.Helper()
+	_, err := tfInitE(t, options)
+	require.NoError(t, err)
+	ctx, cancel := testSchedule(t).Context(context.Background())
+	defer cancel()
+	var out string
+	err = inSlot(ctx, t, limiter.PhasePlan, func() error {
+		out, err = terraform.PlanE(t, options)
+		return err
+	})
+	require.NoError(t, err)
+	return out
+}
+
+// tfInitAndPlanAndShowContextE returns the plan as JSON; options must set
+// PlanFilePath.
+func tfInitAndPlanAndShowContextE(ctx context.Context, t *testing.T, options *terraform.Options) (string, error) {
+	t.Helper()
+	if options.PlanFilePath == "" {
+		return "", terraform.PlanFilePathRequired
+	}
+	if _, err := tfInitContextE(ctx, t, options); err != nil {
+		return "", err
+	}
+	ctx, cancel := testSchedule(t).Context(ctx)
+	defer cancel()
+	var out string
+	err := inSlot(ctx, t, limiter.PhasePlan, func() error {
+		if _, err := terraform.PlanE(t, options); err != nil {
+			return err
+		}
+		var err error
+		out, err = terraform.ShowE(t, options)
+		return err
+	})
+	return out, err
+}
+
+func tfDestroy(t *testing.T, options *terraform.Options) string {
+	t.Helper()
+	out, err := tfDestroyE(t, options)
+	require.NoError(t, err)
+	return out
+}
+
+// tfDestroyE runs destroy with all the time left before the test's
+// deadline, and removes the deployment from the cleanup journal once it
+// succeeds.
+func tfDestroyE(t *testing.T, options *terraform.Options) (string, error) {
+	t.Helper()
+	return tfDestroyContextE(context.Background(), t, options)
+}
+
+func tfDestroyContextE(ctx context.Context, t *testing.T, options *terraform.Options) (out string, err error) {
+	t.Helper()
+	ctx, cancel := testSchedule(t).Context(ctx)
+	defer cancel()
+	err = inSlot(ctx, t, limiter.PhaseDestroy, func() error {
+		start := time.Now()
+		out, err = runTerraformE(ctx, t, options, terraform.FormatArgs(options, "destroy", "-auto-approve", "-input=false")...)
+		if err == nil {
+			terraformTimings.Observe(timingKey(options), deadline.PhaseDestroy, time.Since(start))
+		}
+		return err
+	})
+	if err != nil {
+		return out, err
+	}
+	return out, journalDestroyed(t, options)
+}
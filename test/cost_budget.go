@@ -0,0 +1,130 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/cost"
+	"terraform-advanced-course/internal/plan"
+	"terraform-advanced-course/internal/tfstate"
+)
+
+// runBudget caps the projected monthly cost of everything this test run
+// deploys. TEST_COST_BUDGET sets the limit in catalog currency; when it is
+// unset every scenario is still priced and logged, but nothing is refused.
+// A malformed TEST_COST_BUDGET leaves runBudgetErr set, and TestMain stops
+// the run before any test starts.
+var runBudget, runBudgetErr = newRunBudget()
+
+func newRunBudget() (*cost.Budget, error) {
+	b := &cost.Budget{}
+	if v := os.Getenv("TEST_COST_BUDGET"); v != "" {
+		limit, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return b, fmt.Errorf("TEST_COST_BUDGET=%q is not a number", v)
+		}
+		b.Limit = limit
+	}
+	return b, nil
+}
+
+// initAndApplyWithinBudget is terraform.InitAndApply with a cost check: the
+// scenario is planned, priced against the local catalog and only applied if
+// it fits in what is left of the run's budget.
+func initAndApplyWithinBudget(t *testing.T, options *terraform.Options) string {
+	out, err := initAndApplyWithinBudgetE(t, options)
+	require.NoError(t, err)
+	return out
+}
+
+// initAndApplyWithinBudgetE is initAndApplyWithinBudget returning an error.
+// Nothing is planned or reserved for an apply the test's deadline leaves
+// no time for. Key vault names are checked against soft-deleted vaults
+// before the plan, and the saved plan is applied so that what runs is
+// exactly what was priced. An apply that fails before creating anything
+// gives its reservation back. options itself is left without a plan file,
+// so Output and Destroy work on it as usual.
+func initAndApplyWithinBudgetE(t *testing.T, options *terraform.Options) (string, error) {
+	return initAndApplyWithinBudgetContextE(context.Background(), t, options, "")
+}
+
+// initAndApplyWithinBudgetContextE is initAndApplyWithinBudgetE stopping
+// at ctx as well as at the test's deadline. The budget reservation is
+// named reservation, so that each of the deployments a test runs at once
+// is priced on its own; an empty name means t.Name().
+func initAndApplyWithinBudgetContextE(ctx context.Context, t *testing.T, options *terraform.Options, reservation string) (string, error) {
+	if reservation == "" {
+		reservation = t.Name()
+	}
+	timing, err := checkApplyDeadline(t, options)
+	if err != nil {
+		return "", err
+	}
+	vaultCtx, cancel := testSchedule(t).ApplyContext(ctx, timing)
+	defer cancel()
+	if err := avoidSoftDeletedVaults(vaultCtx, t, options); err != nil {
+		return "", err
+	}
+	planned, err := options.Clone()
+	if err != nil {
+		return "", err
+	}
+	planned.PlanFilePath = filepath.Join(t.TempDir(), "tfplan")
+
+	planJSON, err := tfInitAndPlanAndShowContextE(ctx, t, planned)
+	if err != nil {
+		return "", err
+	}
+	p, err := plan.ParseJSON([]byte(planJSON))
+	if err != nil {
+		return "", err
+	}
+	est := cost.EstimatePlan(p, cost.DefaultCatalog(), cost.Options{})
+	if n := len(est.Unpriced()); n > 0 {
+		t.Logf("%d resource(s) could not be priced and count as zero", n)
+	}
+
+	if err := runBudget.Reserve(reservation, est); err != nil {
+		return "", fmt.Errorf("refusing to apply: %w", err)
+	}
+	t.Logf("Projected cost: %.2f %s/month (run total %.2f)", est.Total, est.Currency, runBudget.Total())
+
+	out, err := tfApplyContextE(ctx, t, planned)
+	if err != nil && appliedNothing(ctx, t, options) {
+		runBudget.Release(reservation)
+	}
+	return out, err
+}
+
+// appliedNothing reports whether options' state manages no resources, as
+// after an apply refused or failed before creating any. When the state
+// cannot be read it reports false, so the reservation is kept.
+func appliedNothing(ctx context.Context, t *testing.T, options *terraform.Options) bool {
+	t.Helper()
+	// The apply may have failed because ctx ended; reading the state
+	// still has to happen.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	out, err := runTerraformE(ctx, t, options, "show", "-json", "-no-color")
+	if err != nil {
+		return false
+	}
+	st, err := tfstate.Parse([]byte(out))
+	if err != nil {
+		return false
+	}
+	for _, r := range st.Resources {
+		if r.Managed() {
+			return false
+		}
+	}
+	return true
+}
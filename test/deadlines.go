@@ -0,0 +1,160 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/deadline"
+)
+
+const (
+	// deadlineMargin is left before go test's -timeout for the test to
+	// report after its last destroy.
+	deadlineMargin = time.Minute
+
+	// interruptGrace is how long terraform gets to stop cleanly and
+	// write its state after an interrupt, before it is killed.
+	interruptGrace = 2 * time.Minute
+
+	defaultTerraformTimings = ".terraform-timings.json"
+)
+
+// defaultEstimate is what an apply and destroy never observed before are
+// expected to take, as TestPerformanceBenchmarks allows for the full
+// configuration.
+var defaultEstimate = deadline.Estimate{Apply: 15 * time.Minute, Destroy: 10 * time.Minute}
+
+// terraformTimings predicts applies and destroys from those of earlier
+// runs, kept in TEST_TERRAFORM_TIMINGS ("off" to keep none).
+var terraformTimings = newTerraformTimings()
+
+func newTerraformTimings() *deadline.Predictor {
+	file := os.Getenv("TEST_TERRAFORM_TIMINGS")
+	switch file {
+	case "off":
+		file = ""
+	case "":
+		file = defaultTerraformTimings
+	}
+	return &deadline.Predictor{File: file, Default: defaultEstimate}
+}
+
+// testSchedule is t's deadline, from go test's -timeout.
+func testSchedule(t *testing.T) deadline.Schedule {
+	d, _ := t.Deadline()
+	return deadline.Schedule{Deadline: d, Margin: deadlineMargin}
+}
+
+// timingKey names the configuration options deploy, the same for every
+// test and working copy of it.
+func timingKey(options *terraform.Options) string {
+	dir, _ := filepath.Abs(options.TerraformDir)
+	if origin, ok := workingCopyOrigin(dir); ok {
+		dir = origin.source
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, dir); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return dir
+}
+
+// checkApplyDeadline refuses an apply that is not expected to finish,
+// and be destroyed again, before the test's deadline.
+func checkApplyDeadline(t *testing.T, options *terraform.Options) (deadline.Estimate, error) {
+	t.Helper()
+	est := terraformTimings.Predict(timingKey(options))
+	if err := testSchedule(t).CanApply(est); err != nil {
+		return est, fmt.Errorf("refusing to apply %s: %w", timingKey(options), err)
+	}
+	return est, nil
+}
+
+// runTerraformE is terraform.RunTerraformCommandE with a context. When
+// ctx ends, terraform is interrupted, which makes it stop starting new
+// operations and save its state, and killed if it has not exited after
+// interruptGrace.
+func runTerraformE(ctx context.Context, t *testing.T, options *terraform.Options, args ...string) (string, error) {
+	t.Helper()
+	options, args = terraform.GetCommonOptions(options, args...)
+	description := fmt.Sprintf("%s %v", options.TerraformBinary, args)
+	return retry.DoWithRetryableErrorsE(t, description, options.RetryableTerraformErrors, options.MaxRetries, options.TimeBetweenRetries, func() (string, error) {
+		options.Logger.Logf(t, "Running command %s with args %s", options.TerraformBinary, args)
+		cmd := exec.CommandContext(ctx, options.TerraformBinary, args...)
+		cmd.Dir = options.TerraformDir
+		cmd.Env = os.Environ()
+		for name, value := range options.EnvVars {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+		cmd.Cancel = func() error {
+			if err := cmd.Process.Signal(os.Interrupt); err != nil {
+				return cmd.Process.Kill()
+			}
+			return nil
+		}
+		cmd.WaitDelay = interruptGrace
+
+		var combined, stderr lockedBuffer
+		logLines := func(r io.Reader) {
+			sc := bufio.NewScanner(r)
+			sc.Buffer(make([]byte, 64*1024), 1024*1024)
+			for sc.Scan() {
+				options.Logger.Logf(t, "%s", sc.Text())
+			}
+		}
+		outR, outW := io.Pipe()
+		errR, errW := io.Pipe()
+		cmd.Stdout = io.MultiWriter(&combined, outW)
+		cmd.Stderr = io.MultiWriter(&combined, &stderr, errW)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); logLines(outR) }()
+		go func() { defer wg.Done(); logLines(errR) }()
+
+		err := cmd.Run()
+		outW.Close()
+		errW.Close()
+		wg.Wait()
+		if ctx.Err() != nil {
+			// An interrupted command is not run again, whatever it printed.
+			err = fmt.Errorf("error while running command: %w (terraform interrupted: %v); %s", err, ctx.Err(), stderr.String())
+			return combined.String(), retry.FatalError{Underlying: err}
+		}
+		if err != nil {
+			return combined.String(), fmt.Errorf("error while running command: %w; %s", err, stderr.String())
+		}
+		return combined.String(), nil
+	})
+}
+
+// lockedBuffer is a bytes.Buffer two output streams can write to.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimRight(b.buf.String(), "\n")
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/deploypool"
+)
+
+// terraformDeployment deploys options for a deploypool.Pool: apply within
+// the cost budget, read outputNames, destroy. The hooks return errors
+// rather than failing t, so they are safe on the pool's goroutines; build
+// options with guardedOptions on the test goroutine beforehand. Apply and
+// destroy stop at the contexts the pool gives them, so its Timeout and
+// DestroyTimeout interrupt terraform. Each deployment reserves its own
+// share of the cost budget, as t.Name()/name.
+func terraformDeployment(t *testing.T, name string, options *terraform.Options, outputNames ...string) deploypool.Deployment {
+	return deploypool.Deployment{
+		Name: name,
+		Apply: func(ctx context.Context) error {
+			_, err := initAndApplyWithinBudgetContextE(ctx, t, options, t.Name()+"/"+name)
+			return err
+		},
+		Outputs: func(context.Context) (map[string]string, error) {
+			outputs := make(map[string]string, len(outputNames))
+			for _, n := range outputNames {
+				v, err := terraform.OutputE(t, options, n)
+				if err != nil {
+					return outputs, err
+				}
+				outputs[n] = v
+			}
+			return outputs, nil
+		},
+		Destroy: func(ctx context.Context) error {
+			_, err := tfDestroyContextE(ctx, t, options)
+			return err
+		},
+	}
+}
+
+// reportDeployments reports each result as a subtest of t named after its
+// deployment and runs check on the outputs of those that deployed.
+func reportDeployments(t *testing.T, results []deploypool.Result, check func(t *testing.T, outputs map[string]string)) {
+	t.Helper()
+	for _, r := range results {
+		r := r
+		t.Run(r.Name, func(t *testing.T) {
+			if !r.Started {
+				t.Fatalf("never deployed: %v", r.Err)
+			}
+			t.Logf("applied in %s, destroyed in %s", r.Applied.Round(time.Second), r.Destroyed.Round(time.Second))
+			if r.DestroyErr != nil {
+				t.Errorf("destroy: %v", r.DestroyErr)
+			}
+			if r.Err != nil {
+				t.Fatalf("deploy: %v", r.Err)
+			}
+			if check != nil {
+				check(t, r.Outputs)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"terraform-advanced-course/internal/workdir"
+)
+
+type workingCopyKey struct {
+	t   *testing.T
+	dir string
+}
+
+var (
+	workingCopiesMu sync.Mutex
+	workingCopies   = map[workingCopyKey]string{}
+
+	// separateCopies holds the copies made by separateDir, which
+	// isolatedDir hands back as they are.
+	separateCopies = map[string]bool{}
+
+	// copyOrigins maps each copy to where it came from.
+	copyOrigins = map[string]copyOrigin{}
+)
+
+// copyOrigin is the directory a working copy was made from, the
+// temporary directory holding the copy and the local modules it calls, and
+// the test that made it, whose end removes it. Subtests of owner may use
+// the copy, but it outlives them.
+type copyOrigin struct {
+	source string
+	root   string
+	owner  *testing.T
+}
+
+// isolatedDir returns the test's private copy of a terraform directory,
+// made with internal/workdir under t.TempDir() and removed with it. All
+// options a test builds for the same directory share one copy, so a test
+// can still init with one set of options and validate or destroy with
+// another.
+func isolatedDir(t *testing.T, dir string) string {
+	t.Helper()
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := workingCopyKey{t, abs}
+
+	workingCopiesMu.Lock()
+	defer workingCopiesMu.Unlock()
+	if separateCopies[abs] {
+		return abs
+	}
+	if copied, ok := workingCopies[key]; ok {
+		return copied
+	}
+	root := t.TempDir()
+	copied, err := workdir.Copy(abs, root)
+	if err != nil {
+		t.Fatalf("copying %s: %v", dir, err)
+	}
+	workingCopies[key] = copied
+	copyOrigins[copied] = copyOrigin{source: abs, root: root, owner: t}
+	t.Cleanup(func() {
+		workingCopiesMu.Lock()
+		defer workingCopiesMu.Unlock()
+		delete(workingCopies, key)
+		delete(copyOrigins, copied)
+	})
+	t.Logf("Running %s in %s", dir, copied)
+	return copied
+}
+
+// separateDir returns a new copy of a terraform directory that no other
+// options share, for a test that deploys the same directory several times
+// at once. Each copy has its own .terraform directory and local state.
+func separateDir(t *testing.T, dir string) string {
+	t.Helper()
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	copied, err := workdir.Copy(abs, root)
+	if err != nil {
+		t.Fatalf("copying %s: %v", dir, err)
+	}
+	workingCopiesMu.Lock()
+	defer workingCopiesMu.Unlock()
+	separateCopies[copied] = true
+	copyOrigins[copied] = copyOrigin{source: abs, root: root, owner: t}
+	t.Cleanup(func() {
+		workingCopiesMu.Lock()
+		defer workingCopiesMu.Unlock()
+		delete(separateCopies, copied)
+		delete(copyOrigins, copied)
+	})
+	t.Logf("Running %s in %s", dir, copied)
+	return copied
+}
+
+// workingCopyOrigin returns where a working copy made by isolatedDir or
+// separateDir came from.
+func workingCopyOrigin(dir string) (copyOrigin, bool) {
+	workingCopiesMu.Lock()
+	defer workingCopiesMu.Unlock()
+	origin, ok := copyOrigins[dir]
+	return origin, ok
+}
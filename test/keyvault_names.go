@@ -0,0 +1,107 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/softdelete"
+)
+
+const (
+	// defaultKeyVaultPolicy leaves deleted vaults alone: purging is
+	// permanent, so it has to be asked for.
+	defaultKeyVaultPolicy = softdelete.PolicyRename
+
+	defaultKeyVaultJournal = "keyvault_purges.jsonl"
+)
+
+var (
+	keyVaultResolverOnce sync.Once
+	keyVaultResolver     *softdelete.Resolver
+	keyVaultResolverErr  error
+)
+
+// keyVaults returns the run's soft-deleted vault resolver, or nil when
+// the run has no Azure credentials and so applies nothing. It resolves
+// the credentials itself, so it does not depend on a test having asked
+// for them first. TEST_KEYVAULT_COLLISIONS sets the policy (rename, purge
+// or fail) and TEST_KEYVAULT_JOURNAL the file purges are recorded in.
+func keyVaults() (*softdelete.Resolver, error) {
+	keyVaultResolverOnce.Do(func() {
+		cred, err := resolveAzureCredential()
+		if errors.Is(err, azauth.ErrNoCredentials) {
+			return
+		}
+		if err != nil {
+			keyVaultResolverErr = err
+			return
+		}
+		policy := defaultKeyVaultPolicy
+		if s := os.Getenv("TEST_KEYVAULT_COLLISIONS"); s != "" {
+			if policy, keyVaultResolverErr = softdelete.ParsePolicy(s); keyVaultResolverErr != nil {
+				return
+			}
+		}
+		journal := os.Getenv("TEST_KEYVAULT_JOURNAL")
+		if journal == "" {
+			journal = defaultKeyVaultJournal
+		}
+		keyVaultResolver = &softdelete.Resolver{
+			Vaults:  cred.Client(),
+			Policy:  policy,
+			Journal: &softdelete.Journal{File: journal},
+		}
+	})
+	return keyVaultResolver, keyVaultResolverErr
+}
+
+// avoidSoftDeletedVaults checks the key vault names in options' vars
+// against the subscription's soft-deleted vaults before apply, and renames
+// or purges around a collision according to the policy. A renamed vault's
+// var is updated in options, so outputs and destroy see the new name.
+// Waiting for a purge to finish stops at ctx.
+func avoidSoftDeletedVaults(ctx context.Context, t *testing.T, options *terraform.Options) error {
+	t.Helper()
+	resolver, err := keyVaults()
+	if err != nil || resolver == nil {
+		return err
+	}
+	for name, value := range options.Vars {
+		vault, ok := value.(string)
+		if !ok || !strings.Contains(name, "key_vault_name") {
+			continue
+		}
+		res, err := resolver.Resolve(ctx, t.Name(), vault)
+		if err != nil {
+			return err
+		}
+		switch res.Action {
+		case softdelete.ActionRenamed:
+			t.Logf("Key vault name %q is held by a soft-deleted vault in %s; deploying as %q", vault, res.Collision.Properties.Location, res.Name)
+			if res.Reason != "" {
+				t.Logf("Not purged: %s", res.Reason)
+			}
+			options.Vars[name] = res.Name
+		case softdelete.ActionPurged:
+			t.Logf("Purged soft-deleted key vault %q in %s (recorded in %s)", vault, res.Collision.Properties.Location, resolver.Journal.File)
+		}
+	}
+	return nil
+}
+
+// writeKeyVaultSummary lists the vaults the run purged.
+func writeKeyVaultSummary() {
+	if keyVaultResolver != nil {
+		if err := keyVaultResolver.Journal.WriteSummary(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "key vault journal:", err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain checks the harness's TEST_* settings, prewarms the provider
+// plugin cache, and prints the run's
+// projected cost, terraform queueing, retries, cache hits and purged key
+// vaults once every test has finished. The terraform timings observed are
+// saved for the next run's deadline checks.
+func TestMain(m *testing.M) {
+	for _, err := range settingsErrors() {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "test settings:", err)
+			os.Exit(2)
+		}
+	}
+	prewarmPluginCache()
+	code := m.Run()
+	runBudget.WriteSummary(os.Stdout)
+	terraformLimiter.WriteSummary(os.Stdout)
+	terraformRetrier.WriteSummary(os.Stdout)
+	if pluginCache != nil {
+		pluginCache.WriteSummary(os.Stdout)
+	}
+	writeKeyVaultSummary()
+	if err := terraformTimings.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "saving terraform timings:", err)
+	}
+	os.Exit(code)
+}
+
+// settingsErrors are the errors reading the harness's TEST_* environment
+// variables. The variables are read when the package is initialised, so
+// the errors are kept for TestMain to report.
+func settingsErrors() []error {
+	return []error{runBudgetErr, terraformLimiterErr, resourceTTLErr}
+}
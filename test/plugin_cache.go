@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/plugincache"
+)
+
+// pluginCache is the provider plugin cache every test's init uses:
+// TF_PLUGIN_CACHE_DIR when set, else ~/.terraform.d/plugin-cache. It is
+// shared with other go test processes on the machine through a file lock.
+// TEST_PLUGIN_CACHE=off leaves each init to download its own providers.
+var pluginCache = openPluginCache()
+
+func openPluginCache() *plugincache.Cache {
+	if os.Getenv("TEST_PLUGIN_CACHE") == "off" {
+		return nil
+	}
+	dir := os.Getenv("TF_PLUGIN_CACHE_DIR")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "plugin cache disabled: %v\n", err)
+			return nil
+		}
+		dir = filepath.Join(home, ".terraform.d", "plugin-cache")
+	}
+	c, err := plugincache.Open(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "plugin cache disabled: %v\n", err)
+		return nil
+	}
+	c.Binary = terraform.DefaultExecutable
+	return c
+}
+
+// prewarmPluginCache installs every provider pinned by the repository's
+// lock files before the tests start, so parallel tests find them cached.
+// Failing to is not fatal: each test then installs what it misses.
+func prewarmPluginCache() {
+	if pluginCache == nil {
+		return
+	}
+	var lockFiles []string
+	for _, pattern := range []string{"..", "../modules/*", "./fixtures/*"} {
+		matches, _ := filepath.Glob(filepath.Join(pattern, plugincache.LockFile))
+		lockFiles = append(lockFiles, matches...)
+	}
+	var providers []plugincache.Provider
+	for _, file := range lockFiles {
+		locked, err := plugincache.LockedProviders(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "plugin cache: %v\n", err)
+			continue
+		}
+		providers = append(providers, locked...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	installed, err := pluginCache.Warm(ctx, providers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "plugin cache: prewarming failed, tests will install providers themselves: %v\n", err)
+		return
+	}
+	if len(installed) > 0 {
+		fmt.Printf("Prewarmed plugin cache %s with %d provider release(s)\n", pluginCache.Dir, len(installed))
+	}
+}
+
+// usePluginCache points options at the shared plugin cache once every
+// provider its directory needs is in it.
+func usePluginCache(t *testing.T, options *terraform.Options) {
+	t.Helper()
+	if pluginCache == nil {
+		return
+	}
+	if err := pluginCache.Prepare(context.Background(), options.TerraformDir); err != nil {
+		t.Fatal(err)
+	}
+	if options.EnvVars == nil {
+		options.EnvVars = map[string]string{}
+	}
+	options.EnvVars["TF_PLUGIN_CACHE_DIR"] = pluginCache.Dir
+}
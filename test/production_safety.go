@@ -0,0 +1,144 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/azauth"
+	"terraform-advanced-course/internal/safety"
+	"terraform-advanced-course/internal/tfconfig"
+)
+
+// defaultDenylist names production for this repository. TEST_PRODUCTION_DENYLIST
+// points at another file; a denylist that cannot be read fails every test.
+const defaultDenylist = "production_denylist.json"
+
+var (
+	denylistOnce sync.Once
+	denylist     *safety.Denylist
+	denylistErr  error
+)
+
+func productionDenylist() (*safety.Denylist, error) {
+	denylistOnce.Do(func() {
+		file := os.Getenv("TEST_PRODUCTION_DENYLIST")
+		if file == "" {
+			file = defaultDenylist
+		}
+		denylist, denylistErr = safety.LoadDenylist(file)
+		if denylistErr != nil {
+			denylistErr = fmt.Errorf("production denylist: %w", denylistErr)
+		}
+	})
+	return denylist, denylistErr
+}
+
+// guardedOptions is how every test builds its terraform options. It fails
+// the test when the subscription, workspace, resource groups or backend
+// state key it would use match the production denylist. The subscription
+// includes the one the run's credentials resolve to, whether or not the
+// test has asked for them yet; credentials that cannot be resolved fail
+// any test of an azurerm configuration. It then points
+// TerraformDir at the test's own copy of the directory (see isolatedDir),
+// and unless the test configures a backend itself, the copy gets a local
+// backend override, so test state never lands in the backend the
+// configuration declares, production or not. Finally the options get the
+// shared provider plugin cache (see pluginCache) and a tag saying when the
+// janitor may delete what they deploy (see tagWithTTL).
+func guardedOptions(t *testing.T, options *terraform.Options) *terraform.Options {
+	t.Helper()
+	d, err := productionDenylist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := resolveAzureCredential()
+	if err != nil && !errors.Is(err, azauth.ErrNoCredentials) && usesAzurerm(options.TerraformDir) {
+		t.Fatalf("production safety: cannot tell which subscription %s would deploy to: %v", options.TerraformDir, err)
+	}
+	if err := d.Check(safetyTarget(options, cred)); err != nil {
+		t.Fatal(err)
+	}
+
+	options.TerraformDir = isolatedDir(t, options.TerraformDir)
+	if len(options.BackendConfig) == 0 {
+		release, err := safety.OverrideBackend(options.TerraformDir)
+		if err != nil {
+			t.Fatalf("overriding the backend in %s: %v", options.TerraformDir, err)
+		}
+		t.Cleanup(release)
+		options.Reconfigure = true
+	}
+	usePluginCache(t, options)
+	tagWithTTL(t, options)
+	return options
+}
+
+// safetyTarget collects what options would touch, deploying with cred
+// (nil without credentials). Resource groups are the string values of
+// variables whose name mentions resource_group; the backend key is only
+// known when the test sets a backend configuration.
+func safetyTarget(options *terraform.Options, cred *azauth.Credential) safety.Target {
+	var target safety.Target
+
+	if v, ok := options.Vars["subscription_id"].(string); ok {
+		target.Subscriptions = append(target.Subscriptions, v)
+	}
+	target.Subscriptions = append(target.Subscriptions,
+		options.EnvVars["ARM_SUBSCRIPTION_ID"],
+		os.Getenv("ARM_SUBSCRIPTION_ID"),
+		os.Getenv("AZURE_SUBSCRIPTION_ID"))
+	if cred != nil {
+		target.Subscriptions = append(target.Subscriptions, cred.SubscriptionID)
+	}
+
+	workspace := options.EnvVars["TF_WORKSPACE"]
+	if workspace == "" {
+		workspace = os.Getenv("TF_WORKSPACE")
+	}
+	if workspace == "" {
+		workspace = "default"
+	}
+	target.Workspaces = []string{workspace}
+
+	names := make([]string, 0, len(options.Vars))
+	for name := range options.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v, ok := options.Vars[name].(string); ok && strings.Contains(name, "resource_group") {
+			target.ResourceGroups = append(target.ResourceGroups, v)
+		}
+	}
+
+	if len(options.BackendConfig) > 0 {
+		if key, ok := options.BackendConfig["key"].(string); ok {
+			target.BackendKeys = append(target.BackendKeys, key)
+		} else if cfg, err := tfconfig.Load(options.TerraformDir); err == nil {
+			target.BackendKeys = append(target.BackendKeys, cfg.BackendConfig["key"])
+		}
+	}
+	return target
+}
+
+// usesAzurerm reports whether the configuration in dir requires the
+// azurerm provider, or cannot be read to tell.
+func usesAzurerm(dir string) bool {
+	cfg, err := tfconfig.Load(dir)
+	if err != nil {
+		return true
+	}
+	for name, req := range cfg.RequiredProviders {
+		if name == "azurerm" || strings.HasSuffix(req.Source, "/azurerm") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/janitor"
+)
+
+// defaultResourceTTL is how long after a test starts its deployments may
+// be deleted by `go run ./cmd/testcleanup janitor`: well past the longest
+// test timeout in the Makefile.
+const defaultResourceTTL = 6 * time.Hour
+
+// resourceTTL is TEST_RESOURCE_TTL, or defaultResourceTTL. A malformed
+// value leaves resourceTTLErr set for TestMain to report.
+var resourceTTL, resourceTTLErr = newResourceTTL()
+
+func newResourceTTL() (time.Duration, error) {
+	spec := os.Getenv("TEST_RESOURCE_TTL")
+	if spec == "" {
+		return defaultResourceTTL, nil
+	}
+	d, err := time.ParseDuration(spec)
+	if err != nil || d <= 0 {
+		return defaultResourceTTL, fmt.Errorf("TEST_RESOURCE_TTL=%q: not a positive duration", spec)
+	}
+	return d, nil
+}
+
+var tagsVariable = regexp.MustCompile(`(?m)^\s*variable\s+"tags"\s*\{`)
+
+// tagWithTTL adds janitor.TTLTag to the tags options deploy with, so the
+// janitor can tell a leaked deployment from one still in use. Options
+// that set no tags get the tag alone when their configuration declares a
+// tags variable; configurations without one are left as they are.
+func tagWithTTL(t *testing.T, options *terraform.Options) {
+	t.Helper()
+	expires := time.Now().Add(resourceTTL).UTC().Format(time.RFC3339)
+	switch tags := options.Vars["tags"].(type) {
+	case map[string]string:
+		merged := map[string]string{janitor.TTLTag: expires}
+		for k, v := range tags {
+			merged[k] = v
+		}
+		options.Vars["tags"] = merged
+		return
+	case map[string]interface{}:
+		merged := map[string]interface{}{janitor.TTLTag: expires}
+		for k, v := range tags {
+			merged[k] = v
+		}
+		options.Vars["tags"] = merged
+		return
+	case nil:
+	default:
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(options.TerraformDir, "*.tf"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil || !tagsVariable.Match(data) {
+			continue
+		}
+		if options.Vars == nil {
+			options.Vars = map[string]interface{}{}
+		}
+		options.Vars["tags"] = map[string]string{janitor.TTLTag: expires}
+		return
+	}
+}
@@ -13,7 +13,7 @@ func TestDisasterRecoveryBasics(t *testing.T) {
 	// This tests the disaster recovery modules and configurations
 	// without actually deploying resources to avoid Azure SDK compatibility issues
 
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/storage",
 		Vars: map[string]interface{}{
 			"storage_account_name":     "drteststa" + generateRandomString(6),
@@ -23,16 +23,16 @@ func TestDisasterRecoveryBasics(t *testing.T) {
 			"storage_container_name":   "drtest-container",
 		},
 		NoColor: true,
-	})
+	}))
 
 	// Test the configuration by initializing and validating
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Use basic validate to check Terraform syntax and configuration
-	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/storage",
 		NoColor:      true,
-	})
+	}))
 	terraform.RunTerraformCommand(t, emptyTerraformOptions, "validate")
 
 	// Note: Skip plan step as modules require provider configuration from root module
@@ -43,7 +43,7 @@ func TestBackupConfiguration(t *testing.T) {
 	t.Parallel()
 
 	// Test backup configuration for key vault
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/keyvault",
 		Vars: map[string]interface{}{
 			"key_vault_name":             "backup-test-kv-" + generateRandomString(6),
@@ -54,16 +54,16 @@ func TestBackupConfiguration(t *testing.T) {
 			"enable_rbac_authorization":  true,
 		},
 		NoColor: true,
-	})
+	}))
 
 	// Test the configuration
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Use basic validate to check Terraform syntax and configuration
-	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/keyvault",
 		NoColor:      true,
-	})
+	}))
 	terraform.RunTerraformCommand(t, emptyTerraformOptions, "validate")
 
 	// Note: Skip plan step as modules require provider configuration from root module
@@ -74,7 +74,7 @@ func TestRecoveryTimeObjective(t *testing.T) {
 	t.Parallel()
 
 	// Test RTO configuration for web app
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/webapp",
 		Vars: map[string]interface{}{
 			"app_service_plan_name": "rto-test-asp",
@@ -86,16 +86,16 @@ func TestRecoveryTimeObjective(t *testing.T) {
 			"minimum_tls_version":   "1.2",
 		},
 		NoColor: true,
-	})
+	}))
 
 	// Test the configuration
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Use basic validate to check Terraform syntax and configuration
-	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/webapp",
 		NoColor:      true,
-	})
+	}))
 	terraform.RunTerraformCommand(t, emptyTerraformOptions, "validate")
 
 	// Note: Skip plan step as modules require provider configuration from root module
@@ -106,7 +106,7 @@ func TestDataReplicationConfiguration(t *testing.T) {
 	t.Parallel()
 
 	// Test data replication configuration for storage
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/storage",
 		Vars: map[string]interface{}{
 			"storage_account_name":     "replicsta" + generateRandomString(6),
@@ -118,16 +118,16 @@ func TestDataReplicationConfiguration(t *testing.T) {
 			"container_access_type":    "private",
 		},
 		NoColor: true,
-	})
+	}))
 
 	// Test the configuration
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Use basic validate to check Terraform syntax and configuration
-	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/storage",
 		NoColor:      true,
-	})
+	}))
 	terraform.RunTerraformCommand(t, emptyTerraformOptions, "validate")
 
 	// Note: Skip plan step as modules require provider configuration from root module
@@ -138,7 +138,7 @@ func TestNetworkFailoverConfiguration(t *testing.T) {
 	t.Parallel()
 
 	// Test network failover configuration
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/network",
 		Vars: map[string]interface{}{
 			"virtual_network_name":    "failover-test-vnet",
@@ -150,16 +150,16 @@ func TestNetworkFailoverConfiguration(t *testing.T) {
 			"nsg_name":                "failover-nsg",
 		},
 		NoColor: true,
-	})
+	}))
 
 	// Test the configuration
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Use basic validate to check Terraform syntax and configuration
-	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/network",
 		NoColor:      true,
-	})
+	}))
 	terraform.RunTerraformCommand(t, emptyTerraformOptions, "validate")
 
 	// Note: Skip plan step as modules require provider configuration from root module
@@ -168,19 +168,19 @@ func TestNetworkFailoverConfiguration(t *testing.T) {
 
 // Test helpers for disaster recovery scenarios
 func validateDRConfiguration(t *testing.T, terraformDir string, vars map[string]interface{}) {
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: terraformDir,
 		Vars:         vars,
 		NoColor:      true,
-	})
+	}))
 
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Use basic validate to check Terraform syntax and configuration
-	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+	emptyTerraformOptions := terraform.WithDefaultRetryableErrors(t, guardedOptions(t, &terraform.Options{
 		TerraformDir: terraformDir,
 		NoColor:      true,
-	})
+	}))
 	terraform.RunTerraformCommand(t, emptyTerraformOptions, "validate")
 
 	t.Log("DR configuration validation completed for", terraformDir)
@@ -2,7 +2,6 @@ package test
 
 import (
 	"fmt"
-	"os"
 	"strings"
 	"testing"
 
@@ -18,19 +17,17 @@ func TestNetworkModule(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping network module test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	// Get the shared resource group name
 	resourceGroupName := GetSharedResourceGroup(t)
 	location := sharedLocation
 
 	// Create resource group for testing
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/network",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":         subscriptionID,
 			"resource_group_name":     resourceGroupName,
@@ -45,15 +42,15 @@ func TestNetworkModule(t *testing.T) {
 				"Purpose":     "terratest",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
 
 	// Resource group would normally be created by main infrastructure
 	// For this test, we assume it exists or will be created by the module
 
 	// Deploy the network module
-	terraform.InitAndApply(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get outputs
 	vnetName := terraform.Output(t, terraformOptions, "virtual_network_name")
@@ -83,17 +80,15 @@ func TestStorageModule(t *testing.T) {
 		storageAccountSuffix = storageAccountSuffix[:10]
 	}
 
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping storage module test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	resourceGroupName := GetSharedResourceGroup(t)
 	location := sharedLocation
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/storage",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":          subscriptionID,
 			"resource_group_name":      resourceGroupName,
@@ -108,10 +103,10 @@ func TestStorageModule(t *testing.T) {
 				"Purpose":     "terratest",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get outputs
 	storageAccountName := terraform.Output(t, terraformOptions, "storage_account_name")
@@ -132,17 +127,15 @@ func TestWebAppModule(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping webapp module test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	resourceGroupName := GetSharedResourceGroup(t)
 	location := sharedLocation
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/webapp",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":       subscriptionID,
 			"resource_group_name":   resourceGroupName,
@@ -162,10 +155,10 @@ func TestWebAppModule(t *testing.T) {
 				"Purpose":     "terratest",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get outputs
 	webAppName := terraform.Output(t, terraformOptions, "web_app_name")
@@ -185,17 +178,15 @@ func TestKeyVaultModule(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping keyvault module test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	resourceGroupName := GetSharedResourceGroup(t)
 	location := sharedLocation
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/keyvault",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":            subscriptionID,
 			"resource_group_name":        resourceGroupName,
@@ -210,10 +201,10 @@ func TestKeyVaultModule(t *testing.T) {
 				"Purpose":     "terratest",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get outputs
 	keyVaultName := terraform.Output(t, terraformOptions, "key_vault_name")
@@ -229,7 +220,7 @@ func TestKeyVaultModule(t *testing.T) {
 func TestTaggingModule(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/tagging",
 		Vars: map[string]interface{}{
 			"environment":       "test",
@@ -238,10 +229,10 @@ func TestTaggingModule(t *testing.T) {
 			"cost_center":       "12345",
 			"terraform_version": "v1.12",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get outputs and verify tags
 	tags := terraform.OutputMap(t, terraformOptions, "tags")
@@ -258,18 +249,15 @@ func TestTaggingModule(t *testing.T) {
 func TestModulesIntegration(t *testing.T) {
 	t.Parallel()
 
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping integration test.")
-	}
+	cred := azureCredential(t)
 
 	// Get the shared resource group name
 	resourceGroupName := GetSharedResourceGroup(t)
 
 	// Test naming module first - using shared resource group
-	namingOptions := &terraform.Options{
+	namingOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/naming",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"prefix":         "tf",
 			"environment":    "test",
@@ -280,18 +268,19 @@ func TestModulesIntegration(t *testing.T) {
 				"Team": "DevOps",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, namingOptions)
-	terraform.InitAndApply(t, namingOptions)
+	defer tfDestroy(t, namingOptions)
+	tfInitAndApply(t, namingOptions)
 
 	// Get naming outputs
 	resourceGroupOutput := terraform.Output(t, namingOptions, "resource_group")
 	storageAccountName := terraform.Output(t, namingOptions, "storage_account")
 
 	// Test naming module without specifying resource group (to test generation)
-	namingGenerationOptions := &terraform.Options{
+	namingGenerationOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/naming",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"prefix":         "tf",
 			"environment":    "test",
@@ -302,17 +291,18 @@ func TestModulesIntegration(t *testing.T) {
 				"Team": "DevOps",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, namingGenerationOptions)
-	terraform.InitAndApply(t, namingGenerationOptions)
+	defer tfDestroy(t, namingGenerationOptions)
+	tfInitAndApply(t, namingGenerationOptions)
 
 	// Get generated naming outputs
 	generatedResourceGroupName := terraform.Output(t, namingGenerationOptions, "resource_group")
 
 	// Test tagging module
-	taggingOptions := &terraform.Options{
+	taggingOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/tagging",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"environment":       "test",
 			"project_name":      "integration-test",
@@ -320,10 +310,10 @@ func TestModulesIntegration(t *testing.T) {
 			"cost_center":       "12345",
 			"terraform_version": "v1.12",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, taggingOptions)
-	terraform.InitAndApply(t, taggingOptions)
+	defer tfDestroy(t, taggingOptions)
+	tfInitAndApply(t, taggingOptions)
 
 	// Verify that when resource_group is provided, it returns the same name
 	assert.Equal(t, resourceGroupName, resourceGroupOutput, "Naming module should return the provided resource group name")
@@ -1,8 +1,8 @@
 package test
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"strings"
 	"testing"
 	"time"
@@ -12,6 +12,8 @@ import (
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/deploypool"
 )
 
 // TestPerformanceBenchmarks tests deployment and destruction times
@@ -21,14 +23,12 @@ func TestPerformanceBenchmarks(t *testing.T) {
 	}
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping performance test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":        subscriptionID,
 			"resource_group_name":    fmt.Sprintf("rg-perf-%s", uniqueID),
@@ -48,12 +48,12 @@ func TestPerformanceBenchmarks(t *testing.T) {
 			"owner":                  "perf-team",
 			"cost_center":            "11111",
 		},
-	}
+	})
 
 	// Benchmark deployment time
 	t.Run("DeploymentTime", func(t *testing.T) {
 		start := time.Now()
-		terraform.InitAndApply(t, terraformOptions)
+		initAndApplyWithinBudget(t, terraformOptions)
 		deploymentTime := time.Since(start)
 
 		t.Logf("Infrastructure deployment time: %v", deploymentTime)
@@ -66,7 +66,7 @@ func TestPerformanceBenchmarks(t *testing.T) {
 	// Benchmark destruction time
 	t.Run("DestructionTime", func(t *testing.T) {
 		start := time.Now()
-		terraform.Destroy(t, terraformOptions)
+		tfDestroy(t, terraformOptions)
 		destructionTime := time.Since(start)
 
 		t.Logf("Infrastructure destruction time: %v", destructionTime)
@@ -82,14 +82,12 @@ func TestScalabilityLimits(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping scalability test.")
-	}
-
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":        subscriptionID,
 			"resource_group_name":    fmt.Sprintf("rg-scale-%s", uniqueID),
@@ -109,10 +107,10 @@ func TestScalabilityLimits(t *testing.T) {
 			"owner":                  "scale-team",
 			"cost_center":            "22222",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	initAndApplyWithinBudget(t, terraformOptions)
 
 	resourceGroupName := terraform.Output(t, terraformOptions, "resource_group_name")
 
@@ -151,14 +149,12 @@ func TestResourceLimits(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping resource limits test.")
-	}
-
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":        subscriptionID,
 			"resource_group_name":    fmt.Sprintf("rg-limits-%s", uniqueID),
@@ -178,10 +174,10 @@ func TestResourceLimits(t *testing.T) {
 			"owner":                  "limits-team",
 			"cost_center":            "33333",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	initAndApplyWithinBudget(t, terraformOptions)
 
 	// Test resource naming limits
 	storageAccountName := terraform.Output(t, terraformOptions, "storage_account_name")
@@ -215,64 +211,50 @@ func TestConcurrentDeployments(t *testing.T) {
 		t.Skip("Skipping concurrent deployment test in short mode")
 	}
 
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping concurrent deployment test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	numDeployments := 3
-	results := make(chan bool, numDeployments)
-
-	for i := 0; i < numDeployments; i++ {
-		go func(deploymentIndex int) {
-			uniqueID := random.UniqueId()
-
-			terraformOptions := &terraform.Options{
-				TerraformDir: "../",
-				Vars: map[string]interface{}{
-					"subscription_id":        subscriptionID,
-					"resource_group_name":    fmt.Sprintf("rg-concurrent-%d-%s", deploymentIndex, uniqueID),
-					"location":               "westeurope",
-					"storage_account_name":   fmt.Sprintf("stconc%d%s", deploymentIndex, strings.ToLower(uniqueID[:7])),
-					"key_vault_name":         fmt.Sprintf("kv-conc-%d-%s", deploymentIndex, uniqueID),
-					"web_app_name":           fmt.Sprintf("webapp-conc-%d-%s", deploymentIndex, uniqueID),
-					"virtual_network_name":   fmt.Sprintf("vnet-conc-%d-%s", deploymentIndex, uniqueID),
-					"subnet_name":            fmt.Sprintf("subnet-conc-%d-%s", deploymentIndex, uniqueID),
-					"nsg_name":               fmt.Sprintf("nsg-conc-%d-%s", deploymentIndex, uniqueID),
-					"storage_container_name": fmt.Sprintf("container%d%s", deploymentIndex, strings.ToLower(uniqueID)),
-					"app_service_plan_name":  fmt.Sprintf("asp-conc-%d-%s", deploymentIndex, uniqueID),
-					"prefix":                 "tf",
-					"environment":            "test",
-					"suffix":                 fmt.Sprintf("%02d", deploymentIndex),
-					"project_name":           "concurrent-test",
-					"owner":                  "concurrent-team",
-					"cost_center":            "44444",
-				},
-			}
-
-			defer terraform.Destroy(t, terraformOptions)
-
-			// Deploy and verify
-			terraform.InitAndApply(t, terraformOptions)
-
-			// Basic verification that deployment succeeded
-			resourceGroupName := terraform.Output(t, terraformOptions, "resource_group_name")
-			assert.NotEmpty(t, resourceGroupName)
-
-			results <- true
-		}(i)
+	deployments := make([]deploypool.Deployment, numDeployments)
+	for deploymentIndex := range deployments {
+		uniqueID := random.UniqueId()
+
+		// Each deployment needs its own working directory and state.
+		terraformOptions := guardedOptions(t, &terraform.Options{
+			TerraformDir: separateDir(t, "../"),
+			EnvVars:      cred.TerraformEnv(),
+			Vars: map[string]interface{}{
+				"subscription_id":        subscriptionID,
+				"resource_group_name":    fmt.Sprintf("rg-concurrent-%d-%s", deploymentIndex, uniqueID),
+				"location":               "westeurope",
+				"storage_account_name":   fmt.Sprintf("stconc%d%s", deploymentIndex, strings.ToLower(uniqueID[:7])),
+				"key_vault_name":         fmt.Sprintf("kv-conc-%d-%s", deploymentIndex, uniqueID),
+				"web_app_name":           fmt.Sprintf("webapp-conc-%d-%s", deploymentIndex, uniqueID),
+				"virtual_network_name":   fmt.Sprintf("vnet-conc-%d-%s", deploymentIndex, uniqueID),
+				"subnet_name":            fmt.Sprintf("subnet-conc-%d-%s", deploymentIndex, uniqueID),
+				"nsg_name":               fmt.Sprintf("nsg-conc-%d-%s", deploymentIndex, uniqueID),
+				"storage_container_name": fmt.Sprintf("container%d%s", deploymentIndex, strings.ToLower(uniqueID)),
+				"app_service_plan_name":  fmt.Sprintf("asp-conc-%d-%s", deploymentIndex, uniqueID),
+				"prefix":                 "tf",
+				"environment":            "test",
+				"suffix":                 fmt.Sprintf("%02d", deploymentIndex),
+				"project_name":           "concurrent-test",
+				"owner":                  "concurrent-team",
+				"cost_center":            "44444",
+			},
+		})
+		deployments[deploymentIndex] = terraformDeployment(t, fmt.Sprintf("deployment-%d", deploymentIndex),
+			terraformOptions, "resource_group_name")
 	}
 
-	// Wait for all deployments to complete
-	for i := 0; i < numDeployments; i++ {
-		select {
-		case result := <-results:
-			assert.True(t, result, "Concurrent deployment should succeed")
-		case <-time.After(20 * time.Minute):
-			t.Fatal("Concurrent deployment timed out")
-		}
-	}
+	// The pool returns only once every deployment it started has been
+	// destroyed, even one whose apply timed out.
+	pool := &deploypool.Pool{Timeout: 20 * time.Minute, DestroyTimeout: 30 * time.Minute}
+	results := pool.Run(context.Background(), deployments)
+
+	reportDeployments(t, results, func(t *testing.T, outputs map[string]string) {
+		assert.NotEmpty(t, outputs["resource_group_name"])
+	})
 }
 
 // Helper functions for name validation
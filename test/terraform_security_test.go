@@ -2,7 +2,6 @@ package test
 
 import (
 	"fmt"
-	"os"
 	"strings"
 	"testing"
 
@@ -18,17 +17,15 @@ func TestSecurityCompliance(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping security test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	// Use shared resource group
 	resourceGroupName := GetSharedResourceGroup(t)
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "./fixtures/security-test",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":     subscriptionID,
 			"resource_group_name": resourceGroupName,
@@ -54,10 +51,10 @@ func TestSecurityCompliance(t *testing.T) {
 			"owner":                  "security-team",
 			"cost_center":            "54321",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get resource information
 	storageAccountName := terraform.Output(t, terraformOptions, "storage_account_name")
@@ -104,17 +101,15 @@ func TestDataEncryption(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping encryption test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	// Use shared resource group
 	resourceGroupName := GetSharedResourceGroup(t)
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "./fixtures/security-test",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":     subscriptionID,
 			"resource_group_name": resourceGroupName,
@@ -140,10 +135,10 @@ func TestDataEncryption(t *testing.T) {
 			"owner":                  "security-team",
 			"cost_center":            "54321",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	storageAccountName := terraform.Output(t, terraformOptions, "storage_account_name")
 
@@ -169,17 +164,15 @@ func TestAccessControl(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping access control test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	// Use shared resource group
 	resourceGroupName := GetSharedResourceGroup(t)
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "./fixtures/security-test",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":     subscriptionID,
 			"resource_group_name": resourceGroupName,
@@ -205,10 +198,10 @@ func TestAccessControl(t *testing.T) {
 			"owner":                  "security-team",
 			"cost_center":            "54321",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	keyVaultName := terraform.Output(t, terraformOptions, "key_vault_name")
 
@@ -231,11 +224,8 @@ func TestComplianceTags(t *testing.T) {
 	t.Parallel()
 
 	uniqueID := random.UniqueId()
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-
-	if subscriptionID == "" {
-		t.Skip("AZURE_SUBSCRIPTION_ID environment variable not set. Skipping compliance test.")
-	}
+	cred := azureCredential(t)
+	subscriptionID := cred.SubscriptionID
 
 	// Make sure uniqueID is safe for use in storage account names
 	safeID := strings.ToLower(uniqueID)
@@ -246,8 +236,9 @@ func TestComplianceTags(t *testing.T) {
 	// Use shared resource group
 	resourceGroupName := GetSharedResourceGroup(t)
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "./fixtures/security-test",
+		EnvVars:      cred.TerraformEnv(),
 		Vars: map[string]interface{}{
 			"subscription_id":        subscriptionID,
 			"resource_group_name":    resourceGroupName,
@@ -267,10 +258,10 @@ func TestComplianceTags(t *testing.T) {
 			"owner":                  "compliance-team",
 			"cost_center":            "99999",
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Required compliance tags
 	requiredTags := []string{"Environment", "Project", "Owner", "CostCenter", "CreatedDate", "TerraformVersion"}
@@ -12,14 +12,14 @@ import (
 func TestTerraformValidation(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		// Use minimal validation config that doesn't require Azure credentials
 		TerraformDir: "./fixtures/minimal-validation",
 		// No variables needed for validation
-	}
+	})
 
 	// Run terraform init first to install modules
-	terraform.Init(t, terraformOptions)
+	tfInit(t, terraformOptions)
 
 	// Then run terraform validate
 	terraform.Validate(t, terraformOptions)
@@ -29,7 +29,7 @@ func TestTerraformValidation(t *testing.T) {
 func TestNamingConventions(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/naming",
 		Vars: map[string]interface{}{
 			"prefix":       "tf",
@@ -40,10 +40,10 @@ func TestNamingConventions(t *testing.T) {
 				"Team": "DevOps",
 			},
 		},
-	}
+	})
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	defer tfDestroy(t, terraformOptions)
+	tfInitAndApply(t, terraformOptions)
 
 	// Get outputs from naming module
 	resourceGroupName := terraform.Output(t, terraformOptions, "resource_group")
@@ -82,7 +82,7 @@ func TestValidationModule(t *testing.T) {
 	t.Parallel()
 
 	// Test with valid names
-	terraformOptions := &terraform.Options{
+	terraformOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/validation",
 		Vars: map[string]interface{}{
 			"resource_group_name":    "valid-rg-name",
@@ -95,13 +95,13 @@ func TestValidationModule(t *testing.T) {
 			"storage_container_name": "valid-container",
 			"app_service_plan_name":  "valid-plan-name",
 		},
-	}
+	})
 
 	// This should succeed with valid names
-	terraform.InitAndPlan(t, terraformOptions)
+	tfInitAndPlan(t, terraformOptions)
 
 	// Now test with invalid storage account name (too long)
-	invalidOptions := &terraform.Options{
+	invalidOptions := guardedOptions(t, &terraform.Options{
 		TerraformDir: "../modules/validation",
 		Vars: map[string]interface{}{
 			"resource_group_name":    "valid-rg-name",
@@ -114,14 +114,14 @@ func TestValidationModule(t *testing.T) {
 			"storage_container_name": "valid-container",
 			"app_service_plan_name":  "valid-plan-name",
 		},
-	}
+	})
 
 	// Plan with invalid data should succeed but output should show validation failed
-	terraform.InitAndPlan(t, invalidOptions)
+	tfInitAndPlan(t, invalidOptions)
 
 	// Apply to get outputs and check validation result
-	terraform.Apply(t, invalidOptions)
-	defer terraform.Destroy(t, invalidOptions)
+	tfApply(t, invalidOptions)
+	defer tfDestroy(t, invalidOptions)
 
 	// Check that validation correctly identified the invalid storage account name
 	isValid := terraform.Output(t, invalidOptions, "is_valid")
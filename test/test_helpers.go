@@ -1,6 +1,8 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -9,6 +11,8 @@ import (
 	"time"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"terraform-advanced-course/internal/azauth"
 )
 
 var (
@@ -37,20 +41,48 @@ func getEnvVar(t *testing.T, key, defaultValue string) string {
 	return defaultValue
 }
 
-// skipIfNoAzureCredentials skips the test if Azure credentials are not configured
-func skipIfNoAzureCredentials(t *testing.T) {
-	if os.Getenv("ARM_SUBSCRIPTION_ID") == "" {
-		t.Skip("Azure credentials not configured. Set ARM_SUBSCRIPTION_ID environment variable.")
-	}
-	if os.Getenv("ARM_CLIENT_ID") == "" {
-		t.Skip("Azure credentials not configured. Set ARM_CLIENT_ID environment variable.")
-	}
-	if os.Getenv("ARM_CLIENT_SECRET") == "" {
-		t.Skip("Azure credentials not configured. Set ARM_CLIENT_SECRET environment variable.")
+var (
+	azureCredentialOnce sync.Once
+	azureCred           *azauth.Credential
+	azureCredErr        error
+)
+
+// resolveAzureCredential resolves the run's Azure credentials once, in the
+// order documented in internal/azauth. The SDK variables are exported for
+// terratest's azure helpers; terraform gets cred.TerraformEnv() through
+// Options.EnvVars.
+func resolveAzureCredential() (*azauth.Credential, error) {
+	azureCredentialOnce.Do(func() {
+		azureCred, azureCredErr = azauth.Resolve(context.Background())
+		if azureCredErr != nil {
+			return
+		}
+		for name, value := range azureCred.SDKEnv() {
+			if value == "" {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, value)
+			}
+		}
+	})
+	return azureCred, azureCredErr
+}
+
+// azureCredential returns the run's Azure credentials and skips the test
+// when there are none. Incomplete or conflicting credentials fail the
+// test instead, so a run never deploys some scenarios and silently skips
+// the rest.
+func azureCredential(t *testing.T) *azauth.Credential {
+	t.Helper()
+	cred, err := resolveAzureCredential()
+	if errors.Is(err, azauth.ErrNoCredentials) {
+		t.Skipf("Azure credentials not configured: %v", err)
 	}
-	if os.Getenv("ARM_TENANT_ID") == "" {
-		t.Skip("Azure credentials not configured. Set ARM_TENANT_ID environment variable.")
+	if err != nil {
+		t.Fatal(err)
 	}
+	t.Logf("Azure credentials: %s", cred)
+	return cred
 }
 
 // GetSharedResourceGroup ensures a shared resource group exists and returns its name
@@ -59,14 +91,12 @@ func GetSharedResourceGroup(t *testing.T) string {
 		uniqueID := generateRandomString(8)
 		sharedResourceGroupName = fmt.Sprintf("rg-terratest-shared-%s", uniqueID)
 
-		subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-		if subscriptionID == "" {
-			t.Fatal("AZURE_SUBSCRIPTION_ID environment variable not set")
-		}
+		cred := azureCredential(t)
 
 		// Create a shared resource group using the resource-group fixture
-		rgOptions := &terraform.Options{
+		rgOptions := guardedOptions(t, &terraform.Options{
 			TerraformDir: "./fixtures/resource-group",
+			EnvVars:      cred.TerraformEnv(),
 			Vars: map[string]interface{}{
 				"name":     sharedResourceGroupName,
 				"location": sharedLocation,
@@ -75,16 +105,16 @@ func GetSharedResourceGroup(t *testing.T) string {
 					"Purpose":     "terratest-shared",
 				},
 			},
-		}
+		})
 
-		_, err := terraform.InitAndApplyE(t, rgOptions)
+		_, err := tfInitAndApplyE(t, rgOptions)
 		if err != nil {
 			t.Fatalf("Failed to create shared resource group: %v", err)
 		}
 
 		// Register cleanup to destroy the resource group after all tests complete
 		t.Cleanup(func() {
-			terraform.Destroy(t, rgOptions)
+			tfDestroy(t, rgOptions)
 		})
 	})
 
@@ -11,6 +11,8 @@ import (
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"terraform-advanced-course/internal/retryable"
 )
 
 // TestTerraformAdvancedInfrastructure validates the full infrastructure deployment
@@ -40,11 +42,9 @@ func TestTerraformAdvancedInfrastructure(t *testing.T) {
 			"project_name":           "terratest",
 			"owner":                  "test-team",
 		},
-		RetryableTerraformErrors: map[string]string{
-			".*": "Will try again",
-		},
-		MaxRetries:         3,
-		TimeBetweenRetries: 5 * time.Second,
+		RetryableTerraformErrors: retryable.Default.TerratestErrors(),
+		MaxRetries:               3,
+		TimeBetweenRetries:       5 * time.Second,
 	})
 
 	defer terraform.Destroy(t, terraformOptions)
@@ -124,11 +124,9 @@ func TestTerraformInfrastructureWithDifferentEnvironments(t *testing.T) {
 					"project_name":           "terratest",
 					"owner":                  "test-team",
 				},
-				RetryableTerraformErrors: map[string]string{
-					".*": "Will try again",
-				},
-				MaxRetries:         3,
-				TimeBetweenRetries: 5 * time.Second,
+				RetryableTerraformErrors: retryable.Default.TerratestErrors(),
+				MaxRetries:               3,
+				TimeBetweenRetries:       5 * time.Second,
 			})
 
 			defer terraform.Destroy(t, terraformOptions)
@@ -174,11 +172,9 @@ func TestInfrastructurePerformance(t *testing.T) {
 			"project_name":           "terratest",
 			"owner":                  "test-team",
 		},
-		RetryableTerraformErrors: map[string]string{
-			".*": "Will try again",
-		},
-		MaxRetries:         3,
-		TimeBetweenRetries: 5 * time.Second,
+		RetryableTerraformErrors: retryable.Default.TerratestErrors(),
+		MaxRetries:               3,
+		TimeBetweenRetries:       5 * time.Second,
 	})
 
 	// Measure deployment time
@@ -197,11 +193,8 @@ func TestInfrastructurePerformance(t *testing.T) {
 	t.Logf("Infrastructure deployment completed in %v", deploymentTime)
 }
 
-// getAzureSubscriptionID retrieves the Azure subscription ID from environment or skips test
+// getAzureSubscriptionID returns the subscription of the run's Azure
+// credentials, or skips the test when there are none
 func getAzureSubscriptionID(t *testing.T) string {
-	subscriptionID := getEnvVar(t, "ARM_SUBSCRIPTION_ID", "")
-	if subscriptionID == "" {
-		t.Skip("ARM_SUBSCRIPTION_ID environment variable not set")
-	}
-	return subscriptionID
+	return azureCredential(t).SubscriptionID
 }
@@ -13,10 +13,7 @@ func TestAllValidation(t *testing.T) {
 
 // TestAllModules runs all module tests (requires Azure credentials)
 func TestAllModules(t *testing.T) {
-	subscriptionID := getEnvVar(t, "ARM_SUBSCRIPTION_ID", "")
-	if subscriptionID == "" {
-		t.Skip("Azure subscription ID not available")
-	}
+	azureCredential(t)
 
 	t.Run("NetworkModule", TestNetworkModule)
 	t.Run("StorageModule", TestStorageModule)
@@ -28,20 +25,14 @@ func TestAllModules(t *testing.T) {
 
 // TestAllInfrastructure runs all infrastructure tests (requires Azure credentials)
 func TestAllInfrastructure(t *testing.T) {
-	subscriptionID := getEnvVar(t, "ARM_SUBSCRIPTION_ID", "")
-	if subscriptionID == "" {
-		t.Skip("Azure subscription ID not available")
-	}
+	azureCredential(t)
 
 	t.Run("AdvancedInfrastructure", TestTerraformAdvancedInfrastructure)
 }
 
 // TestAllSecurity runs all security tests (requires Azure credentials)
 func TestAllSecurity(t *testing.T) {
-	subscriptionID := getEnvVar(t, "ARM_SUBSCRIPTION_ID", "")
-	if subscriptionID == "" {
-		t.Skip("Azure subscription ID not available")
-	}
+	azureCredential(t)
 
 	t.Run("SecurityCompliance", TestSecurityCompliance)
 	t.Run("DataEncryption", TestDataEncryption)
@@ -51,10 +42,7 @@ func TestAllSecurity(t *testing.T) {
 
 // TestAllPerformance runs all performance tests (requires Azure credentials)
 func TestAllPerformance(t *testing.T) {
-	subscriptionID := getEnvVar(t, "ARM_SUBSCRIPTION_ID", "")
-	if subscriptionID == "" {
-		t.Skip("Azure subscription ID not available")
-	}
+	azureCredential(t)
 
 	t.Run("PerformanceBenchmarks", TestPerformanceBenchmarks)
 	t.Run("ScalabilityLimits", TestScalabilityLimits)
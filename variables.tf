@@ -102,3 +102,9 @@ variable "app_service_plan_name" {
   type        = string
   default     = "myTFAppServicePlan"
 }
+
+variable "tags" {
+  description = "Additional tags for every resource, merged over the common tags"
+  type        = map(string)
+  default     = {}
+}